@@ -1078,6 +1078,159 @@ func (x *AppendEntriesResponse) GetConflictTerm() int64 {
 	return 0
 }
 
+type WatchEventsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FromSeq       uint64                 `protobuf:"varint,1,opt,name=from_seq,json=fromSeq,proto3" json:"from_seq,omitempty"` // First WAL seq to send; 0 = only events committed from now on
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchEventsRequest) Reset() {
+	*x = WatchEventsRequest{}
+	mi := &file_api_proto_v1_service_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchEventsRequest) ProtoMessage() {}
+
+func (x *WatchEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_v1_service_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchEventsRequest.ProtoReflect.Descriptor instead.
+func (*WatchEventsRequest) Descriptor() ([]byte, []int) {
+	return file_api_proto_v1_service_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *WatchEventsRequest) GetFromSeq() uint64 {
+	if x != nil {
+		return x.FromSeq
+	}
+	return 0
+}
+
+// WalEvent is one committed job state change, in WAL order
+type WalEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Seq           uint64                 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"` // ENQUEUE, DISPATCH, ACK, RETRY, TIMEOUT or DEAD
+	JobId         string                 `protobuf:"bytes,3,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	Timestamp     int64                  `protobuf:"varint,4,opt,name=timestamp,proto3" json:"timestamp,omitempty"` // Unix ms
+	Attempt       int32                  `protobuf:"varint,5,opt,name=attempt,proto3" json:"attempt,omitempty"`
+	Payload       []byte                 `protobuf:"bytes,6,opt,name=payload,proto3" json:"payload,omitempty"` // JSON encoded payload (ENQUEUE only)
+	TimeoutMs     int64                  `protobuf:"varint,7,opt,name=timeout_ms,json=timeoutMs,proto3" json:"timeout_ms,omitempty"`
+	DeadlineMs    int64                  `protobuf:"varint,8,opt,name=deadline_ms,json=deadlineMs,proto3" json:"deadline_ms,omitempty"` // 0 if unset
+	CreatedAt     int64                  `protobuf:"varint,9,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`    // Unix ms
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WalEvent) Reset() {
+	*x = WalEvent{}
+	mi := &file_api_proto_v1_service_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WalEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WalEvent) ProtoMessage() {}
+
+func (x *WalEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_v1_service_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WalEvent.ProtoReflect.Descriptor instead.
+func (*WalEvent) Descriptor() ([]byte, []int) {
+	return file_api_proto_v1_service_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *WalEvent) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *WalEvent) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *WalEvent) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *WalEvent) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *WalEvent) GetAttempt() int32 {
+	if x != nil {
+		return x.Attempt
+	}
+	return 0
+}
+
+func (x *WalEvent) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *WalEvent) GetTimeoutMs() int64 {
+	if x != nil {
+		return x.TimeoutMs
+	}
+	return 0
+}
+
+func (x *WalEvent) GetDeadlineMs() int64 {
+	if x != nil {
+		return x.DeadlineMs
+	}
+	return 0
+}
+
+func (x *WalEvent) GetCreatedAt() int64 {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return 0
+}
+
 var File_api_proto_v1_service_proto protoreflect.FileDescriptor
 
 const file_api_proto_v1_service_proto_rawDesc = "" +
@@ -1157,13 +1310,28 @@ const file_api_proto_v1_service_proto_rawDesc = "" +
 	"\x04term\x18\x01 \x01(\x03R\x04term\x12\x18\n" +
 	"\asuccess\x18\x02 \x01(\bR\asuccess\x12%\n" +
 	"\x0econflict_index\x18\x03 \x01(\x03R\rconflictIndex\x12#\n" +
-	"\rconflict_term\x18\x04 \x01(\x03R\fconflictTerm*\x88\x01\n" +
+	"\rconflict_term\x18\x04 \x01(\x03R\fconflictTerm\"/\n" +
+	"\x12WatchEventsRequest\x12\x19\n" +
+	"\bfrom_seq\x18\x01 \x01(\x04R\afromSeq\"\xf8\x01\n" +
+	"\bWalEvent\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x04R\x03seq\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x15\n" +
+	"\x06job_id\x18\x03 \x01(\tR\x05jobId\x12\x1c\n" +
+	"\ttimestamp\x18\x04 \x01(\x03R\ttimestamp\x12\x18\n" +
+	"\aattempt\x18\x05 \x01(\x05R\aattempt\x12\x18\n" +
+	"\apayload\x18\x06 \x01(\fR\apayload\x12\x1d\n" +
+	"\n" +
+	"timeout_ms\x18\a \x01(\x03R\ttimeoutMs\x12\x1f\n" +
+	"\vdeadline_ms\x18\b \x01(\x03R\n" +
+	"deadlineMs\x12\x1d\n" +
+	"\n" +
+	"created_at\x18\t \x01(\x03R\tcreatedAt*\x88\x01\n" +
 	"\tJobStatus\x12\x1a\n" +
 	"\x16JOB_STATUS_UNSPECIFIED\x10\x00\x12\x16\n" +
 	"\x12JOB_STATUS_PENDING\x10\x01\x12\x18\n" +
 	"\x14JOB_STATUS_IN_FLIGHT\x10\x02\x12\x18\n" +
 	"\x14JOB_STATUS_COMPLETED\x10\x03\x12\x13\n" +
-	"\x0fJOB_STATUS_DEAD\x10\x042\xdb\x03\n" +
+	"\x0fJOB_STATUS_DEAD\x10\x042\x92\x04\n" +
 	"\x12FalconQueueService\x128\n" +
 	"\tSubmitJob\x12\x14.v1.SubmitJobRequest\x1a\x15.v1.SubmitJobResponse\x12G\n" +
 	"\x0eRegisterWorker\x12\x19.v1.RegisterWorkerRequest\x1a\x1a.v1.RegisterWorkerResponse\x12<\n" +
@@ -1171,7 +1339,8 @@ const file_api_proto_v1_service_proto_rawDesc = "" +
 	"\bPollJobs\x12\x13.v1.PollJobsRequest\x1a\x14.v1.PollJobsResponse\x12G\n" +
 	"\x0eAcknowledgeJob\x12\x19.v1.AcknowledgeJobRequest\x1a\x1a.v1.AcknowledgeJobResponse\x12>\n" +
 	"\vRequestVote\x12\x16.v1.RequestVoteRequest\x1a\x17.v1.RequestVoteResponse\x12D\n" +
-	"\rAppendEntries\x12\x18.v1.AppendEntriesRequest\x1a\x19.v1.AppendEntriesResponseB/Z-github.com/ChuLiYu/raft-recovery/api/proto/v1b\x06proto3"
+	"\rAppendEntries\x12\x18.v1.AppendEntriesRequest\x1a\x19.v1.AppendEntriesResponse\x125\n" +
+	"\vWatchEvents\x12\x16.v1.WatchEventsRequest\x1a\f.v1.WalEvent0\x01B/Z-github.com/ChuLiYu/raft-recovery/api/proto/v1b\x06proto3"
 
 var (
 	file_api_proto_v1_service_proto_rawDescOnce sync.Once
@@ -1186,7 +1355,7 @@ func file_api_proto_v1_service_proto_rawDescGZIP() []byte {
 }
 
 var file_api_proto_v1_service_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_api_proto_v1_service_proto_msgTypes = make([]protoimpl.MessageInfo, 16)
+var file_api_proto_v1_service_proto_msgTypes = make([]protoimpl.MessageInfo, 18)
 var file_api_proto_v1_service_proto_goTypes = []any{
 	(JobStatus)(0),                 // 0: v1.JobStatus
 	(*Job)(nil),                    // 1: v1.Job
@@ -1205,6 +1374,8 @@ var file_api_proto_v1_service_proto_goTypes = []any{
 	(*LogEntry)(nil),               // 14: v1.LogEntry
 	(*AppendEntriesRequest)(nil),   // 15: v1.AppendEntriesRequest
 	(*AppendEntriesResponse)(nil),  // 16: v1.AppendEntriesResponse
+	(*WatchEventsRequest)(nil),     // 17: v1.WatchEventsRequest
+	(*WalEvent)(nil),               // 18: v1.WalEvent
 }
 var file_api_proto_v1_service_proto_depIdxs = []int32{
 	0,  // 0: v1.Job.status:type_name -> v1.JobStatus
@@ -1218,15 +1389,17 @@ var file_api_proto_v1_service_proto_depIdxs = []int32{
 	10, // 8: v1.FalconQueueService.AcknowledgeJob:input_type -> v1.AcknowledgeJobRequest
 	12, // 9: v1.FalconQueueService.RequestVote:input_type -> v1.RequestVoteRequest
 	15, // 10: v1.FalconQueueService.AppendEntries:input_type -> v1.AppendEntriesRequest
-	3,  // 11: v1.FalconQueueService.SubmitJob:output_type -> v1.SubmitJobResponse
-	5,  // 12: v1.FalconQueueService.RegisterWorker:output_type -> v1.RegisterWorkerResponse
-	7,  // 13: v1.FalconQueueService.SendHeartbeat:output_type -> v1.HeartbeatResponse
-	9,  // 14: v1.FalconQueueService.PollJobs:output_type -> v1.PollJobsResponse
-	11, // 15: v1.FalconQueueService.AcknowledgeJob:output_type -> v1.AcknowledgeJobResponse
-	13, // 16: v1.FalconQueueService.RequestVote:output_type -> v1.RequestVoteResponse
-	16, // 17: v1.FalconQueueService.AppendEntries:output_type -> v1.AppendEntriesResponse
-	11, // [11:18] is the sub-list for method output_type
-	4,  // [4:11] is the sub-list for method input_type
+	17, // 11: v1.FalconQueueService.WatchEvents:input_type -> v1.WatchEventsRequest
+	3,  // 12: v1.FalconQueueService.SubmitJob:output_type -> v1.SubmitJobResponse
+	5,  // 13: v1.FalconQueueService.RegisterWorker:output_type -> v1.RegisterWorkerResponse
+	7,  // 14: v1.FalconQueueService.SendHeartbeat:output_type -> v1.HeartbeatResponse
+	9,  // 15: v1.FalconQueueService.PollJobs:output_type -> v1.PollJobsResponse
+	11, // 16: v1.FalconQueueService.AcknowledgeJob:output_type -> v1.AcknowledgeJobResponse
+	13, // 17: v1.FalconQueueService.RequestVote:output_type -> v1.RequestVoteResponse
+	16, // 18: v1.FalconQueueService.AppendEntries:output_type -> v1.AppendEntriesResponse
+	18, // 19: v1.FalconQueueService.WatchEvents:output_type -> v1.WalEvent
+	12, // [12:20] is the sub-list for method output_type
+	4,  // [4:12] is the sub-list for method input_type
 	4,  // [4:4] is the sub-list for extension type_name
 	4,  // [4:4] is the sub-list for extension extendee
 	0,  // [0:4] is the sub-list for field type_name
@@ -1243,7 +1416,7 @@ func file_api_proto_v1_service_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_api_proto_v1_service_proto_rawDesc), len(file_api_proto_v1_service_proto_rawDesc)),
 			NumEnums:      1,
-			NumMessages:   16,
+			NumMessages:   18,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -26,6 +26,7 @@ const (
 	FalconQueueService_AcknowledgeJob_FullMethodName = "/v1.FalconQueueService/AcknowledgeJob"
 	FalconQueueService_RequestVote_FullMethodName    = "/v1.FalconQueueService/RequestVote"
 	FalconQueueService_AppendEntries_FullMethodName  = "/v1.FalconQueueService/AppendEntries"
+	FalconQueueService_WatchEvents_FullMethodName    = "/v1.FalconQueueService/WatchEvents"
 )
 
 // FalconQueueServiceClient is the client API for FalconQueueService service.
@@ -44,6 +45,8 @@ type FalconQueueServiceClient interface {
 	// Raft Consensus
 	RequestVote(ctx context.Context, in *RequestVoteRequest, opts ...grpc.CallOption) (*RequestVoteResponse, error)
 	AppendEntries(ctx context.Context, in *AppendEntriesRequest, opts ...grpc.CallOption) (*AppendEntriesResponse, error)
+	// Change Data Capture
+	WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WalEvent], error)
 }
 
 type falconQueueServiceClient struct {
@@ -124,6 +127,25 @@ func (c *falconQueueServiceClient) AppendEntries(ctx context.Context, in *Append
 	return out, nil
 }
 
+func (c *falconQueueServiceClient) WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WalEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FalconQueueService_ServiceDesc.Streams[0], FalconQueueService_WatchEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchEventsRequest, WalEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FalconQueueService_WatchEventsClient = grpc.ServerStreamingClient[WalEvent]
+
 // FalconQueueServiceServer is the server API for FalconQueueService service.
 // All implementations must embed UnimplementedFalconQueueServiceServer
 // for forward compatibility.
@@ -140,6 +162,8 @@ type FalconQueueServiceServer interface {
 	// Raft Consensus
 	RequestVote(context.Context, *RequestVoteRequest) (*RequestVoteResponse, error)
 	AppendEntries(context.Context, *AppendEntriesRequest) (*AppendEntriesResponse, error)
+	// Change Data Capture
+	WatchEvents(*WatchEventsRequest, grpc.ServerStreamingServer[WalEvent]) error
 	mustEmbedUnimplementedFalconQueueServiceServer()
 }
 
@@ -171,6 +195,9 @@ func (UnimplementedFalconQueueServiceServer) RequestVote(context.Context, *Reque
 func (UnimplementedFalconQueueServiceServer) AppendEntries(context.Context, *AppendEntriesRequest) (*AppendEntriesResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method AppendEntries not implemented")
 }
+func (UnimplementedFalconQueueServiceServer) WatchEvents(*WatchEventsRequest, grpc.ServerStreamingServer[WalEvent]) error {
+	return status.Error(codes.Unimplemented, "method WatchEvents not implemented")
+}
 func (UnimplementedFalconQueueServiceServer) mustEmbedUnimplementedFalconQueueServiceServer() {}
 func (UnimplementedFalconQueueServiceServer) testEmbeddedByValue()                            {}
 
@@ -318,6 +345,17 @@ func _FalconQueueService_AppendEntries_Handler(srv interface{}, ctx context.Cont
 	return interceptor(ctx, in, info, handler)
 }
 
+func _FalconQueueService_WatchEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FalconQueueServiceServer).WatchEvents(m, &grpc.GenericServerStream[WatchEventsRequest, WalEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FalconQueueService_WatchEventsServer = grpc.ServerStreamingServer[WalEvent]
+
 // FalconQueueService_ServiceDesc is the grpc.ServiceDesc for FalconQueueService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -354,6 +392,12 @@ var FalconQueueService_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _FalconQueueService_AppendEntries_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchEvents",
+			Handler:       _FalconQueueService_WatchEvents_Handler,
+			ServerStreams: true,
+		},
+	},
 	Metadata: "api/proto/v1/service.proto",
 }
@@ -9,10 +9,17 @@
 // Command Structure:
 //   beaver-raft                    # Root command
 //   ├── run                        # Start queue system
-//   │   └── --config, -c          # Specify config file
+//   │   ├── --config, -c          # Specify config file
+//   │   └── --recover-to          # Point-in-time recovery (seq or RFC 3339)
 //   ├── enqueue                    # Submit jobs
 //   │   └── --file, -f            # Specify job JSON file
 //   ├── status                     # View system status
+//   ├── wal                        # Offline WAL maintenance (see wal.go)
+//   │   ├── dump | validate | stats # Inspect (--json for machine output)
+//   │   ├── repair | truncate      # Fix a broken WAL
+//   │   ├── diff <a> <b>           # Compare two WALs
+//   │   └── convert --to binary    # Rewrite segments in another format
+//   ├── snapshot inspect           # Snapshot metadata (see snapshot.go)
 //   ├── --version                  # Display version information
 //   └── --help                     # Display help information
 //
@@ -23,6 +30,7 @@
 //   - wal: WAL log configuration
 //   - snapshot: Snapshot strategy configuration
 //   - metrics: Prometheus monitoring configuration
+//   - tls: Mutual TLS for gRPC (CA/cert/key paths, peer and worker allowlists)
 //
 // run Command:
 //   Starts complete queue system, including:
@@ -35,6 +43,8 @@
 //   Examples:
 //     ./beaver-raft run
 //     ./beaver-raft run -c custom-config.yaml
+//     ./beaver-raft run --recover-to 1200
+//     ./beaver-raft run --recover-to 2024-05-01T12:00:00Z
 //
 // enqueue Command:
 //   Batch submit jobs from JSON file
@@ -88,7 +98,9 @@ package cli
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"net"
 	"net/http"
@@ -99,12 +111,19 @@ import (
 
 	pb "github.com/ChuLiYu/raft-recovery/api/proto/v1"
 	"github.com/ChuLiYu/raft-recovery/internal/controller"
+	"github.com/ChuLiYu/raft-recovery/internal/encryption"
+	"github.com/ChuLiYu/raft-recovery/internal/metrics"
+	"github.com/ChuLiYu/raft-recovery/internal/raft"
+	"github.com/ChuLiYu/raft-recovery/internal/security"
 	"github.com/ChuLiYu/raft-recovery/internal/server"
+	"github.com/ChuLiYu/raft-recovery/internal/snapshot"
+	"github.com/ChuLiYu/raft-recovery/internal/storage/wal"
 	"github.com/ChuLiYu/raft-recovery/internal/worker"
 	"github.com/ChuLiYu/raft-recovery/pkg/types"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"gopkg.in/yaml.v3"
 )
@@ -112,30 +131,59 @@ import (
 // Config represents the complete system configuration structure
 // Maps config file fields through YAML tags
 type Config struct {
+	// NodeID identifies this node in snapshot headers (default: hostname)
+	NodeID string `yaml:"node_id"`
+
 	Worker struct {
 		WorkerCount int           `yaml:"worker_count"`
 		TaskTimeout time.Duration `yaml:"task_timeout"`
 	} `yaml:"worker"`
 
 	WAL struct {
-		Dir              string `yaml:"dir"`
-		MaxSegmentSize   int64  `yaml:"max_segment_size"`
-		SyncInterval     int    `yaml:"sync_interval"`
-		RetentionSeconds int    `yaml:"retention_seconds"`
-		BufferSize       int    `yaml:"buffer_size"`
-		FlushIntervalMs  int    `yaml:"flush_interval_ms"` // NEW: batch flush interval in ms
+		Dir                    string `yaml:"dir"`
+		MaxSegmentSize         int64  `yaml:"max_segment_size"`
+		SyncInterval           int    `yaml:"sync_interval"`
+		RetentionSeconds       int    `yaml:"retention_seconds"`
+		BufferSize             int    `yaml:"buffer_size"`
+		FlushIntervalMs        int    `yaml:"flush_interval_ms"`        // NEW: batch flush interval in ms
+		LatencyTargetMs        int    `yaml:"latency_target_ms"`        // p99 append latency for adaptive group commit (0 = fixed batching)
+		Encoding               string `yaml:"encoding"`                 // Record format: json or binary
+		CompactIntervalSeconds int    `yaml:"compact_interval_seconds"` // Background compaction period (0 = disabled)
+		CompactAfterSeconds    int    `yaml:"compact_after_seconds"`    // Keep completed jobs in the WAL at least this long
+		SyncMode               string `yaml:"sync_mode"`                // batch, datasync, periodic or none (sync_interval ms applies to periodic)
+		PreallocateBytes       int64  `yaml:"preallocate_bytes"`        // Reserve disk space for each new segment (0 = off)
+		ReplayWorkers          int    `yaml:"replay_workers"`           // Goroutines per recovery stage (0 = one per CPU, 1 = sequential)
+		Archive                struct {
+			Dir           string `yaml:"dir"`             // Compress pruned segments here ("" = delete them)
+			MaxFiles      int    `yaml:"max_files"`       // Keep at most this many archive files (0 = no limit)
+			MaxAgeSeconds int    `yaml:"max_age_seconds"` // Delete archive files older than this (0 = no limit)
+			MaxBytes      int64  `yaml:"max_bytes"`       // Keep the archive at most this large (0 = no limit)
+		} `yaml:"archive"`
 	} `yaml:"wal"`
 
 	Snapshot struct {
 		Dir             string `yaml:"dir"`
 		IntervalSeconds int    `yaml:"interval_seconds"`
-		RetentionCount  int    `yaml:"retention_count"`
+		RetentionCount  int    `yaml:"retention_count"` // Snapshot generations kept for fallback on load
+		Compression     string `yaml:"compression"`     // none, gzip or flate
 	} `yaml:"snapshot"`
 
 	Metrics struct {
 		Enabled bool `yaml:"enabled"`
 		Port    int  `yaml:"port"`
 	} `yaml:"metrics"`
+
+	Raft struct {
+		Transport raft.TransportConfig `yaml:"transport"` // Peer RPC timeouts, keepalive, backoff
+	} `yaml:"raft"`
+
+	// TLS configures mutual TLS for gRPC traffic to the master and workers;
+	// dialing Raft peers with it is deferred until a Raft node is started
+	// (see runControllerNode)
+	TLS security.Config `yaml:"tls"`
+
+	// Encryption configures AES-GCM encryption at rest for WAL payloads and snapshots
+	Encryption encryption.Config `yaml:"encryption"`
 }
 
 var (
@@ -160,6 +208,8 @@ func BuildCLI() *cobra.Command {
 	rootCmd.AddCommand(buildRunCommand())
 	rootCmd.AddCommand(buildEnqueueCommand())
 	rootCmd.AddCommand(buildStatusCommand())
+	rootCmd.AddCommand(buildWALCommand())
+	rootCmd.AddCommand(buildSnapshotCommand())
 
 	return rootCmd
 }
@@ -168,24 +218,26 @@ func buildRunCommand() *cobra.Command {
 	var mode string
 	var port int
 	var masterAddr string
+	var recoverTo string
 
 	cmd := &cobra.Command{
 		Use:   "run",
 		Short: "Start the Beaver-Raft queue system",
 		Long:  "Start the system in standalone, master, or worker mode",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runSystem(mode, port, masterAddr)
+			return runSystem(mode, port, masterAddr, recoverTo)
 		},
 	}
 
 	cmd.Flags().StringVar(&mode, "mode", "standalone", "System mode: standalone, master, worker")
 	cmd.Flags().IntVar(&port, "port", 50051, "Port to listen on (master mode)")
 	cmd.Flags().StringVar(&masterAddr, "master", "", "Master address (worker mode)")
+	cmd.Flags().StringVar(&recoverTo, "recover-to", "", "Roll back to a WAL seq or RFC 3339 time before serving")
 
 	return cmd
 }
 
-func runSystem(mode string, port int, masterAddr string) error {
+func runSystem(mode string, port int, masterAddr string, recoverTo string) error {
 	cfg, err := loadConfig(configFile)
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
@@ -194,11 +246,21 @@ func runSystem(mode string, port int, masterAddr string) error {
 	log.Printf("Starting Beaver-Raft in %s mode\n", mode)
 
 	if mode == "worker" {
+		if recoverTo != "" {
+			return fmt.Errorf("--recover-to is not supported in worker mode")
+		}
 		return runWorkerNode(cfg, masterAddr)
 	}
 
+	var target controller.RecoveryTarget
+	if recoverTo != "" {
+		if target, err = controller.ParseRecoveryTarget(recoverTo); err != nil {
+			return err
+		}
+	}
+
 	// Master or Standalone Mode
-	return runControllerNode(cfg, mode, port)
+	return runControllerNode(cfg, mode, port, target)
 }
 
 func runWorkerNode(cfg *Config, masterAddr string) error {
@@ -207,8 +269,13 @@ func runWorkerNode(cfg *Config, masterAddr string) error {
 	}
 
 	log.Printf("Connecting to master at %s...\n", masterAddr)
-	
-	conn, err := grpc.NewClient(masterAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+
+	creds, err := security.DialCredentials(cfg.TLS)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS credentials: %w", err)
+	}
+
+	conn, err := grpc.NewClient(masterAddr, grpc.WithTransportCredentials(creds))
 	if err != nil {
 		return fmt.Errorf("failed to connect to master: %w", err)
 	}
@@ -237,7 +304,7 @@ func runWorkerNode(cfg *Config, masterAddr string) error {
 	return nil
 }
 
-func runControllerNode(cfg *Config, mode string, port int) error {
+func runControllerNode(cfg *Config, mode string, port int, recoverTo controller.RecoveryTarget) error {
 	log.Printf("Starting Controller with config: %s\n", configFile)
 	log.Printf("Workers: %d, Timeout: %s\n", cfg.Worker.WorkerCount, cfg.Worker.TaskTimeout)
 
@@ -250,10 +317,29 @@ func runControllerNode(cfg *Config, mode string, port int) error {
 		MaxRetry:         3,
 		WALPath:          cfg.WAL.Dir,
 		SnapshotPath:     cfg.Snapshot.Dir,
+		SnapshotRetention: cfg.Snapshot.RetentionCount,
+		SnapshotCompression: cfg.Snapshot.Compression,
+		NodeID: cfg.NodeID,
 		WALBufferSize:    cfg.WAL.BufferSize,
 		WALFlushInterval: time.Duration(cfg.WAL.FlushIntervalMs) * time.Millisecond,
+		WALLatencyTarget: time.Duration(cfg.WAL.LatencyTargetMs) * time.Millisecond,
+		WALMaxSegmentSize: cfg.WAL.MaxSegmentSize,
+		WALRetention:      time.Duration(cfg.WAL.RetentionSeconds) * time.Second,
+		WALEncoding:       cfg.WAL.Encoding,
+		WALCompactInterval: time.Duration(cfg.WAL.CompactIntervalSeconds) * time.Second,
+		WALCompactAfter:    time.Duration(cfg.WAL.CompactAfterSeconds) * time.Second,
+		WALArchive:         walArchiveOptions(cfg),
+		WALSyncMode:        cfg.WAL.SyncMode,
+		WALSyncInterval:    time.Duration(cfg.WAL.SyncInterval) * time.Millisecond,
+		WALPreallocate:     cfg.WAL.PreallocateBytes,
+		RecoveryWorkers:    cfg.WAL.ReplayWorkers,
+		Encryption:         cfg.Encryption,
+		RecoverTo:         recoverTo,
 		DisableDispatchLoop: mode == "master", // <-- Key fix: disables local dispatchers in Master mode
 	}
+	if cfg.Metrics.Enabled {
+		ctrlConfig.Metrics = metrics.NewCollector()
+	}
 
 	ctrl, err := controller.NewController(ctrlConfig)
 	if err != nil {
@@ -286,8 +372,20 @@ func runControllerNode(cfg *Config, mode string, port int) error {
 			return fmt.Errorf("failed to listen on port %d: %w", port, err)
 		}
 		
-		grpcServer := grpc.NewServer()
-		// TODO: Initialize Raft node for Phase 3
+		serverOpts, err := security.ServerOptions(cfg.TLS)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS credentials: %w", err)
+		}
+		if cfg.TLS.Enabled {
+			log.Println("mTLS enabled for gRPC server")
+		}
+
+		serverOpts = append(serverOpts, cfg.Raft.Transport.ServerOptions()...)
+
+		grpcServer := grpc.NewServer(serverOpts...)
+		// TODO: Initialize Raft node for Phase 3. Peer mTLS is deferred until
+		// then: build its transport with raft.NewGrpcTransportWithConfig and
+		// Credentials from security.DialCredentials(cfg.TLS).
 		srv := server.NewServer(ctrl, nil)
 		pb.RegisterFalconQueueServiceServer(grpcServer, srv)
 		
@@ -355,7 +453,12 @@ func enqueueJobs(filePath string, masterAddr string) error {
 
 	// Mode 1: Remote Submission (gRPC)
 	if masterAddr != "" {
-		conn, err := grpc.NewClient(masterAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		creds, err := remoteCredentials(configFile)
+		if err != nil {
+			return err
+		}
+
+		conn, err := grpc.NewClient(masterAddr, grpc.WithTransportCredentials(creds))
 		if err != nil {
 			return fmt.Errorf("failed to connect to master: %w", err)
 		}
@@ -403,8 +506,21 @@ func enqueueJobs(filePath string, masterAddr string) error {
 			MaxRetry:         3,
 			WALPath:          cfg.WAL.Dir,
 			SnapshotPath:     cfg.Snapshot.Dir,
+			SnapshotRetention: cfg.Snapshot.RetentionCount,
+			SnapshotCompression: cfg.Snapshot.Compression,
+			NodeID: cfg.NodeID,
 			WALBufferSize:    cfg.WAL.BufferSize,
 			WALFlushInterval: time.Duration(cfg.WAL.FlushIntervalMs) * time.Millisecond,
+			WALLatencyTarget: time.Duration(cfg.WAL.LatencyTargetMs) * time.Millisecond,
+			WALMaxSegmentSize: cfg.WAL.MaxSegmentSize,
+			WALRetention:      time.Duration(cfg.WAL.RetentionSeconds) * time.Second,
+			WALEncoding:       cfg.WAL.Encoding,
+			WALArchive:        walArchiveOptions(cfg),
+			WALSyncMode:       cfg.WAL.SyncMode,
+			WALSyncInterval:   time.Duration(cfg.WAL.SyncInterval) * time.Millisecond,
+			WALPreallocate:    cfg.WAL.PreallocateBytes,
+			RecoveryWorkers:   cfg.WAL.ReplayWorkers,
+			Encryption:        cfg.Encryption,
 		}
 
 		ctrl, err := controller.NewController(ctrlConfig)
@@ -472,8 +588,12 @@ func showStatus() error {
 	fmt.Printf("  ├─ WAL Directory:       %s\n", cfg.WAL.Dir)
 	fmt.Printf("  │  └─ Buffer Size:      %d entries\n", cfg.WAL.BufferSize)
 	fmt.Printf("  │  └─ Max Segment Size: %.1f MB\n", float64(cfg.WAL.MaxSegmentSize)/(1024*1024))
+	fmt.Printf("  │  └─ Durability:       %s\n", describeWALDurability(cfg))
+	fmt.Printf("  │  └─ Group Commit:     %s\n", describeGroupCommit(cfg))
+	fmt.Printf("  ├─ Encryption:          %s\n", describeEncryption(cfg))
 	fmt.Printf("  └─ Snapshot Directory:  %s\n", cfg.Snapshot.Dir)
-	fmt.Printf("     └─ Retention Count:  %d\n", cfg.Snapshot.RetentionCount)
+	fmt.Printf("     ├─ Retention Count:  %d\n", cfg.Snapshot.RetentionCount)
+	fmt.Printf("     └─ Compression:      %s\n", describeCompression(cfg))
 	fmt.Println()
 
 	// Job Queue Statistics (if controller is running)
@@ -514,6 +634,32 @@ func showStatus() error {
 	return nil
 }
 
+// remoteCredentials returns the credentials for submitting to a remote master
+//
+// Without a config file the client dials in plaintext. With one, it uses
+// mTLS if the file enables TLS, and fails if the credentials cannot load.
+//
+// Parameters:
+//   - path: Config file path
+//
+// Returns:
+//   - credentials.TransportCredentials: Credentials for grpc.NewClient
+//   - error: Unreadable config or TLS credentials
+func remoteCredentials(path string) (credentials.TransportCredentials, error) {
+	cfg, err := loadConfig(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return insecure.NewCredentials(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	creds, err := security.DialCredentials(cfg.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS credentials: %w", err)
+	}
+	return creds, nil
+}
+
 func loadConfig(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -527,3 +673,48 @@ func loadConfig(path string) (*Config, error) {
 
 	return &cfg, nil
 }
+
+// describeWALDurability explains the configured wal.sync_mode
+func describeWALDurability(cfg *Config) string {
+	mode, err := wal.ParseSyncMode(cfg.WAL.SyncMode)
+	if err != nil {
+		return "⚠️  " + err.Error()
+	}
+	return wal.DescribeDurability(mode, time.Duration(cfg.WAL.SyncInterval)*time.Millisecond)
+}
+
+// describeGroupCommit explains how wal batches are sized
+func describeGroupCommit(cfg *Config) string {
+	if cfg.WAL.LatencyTargetMs > 0 {
+		return fmt.Sprintf("adaptive (p99 target %dms)", cfg.WAL.LatencyTargetMs)
+	}
+	return fmt.Sprintf("fixed (%d events or %dms)", cfg.WAL.BufferSize, cfg.WAL.FlushIntervalMs)
+}
+
+// describeCompression summarizes the snapshot compression setting
+func describeCompression(cfg *Config) string {
+	compression, err := snapshot.ParseCompression(cfg.Snapshot.Compression)
+	if err != nil {
+		return "⚠️  " + err.Error()
+	}
+	return string(compression)
+}
+
+// describeEncryption explains the configured encryption block
+func describeEncryption(cfg *Config) string {
+	keyring, err := encryption.LoadKeyring(cfg.Encryption)
+	if err != nil {
+		return "⚠️  " + err.Error()
+	}
+	return keyring.Describe()
+}
+
+// walArchiveOptions maps the wal.archive config block
+func walArchiveOptions(cfg *Config) wal.ArchiveOptions {
+	return wal.ArchiveOptions{
+		Dir:      cfg.WAL.Archive.Dir,
+		MaxFiles: cfg.WAL.Archive.MaxFiles,
+		MaxAge:   time.Duration(cfg.WAL.Archive.MaxAgeSeconds) * time.Second,
+		MaxBytes: cfg.WAL.Archive.MaxBytes,
+	}
+}
@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"encoding/base64"
 	"os"
 	"path/filepath"
 	"testing"
@@ -19,7 +20,7 @@ func TestBuildCLI(t *testing.T) {
 
 	// Check subcommands
 	commands := cmd.Commands()
-	assert.Len(t, commands, 3, "Should have 3 subcommands")
+	assert.Len(t, commands, 5, "Should have 5 subcommands")
 
 	commandNames := make(map[string]bool)
 	for _, c := range commands {
@@ -29,6 +30,8 @@ func TestBuildCLI(t *testing.T) {
 	assert.True(t, commandNames["run"], "Should have 'run' command")
 	assert.True(t, commandNames["enqueue"], "Should have 'enqueue' command")
 	assert.True(t, commandNames["status"], "Should have 'status' command")
+	assert.True(t, commandNames["wal"], "Should have 'wal' command")
+	assert.True(t, commandNames["snapshot"], "Should have 'snapshot' command")
 
 	// Check persistent flags
 	configFlag := cmd.PersistentFlags().Lookup("config")
@@ -189,7 +192,7 @@ worker:
 }
 
 func TestEnqueueJobs_InvalidFile(t *testing.T) {
-	err := enqueueJobs("/nonexistent/jobs.json")
+	err := enqueueJobs("/nonexistent/jobs.json", "")
 
 	assert.Error(t, err, "enqueueJobs should return error for nonexistent file")
 	assert.Contains(t, err.Error(), "failed to read job file", "Error should mention file reading failure")
@@ -204,12 +207,47 @@ func TestEnqueueJobs_InvalidJSON(t *testing.T) {
 	err := os.WriteFile(jobFile, []byte(invalidJSON), 0644)
 	require.NoError(t, err, "Failed to write invalid JSON")
 
-	err = enqueueJobs(jobFile)
+	err = enqueueJobs(jobFile, "")
 
 	assert.Error(t, err, "enqueueJobs should return error for invalid JSON")
 	assert.Contains(t, err.Error(), "failed to parse job file", "Error should mention JSON parsing failure")
 }
 
+func TestRemoteCredentials(t *testing.T) {
+	// No config file: plaintext
+	creds, err := remoteCredentials("/nonexistent/config.yaml")
+	require.NoError(t, err, "A missing config file should not be an error")
+	assert.Equal(t, "insecure", creds.Info().SecurityProtocol)
+
+	// TLS disabled in the config: plaintext
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("tls:\n  enabled: false\n"), 0644))
+	creds, err = remoteCredentials(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, "insecure", creds.Info().SecurityProtocol)
+
+	// TLS enabled but its certificates are missing: fail instead of plaintext
+	tlsConfig := `
+tls:
+  enabled: true
+  client:
+    ca_file: /nonexistent/ca.pem
+    cert_file: /nonexistent/cert.pem
+    key_file: /nonexistent/key.pem
+`
+	require.NoError(t, os.WriteFile(configPath, []byte(tlsConfig), 0644))
+	_, err = remoteCredentials(configPath)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to load TLS credentials")
+
+	// Broken config file
+	require.NoError(t, os.WriteFile(configPath, []byte("tls: [\n"), 0644))
+	_, err = remoteCredentials(configPath)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to load config")
+}
+
 func TestShowStatus(t *testing.T) {
 	// showStatus only prints output and should not return an error
 	err := showStatus()
@@ -239,3 +277,29 @@ func TestConfigStructure(t *testing.T) {
 	assert.True(t, cfg.Metrics.Enabled)
 	assert.Equal(t, 9090, cfg.Metrics.Port)
 }
+
+func TestDescribeWALDurability(t *testing.T) {
+	cfg := &Config{}
+	assert.Contains(t, describeWALDurability(cfg), "batch")
+
+	cfg.WAL.SyncMode = "periodic"
+	cfg.WAL.SyncInterval = 250
+	assert.Contains(t, describeWALDurability(cfg), "up to 250ms of acknowledged writes lost")
+
+	cfg.WAL.SyncMode = "sometimes"
+	assert.Contains(t, describeWALDurability(cfg), "unknown WAL sync mode")
+}
+
+func TestDescribeEncryption(t *testing.T) {
+	cfg := &Config{}
+	assert.Equal(t, "off", describeEncryption(cfg))
+
+	keyfile := filepath.Join(t.TempDir(), "keys")
+	require.NoError(t, os.WriteFile(keyfile, []byte("k1:"+base64.StdEncoding.EncodeToString(make([]byte, 32))+"\n"), 0600))
+	cfg.Encryption.KeyFile = keyfile
+	assert.Contains(t, describeEncryption(cfg), `active key "k1"`)
+
+	cfg.Encryption.ActiveKey = "k2"
+	assert.Contains(t, describeEncryption(cfg), `active key "k2"`)
+	assert.Contains(t, describeEncryption(cfg), "⚠️")
+}
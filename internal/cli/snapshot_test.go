@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ChuLiYu/raft-recovery/internal/snapshot"
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runSnapshotCommand executes `snapshot <args>` and returns its output
+func runSnapshotCommand(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	cmd := BuildCLI()
+	cmd.SetOut(&out)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs(append([]string{"snapshot"}, args...))
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestSnapshotInspectCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "beaver-raft.snap")
+	manager := snapshot.NewManagerWithOptions(path, snapshot.Options{NodeID: "node-a", Compression: snapshot.CompressionGzip})
+	require.NoError(t, manager.Write(types.SnapshotData{
+		Jobs: map[types.JobID]*types.Job{
+			"job-1": {ID: "job-1", Status: types.StatusPending},
+			"job-2": {ID: "job-2", Status: types.StatusCompleted},
+		},
+		LastSeq: 42,
+	}))
+
+	out, err := runSnapshotCommand(t, "inspect", "--path", path)
+	require.NoError(t, err)
+	assert.Contains(t, out, "full)")
+	assert.Contains(t, out, "Last Seq:    42")
+	assert.Contains(t, out, "Node:        node-a")
+	assert.Contains(t, out, "Compression: gzip")
+	assert.Contains(t, out, "not verified")
+	assert.Contains(t, out, "completed: 1")
+
+	out, err = runSnapshotCommand(t, "inspect", "--path", path, "--verify", "--json")
+	require.NoError(t, err)
+	var report struct {
+		LastSeq   uint64                  `json:"last_seq"`
+		JobCounts map[types.JobStatus]int `json:"job_counts"`
+		BodySize  int64                   `json:"body_size"`
+		Verified  bool                    `json:"verified"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(out), &report))
+	assert.Equal(t, uint64(42), report.LastSeq)
+	assert.Equal(t, 1, report.JobCounts[types.StatusPending])
+	assert.Positive(t, report.BodySize)
+	assert.True(t, report.Verified)
+
+	// Damage in the body is only found with --verify
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	raw[len(raw)-20] ^= 0xff
+	require.NoError(t, os.WriteFile(path, raw, 0644))
+	_, err = runSnapshotCommand(t, "inspect", "--path", path)
+	assert.NoError(t, err)
+	_, err = runSnapshotCommand(t, "inspect", "--path", path, "--verify")
+	assert.ErrorIs(t, err, snapshot.ErrCorruptedSnapshot)
+}
@@ -0,0 +1,467 @@
+package cli
+
+// ============================================================================
+// WAL Maintenance Commands
+// ============================================================================
+//
+// Offline tools operating on the WAL files of a stopped node:
+//
+//   beaver-raft wal dump --from 100 --job job-42   # Events (add --json for NDJSON)
+//   beaver-raft wal validate                       # Checksums, torn tails, seq gaps
+//   beaver-raft wal stats
+//   beaver-raft wal repair --in-place              # Drop damaged records
+//   beaver-raft wal truncate --seq 500             # Drop seq >= 500
+//   beaver-raft wal diff a.wal b.wal
+//   beaver-raft wal convert --to binary            # Rewrite every segment in place
+//   beaver-raft wal convert --to json --path ./data/wal/beaver-raft.wal
+//   beaver-raft wal archive                        # Archived segments and seq ranges
+//
+// --path defaults to wal.dir and --dir to wal.archive.dir from the config
+// file. Every command except convert accepts --json for machine-readable
+// output.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/wal"
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+func buildWALCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "wal",
+		Short: "Inspect and maintain WAL files",
+		Long:  "Offline WAL tools. Stop the node before running commands that modify the WAL.",
+	}
+
+	cmd.AddCommand(
+		buildWALDumpCommand(),
+		buildWALValidateCommand(),
+		buildWALStatsCommand(),
+		buildWALRepairCommand(),
+		buildWALTruncateCommand(),
+		buildWALDiffCommand(),
+		buildWALConvertCommand(),
+		buildWALArchiveCommand(),
+	)
+	return cmd
+}
+
+// walDumpLine is one line of `wal dump --json`; exactly one field is set
+type walDumpLine struct {
+	Record *wal.Record `json:"record,omitempty"`
+	Issue  *wal.Issue  `json:"issue,omitempty"`
+}
+
+func buildWALDumpCommand() *cobra.Command {
+	var walPath, jobID string
+	var fromSeq, toSeq uint64
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "dump",
+		Short: "Print WAL events",
+		Long:  "Print every event of the WAL in order, marking damaged regions",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := resolveWALPath(walPath)
+			if err != nil {
+				return err
+			}
+
+			// --from seeks through the segment indexes instead of decoding from the start
+			var afterSeq uint64
+			if fromSeq > 0 {
+				afterSeq = fromSeq - 1
+			}
+			out := cmd.OutOrStdout()
+			enc := json.NewEncoder(out)
+			return wal.WalkWALFrom(path, afterSeq, func(rec *wal.Record, issue *wal.Issue) error {
+				if rec != nil {
+					e := &rec.Event
+					if e.Seq < fromSeq || (toSeq > 0 && e.Seq > toSeq) || (jobID != "" && e.JobID != types.JobID(jobID)) {
+						return nil
+					}
+				}
+				if asJSON {
+					return enc.Encode(walDumpLine{Record: rec, Issue: issue})
+				}
+				var line string
+				if rec != nil {
+					line = rec.String()
+				} else {
+					line = issue.String()
+				}
+				_, err := fmt.Fprintln(out, line)
+				return err
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&walPath, "path", "", "WAL path (default: wal.dir from config)")
+	cmd.Flags().Uint64Var(&fromSeq, "from", 0, "First sequence number to print")
+	cmd.Flags().Uint64Var(&toSeq, "to", 0, "Last sequence number to print (0 = no limit)")
+	cmd.Flags().StringVar(&jobID, "job", "", "Only print events of this job")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print one JSON object per line")
+	return cmd
+}
+
+func buildWALValidateCommand() *cobra.Command {
+	var walPath string
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check WAL integrity",
+		Long:  "Verify checksums and sequence numbers of every event; exits non-zero if issues are found",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := resolveWALPath(walPath)
+			if err != nil {
+				return err
+			}
+
+			var issues []wal.Issue
+			validateErr := wal.ValidateWAL(path)
+			var invalid *wal.ValidationError
+			if errors.As(validateErr, &invalid) {
+				issues = invalid.Issues
+			} else if validateErr != nil {
+				return validateErr
+			}
+			events, err := wal.CountEvents(path)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if asJSON {
+				report := struct {
+					Path   string      `json:"path"`
+					Valid  bool        `json:"valid"`
+					Events int         `json:"events"`
+					Issues []wal.Issue `json:"issues"`
+				}{path, len(issues) == 0, events, issues}
+				if report.Issues == nil {
+					report.Issues = []wal.Issue{}
+				}
+				if err := writeJSON(out, report); err != nil {
+					return err
+				}
+			} else {
+				for _, issue := range issues {
+					fmt.Fprintln(out, issue.String())
+				}
+				if len(issues) == 0 {
+					fmt.Fprintf(out, "✅ %s is valid (%d events)\n", path, events)
+				} else {
+					fmt.Fprintf(out, "❌ %s has %d issue(s) (%d readable events)\n", path, len(issues), events)
+				}
+			}
+
+			if validateErr != nil {
+				cmd.SilenceUsage = true
+			}
+			return validateErr
+		},
+	}
+
+	cmd.Flags().StringVar(&walPath, "path", "", "WAL path (default: wal.dir from config)")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the report as JSON")
+	return cmd
+}
+
+func buildWALStatsCommand() *cobra.Command {
+	var walPath string
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show WAL statistics",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := resolveWALPath(walPath)
+			if err != nil {
+				return err
+			}
+			stats, err := wal.GetWALStats(path)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if asJSON {
+				return writeJSON(out, stats)
+			}
+
+			fmt.Fprintf(out, "📜 WAL: %s\n", path)
+			fmt.Fprintf(out, "  ├─ Segments:    %d (%.1f KB)\n", stats.Segments, float64(stats.TotalBytes)/1024)
+			fmt.Fprintf(out, "  ├─ Events:      %d\n", stats.TotalEvents)
+			fmt.Fprintf(out, "  ├─ Seq Range:   %d - %d\n", stats.FirstSeq, stats.LastSeq)
+			if stats.TotalEvents > 0 {
+				fmt.Fprintf(out, "  ├─ Time Range:  %s - %s\n", formatMillis(stats.TimeRange[0]), formatMillis(stats.TimeRange[1]))
+			}
+			eventTypes := make([]string, 0, len(stats.EventTypes))
+			for eventType := range stats.EventTypes {
+				eventTypes = append(eventTypes, string(eventType))
+			}
+			sort.Strings(eventTypes)
+			for _, eventType := range eventTypes {
+				fmt.Fprintf(out, "  │  └─ %-9s %d\n", eventType+":", stats.EventTypes[wal.EventType(eventType)])
+			}
+			fmt.Fprintf(out, "  ├─ Corrupted:   %d\n", stats.CorruptedCount)
+			fmt.Fprintf(out, "  └─ Torn Tail:   %t\n", stats.TornTail)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&walPath, "path", "", "WAL path (default: wal.dir from config)")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print statistics as JSON")
+	return cmd
+}
+
+func buildWALRepairCommand() *cobra.Command {
+	var walPath, outPath string
+	var inPlace, asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "repair",
+		Short: "Rewrite the WAL without damaged records",
+		Long: "Copy every readable event into a single new segment, dropping corrupted records and torn tails. " +
+			"Sequence numbers are kept. With --in-place the original files are kept with a .bak suffix.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := resolveWALPath(walPath)
+			if err != nil {
+				return err
+			}
+			dst := outPath
+			switch {
+			case inPlace && outPath != "":
+				return fmt.Errorf("--out and --in-place are mutually exclusive")
+			case inPlace:
+				dst = path
+			case dst == "":
+				dst = path + ".repaired"
+			}
+
+			result, err := wal.RepairWAL(path, dst)
+			if err != nil {
+				return fmt.Errorf("repair failed: %w", err)
+			}
+
+			out := cmd.OutOrStdout()
+			if asJSON {
+				report := struct {
+					Output string `json:"output"`
+					*wal.RepairResult
+				}{dst, result}
+				return writeJSON(out, report)
+			}
+			for _, issue := range result.Dropped {
+				fmt.Fprintln(out, issue.String())
+			}
+			fmt.Fprintf(out, "Wrote %d event(s) to %s, dropped %d damaged region(s)\n", result.Events, dst, len(result.Dropped))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&walPath, "path", "", "WAL path (default: wal.dir from config)")
+	cmd.Flags().StringVar(&outPath, "out", "", "Output path (default: <path>.repaired)")
+	cmd.Flags().BoolVar(&inPlace, "in-place", false, "Replace the WAL, keeping the originals as .bak files")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the result as JSON")
+	return cmd
+}
+
+func buildWALTruncateCommand() *cobra.Command {
+	var walPath string
+	var seq uint64
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "truncate",
+		Short: "Drop events from a sequence number on",
+		Long:  "Delete every event with seq >= --seq, e.g. to roll a node back to a known good state",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := resolveWALPath(walPath)
+			if err != nil {
+				return err
+			}
+			if !cmd.Flags().Changed("seq") {
+				return fmt.Errorf("--seq is required")
+			}
+
+			removed, err := wal.TruncateWAL(path, seq)
+			if err != nil {
+				return fmt.Errorf("truncate failed after removing %d events: %w", removed, err)
+			}
+
+			out := cmd.OutOrStdout()
+			if asJSON {
+				return writeJSON(out, map[string]interface{}{"path": path, "seq": seq, "removed": removed})
+			}
+			fmt.Fprintf(out, "Removed %d event(s) with seq >= %d from %s\n", removed, seq, path)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&walPath, "path", "", "WAL path (default: wal.dir from config)")
+	cmd.Flags().Uint64Var(&seq, "seq", 0, "First sequence number to drop")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the result as JSON")
+	return cmd
+}
+
+func buildWALDiffCommand() *cobra.Command {
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "diff <wal-a> <wal-b>",
+		Short: "Compare the events of two WALs",
+		Long:  "Match events by sequence number and list missing or differing events; exits non-zero if they differ",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			diffs, err := wal.CompareWAL(args[0], args[1])
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if asJSON {
+				if diffs == nil {
+					diffs = []string{}
+				}
+				if err := writeJSON(out, map[string]interface{}{"identical": len(diffs) == 0, "differences": diffs}); err != nil {
+					return err
+				}
+			} else {
+				for _, diff := range diffs {
+					fmt.Fprintln(out, diff)
+				}
+				if len(diffs) == 0 {
+					fmt.Fprintln(out, "WALs hold the same events")
+				}
+			}
+
+			if len(diffs) > 0 {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("%d difference(s)", len(diffs))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print differences as JSON")
+	return cmd
+}
+
+func buildWALConvertCommand() *cobra.Command {
+	var walPath string
+	var to string
+
+	cmd := &cobra.Command{
+		Use:   "convert",
+		Short: "Rewrite WAL segments in another record format",
+		Long:  "Convert every segment of a stopped node's WAL to the given encoding (json or binary)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := resolveWALPath(walPath)
+			if err != nil {
+				return err
+			}
+			encoding, err := wal.ParseEncoding(to)
+			if err != nil {
+				return err
+			}
+
+			converted, err := wal.ConvertWAL(path, encoding)
+			if err != nil {
+				return fmt.Errorf("conversion failed after %d segments: %w", converted, err)
+			}
+			fmt.Printf("Converted %d segment(s) of %s to %s\n", converted, path, encoding)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&walPath, "path", "", "WAL path (default: wal.dir from config)")
+	cmd.Flags().StringVar(&to, "to", string(wal.EncodingBinary), "Target encoding: json or binary")
+	return cmd
+}
+
+func buildWALArchiveCommand() *cobra.Command {
+	var walPath, archiveDir string
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "archive",
+		Short: "List archived WAL segments",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := resolveWALPath(walPath)
+			if err != nil {
+				return err
+			}
+			if archiveDir == "" {
+				cfg, err := loadConfig(configFile)
+				if err != nil {
+					return fmt.Errorf("failed to load config (or pass --dir): %w", err)
+				}
+				archiveDir = cfg.WAL.Archive.Dir
+			}
+			if archiveDir == "" {
+				return fmt.Errorf("no WAL archive configured (set wal.archive.dir or pass --dir)")
+			}
+			entries, err := wal.ReadArchiveIndex(archiveDir, path)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if asJSON {
+				if entries == nil {
+					entries = []wal.ArchiveEntry{}
+				}
+				return writeJSON(out, entries)
+			}
+
+			fmt.Fprintf(out, "🗄  WAL archive: %s (%d files)\n", archiveDir, len(entries))
+			for _, e := range entries {
+				seqs := fmt.Sprintf("seq %d - %d", e.FirstSeq, e.LastSeq)
+				if e.Legacy {
+					seqs += " (legacy, not replayed)"
+				}
+				fmt.Fprintf(out, "  ├─ %s  %s, %d events, %.1f KB, archived %s\n",
+					e.File, seqs, e.Events, float64(e.Size)/1024, formatMillis(e.ArchivedAt))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&walPath, "path", "", "WAL path (default: wal.dir from config)")
+	cmd.Flags().StringVar(&archiveDir, "dir", "", "Archive directory (default: wal.archive.dir from config)")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the archive index as JSON")
+	return cmd
+}
+
+// writeJSON prints v as indented JSON
+func writeJSON(out io.Writer, v interface{}) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// formatMillis formats a Unix millisecond timestamp for display
+func formatMillis(ms int64) string {
+	return time.UnixMilli(ms).UTC().Format(time.RFC3339)
+}
+
+// resolveWALPath returns the explicit path or the one from the config file
+func resolveWALPath(walPath string) (string, error) {
+	if walPath != "" {
+		return walPath, nil
+	}
+	cfg, err := loadConfig(configFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to load config (or pass --path): %w", err)
+	}
+	return cfg.WAL.Dir, nil
+}
@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/wal"
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWALConvertCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+	w, err := wal.NewWAL(path, false, 10, time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, w.Append(wal.EventEnqueue, &types.Job{ID: "job-1"}))
+	require.NoError(t, w.Close())
+
+	cmd := BuildCLI()
+	cmd.SetArgs([]string{"wal", "convert", "--path", path, "--to", "binary"})
+	require.NoError(t, cmd.Execute())
+
+	w, err = wal.NewWALWithOptions(path, wal.Options{Encoding: wal.EncodingBinary})
+	require.NoError(t, err)
+	defer w.Close()
+	assert.Equal(t, uint64(1), w.GetLastSeq())
+
+	cmd = BuildCLI()
+	cmd.SetArgs([]string{"wal", "convert", "--path", path, "--to", "xml"})
+	assert.Error(t, cmd.Execute())
+}
+
+// writeDamagedWAL writes three events and corrupts the second one
+func writeDamagedWAL(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.wal")
+	w, err := wal.NewWAL(path, false, 10, time.Millisecond)
+	require.NoError(t, err)
+	for _, id := range []types.JobID{"job-1", "job-2", "job-3"} {
+		require.NoError(t, w.Append(wal.EventEnqueue, &types.Job{ID: id}))
+	}
+	require.NoError(t, w.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	second := bytes.IndexByte(data, '\n') + 1
+	copy(data[second:], "XXXX")
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	return path
+}
+
+// runWALCommand executes `wal <args>` and returns its output
+func runWALCommand(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	cmd := BuildCLI()
+	cmd.SetOut(&out)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs(append([]string{"wal"}, args...))
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestWALInspectCommands(t *testing.T) {
+	path := writeDamagedWAL(t)
+
+	out, err := runWALCommand(t, "dump", "--path", path)
+	require.NoError(t, err)
+	assert.Contains(t, out, "[Seq:1] ENQUEUE job-1")
+	assert.Contains(t, out, "!! corrupt in test.wal")
+	assert.Contains(t, out, "[Seq:3] ENQUEUE job-3")
+
+	out, err = runWALCommand(t, "dump", "--path", path, "--json", "--job", "job-3")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 2) // The issue and job-3's event
+	var line walDumpLine
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &line))
+	assert.Equal(t, uint64(3), line.Record.Event.Seq)
+
+	out, err = runWALCommand(t, "dump", "--path", path, "--from", "3")
+	require.NoError(t, err)
+	assert.NotContains(t, out, "[Seq:1]")
+	assert.Contains(t, out, "[Seq:3] ENQUEUE job-3")
+
+	out, err = runWALCommand(t, "validate", "--path", path, "--json")
+	assert.Error(t, err)
+	var report struct {
+		Valid  bool        `json:"valid"`
+		Events int         `json:"events"`
+		Issues []wal.Issue `json:"issues"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(out), &report))
+	assert.False(t, report.Valid)
+	assert.Equal(t, 2, report.Events)
+	assert.Equal(t, wal.IssueCorrupt, report.Issues[0].Kind)
+
+	out, err = runWALCommand(t, "stats", "--path", path, "--json")
+	require.NoError(t, err)
+	var stats wal.WALStats
+	require.NoError(t, json.Unmarshal([]byte(out), &stats))
+	assert.Equal(t, 2, stats.TotalEvents)
+	assert.Equal(t, 1, stats.CorruptedCount)
+}
+
+func TestWALRepairTruncateDiffCommands(t *testing.T) {
+	path := writeDamagedWAL(t)
+	repaired := path + ".repaired"
+
+	out, err := runWALCommand(t, "repair", "--path", path)
+	require.NoError(t, err)
+	assert.Contains(t, out, "Wrote 2 event(s) to "+repaired)
+
+	out, err = runWALCommand(t, "diff", path, repaired)
+	require.NoError(t, err)
+	assert.Contains(t, out, "same events")
+
+	out, err = runWALCommand(t, "truncate", "--path", repaired, "--seq", "3", "--json")
+	require.NoError(t, err)
+	assert.Contains(t, out, `"removed": 1`)
+
+	out, err = runWALCommand(t, "diff", path, repaired, "--json")
+	assert.Error(t, err)
+	assert.Contains(t, out, "seq 3: only in "+path)
+
+	_, err = runWALCommand(t, "truncate", "--path", repaired)
+	assert.Error(t, err)
+}
+
+func TestWALArchiveCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+	archiveDir := filepath.Join(t.TempDir(), "archive")
+	w, err := wal.NewWALWithOptions(path, wal.Options{BufferSize: 10, FlushInterval: time.Millisecond,
+		Archive: wal.ArchiveOptions{Dir: archiveDir}})
+	require.NoError(t, err)
+	require.NoError(t, w.Append(wal.EventEnqueue, &types.Job{ID: "job-1"}))
+	require.NoError(t, w.Rotate())
+	require.NoError(t, w.Append(wal.EventEnqueue, &types.Job{ID: "job-2"}))
+	_, err = w.Prune(1)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	out, err := runWALCommand(t, "archive", "--path", path, "--dir", archiveDir)
+	require.NoError(t, err)
+	assert.Contains(t, out, "(1 files)")
+	assert.Contains(t, out, "test.wal.00000000000000000001.gz  seq 1 - 1, 1 events")
+
+	out, err = runWALCommand(t, "archive", "--path", path, "--dir", archiveDir, "--json")
+	require.NoError(t, err)
+	var entries []wal.ArchiveEntry
+	require.NoError(t, json.Unmarshal([]byte(out), &entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, uint64(1), entries[0].LastSeq)
+}
@@ -18,6 +18,7 @@
 //   2. Result Loop - Receives worker execution results and updates job states
 //   3. Timeout Loop - Periodically scans for timed-out tasks, requeues or marks as dead
 //   4. Snapshot Loop - Periodically creates snapshots to ensure fast recovery capability
+//   (Optional) Compaction Loop - Drops finished job histories from the WAL
 //
 // Crash Recovery Flow:
 //   Automatically executed on startup:
@@ -25,6 +26,8 @@
 //   2. replayWAL() - Replays WAL logs to recover operations after the snapshot
 //   3. requeueInFlightJobs() - Reschedules tasks that were in-flight before the crash
 //   Target: Achieve < 3 second recovery time
+//   With Config.RecoverTo set, steps 1-2 stop at an earlier point instead
+//   (point-in-time recovery, see recovery.go).
 //
 // Idempotency Guarantee:
 //   - Each operation writes to WAL first, then modifies in-memory state
@@ -47,15 +50,20 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"os"
 	"sync"
 	"time"
 
+	"github.com/ChuLiYu/raft-recovery/internal/encryption"
 	"github.com/ChuLiYu/raft-recovery/internal/jobmanager"
+	"github.com/ChuLiYu/raft-recovery/internal/metrics"
 	"github.com/ChuLiYu/raft-recovery/internal/raft"
 	"github.com/ChuLiYu/raft-recovery/internal/snapshot"
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
 	"github.com/ChuLiYu/raft-recovery/internal/storage/wal"
 	"github.com/ChuLiYu/raft-recovery/internal/worker"
 	"github.com/ChuLiYu/raft-recovery/pkg/types"
@@ -78,6 +86,34 @@ type Config struct {
 	// WAL batch commit settings (NEW!)
 	WALBufferSize    int           // Max events per batch (e.g., 100)
 	WALFlushInterval time.Duration // Max time between flushes (e.g., 10ms)
+	WALLatencyTarget time.Duration // p99 append latency for adaptive batching (0 = fixed, see wal/group_commit.go)
+	// Snapshot retention (see snapshot/generations.go)
+	SnapshotRetention   int    // Snapshot generations to keep for fallback (<= 1 = newest only)
+	SnapshotCompression string // "none" (default), "gzip" or "flate" (see snapshot/compression.go)
+	NodeID              string // Recorded in snapshot headers (default: hostname)
+	// Recovery settings
+	RecoveryWorkers int // Goroutines per WAL replay stage (0 = one per CPU, 1 = sequential, see replay.go)
+	// WAL segment settings
+	WALMaxSegmentSize int64         // Seal the active WAL segment at this size in bytes (0 = on snapshot only)
+	WALRetention      time.Duration // Keep snapshot-covered WAL segments at least this long
+	WALEncoding       string        // WAL record format: "json" (default) or "binary"
+	// WAL durability settings (see wal.SyncMode)
+	WALSyncMode     string        // "batch" (default), "datasync", "periodic" or "none"
+	WALSyncInterval time.Duration // Background sync period in periodic mode
+	WALPreallocate  int64         // Bytes reserved for each new WAL segment (0 = off)
+	// WAL compaction settings (see compactionLoop)
+	WALCompactInterval time.Duration // How often to compact covered WAL segments (0 = disabled)
+	WALCompactAfter    time.Duration // Completed jobs stay in the WAL at least this long
+	// WAL archive settings (pruned segments are compressed here instead of deleted)
+	WALArchive wal.ArchiveOptions
+	// Encryption at rest for WAL payloads and snapshots (no key source = off)
+	Encryption encryption.Config
+	// Point-in-time recovery (see recovery.go)
+	RecoverTo RecoveryTarget // Recover only up to this point (zero value = everything)
+	// Filesystem for the WAL and snapshots (nil = the real disk; tests use vfs.MemFS)
+	FS vfs.FS
+	// Prometheus metrics for the WAL and snapshots (nil = not exported)
+	Metrics *metrics.Collector
 	
 	// Phase 2: Distributed Mode Settings
 	DisableDispatchLoop bool // If true, internal dispatch loops are disabled (for Master node)
@@ -95,6 +131,9 @@ type Controller struct {
 	stopped    bool                   // Flag indicating if stopped
 	startTime  time.Time              // Start time (for statistics)
 	loopWg     sync.WaitGroup         // Wait for all loops to exit
+	applyMu    sync.RWMutex           // Read: WAL append + state change in progress; Write: snapshot capture
+	replayFrom uint64                 // WAL seq covered by the loaded snapshot
+	coveredSeq uint64                 // WAL seq covered by the latest snapshot (compaction limit)
 	
 	// Phase 3: Raft integration
 	applyCh    chan raft.ApplyMsg     // Channel for committed entries
@@ -127,13 +166,67 @@ func NewController(config Config) (*Controller, error) {
 	if flushInterval <= 0 {
 		flushInterval = 10 * time.Millisecond // Default: 10ms
 	}
-	walInstance, err := wal.NewWAL(config.WALPath, false, bufferSize, flushInterval)
+	encoding, err := wal.ParseEncoding(config.WALEncoding)
+	if err != nil {
+		return nil, err
+	}
+	syncMode, err := wal.ParseSyncMode(config.WALSyncMode)
+	if err != nil {
+		return nil, err
+	}
+	compression, err := snapshot.ParseCompression(config.SnapshotCompression)
+	if err != nil {
+		return nil, err
+	}
+	keyring, err := encryption.LoadKeyring(config.Encryption)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encryption keys: %w", err)
+	}
+	// A nil *Collector must stay a nil interface
+	var walMetrics wal.Metrics
+	var snapshotMetrics snapshot.Metrics
+	if config.Metrics != nil {
+		walMetrics, snapshotMetrics = config.Metrics, config.Metrics
+	}
+	walInstance, err := wal.NewWALWithOptions(config.WALPath, wal.Options{
+		BufferSize:     bufferSize,
+		FlushInterval:  flushInterval,
+		MaxSegmentSize: config.WALMaxSegmentSize,
+		Retention:      config.WALRetention,
+		Encoding:       encoding,
+		Archive:        config.WALArchive,
+		SyncMode:       syncMode,
+		SyncInterval:   config.WALSyncInterval,
+		Preallocate:    config.WALPreallocate,
+		LatencyTarget:  config.WALLatencyTarget,
+		Keyring:        keyring,
+		Metrics:        walMetrics,
+		FS:             config.FS,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to open WAL: %w", err)
 	}
+	if syncMode != wal.SyncBatch {
+		log.Warn("WAL durability relaxed", "mode", walInstance.Durability())
+	}
+
+	if keyring != nil {
+		log.Info("Encryption at rest enabled", "keyring", keyring.Describe())
+	}
 
 	// 3. Create Snapshot Manager
-	snapshotMgr := snapshot.NewManager(config.SnapshotPath)
+	nodeID := config.NodeID
+	if nodeID == "" {
+		nodeID, _ = os.Hostname()
+	}
+	snapshotMgr := snapshot.NewManagerWithOptions(config.SnapshotPath, snapshot.Options{
+		Keyring:     keyring,
+		FS:          config.FS,
+		Retain:      config.SnapshotRetention,
+		Compression: compression,
+		NodeID:      nodeID,
+		Metrics:     snapshotMetrics,
+	})
 
 	// 4. Create Worker Pool
 	pool := worker.NewPool(config.WALBufferSize)
@@ -170,12 +263,18 @@ func (c *Controller) Start() error {
 	// 1. Recovery phase
 	log.Info("Starting recovery...")
 
-	if err := c.loadSnapshot(); err != nil {
-		return fmt.Errorf("loadSnapshot failed: %w", err)
-	}
+	if !c.config.RecoverTo.IsZero() {
+		if err := c.recoverToTarget(c.config.RecoverTo); err != nil {
+			return fmt.Errorf("point-in-time recovery failed: %w", err)
+		}
+	} else {
+		if err := c.loadSnapshot(); err != nil {
+			return fmt.Errorf("loadSnapshot failed: %w", err)
+		}
 
-	if err := c.replayWAL(); err != nil {
-		return fmt.Errorf("replayWAL failed: %w", err)
+		if err := c.replayWAL(); err != nil {
+			return fmt.Errorf("replayWAL failed: %w", err)
+		}
 	}
 
 	// Requeue all in_flight jobs (these tasks were incomplete at the time of crash)
@@ -189,12 +288,22 @@ func (c *Controller) Start() error {
 			requeueCount++
 		}
 	}
+	// Replay marks jobs in-flight without popping them; drop stale queue entries
+	c.jobManager.CompactQueue()
 	c.mu.Unlock()
 
 	log.Info("Recovery completed",
 		"duration", time.Since(c.startTime),
 		"requeued_jobs", requeueCount)
 
+	// A point-in-time recovery is only durable once the recovered state
+	// replaces the newer snapshot
+	if !c.config.RecoverTo.IsZero() {
+		if err := c.persistRecoveredState(); err != nil {
+			return fmt.Errorf("failed to persist recovered state: %w", err)
+		}
+	}
+
 	// 2. Start Worker Pool
 	if err := c.pool.Start(c.config.WorkerCount, nil); err != nil {
 		return fmt.Errorf("failed to start worker pool: %w", err)
@@ -218,6 +327,11 @@ func (c *Controller) Start() error {
 	go c.resultLoop()
 	go c.timeoutLoop()
 	go c.snapshotLoop()
+
+	if c.config.WALCompactInterval > 0 {
+		c.loopWg.Add(1)
+		go c.compactionLoop()
+	}
 	
 	// Phase 3: Start apply loop
 	c.loopWg.Add(1)
@@ -302,20 +416,53 @@ func (c *Controller) GetApplyCh() chan raft.ApplyMsg {
 func (c *Controller) loadSnapshot() error {
 	start := time.Now()
 
-	// Load snapshot
-	data, err := c.snapshot.Load()
+	// Stream the newest snapshot generation that verifies into the
+	// JobManager; a generation failing halfway is replaced by the next one
+	c.mu.Lock()
+	data, skipped, err := c.snapshot.LoadNewestStream(func(r *snapshot.Reader) error {
+		return c.jobManager.RestoreStream(r)
+	})
+	for _, s := range skipped {
+		log.Warn("Snapshot generation skipped", "path", s.Path, "last_seq", s.LastSeq, "error", s.Err)
+	}
 	if err != nil {
+		c.mu.Unlock()
 		return fmt.Errorf("failed to load snapshot: %w", err)
 	}
-
-	// Restore JobManager state
-	c.mu.Lock()
-	if err := c.jobManager.Restore(data); err != nil {
-		c.mu.Unlock()
-		return fmt.Errorf("failed to restore state: %w", err)
+	// In Raft mode LastSeq is a Raft index, not a WAL seq
+	raftMode := c.raftNode != nil
+	if !raftMode {
+		c.replayFrom = data.LastSeq
+		c.coveredSeq = min(data.LastSeq, c.snapshot.RetainedSeq())
 	}
 	c.mu.Unlock()
 
+	// A partial snapshot leaves out completed and dead jobs; only Raft
+	// mode writes them, since the log can rebuild the rest
+	if data.IsPartial() && !raftMode {
+		log.Warn("Recovering from a partial snapshot: completed and dead jobs it left out are not restored",
+			"snapshot_seq", data.LastSeq)
+	}
+
+	// An older generation is only usable if the WAL still holds what
+	// followed it
+	if len(skipped) > 0 && !raftMode {
+		if err := c.checkReplayableFrom(data.LastSeq); err != nil {
+			return fmt.Errorf("cannot fall back to snapshot at seq %d: %w", data.LastSeq, err)
+		}
+		log.Warn("Recovering from an older snapshot generation", "snapshot_seq", data.LastSeq)
+	}
+
+	// A WAL that ends inside the snapshot (lost unsynced tail, restored
+	// directory) must not hand out covered seqs again (see wal/checkpoint.go)
+	if walSeq := c.wal.GetLastSeq(); !raftMode && walSeq < data.LastSeq {
+		log.Warn("WAL ends before the snapshot, continuing numbering after it",
+			"wal_seq", walSeq, "snapshot_seq", data.LastSeq)
+		if err := c.wal.AdvanceTo(data.LastSeq); err != nil {
+			return fmt.Errorf("failed to advance WAL past snapshot: %w", err)
+		}
+	}
+
 	recoveryTime := time.Since(start)
 
 	// Log recovery time (target < 3s)
@@ -326,7 +473,8 @@ func (c *Controller) loadSnapshot() error {
 
 	log.Info("Snapshot loaded",
 		"duration", recoveryTime,
-		"jobs", len(data.Jobs))
+		"kind", data.Kind,
+		"jobs", c.jobManager.GetTotalJobs())
 
 	return nil
 }
@@ -338,46 +486,82 @@ func (c *Controller) loadSnapshot() error {
 // Returns:
 //   - error: Replay failure error
 func (c *Controller) replayWAL() error {
-	handler := func(event *wal.Event) error {
-		c.mu.Lock()
-		defer c.mu.Unlock()
+	// Only events after the snapshot; covered segments are not read
+	if workers := c.recoveryWorkers(); workers > 1 {
+		return c.replayWALParallel(workers) // See replay.go
+	}
+	return c.wal.ReplayFrom(c.replayFrom, c.applyReplayedEvent)
+}
 
-		switch event.Type {
-		case wal.EventEnqueue:
-			// Usually already included in snapshot, can skip
+// applyReplayedEvent applies one WAL event to the recovered state
+func (c *Controller) applyReplayedEvent(event *wal.Event) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.applyEvent(event)
+}
 
-		case wal.EventDispatch:
-			// Check idempotency: don't reschedule already completed or dead jobs
-			if c.jobManager.IsCompleted(event.JobID) ||
-				c.jobManager.IsDead(event.JobID) {
-				return nil
-			}
+// applyEvent applies one WAL event; caller must hold c.mu
+func (c *Controller) applyEvent(event *wal.Event) error {
+	return c.applyEventTo(c.jobManager, event)
+}
 
-			// Mark as in-flight
-			deadline := time.Now().Add(c.config.TaskTimeout)
-			return c.jobManager.MarkInFlight(event.JobID, deadline)
+// applyEventTo applies one WAL event to jm, which is c.jobManager or a
+// replay partition's shard (see replay.go)
+func (c *Controller) applyEventTo(jm *jobmanager.JobManager, event *wal.Event) error {
+	switch event.Type {
+	case wal.EventEnqueue:
+		// Jobs already in the snapshot are skipped (idempotency).
+		// V2 events carry the full job, so jobs enqueued after the
+		// snapshot are rebuilt here; V1 events can only rely on the snapshot.
+		if !event.HasJob() || jm.GetJob(event.JobID) != nil {
+			return nil
+		}
+		return jm.RestoreJob(event.Job())
 
-		case wal.EventAck:
-			// Skip if already completed
-			if c.jobManager.IsCompleted(event.JobID) {
-				return nil
-			}
-			return c.jobManager.MarkCompleted(event.JobID)
+	case wal.EventDispatch:
+		// Check idempotency: don't reschedule already completed or dead jobs
+		if jm.IsCompleted(event.JobID) ||
+			jm.IsDead(event.JobID) {
+			return nil
+		}
+
+		// Mark as in-flight with the logged deadline; V1 events have none
+		deadline := time.Now().Add(c.config.TaskTimeout)
+		if event.HasState() && event.Deadline != nil {
+			deadline = time.UnixMilli(*event.Deadline)
+		}
+		return jm.MarkInFlight(event.JobID, deadline)
 
-		case wal.EventRetry:
-			return c.jobManager.Requeue(event.JobID)
+	case wal.EventAck:
+		// Skip if already completed
+		if jm.IsCompleted(event.JobID) {
+			return nil
+		}
+		return jm.MarkCompleted(event.JobID)
 
-		case wal.EventTimeout:
-			return c.jobManager.Requeue(event.JobID)
+	case wal.EventRetry, wal.EventTimeout:
+		if err := jm.Requeue(event.JobID); err != nil {
+			return err
+		}
+		return restoreAttempt(jm, event)
 
-		case wal.EventDead:
-			return c.jobManager.MarkDead(event.JobID)
+	case wal.EventDead:
+		if err := jm.MarkDead(event.JobID); err != nil {
+			return err
 		}
+		return restoreAttempt(jm, event)
+	}
+
+	return nil
+}
 
+// restoreAttempt sets the job's attempt count to the one the event logged,
+// instead of the count Requeue derived; V1 events carry none
+func restoreAttempt(jm *jobmanager.JobManager, event *wal.Event) error {
+	if !event.HasState() {
 		return nil
 	}
-
-	return c.wal.Replay(handler)
+	return jm.RestoreAttempt(event.JobID, event.Attempt)
 }
 
 // ============================================================================
@@ -422,15 +606,22 @@ func (c *Controller) dispatchLoop() {
 				}
 			}
 
-			// Phase 1: WAL writes (parallel-safe, no lock)
-			for _, job := range jobs {
-				if err := c.wal.Append(wal.EventDispatch, job); err != nil {
+			// Phase 1: WAL writes (parallel-safe, no lock); queue them all
+			// first so they share fsync groups. The records carry the
+			// deadline so replay restores it.
+			deadline := time.Now().Add(c.config.TaskTimeout)
+			c.applyMu.RLock()
+			futures := make([]*wal.AppendFuture, len(jobs))
+			for i, job := range jobs {
+				futures[i] = c.wal.AppendAsync(wal.EventDispatch, dispatched(job, deadline))
+			}
+			for _, future := range futures {
+				if err := future.Wait(); err != nil {
 					log.Error("Failed to append DISPATCH event", "error", err)
 				}
 			}
 
 			// Phase 2: Batch mark in-flight (single lock acquisition)
-			deadline := time.Now().Add(c.config.TaskTimeout)
 			c.mu.Lock()
 			for _, job := range jobs {
 				if err := c.jobManager.MarkInFlight(job.ID, deadline); err != nil {
@@ -438,6 +629,7 @@ func (c *Controller) dispatchLoop() {
 				}
 			}
 			c.mu.Unlock()
+			c.applyMu.RUnlock()
 
 			// Phase 3: Submit to Worker Pool (thread-safe)
 			for _, job := range jobs {
@@ -480,6 +672,8 @@ func (c *Controller) resultLoop() {
 
 // handleResult processes a single task result
 func (c *Controller) handleResult(result worker.Result) {
+	c.applyMu.RLock()
+	defer c.applyMu.RUnlock()
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -504,39 +698,69 @@ func (c *Controller) handleResult(result worker.Result) {
 			"jobID", result.JobID,
 			"duration", result.Duration)
 	} else {
-		// Failure: Increment retry count
-		job.Attempt++
+		// Failure: Requeue or move to dead letter queue
+		c.failAttemptLocked(job, wal.EventRetry)
+	}
+}
 
-		if job.Attempt >= c.config.MaxRetry {
-			// Exceeded retry count, move to dead letter queue
-			if err := c.wal.Append(wal.EventDead, job); err != nil {
-				log.Error("Failed to append DEAD event", "error", err)
-				return
-			}
+// failAttemptLocked counts a failed attempt of job and requeues it, or
+// moves it to the dead letter queue once MaxRetry attempts have failed;
+// caller must hold c.mu
+//
+// The RETRY, TIMEOUT or DEAD record carries the attempt count after the
+// failure, which replay restores as is.
+//
+// Parameters:
+//   - job: Failed in-flight job
+//   - eventType: wal.EventRetry or wal.EventTimeout, logged when requeued
+func (c *Controller) failAttemptLocked(job *types.Job, eventType wal.EventType) {
+	failed := *job
+	failed.Attempt++
+	failed.Deadline = nil
+
+	if failed.Attempt >= c.config.MaxRetry {
+		// Exceeded retry count, move to dead letter queue
+		if err := c.wal.Append(wal.EventDead, &failed); err != nil {
+			log.Error("Failed to append DEAD event", "error", err)
+			return
+		}
+		if _, err := c.jobManager.IncrementAttempt(job.ID); err != nil {
+			log.Error("Failed to count attempt", "error", err)
+		}
+		if err := c.jobManager.MarkDead(job.ID); err != nil {
+			log.Error("Failed to mark dead", "error", err)
+		}
 
-			if err := c.jobManager.MarkDead(result.JobID); err != nil {
-				log.Error("Failed to mark dead", "error", err)
-			}
+		log.Warn("Job marked as dead",
+			"jobID", job.ID,
+			"attempts", failed.Attempt,
+			"cause", eventType)
+		return
+	}
 
-			log.Warn("Job marked as dead",
-				"jobID", result.JobID,
-				"attempts", job.Attempt)
-		} else {
-			// Requeue
-			if err := c.wal.Append(wal.EventRetry, job); err != nil {
-				log.Error("Failed to append RETRY event", "error", err)
-				return
-			}
+	// Requeue (counts the attempt)
+	if err := c.wal.Append(eventType, &failed); err != nil {
+		log.Error("Failed to append event", "type", eventType, "error", err)
+		return
+	}
+	if err := c.jobManager.Requeue(job.ID); err != nil {
+		log.Error("Failed to requeue", "error", err)
+	}
 
-			if err := c.jobManager.Requeue(result.JobID); err != nil {
-				log.Error("Failed to requeue", "error", err)
-			}
+	log.Debug("Job requeued",
+		"jobID", job.ID,
+		"attempt", failed.Attempt,
+		"cause", eventType)
+}
 
-			log.Debug("Job requeued",
-				"jobID", result.JobID,
-				"attempt", job.Attempt)
-		}
-	}
+// dispatched returns a copy of job as MarkInFlight leaves it, for the
+// DISPATCH record
+func dispatched(job *types.Job, deadline time.Time) *types.Job {
+	deadlineMs := deadline.UnixMilli()
+	copied := *job
+	copied.Status = types.StatusInFlight
+	copied.Deadline = &deadlineMs
+	return &copied
 }
 
 // timeoutLoop detects and handles timed-out tasks
@@ -552,45 +776,28 @@ func (c *Controller) timeoutLoop() {
 			return
 
 		case <-ticker.C:
-			c.mu.Lock()
-
-			// Get all expired tasks
-			expiredJobIDs := c.jobManager.GetExpiredJobs(time.Now())
-
-			for _, jobID := range expiredJobIDs {
-				job := c.jobManager.GetJob(jobID)
-				if job == nil {
-					continue
-				}
-
-				// Write to WAL
-				if err := c.wal.Append(wal.EventTimeout, job); err != nil {
-					log.Error("Failed to append TIMEOUT event", "error", err)
-					continue
-				}
-
-				// Increment retry count
-				job.Attempt++
+			c.expireJobs(time.Now())
+		}
+	}
+}
 
-				if job.Attempt >= c.config.MaxRetry {
-					// Exceeded retry count, move to dead letter queue
-					if err := c.jobManager.MarkDead(jobID); err != nil {
-						log.Error("Failed to mark dead", "error", err)
-					}
-					log.Debug("Job timeout and marked as dead",
-						"jobID", jobID)
-				} else {
-					// Requeue
-					if err := c.jobManager.Requeue(jobID); err != nil {
-						log.Error("Failed to requeue", "error", err)
-					}
-					log.Debug("Job timeout and requeued",
-						"jobID", jobID)
-				}
-			}
+// expireJobs requeues, or moves to the dead letter queue, every in-flight
+// job whose deadline is before now
+func (c *Controller) expireJobs(now time.Time) {
+	c.applyMu.RLock()
+	defer c.applyMu.RUnlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-			c.mu.Unlock()
+	// Get all expired tasks
+	for _, jobID := range c.jobManager.GetExpiredJobs(now) {
+		job := c.jobManager.GetJob(jobID)
+		if job == nil {
+			continue
 		}
+
+		// Logs TIMEOUT, or DEAD once retries are exhausted
+		c.failAttemptLocked(job, wal.EventTimeout)
 	}
 }
 
@@ -614,46 +821,141 @@ func (c *Controller) snapshotLoop() {
 	}
 }
 
+// compactionLoop periodically drops finished job histories from the WAL
+func (c *Controller) compactionLoop() {
+	defer c.loopWg.Done()
+	ticker := time.NewTicker(c.config.WALCompactInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopCh:
+			log.Info("Compaction loop stopped")
+			return
+
+		case <-ticker.C:
+			if err := c.compactWAL(); err != nil {
+				log.Error("Failed to compact WAL", "error", err)
+			}
+		}
+	}
+}
+
+// compactWAL rewrites WAL segments covered by the latest snapshot without
+// the events of jobs completed more than WALCompactAfter ago
+//
+// Only segments the snapshot covers are touched, so recovery from it is
+// unaffected; see wal/compaction.go for what is kept.
+func (c *Controller) compactWAL() error {
+	c.mu.Lock()
+	coveredSeq := c.coveredSeq
+	c.mu.Unlock()
+	if coveredSeq == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	result, err := c.wal.Compact(coveredSeq, start.Add(-c.config.WALCompactAfter))
+	if err != nil {
+		return err
+	}
+	if result.Segments > 0 {
+		log.Info("WAL compacted",
+			"duration", time.Since(start),
+			"segments", result.Segments,
+			"jobs", result.Jobs,
+			"dropped_events", result.Dropped)
+	}
+	return nil
+}
+
 // takeSnapshot executes the snapshot operation
+// Steps follow the checkpoint protocol in wal/checkpoint.go
 func (c *Controller) takeSnapshot() error {
 	start := time.Now()
 
-	// Phase 1: Quickly copy state with minimal lock hold time
+	// Phase 1: Start a snapshot cursor with minimal lock hold time; it
+	// copies jobs as they are written (see jobmanager/snapshot_cursor.go)
+	// applyMu waits out appends whose state change is not applied yet, so
+	// every event up to walSeq is reflected in the snapshot
+	c.applyMu.Lock()
 	c.mu.Lock()
-	var data types.SnapshotData
-	
-	// Beaver Logic: Use PartialSnapshot if Raft is enabled, otherwise Full Snapshot
+	var cursor *jobmanager.SnapshotCursor
+	var lastSeq uint64
+
+	// Beaver Logic: Use a partial snapshot if Raft is enabled, otherwise full
 	if c.raftNode != nil {
-		data = c.jobManager.PartialSnapshot()
+		cursor = c.jobManager.BeginSnapshot(types.SnapshotPartial)
 		// Metadata for Raft
-		data.LastSeq = uint64(c.jobManager.GetLastAppliedIndex()) // We'll need this helper
+		lastSeq = uint64(c.jobManager.GetLastAppliedIndex())
 	} else {
-		data = c.jobManager.Snapshot()
-		data.LastSeq = c.wal.GetLastSeq()
+		cursor = c.jobManager.BeginSnapshot(types.SnapshotFull)
+		lastSeq = c.wal.GetLastSeq()
 	}
+	walSeq := c.wal.GetLastSeq()
 	raftPtr := c.raftNode
 	c.mu.Unlock()
+	c.applyMu.Unlock()
+	defer cursor.Close()
 
-	// Phase 2: Write to disk (no lock, runs async)
-	snapshotBytes, _ := json.Marshal(data)
-	if err := c.snapshot.Write(data); err != nil {
+	// Phase 2: Stream to disk (no lock, runs async)
+	// The WAL must be durable through walSeq before a snapshot claims it
+	if err := c.wal.Sync(); err != nil {
+		return fmt.Errorf("failed to sync WAL before snapshot: %w", err)
+	}
+	stream := snapshot.Stream{
+		Kind:      cursor.Kind(),
+		LastSeq:   lastSeq,
+		JobCounts: cursor.Counts(),
+		Jobs:      cursor,
+	}
+	if raftPtr != nil {
+		// The header records the term of the last applied entry
+		term, _ := raftPtr.TermAt(int64(lastSeq))
+		stream.RaftTerm = uint64(term)
+	}
+	if err := c.snapshot.WriteStream(stream); err != nil {
 		return fmt.Errorf("failed to write snapshot: %w", err)
 	}
+	jobCount := cursor.Len()
+	cursor.Close() // Stop copying jobs changed from here on
+	// Older generations stay loadable, so the WAL keeps what follows the
+	// oldest one
+	retainedSeq := walSeq
+	if raftPtr == nil {
+		retainedSeq = c.snapshot.RetainedSeq()
+	}
+	c.mu.Lock()
+	c.coveredSeq = retainedSeq
+	c.mu.Unlock()
 
-	// Phase 3: Notify Raft for log compaction (if enabled)
+	// Phase 3: Notify Raft for log compaction (if enabled); the state
+	// lives in the snapshot file just written
 	if raftPtr != nil {
-		raftPtr.Snapshot(int64(data.LastSeq), snapshotBytes)
+		raftPtr.Snapshot(int64(lastSeq), nil)
 	}
 
-	// Phase 4: Rotate WAL (thread-safe operation)
+	// Phase 4: Rotate WAL (a segment switch in the writer, appends keep flowing)
 	// For Raft mode, we might not need WAL rotation the same way, but keeping it for now
 	if err := c.wal.Rotate(); err != nil {
 		return fmt.Errorf("failed to rotate WAL: %w", err)
 	}
 
+	// Phase 5: Delete WAL segments the snapshot now covers
+	if pruned, err := c.wal.Prune(retainedSeq); err != nil {
+		log.Warn("Failed to prune WAL segments", "error", err)
+	} else if pruned > 0 {
+		log.Info("WAL segments pruned", "count", pruned, "covered_seq", retainedSeq)
+	}
+
+	stats := c.snapshot.LastWrite()
 	log.Info("Snapshot taken (Partial)",
 		"duration", time.Since(start),
-		"jobs", len(data.Jobs))
+		"jobs", jobCount,
+		"bytes", stats.Size,
+		"compression", stats.Compression,
+		"compression_ratio", fmt.Sprintf("%.2f", stats.Ratio()),
+		"encode", stats.Encode)
 
 	return nil
 }
@@ -675,12 +977,18 @@ func (c *Controller) takeSnapshot() error {
 // Returns:
 //   - error: Enqueue failure error
 func (c *Controller) EnqueueJobs(jobs []types.Job) error {
+	c.applyMu.RLock()
+	defer c.applyMu.RUnlock()
+
 	// Phase 1: Batch write to WAL (no lock needed, WAL is thread-safe)
-	// This allows dispatch/timeout loops to continue running
+	// One fsync group for all jobs; this allows dispatch/timeout loops to
+	// continue running
+	entries := make([]wal.BatchEntry, len(jobs))
 	for i := range jobs {
-		if err := c.wal.Append(wal.EventEnqueue, &jobs[i]); err != nil {
-			return fmt.Errorf("failed to append ENQUEUE event for job %s: %w", jobs[i].ID, err)
-		}
+		entries[i] = wal.BatchEntry{Type: wal.EventEnqueue, Job: &jobs[i]}
+	}
+	if err := c.wal.AppendBatch(entries); err != nil {
+		return fmt.Errorf("failed to append ENQUEUE events for %d jobs: %w", len(jobs), err)
 	}
 
 	// Phase 2: Batch add to JobManager (lock held, but very fast)
@@ -696,6 +1004,26 @@ func (c *Controller) EnqueueJobs(jobs []types.Job) error {
 	return nil
 }
 
+// WatchEvents streams committed WAL events after afterSeq to handler
+// (change data capture, see wal.Subscribe)
+//
+// Parameters:
+//   - ctx: Ends the stream when done
+//   - afterSeq: Last seq the consumer already has (0 = everything retained)
+//   - handler: Called in seq order; may block without stalling the queue
+//
+// Returns:
+//   - error: wal.ErrCompacted if the history after afterSeq is gone,
+//     wal.ErrWALClosed on shutdown, ctx.Err() or the handler's error
+func (c *Controller) WatchEvents(ctx context.Context, afterSeq uint64, handler func(event *wal.Event) error) error {
+	return c.wal.Subscribe(ctx, afterSeq, handler)
+}
+
+// LastSeq returns the sequence number of the last committed WAL event
+func (c *Controller) LastSeq() uint64 {
+	return c.wal.GetLastSeq()
+}
+
 // GetStatus returns system status
 //
 // Returns:
@@ -707,12 +1035,15 @@ func (c *Controller) GetStatus() map[string]interface{} {
 	stats := c.jobManager.Stats()
 
 	return map[string]interface{}{
-		"uptime":    time.Since(c.startTime).String(),
-		"workers":   c.config.WorkerCount,
-		"pending":   stats["pending"],
-		"in_flight": stats["in_flight"],
-		"completed": stats["completed"],
-		"dead":      stats["dead"],
+		"uptime":       time.Since(c.startTime).String(),
+		"workers":      c.config.WorkerCount,
+		"pending":      stats["pending"],
+		"in_flight":    stats["in_flight"],
+		"completed":    stats["completed"],
+		"dead":         stats["dead"],
+		"durability":   c.wal.Durability(),
+		"group_commit": c.wal.GroupCommit(),
+		"encryption":   c.wal.Encryption(),
 	}
 }
 
@@ -1,12 +1,21 @@
 package controller
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/ChuLiYu/raft-recovery/internal/encryption"
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
 	"github.com/ChuLiYu/raft-recovery/internal/storage/wal"
+	"github.com/ChuLiYu/raft-recovery/internal/worker"
 	"github.com/ChuLiYu/raft-recovery/pkg/types"
 )
 
@@ -218,6 +227,14 @@ func TestGetStatus(t *testing.T) {
 	if _, ok := status["dead"]; !ok {
 		t.Error("status missing dead field")
 	}
+
+	if durability, _ := status["durability"].(string); !strings.HasPrefix(durability, "batch") {
+		t.Errorf("durability = %q, want the default batch mode", durability)
+	}
+
+	if encryption := status["encryption"]; encryption != "off" {
+		t.Errorf("encryption = %v, want off", encryption)
+	}
 }
 
 // TestStop tests graceful shutdown
@@ -673,6 +690,206 @@ func TestReplayWAL(t *testing.T) {
 	t.Logf("Statistics after replay: %+v", stats)
 }
 
+// TestReplayRebuildsJobsAfterSnapshot tests that jobs enqueued after the last
+// snapshot are reconstructed from self-contained WAL events
+func TestReplayRebuildsJobsAfterSnapshot(t *testing.T) {
+	controller1, tmpDir := createTestController(t)
+
+	job := types.Job{
+		ID:        "late-001",
+		Payload:   map[string]interface{}{"data": "after-snapshot"},
+		Timeout:   3 * time.Second,
+		CreatedAt: time.Now().UnixMilli(),
+	}
+	if err := controller1.wal.Append(wal.EventEnqueue, &job); err != nil {
+		t.Fatalf("WAL append failed: %v", err)
+	}
+	if err := controller1.wal.Append(wal.EventDispatch, &job); err != nil {
+		t.Fatalf("WAL append failed: %v", err)
+	}
+	controller1.wal.Close()
+
+	// Recover with no snapshot on disk
+	controller2, err := NewController(controller1.config)
+	if err != nil {
+		t.Fatalf("Failed to create controller2: %v", err)
+	}
+	defer cleanup(t, controller2, tmpDir)
+
+	if err := controller2.replayWAL(); err != nil {
+		t.Fatalf("WAL replay failed: %v", err)
+	}
+
+	restored := controller2.jobManager.GetJob("late-001")
+	if restored == nil {
+		t.Fatal("Job enqueued after snapshot was not rebuilt")
+	}
+	if restored.Status != types.StatusInFlight {
+		t.Errorf("Status = %v, want %v", restored.Status, types.StatusInFlight)
+	}
+	if restored.Payload["data"] != "after-snapshot" {
+		t.Errorf("Payload = %v, want data=after-snapshot", restored.Payload)
+	}
+	if restored.Timeout != 3*time.Second {
+		t.Errorf("Timeout = %v, want 3s", restored.Timeout)
+	}
+}
+
+// TestEncryptionAtRest tests that payloads never reach the disk in the clear
+// and that recovery needs the keys
+func TestEncryptionAtRest(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("TEST_CONTROLLER_KEYS", "k1:"+base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	config := Config{
+		WorkerCount:         1,
+		TaskTimeout:         2 * time.Second,
+		SnapshotInterval:    time.Minute,
+		WALPath:             filepath.Join(tmpDir, "test.wal"),
+		SnapshotPath:        filepath.Join(tmpDir, "test.snapshot"),
+		WALBufferSize:       10,
+		Encryption:          encryption.Config{KeyEnv: "TEST_CONTROLLER_KEYS"},
+		DisableDispatchLoop: true,
+	}
+
+	controller1, err := NewController(config)
+	if err != nil {
+		t.Fatalf("Failed to create controller: %v", err)
+	}
+	if err := controller1.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if got := controller1.GetStatus()["encryption"]; !strings.Contains(fmt.Sprint(got), `"k1"`) {
+		t.Errorf("encryption status = %v, want active key k1", got)
+	}
+	if err := controller1.EnqueueJobs([]types.Job{{ID: "enc-001", Payload: map[string]interface{}{"card": "4111-snap"}}}); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	if err := controller1.takeSnapshot(); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	if err := controller1.EnqueueJobs([]types.Job{{ID: "enc-002", Payload: map[string]interface{}{"card": "4111-wal"}}}); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	controller1.Stop()
+
+	files, _ := filepath.Glob(filepath.Join(tmpDir, "*"))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		if strings.Contains(string(data), "4111") {
+			t.Errorf("%s contains a plaintext payload", filepath.Base(file))
+		}
+	}
+
+	// Recover with the keys
+	controller2, err := NewController(config)
+	if err != nil {
+		t.Fatalf("Failed to create controller2: %v", err)
+	}
+	if err := controller2.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	for id, want := range map[types.JobID]string{"enc-001": "4111-snap", "enc-002": "4111-wal"} {
+		job := controller2.jobManager.GetJob(id)
+		if job == nil || job.Payload["card"] != want {
+			t.Errorf("job %s = %+v, want payload card=%s", id, job, want)
+		}
+	}
+	controller2.Stop()
+
+	// Recover without the keys
+	config.Encryption = encryption.Config{}
+	controller3, err := NewController(config)
+	if err != nil {
+		t.Fatalf("Failed to create controller3: %v", err)
+	}
+	defer controller3.wal.Close()
+	if err := controller3.Start(); !errors.Is(err, encryption.ErrKeyNotFound) {
+		t.Errorf("Start without keys = %v, want ErrKeyNotFound", err)
+	}
+}
+
+// TestRecoveryAcrossWALSegments tests that recovery combines the snapshot with
+// every segment written after it and that covered segments are pruned
+func TestRecoveryAcrossWALSegments(t *testing.T) {
+	controller1, tmpDir := createTestController(t)
+	controller1.wal.Close()
+
+	config := controller1.config
+	config.WALMaxSegmentSize = 1024 // Roll over every few events
+	controller1, err := NewController(config)
+	if err != nil {
+		t.Fatalf("Failed to create controller: %v", err)
+	}
+
+	makeJobs := func(from, to int) []types.Job {
+		jobs := make([]types.Job, 0, to-from+1)
+		for i := from; i <= to; i++ {
+			jobs = append(jobs, types.Job{
+				ID:      types.JobID(fmt.Sprintf("seg-%03d", i)),
+				Payload: map[string]interface{}{"index": i},
+			})
+		}
+		return jobs
+	}
+
+	if err := controller1.EnqueueJobs(makeJobs(1, 30)); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	if err := controller1.takeSnapshot(); err != nil {
+		t.Fatalf("Failed to create snapshot: %v", err)
+	}
+	snapshotSeq := controller1.wal.GetLastSeq()
+
+	// Everything up to the snapshot was sealed and pruned (retention 0),
+	// except the newest segment, which keeps the last seq while the active
+	// segment is empty
+	segments, err := controller1.wal.Segments()
+	if err != nil {
+		t.Fatalf("Failed to list segments: %v", err)
+	}
+	for i, seg := range segments {
+		if i < len(segments)-2 && seg.StartSeq <= snapshotSeq {
+			t.Errorf("Segment %s is covered by the snapshot but was not pruned", seg.Path)
+		}
+	}
+
+	// More jobs after the snapshot, spanning several new segments, then crash
+	if err := controller1.EnqueueJobs(makeJobs(31, 60)); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	controller1.wal.Close()
+
+	controller2, err := NewController(config)
+	if err != nil {
+		t.Fatalf("Failed to create controller2: %v", err)
+	}
+	defer cleanup(t, controller2, tmpDir)
+
+	if err := controller2.loadSnapshot(); err != nil {
+		t.Fatalf("loadSnapshot failed: %v", err)
+	}
+	replayed := 0
+	if err := controller2.wal.ReplayFrom(controller2.replayFrom, func(e *wal.Event) error {
+		replayed++
+		return nil
+	}); err != nil {
+		t.Fatalf("ReplayFrom failed: %v", err)
+	}
+	if replayed != 30 {
+		t.Errorf("Replayed %d events after the snapshot, want 30", replayed)
+	}
+	if err := controller2.replayWAL(); err != nil {
+		t.Fatalf("replayWAL failed: %v", err)
+	}
+
+	if total := controller2.GetTotalJobs(); total != 60 {
+		t.Errorf("Total jobs after recovery = %d, want 60", total)
+	}
+}
+
 // TestIdempotency tests idempotency (repeated replay without errors)
 func TestIdempotency(t *testing.T) {
 	controller, tmpDir := createTestController(t)
@@ -817,3 +1034,806 @@ func TestEnqueueAfterStop(t *testing.T) {
 		t.Logf("Enqueue after stop correctly returned error: %v", err)
 	}
 }
+
+// ============================================================================
+// Point-in-Time Recovery Tests
+// ============================================================================
+
+// enqueueRange enqueues jobs pitr-<from>..pitr-<to>
+func enqueueRange(t *testing.T, controller *Controller, from, to int) {
+	t.Helper()
+
+	jobs := make([]types.Job, 0, to-from+1)
+	for i := from; i <= to; i++ {
+		jobs = append(jobs, types.Job{ID: types.JobID(fmt.Sprintf("pitr-%03d", i))})
+	}
+	if err := controller.EnqueueJobs(jobs); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+}
+
+// TestParseRecoveryTarget tests parsing --recover-to values
+func TestParseRecoveryTarget(t *testing.T) {
+	target, err := ParseRecoveryTarget("42")
+	if err != nil || target.Seq != 42 || !target.Time.IsZero() {
+		t.Errorf("ParseRecoveryTarget(42) = %+v, %v", target, err)
+	}
+
+	target, err = ParseRecoveryTarget("2024-05-01T12:00:00Z")
+	if err != nil || target.Seq != 0 || !target.Time.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("ParseRecoveryTarget(time) = %+v, %v", target, err)
+	}
+
+	for _, bad := range []string{"0", "-1", "yesterday", ""} {
+		if _, err := ParseRecoveryTarget(bad); err == nil {
+			t.Errorf("ParseRecoveryTarget(%q) should fail", bad)
+		}
+	}
+}
+
+// TestPointInTimeRecoveryToSeq tests rolling back past the latest snapshot
+// and that the rollback survives a normal restart
+func TestPointInTimeRecoveryToSeq(t *testing.T) {
+	controller1, tmpDir := createTestController(t)
+	controller1.wal.Close()
+
+	// Keep the WAL from before the latest snapshot
+	config := controller1.config
+	config.WALRetention = time.Hour
+	controller1, err := NewController(config)
+	if err != nil {
+		t.Fatalf("Failed to create controller: %v", err)
+	}
+
+	enqueueRange(t, controller1, 1, 5)
+	if err := controller1.takeSnapshot(); err != nil {
+		t.Fatalf("Failed to create snapshot: %v", err)
+	}
+	enqueueRange(t, controller1, 6, 10)
+	if err := controller1.takeSnapshot(); err != nil {
+		t.Fatalf("Failed to create snapshot: %v", err)
+	}
+	controller1.wal.Close()
+
+	// Seq 7 is before the current snapshot (seq 10): recovery falls back to
+	// an empty state and replays the WAL
+	config.RecoverTo = RecoveryTarget{Seq: 7}
+	controller2, err := NewController(config)
+	if err != nil {
+		t.Fatalf("Failed to create controller2: %v", err)
+	}
+	if err := controller2.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if total := controller2.GetTotalJobs(); total != 7 {
+		t.Errorf("Total jobs after PITR = %d, want 7", total)
+	}
+	if controller2.jobManager.GetJob("pitr-008") != nil {
+		t.Error("Job enqueued after the target was recovered")
+	}
+	archives, _ := filepath.Glob(config.WALPath + ".pitr-*")
+	if len(archives) != 1 {
+		t.Errorf("Found %d PITR archives, want 1", len(archives))
+	}
+	controller2.Stop()
+
+	// A normal restart keeps the rolled-back state
+	config.RecoverTo = RecoveryTarget{}
+	controller3, err := NewController(config)
+	if err != nil {
+		t.Fatalf("Failed to create controller3: %v", err)
+	}
+	defer cleanup(t, controller3, tmpDir)
+	if err := controller3.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if total := controller3.GetTotalJobs(); total != 7 {
+		t.Errorf("Total jobs after restart = %d, want 7", total)
+	}
+}
+
+// TestPointInTimeRecoveryNeedsWAL tests that recovery refuses to skip over
+// pruned WAL history
+func TestPointInTimeRecoveryNeedsWAL(t *testing.T) {
+	controller1, tmpDir := createTestController(t)
+	config := controller1.config
+
+	enqueueRange(t, controller1, 1, 5)
+	if err := controller1.takeSnapshot(); err != nil {
+		t.Fatalf("Failed to create snapshot: %v", err)
+	}
+	enqueueRange(t, controller1, 6, 10)
+	if err := controller1.takeSnapshot(); err != nil {
+		t.Fatalf("Failed to create snapshot: %v", err)
+	}
+	controller1.wal.Close()
+
+	// Retention 0: seqs 1-5 are gone and no snapshot covers seq 3
+	config.RecoverTo = RecoveryTarget{Seq: 3}
+	controller2, err := NewController(config)
+	if err != nil {
+		t.Fatalf("Failed to create controller2: %v", err)
+	}
+	defer cleanup(t, controller2, tmpDir)
+	if err := controller2.Start(); err == nil {
+		t.Error("Start should fail when the WAL history was pruned")
+	}
+}
+
+// TestPointInTimeRecoveryToTime tests recovering to a timestamp from a
+// snapshot taken before it
+func TestPointInTimeRecoveryToTime(t *testing.T) {
+	controller1, tmpDir := createTestController(t)
+	config := controller1.config
+
+	enqueueRange(t, controller1, 1, 3)
+	if err := controller1.takeSnapshot(); err != nil {
+		t.Fatalf("Failed to create snapshot: %v", err)
+	}
+	enqueueRange(t, controller1, 4, 5)
+	time.Sleep(20 * time.Millisecond)
+	target := time.Now()
+	time.Sleep(20 * time.Millisecond)
+	enqueueRange(t, controller1, 6, 9)
+	controller1.wal.Close()
+
+	config.RecoverTo = RecoveryTarget{Time: target}
+	controller2, err := NewController(config)
+	if err != nil {
+		t.Fatalf("Failed to create controller2: %v", err)
+	}
+	defer cleanup(t, controller2, tmpDir)
+	if err := controller2.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if total := controller2.GetTotalJobs(); total != 5 {
+		t.Errorf("Total jobs after PITR = %d, want 5", total)
+	}
+	if last := controller2.wal.GetLastSeq(); last < 5 {
+		t.Errorf("WAL last seq = %d, want >= 5", last)
+	}
+}
+
+// ============================================================================
+// WAL Compaction Tests
+// ============================================================================
+
+// TestWALCompaction tests that finished job histories leave the WAL while
+// recovery still sees every job
+func TestWALCompaction(t *testing.T) {
+	controller1, tmpDir := createTestController(t)
+	controller1.wal.Close()
+
+	config := controller1.config
+	config.WALRetention = time.Hour // Keep covered segments for compaction
+	controller1, err := NewController(config)
+	if err != nil {
+		t.Fatalf("Failed to create controller: %v", err)
+	}
+
+	// Five jobs run to completion, one stays pending
+	enqueueRange(t, controller1, 1, 6)
+	for i := 1; i <= 5; i++ {
+		job := controller1.jobManager.GetJob(types.JobID(fmt.Sprintf("pitr-%03d", i)))
+		for _, eventType := range []wal.EventType{wal.EventDispatch, wal.EventAck} {
+			if err := controller1.wal.Append(eventType, job); err != nil {
+				t.Fatalf("WAL append failed: %v", err)
+			}
+		}
+		controller1.mu.Lock()
+		controller1.jobManager.MarkInFlight(job.ID, time.Now().Add(time.Minute))
+		controller1.jobManager.MarkCompleted(job.ID)
+		controller1.mu.Unlock()
+	}
+	if err := controller1.takeSnapshot(); err != nil {
+		t.Fatalf("Failed to create snapshot: %v", err)
+	}
+
+	// Nothing to compact until the segment is no longer the newest one
+	if err := controller1.compactWAL(); err != nil {
+		t.Fatalf("compactWAL failed: %v", err)
+	}
+	enqueueRange(t, controller1, 7, 7)
+	if err := controller1.takeSnapshot(); err != nil {
+		t.Fatalf("Failed to create snapshot: %v", err)
+	}
+	if err := controller1.compactWAL(); err != nil {
+		t.Fatalf("compactWAL failed: %v", err)
+	}
+
+	var remaining []types.JobID
+	if err := controller1.wal.Replay(func(e *wal.Event) error {
+		remaining = append(remaining, e.JobID)
+		return nil
+	}); err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if len(remaining) != 2 || remaining[0] != "pitr-006" || remaining[1] != "pitr-007" {
+		t.Errorf("Events left after compaction = %v, want pitr-006 and pitr-007", remaining)
+	}
+	controller1.wal.Close()
+
+	controller2, err := NewController(config)
+	if err != nil {
+		t.Fatalf("Failed to create controller2: %v", err)
+	}
+	defer cleanup(t, controller2, tmpDir)
+	if err := controller2.loadSnapshot(); err != nil {
+		t.Fatalf("loadSnapshot failed: %v", err)
+	}
+	if err := controller2.replayWAL(); err != nil {
+		t.Fatalf("replayWAL failed: %v", err)
+	}
+	if total := controller2.GetTotalJobs(); total != 7 {
+		t.Errorf("Total jobs after recovery = %d, want 7", total)
+	}
+	if !controller2.jobManager.IsCompleted("pitr-001") {
+		t.Error("Completed job should be restored from the snapshot")
+	}
+}
+
+// TestCrashRecoveryOnMemFS cuts power without stopping the controller:
+// every job whose enqueue was acknowledged is recovered
+func TestCrashRecoveryOnMemFS(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	config := Config{
+		WorkerCount:         1,
+		TaskTimeout:         2 * time.Second,
+		SnapshotInterval:    time.Minute,
+		WALPath:             "/data/test.wal",
+		SnapshotPath:        "/data/test.snapshot",
+		WALBufferSize:       10,
+		WALMaxSegmentSize:   1024,
+		DisableDispatchLoop: true,
+		FS:                  fsys,
+	}
+
+	controller1, err := NewController(config)
+	if err != nil {
+		t.Fatalf("Failed to create controller: %v", err)
+	}
+	if err := controller1.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	enqueue := func(from, to int) {
+		for i := from; i < to; i++ {
+			if err := controller1.EnqueueJobs([]types.Job{{ID: types.JobID(fmt.Sprintf("crash-%03d", i))}}); err != nil {
+				t.Fatalf("Enqueue failed: %v", err)
+			}
+		}
+	}
+	enqueue(0, 20)
+	if err := controller1.takeSnapshot(); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	enqueue(20, 40)
+
+	config.FS = fsys.Crash()
+	controller1.Stop()
+
+	controller2, err := NewController(config)
+	if err != nil {
+		t.Fatalf("Failed to create controller2: %v", err)
+	}
+	if err := controller2.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer controller2.Stop()
+	for i := 0; i < 40; i++ {
+		id := types.JobID(fmt.Sprintf("crash-%03d", i))
+		if controller2.jobManager.GetJob(id) == nil {
+			t.Errorf("acknowledged job %s lost in crash", id)
+		}
+	}
+}
+
+// TestEnqueueJobsIsAllOrNothing verifies a failed WAL write enqueues none
+// of the batch
+func TestEnqueueJobsIsAllOrNothing(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	controller, err := NewController(Config{
+		WorkerCount:         1,
+		TaskTimeout:         2 * time.Second,
+		SnapshotInterval:    time.Minute,
+		WALPath:             "/data/test.wal",
+		SnapshotPath:        "/data/test.snapshot",
+		WALBufferSize:       10,
+		DisableDispatchLoop: true,
+		FS:                  fsys,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create controller: %v", err)
+	}
+	if err := controller.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer controller.Stop()
+
+	jobs := make([]types.Job, 25)
+	for i := range jobs {
+		jobs[i] = types.Job{ID: types.JobID(fmt.Sprintf("batch-%03d", i))}
+	}
+	fsys.Inject(vfs.Fault{Op: vfs.OpSync, Path: "/data/test.wal", Times: 1})
+	if err := controller.EnqueueJobs(jobs); err == nil {
+		t.Fatal("EnqueueJobs should fail when the WAL cannot sync")
+	}
+	if seq := controller.wal.GetLastSeq(); seq != 0 {
+		t.Errorf("WAL last seq = %d after failed batch, want 0", seq)
+	}
+
+	if err := controller.EnqueueJobs(jobs); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	controller.mu.Lock()
+	stats := controller.jobManager.Stats()
+	controller.mu.Unlock()
+	if stats["pending"] != 25 {
+		t.Errorf("pending job count = %d, want 25", stats["pending"])
+	}
+	if seq := controller.wal.GetLastSeq(); seq != 25 {
+		t.Errorf("WAL last seq = %d, want 25", seq)
+	}
+}
+
+// recoverQueue recovers a controller the way Start does and returns the
+// pending queue in dispatch order
+func recoverQueue(t *testing.T, controller *Controller) []types.JobID {
+	t.Helper()
+	if err := controller.loadSnapshot(); err != nil {
+		t.Fatalf("loadSnapshot failed: %v", err)
+	}
+	if err := controller.replayWAL(); err != nil {
+		t.Fatalf("replayWAL failed: %v", err)
+	}
+	controller.jobManager.CompactQueue()
+
+	var queue []types.JobID
+	for job := controller.jobManager.PopPending(); job != nil; job = controller.jobManager.PopPending() {
+		queue = append(queue, job.ID)
+	}
+	return queue
+}
+
+// TestParallelReplayMatchesSequential verifies the recovery pipeline
+// rebuilds the same jobs and queue order as a sequential replay
+func TestParallelReplayMatchesSequential(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	config := Config{
+		WorkerCount:         1,
+		TaskTimeout:         time.Minute,
+		SnapshotInterval:    time.Hour,
+		WALPath:             "/data/test.wal",
+		SnapshotPath:        "/data/test.snapshot",
+		WALBufferSize:       100,
+		DisableDispatchLoop: true,
+		FS:                  fsys,
+	}
+	controller1, err := NewController(config)
+	if err != nil {
+		t.Fatalf("Failed to create controller: %v", err)
+	}
+	appendEvents := func(events ...wal.BatchEntry) {
+		t.Helper()
+		if err := controller1.wal.AppendBatch(events); err != nil {
+			t.Fatalf("AppendBatch failed: %v", err)
+		}
+	}
+	newJob := func(id string) *types.Job {
+		return &types.Job{ID: types.JobID(id), Payload: map[string]interface{}{"data": strings.Repeat("x", 100)}}
+	}
+
+	// Snapshot with one pending, one in-flight and one completed job
+	pending, inFlight, done := newJob("snap-pending"), newJob("snap-inflight"), newJob("snap-done")
+	appendEvents(
+		wal.BatchEntry{Type: wal.EventEnqueue, Job: pending},
+		wal.BatchEntry{Type: wal.EventEnqueue, Job: inFlight},
+		wal.BatchEntry{Type: wal.EventEnqueue, Job: done},
+		wal.BatchEntry{Type: wal.EventDispatch, Job: inFlight},
+		wal.BatchEntry{Type: wal.EventDispatch, Job: done},
+		wal.BatchEntry{Type: wal.EventAck, Job: done},
+	)
+	if err := controller1.replayWAL(); err != nil {
+		t.Fatalf("replayWAL failed: %v", err)
+	}
+	if err := controller1.takeSnapshot(); err != nil {
+		t.Fatalf("Failed to create snapshot: %v", err)
+	}
+
+	// Interleaved lifecycles after the snapshot, in rounds of shuffled jobs
+	const jobCount = 5000
+	jobs := make([]*types.Job, jobCount)
+	for i := range jobs {
+		jobs[i] = newJob(fmt.Sprintf("job-%05d", i))
+	}
+	rounds := [][]wal.EventType{
+		{wal.EventEnqueue, wal.EventEnqueue, wal.EventEnqueue, wal.EventEnqueue, wal.EventEnqueue},
+		{"", wal.EventDispatch, wal.EventDispatch, wal.EventDispatch, wal.EventDispatch},
+		{"", wal.EventAck, wal.EventRetry, wal.EventTimeout, wal.EventDead},
+		{"", "", wal.EventDispatch, wal.EventDispatch, ""},
+		{"", "", "", wal.EventRetry, ""},
+	}
+	for round, kinds := range rounds {
+		var batch []wal.BatchEntry
+		for _, i := range rand.New(rand.NewSource(int64(round))).Perm(jobCount) {
+			if eventType := kinds[i%5]; eventType != "" {
+				batch = append(batch, wal.BatchEntry{Type: eventType, Job: jobs[i]})
+			}
+		}
+		appendEvents(batch...)
+	}
+	appendEvents(
+		wal.BatchEntry{Type: wal.EventDispatch, Job: pending},
+		wal.BatchEntry{Type: wal.EventRetry, Job: pending},
+		wal.BatchEntry{Type: wal.EventRetry, Job: inFlight},
+	)
+	controller1.wal.Close()
+
+	recovered := make([]*Controller, 0, 2)
+	queues := make([][]types.JobID, 0, 2)
+	for _, workers := range []int{1, 4} {
+		config.RecoveryWorkers = workers
+		controller, err := NewController(config)
+		if err != nil {
+			t.Fatalf("Failed to create controller: %v", err)
+		}
+		queues = append(queues, recoverQueue(t, controller))
+		controller.wal.Close()
+		recovered = append(recovered, controller)
+	}
+
+	sequential, parallel := recovered[0].jobManager.Snapshot().Jobs, recovered[1].jobManager.Snapshot().Jobs
+	if len(sequential) != jobCount+3 || len(parallel) != len(sequential) {
+		t.Fatalf("job count: sequential %d, parallel %d, want %d", len(sequential), len(parallel), jobCount+3)
+	}
+	for id, want := range sequential {
+		got := parallel[id]
+		if got == nil || got.Status != want.Status || got.Attempt != want.Attempt {
+			t.Errorf("job %s: parallel %+v, sequential %+v", id, got, want)
+		}
+	}
+	if fmt.Sprint(queues[0]) != fmt.Sprint(queues[1]) {
+		t.Errorf("queue order differs:\nsequential %v\nparallel   %v", queues[0], queues[1])
+	}
+	if len(queues[0]) == 0 || queues[0][0] != "snap-pending" {
+		t.Errorf("snapshot job not first in queue: %v", queues[0][:min(3, len(queues[0]))])
+	}
+}
+
+// TestCheckpointCrashAtEveryStep crashes a snapshot after each of its file
+// system operations and verifies recovery neither loses nor re-applies
+// events
+func TestCheckpointCrashAtEveryStep(t *testing.T) {
+	for step := 0; ; step++ {
+		if step > 500 {
+			t.Fatal("checkpoint never completed")
+		}
+		fsys := vfs.NewMemFS()
+		config := Config{
+			WorkerCount:         1,
+			TaskTimeout:         time.Minute,
+			SnapshotInterval:    time.Hour,
+			WALPath:             "/data/test.wal",
+			SnapshotPath:        "/data/test.snapshot",
+			WALBufferSize:       10,
+			DisableDispatchLoop: true,
+			FS:                  fsys,
+		}
+		controller1, err := NewController(config)
+		if err != nil {
+			t.Fatalf("Failed to create controller: %v", err)
+		}
+		enqueueRange(t, controller1, 0, 9)
+		if err := controller1.takeSnapshot(); err != nil {
+			t.Fatalf("Snapshot failed: %v", err)
+		}
+		enqueueRange(t, controller1, 10, 19)
+
+		// Retry jobs 0-4 and complete jobs 5-9, so a double replay shows
+		for i := 0; i < 10; i++ {
+			last := wal.EventRetry
+			if i >= 5 {
+				last = wal.EventAck
+			}
+			for _, eventType := range []wal.EventType{wal.EventDispatch, last} {
+				id := types.JobID(fmt.Sprintf("pitr-%03d", i))
+				job := &types.Job{ID: id}
+				if eventType == wal.EventRetry {
+					job.Attempt = 1 // Records carry the attempt after the retry
+				}
+				if err := controller1.wal.AppendBatch([]wal.BatchEntry{{Type: eventType, Job: job}}); err != nil {
+					t.Fatalf("AppendBatch failed: %v", err)
+				}
+				if err := controller1.applyReplayedEvent(&wal.Event{Type: eventType, JobID: id}); err != nil {
+					t.Fatalf("apply failed: %v", err)
+				}
+			}
+		}
+		want := controller1.jobManager.Snapshot().Jobs
+
+		// Every operation from the step on fails, then the power goes out
+		fsys.Inject(vfs.Fault{Op: vfs.OpAny, After: step})
+		snapshotErr := controller1.takeSnapshot()
+		_, probeErr := fsys.OpenFile("/data/probe", os.O_CREATE|os.O_WRONLY, 0644)
+		crashed := fsys.Crash()
+		fsys.ClearFaults()
+		controller1.wal.Close()
+
+		recover := func() *Controller {
+			t.Helper()
+			config.FS = crashed
+			controller, err := NewController(config)
+			if err != nil {
+				t.Fatalf("step %d: failed to create controller: %v", step, err)
+			}
+			if err := controller.loadSnapshot(); err != nil {
+				t.Fatalf("step %d: loadSnapshot failed: %v", step, err)
+			}
+			if err := controller.replayWAL(); err != nil {
+				t.Fatalf("step %d: replayWAL failed: %v", step, err)
+			}
+			return controller
+		}
+		controller2 := recover()
+		got := controller2.jobManager.Snapshot().Jobs
+		if len(got) != len(want) {
+			t.Errorf("step %d: recovered %d jobs, want %d", step, len(got), len(want))
+		}
+		for id, job := range want {
+			if g := got[id]; g == nil || g.Status != job.Status || g.Attempt != job.Attempt {
+				t.Errorf("step %d: job %s recovered as %+v, want %+v", step, id, g, job)
+			}
+		}
+
+		// New events after recovery must survive the next recovery
+		enqueueRange(t, controller2, 20, 24)
+		controller2.wal.Close()
+		controller3 := recover()
+		if total := controller3.GetTotalJobs(); total != len(want)+5 {
+			t.Errorf("step %d: second recovery has %d jobs, want %d", step, total, len(want)+5)
+		}
+		controller3.wal.Close()
+
+		if probeErr == nil {
+			if snapshotErr != nil {
+				t.Errorf("snapshot failed without a fault: %v", snapshotErr)
+			}
+			break // The fault never fired: every step is covered
+		}
+	}
+}
+
+// TestRecoveryRestoresAttemptsAndDeadlines drives jobs through failures,
+// timeouts and dead letters, crashes, and verifies replay restores the
+// logged attempt counts and deadlines
+func TestRecoveryRestoresAttemptsAndDeadlines(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	config := Config{
+		WorkerCount:         1,
+		TaskTimeout:         time.Minute,
+		SnapshotInterval:    time.Hour,
+		MaxRetry:            3,
+		WALPath:             "/data/test.wal",
+		SnapshotPath:        "/data/test.snapshot",
+		WALBufferSize:       10,
+		DisableDispatchLoop: true,
+		FS:                  fsys,
+	}
+	controller1, err := NewController(config)
+	if err != nil {
+		t.Fatalf("Failed to create controller: %v", err)
+	}
+
+	ctx := context.Background()
+	poll := func(n int) {
+		t.Helper()
+		if jobs, err := controller1.Poll(ctx, n); err != nil || len(jobs) != n {
+			t.Fatalf("Poll(%d) = %d jobs, %v", n, len(jobs), err)
+		}
+	}
+	fail := func(id types.JobID) { controller1.handleResult(worker.Result{JobID: id}) }
+	timeout := func() { controller1.expireJobs(time.Now().Add(time.Hour)) }
+
+	enqueueRange(t, controller1, 0, 3)
+	poll(4)
+	fail("pitr-000")
+	timeout() // 1-3: TIMEOUT
+	poll(4)
+	controller1.handleResult(worker.Result{JobID: "pitr-003", Success: true})
+	fail("pitr-000")
+	timeout() // 1-2: TIMEOUT
+	poll(3)
+	fail("pitr-000") // DEAD after RETRY
+	timeout()        // 1-2: DEAD after TIMEOUT
+	enqueueRange(t, controller1, 4, 5)
+	poll(2)
+	fail("pitr-005")
+
+	want := controller1.jobManager.Snapshot().Jobs
+	expect := map[types.JobID]struct {
+		status   types.JobStatus
+		attempt  int
+		deadline bool
+	}{
+		"pitr-000": {types.StatusDead, 3, false},
+		"pitr-001": {types.StatusDead, 3, false},
+		"pitr-002": {types.StatusDead, 3, false},
+		"pitr-003": {types.StatusCompleted, 1, false},
+		"pitr-004": {types.StatusInFlight, 0, true},
+		"pitr-005": {types.StatusPending, 1, false},
+	}
+	for id, e := range expect {
+		job := want[id]
+		if job == nil || job.Status != e.status || job.Attempt != e.attempt || (job.Deadline != nil) != e.deadline {
+			t.Fatalf("live job %s = %+v, want %s attempt %d", id, job, e.status, e.attempt)
+		}
+	}
+
+	crashed := fsys.Crash()
+	controller1.wal.Close()
+
+	for _, workers := range []int{1, 4} {
+		config.FS = crashed
+		config.RecoveryWorkers = workers
+		controller2, err := NewController(config)
+		if err != nil {
+			t.Fatalf("Failed to create controller: %v", err)
+		}
+		if err := controller2.loadSnapshot(); err != nil {
+			t.Fatalf("loadSnapshot failed: %v", err)
+		}
+		if err := controller2.replayWAL(); err != nil {
+			t.Fatalf("replayWAL failed: %v", err)
+		}
+		got := controller2.jobManager.Snapshot().Jobs
+		if len(got) != len(want) {
+			t.Errorf("workers %d: recovered %d jobs, want %d", workers, len(got), len(want))
+		}
+		for id, job := range want {
+			g := got[id]
+			if g == nil || g.Status != job.Status || g.Attempt != job.Attempt {
+				t.Errorf("workers %d: job %s recovered as %+v, want %+v", workers, id, g, job)
+				continue
+			}
+			if fmt.Sprint(deref(g.Deadline)) != fmt.Sprint(deref(job.Deadline)) {
+				t.Errorf("workers %d: job %s deadline %v, want %v", workers, id, deref(g.Deadline), deref(job.Deadline))
+			}
+		}
+		controller2.wal.Close()
+	}
+}
+
+// deref returns *p, or nil for a nil pointer
+func deref(p *int64) interface{} {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+// TestRecoveryAdvancesPastSnapshot verifies a WAL that lost events the
+// snapshot covers does not number new events inside the snapshot
+func TestRecoveryAdvancesPastSnapshot(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	config := Config{
+		WorkerCount:         1,
+		TaskTimeout:         time.Minute,
+		SnapshotInterval:    time.Hour,
+		WALPath:             "/data/test.wal",
+		SnapshotPath:        "/data/test.snapshot",
+		WALBufferSize:       10,
+		WALSyncMode:         "none",
+		DisableDispatchLoop: true,
+		FS:                  fsys,
+	}
+	controller1, err := NewController(config)
+	if err != nil {
+		t.Fatalf("Failed to create controller: %v", err)
+	}
+	enqueueRange(t, controller1, 0, 9)
+	if err := controller1.takeSnapshot(); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	config.FS = fsys.Crash() // The snapshot is synced, the WAL is not
+	controller1.wal.Close()
+
+	controller2, err := NewController(config)
+	if err != nil {
+		t.Fatalf("Failed to create controller: %v", err)
+	}
+	if err := controller2.loadSnapshot(); err != nil {
+		t.Fatalf("loadSnapshot failed: %v", err)
+	}
+	if seq := controller2.wal.GetLastSeq(); seq != 10 {
+		t.Errorf("WAL last seq = %d after loading the snapshot, want 10", seq)
+	}
+	enqueueRange(t, controller2, 10, 14)
+	controller2.wal.Close()
+
+	controller3, err := NewController(config)
+	if err != nil {
+		t.Fatalf("Failed to create controller: %v", err)
+	}
+	defer controller3.wal.Close()
+	if err := controller3.loadSnapshot(); err != nil {
+		t.Fatalf("loadSnapshot failed: %v", err)
+	}
+	if err := controller3.replayWAL(); err != nil {
+		t.Fatalf("replayWAL failed: %v", err)
+	}
+	if total := controller3.GetTotalJobs(); total != 15 {
+		t.Errorf("recovered %d jobs, want 15", total)
+	}
+	if seq := controller3.wal.GetLastSeq(); seq != 15 {
+		t.Errorf("WAL last seq = %d, want 15", seq)
+	}
+}
+
+// TestSnapshotFallbackReplaysWAL verifies a corrupted newest snapshot falls
+// back to the previous generation and the WAL still covers the difference
+func TestSnapshotFallbackReplaysWAL(t *testing.T) {
+	for _, retention := range []int{1, 2} {
+		fsys := vfs.NewMemFS()
+		config := Config{
+			WorkerCount:         1,
+			TaskTimeout:         time.Minute,
+			SnapshotInterval:    time.Hour,
+			WALPath:             "/data/test.wal",
+			SnapshotPath:        "/data/test.snapshot",
+			WALBufferSize:       10,
+			WALMaxSegmentSize:   512,
+			SnapshotRetention:   retention,
+			DisableDispatchLoop: true,
+			FS:                  fsys,
+		}
+		controller1, err := NewController(config)
+		if err != nil {
+			t.Fatalf("Failed to create controller: %v", err)
+		}
+		// One job per batch, so every snapshot covers several segments
+		for i := 0; i < 25; i++ {
+			enqueueRange(t, controller1, i, i)
+			if i == 9 || i == 19 {
+				if err := controller1.takeSnapshot(); err != nil {
+					t.Fatalf("Snapshot failed: %v", err)
+				}
+			}
+		}
+		controller1.wal.Close()
+
+		// Flip one byte of the newest snapshot
+		raw, err := vfs.ReadFile(fsys, config.SnapshotPath)
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		raw[len(raw)/2] ^= 0x20
+		if err := vfs.WriteFile(fsys, config.SnapshotPath, raw, 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+
+		controller2, err := NewController(config)
+		if err != nil {
+			t.Fatalf("Failed to create controller: %v", err)
+		}
+		err = controller2.loadSnapshot()
+		if retention == 1 {
+			if err == nil {
+				t.Error("loading a corrupted snapshot without older generations should fail")
+			}
+			controller2.wal.Close()
+			continue
+		}
+		if err != nil {
+			t.Fatalf("loadSnapshot failed: %v", err)
+		}
+		if controller2.replayFrom != 10 {
+			t.Errorf("replaying from seq %d, want 10 (previous generation)", controller2.replayFrom)
+		}
+		if err := controller2.replayWAL(); err != nil {
+			t.Fatalf("replayWAL failed: %v", err)
+		}
+		if total := controller2.GetTotalJobs(); total != 25 {
+			t.Errorf("recovered %d jobs, want 25", total)
+		}
+		controller2.wal.Close()
+	}
+}
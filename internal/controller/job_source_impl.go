@@ -47,9 +47,14 @@ func (c *Controller) Poll(ctx context.Context, maxJobs int) ([]*types.Job, error
 	
 	deadline := time.Now().Add(c.config.TaskTimeout)
 
-	for _, job := range jobs {
-		// 1. Write WAL (Dispatch Event)
-		if err := c.wal.Append(wal.EventDispatch, job); err != nil {
+	// 1. Write WAL (Dispatch Events with the deadline), sharing fsync groups
+	futures := make([]*wal.AppendFuture, len(jobs))
+	for i, job := range jobs {
+		futures[i] = c.wal.AppendAsync(wal.EventDispatch, dispatched(job, deadline))
+	}
+
+	for i, job := range jobs {
+		if err := futures[i].Wait(); err != nil {
 			log.Error("Failed to append DISPATCH event during Poll", "jobID", job.ID, "error", err)
 			// If WAL fails, we shouldn't return this job to worker? 
 			// For now, continue best effort.
@@ -0,0 +1,224 @@
+// ============================================================================
+// Beaver-Raft Controller - Point-in-Time Recovery
+// ============================================================================
+//
+// Package: internal/controller
+// File: recovery.go
+// Purpose: Roll the queue back to its state at a given WAL seq or time
+//
+// Flow (Config.RecoverTo set, standalone mode only):
+//   1. Load the newest snapshot at or before the target (current snapshot
+//      or a timestamped backup), or start empty if there is none
+//   2. Replay the WAL (all retained segments) from that snapshot, stopping
+//      at the first event past the target
+//   3. Cut the WAL back to the last applied event; the discarded events
+//      are archived next to the WAL as <wal>.pitr-<time>
+//   4. After the usual requeue step, back up the current snapshot and
+//      write the recovered state as the new one
+//
+// The WAL since the chosen snapshot must still be on disk or in the WAL
+// archive and must not be compacted, so recovering far back needs a long
+// enough wal.retention_seconds (or wal.archive) and wal.compact_after_seconds. If the node crashes
+// during point-in-time recovery, run it again with the same target.
+//
+// ============================================================================
+
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ChuLiYu/raft-recovery/internal/snapshot"
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+	"github.com/ChuLiYu/raft-recovery/internal/storage/wal"
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+)
+
+// RecoveryTarget selects the point Start recovers to
+//
+// Events up to and including the target are applied. The zero value
+// means normal recovery of everything.
+type RecoveryTarget struct {
+	Seq  uint64    // Last WAL sequence number to apply (0 = no limit)
+	Time time.Time // Apply events with timestamps up to this time (zero = no limit)
+}
+
+// ParseRecoveryTarget parses a --recover-to value
+//
+// Accepts a positive WAL sequence number ("1234") or an RFC 3339
+// timestamp ("2024-05-01T12:00:00Z").
+func ParseRecoveryTarget(s string) (RecoveryTarget, error) {
+	if seq, err := strconv.ParseUint(s, 10, 64); err == nil {
+		if seq == 0 {
+			return RecoveryTarget{}, fmt.Errorf("recovery target seq must be positive")
+		}
+		return RecoveryTarget{Seq: seq}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return RecoveryTarget{}, fmt.Errorf("invalid recovery target %q: want a sequence number or an RFC 3339 time", s)
+	}
+	return RecoveryTarget{Time: t}, nil
+}
+
+// IsZero reports whether no target is set
+func (t RecoveryTarget) IsZero() bool {
+	return t.Seq == 0 && t.Time.IsZero()
+}
+
+func (t RecoveryTarget) String() string {
+	switch {
+	case t.Seq != 0 && !t.Time.IsZero():
+		return fmt.Sprintf("seq %d / %s", t.Seq, t.Time.Format(time.RFC3339))
+	case t.Seq != 0:
+		return fmt.Sprintf("seq %d", t.Seq)
+	case !t.Time.IsZero():
+		return t.Time.Format(time.RFC3339)
+	default:
+		return "latest"
+	}
+}
+
+// includes reports whether an event is at or before the target
+func (t RecoveryTarget) includes(event *wal.Event) bool {
+	if t.Seq != 0 && event.Seq > t.Seq {
+		return false
+	}
+	if !t.Time.IsZero() && event.Timestamp > t.Time.UnixMilli() {
+		return false
+	}
+	return true
+}
+
+// coversSnapshot reports whether a snapshot was taken at or before the target
+func (t RecoveryTarget) coversSnapshot(info snapshot.Info) bool {
+	if t.Seq != 0 && info.LastSeq > t.Seq {
+		return false
+	}
+	if !t.Time.IsZero() && info.CreatedAt.After(t.Time) {
+		return false
+	}
+	return true
+}
+
+// recoverToTarget restores the state at target (steps 1-3 above)
+//
+// Returns:
+//   - error: No usable WAL history, load, replay or truncation failure
+func (c *Controller) recoverToTarget(target RecoveryTarget) error {
+	if c.raftNode != nil {
+		return fmt.Errorf("not supported in Raft mode")
+	}
+	log.Info("Starting point-in-time recovery", "target", target.String())
+
+	// 1. Newest snapshot at or before the target (List is ordered by LastSeq)
+	infos, err := c.snapshot.List()
+	if err != nil {
+		return err
+	}
+	var base *snapshot.Info
+	for i := range infos {
+		if target.coversSnapshot(infos[i]) {
+			base = &infos[i]
+		}
+	}
+
+	data := types.SnapshotData{Jobs: make(map[types.JobID]*types.Job), SchemaVer: types.CurrentSnapshotSchema, Kind: types.SnapshotFull}
+	if base != nil {
+		if data, err = c.snapshot.LoadFile(base.Path); err != nil {
+			return fmt.Errorf("failed to load snapshot %s: %w", base.Path, err)
+		}
+	}
+	c.mu.Lock()
+	if err := c.jobManager.Restore(data); err != nil {
+		c.mu.Unlock()
+		return fmt.Errorf("failed to restore state: %w", err)
+	}
+	c.replayFrom = data.LastSeq
+	c.mu.Unlock()
+
+	// 2. The WAL must still hold every event after the snapshot
+	if err := c.checkReplayableFrom(c.replayFrom); err != nil {
+		return err
+	}
+
+	lastSeq := c.replayFrom
+	err = c.wal.ReplayFrom(c.replayFrom, func(event *wal.Event) error {
+		if !target.includes(event) {
+			return wal.ErrStopReplay
+		}
+		lastSeq = event.Seq
+		return c.applyReplayedEvent(event)
+	})
+	if err != nil {
+		return fmt.Errorf("replayWAL failed: %w", err)
+	}
+	if target.Seq > c.wal.GetLastSeq() {
+		log.Warn("Recovery target is past the end of the WAL, recovering everything",
+			"target", target.String(), "last_seq", c.wal.GetLastSeq())
+	}
+
+	// 3. Later events must not come back on the next restart
+	archive := fmt.Sprintf("%s.pitr-%s", c.config.WALPath, time.Now().Format("20060102_150405"))
+	discarded, err := c.wal.TruncateAfter(lastSeq, archive)
+	if err != nil {
+		return fmt.Errorf("failed to truncate WAL after seq %d: %w", lastSeq, err)
+	}
+	if discarded == 0 {
+		vfs.Default(c.config.FS).Remove(archive)
+		archive = ""
+	}
+
+	snapshotPath := ""
+	if base != nil {
+		snapshotPath = base.Path
+	}
+	log.Info("Point-in-time recovery applied",
+		"target", target.String(),
+		"snapshot", snapshotPath,
+		"snapshot_seq", data.LastSeq,
+		"recovered_seq", lastSeq,
+		"discarded_events", discarded,
+		"archive", archive)
+	return nil
+}
+
+// checkReplayableFrom returns an error unless the WAL still holds every
+// event after seq (locally or in the archive), uncompacted
+func (c *Controller) checkReplayableFrom(seq uint64) error {
+	oldest, err := c.wal.OldestSeq()
+	if err != nil {
+		return err
+	}
+	if oldest > seq+1 {
+		return fmt.Errorf("WAL before seq %d has been pruned, cannot replay from seq %d (increase wal.retention_seconds or configure wal.archive)",
+			oldest, seq+1)
+	}
+	// A snapshot inside compacted history may hold jobs whose later events
+	// were dropped; an empty start (seq 0) is fine, finished jobs just stay
+	// absent
+	compacted, err := c.wal.CompactedThrough()
+	if err != nil {
+		return err
+	}
+	if seq > 0 && seq < compacted {
+		return fmt.Errorf("WAL up to seq %d has been compacted, cannot replay from snapshot at seq %d (increase wal.compact_after_seconds)",
+			compacted, seq)
+	}
+	return nil
+}
+
+// persistRecoveredState makes the recovered state the current snapshot
+// (step 4 above); the snapshot it replaces is kept as a backup
+func (c *Controller) persistRecoveredState() error {
+	backup, err := c.snapshot.Backup()
+	if err != nil {
+		return err
+	}
+	if backup != "" {
+		log.Info("Previous snapshot kept", "path", backup)
+	}
+	return c.takeSnapshot()
+}
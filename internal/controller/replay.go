@@ -0,0 +1,196 @@
+package controller
+
+// ============================================================================
+// Parallel Recovery Pipeline
+// Responsibility: Replay the WAL after the snapshot on several goroutines
+// while keeping every job's events in order
+// ============================================================================
+//
+// Stages:
+//   1. Decode: wal.ReplayParallel decodes and verifies chunks of the WAL on
+//      RecoveryWorkers goroutines and delivers the events in seq order
+//   2. Partition: events are routed by a hash of their job ID, so all
+//      events of a job go to the same partition, in seq order
+//   3. Apply: one goroutine per partition applies its events to its own
+//      JobManager shard, so the partitions share no lock
+//
+// Before the apply stage the recovered jobs are split into the shards
+// (JobManager.Split); afterwards the shards are merged back once
+// (JobManager.Merge). Each partition records the seq that first queued
+// each job, and the merged queue is ordered by it, which gives the order a
+// sequential replay would produce once CompactQueue has run.
+//
+// Point-in-time recovery (recovery.go) stops at a target event and stays
+// sequential.
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+
+	"github.com/ChuLiYu/raft-recovery/internal/jobmanager"
+	"github.com/ChuLiYu/raft-recovery/internal/storage/wal"
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+)
+
+// replayBatchSize is the number of events handed to a partition at once
+const replayBatchSize = 256
+
+// errPartitionFailed stops the decode stage once a partition has failed
+var errPartitionFailed = errors.New("replay partition failed")
+
+// replayPartition applies the events of the jobs that hash to it; only
+// its goroutine touches it until the shards are merged
+type replayPartition struct {
+	jobs    *jobmanager.JobManager // Shard holding the partition's jobs
+	batches chan []*wal.Event
+	queued  map[types.JobID]uint64 // Seq that first queued a job during replay
+	err     error                  // First apply error
+	errSeq  uint64                 // Seq of the event that failed
+}
+
+// recoveryWorkers returns the number of goroutines per recovery stage
+func (c *Controller) recoveryWorkers() int {
+	if c.config.RecoveryWorkers > 0 {
+		return c.config.RecoveryWorkers
+	}
+	return runtime.NumCPU()
+}
+
+// partitionOf returns the partition of a job (FNV-1a)
+func partitionOf(jobID types.JobID, partitions int) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(jobID); i++ {
+		h ^= uint32(jobID[i])
+		h *= 16777619
+	}
+	return int(h % uint32(partitions))
+}
+
+// replayWALParallel replays the WAL after the snapshot through the pipeline
+//
+// Parameters:
+//   - workers: Decoding goroutines and apply partitions
+//
+// Returns:
+//   - error: Decode error, or the apply error of the earliest event
+func (c *Controller) replayWALParallel(workers int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	shards := c.jobManager.Split(workers, func(jobID types.JobID) int {
+		return partitionOf(jobID, workers)
+	})
+	partitions := make([]*replayPartition, workers)
+	defer func() {
+		// Merge on failure too, so the state is never left split
+		c.jobManager.Merge(shards, func(jobID types.JobID) uint64 {
+			return partitions[partitionOf(jobID, workers)].queued[jobID]
+		})
+	}()
+
+	failed := make(chan struct{})
+	var failOnce sync.Once
+	var wg sync.WaitGroup
+	for i := range partitions {
+		p := &replayPartition{
+			jobs:    shards[i],
+			batches: make(chan []*wal.Event, 4),
+			queued:  make(map[types.JobID]uint64),
+		}
+		partitions[i] = p
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range p.batches {
+				if p.err != nil {
+					continue // Drain after a failure
+				}
+				for _, event := range batch {
+					if err := c.applyPartitioned(p, event); err != nil {
+						p.err, p.errSeq = err, event.Seq
+						failOnce.Do(func() { close(failed) })
+						break
+					}
+				}
+			}
+		}()
+	}
+
+	// Events stay valid after the handler returns: each decoded chunk
+	// keeps its own slice
+	pending := make([][]*wal.Event, workers)
+	send := func(i int) error {
+		select {
+		case partitions[i].batches <- pending[i]:
+			pending[i] = nil
+			return nil
+		case <-failed:
+			return errPartitionFailed
+		}
+	}
+	err := c.wal.ReplayParallel(c.replayFrom, workers, func(event *wal.Event) error {
+		i := partitionOf(event.JobID, workers)
+		if pending[i] == nil {
+			pending[i] = make([]*wal.Event, 0, replayBatchSize)
+		}
+		pending[i] = append(pending[i], event)
+		if len(pending[i]) < replayBatchSize {
+			return nil
+		}
+		return send(i)
+	})
+	if err == nil {
+		for i := range pending {
+			if len(pending[i]) > 0 {
+				if err = send(i); err != nil {
+					break
+				}
+			}
+		}
+	}
+	for _, p := range partitions {
+		close(p.batches)
+	}
+	wg.Wait()
+
+	// A failed partition reports the earliest failing event, as a
+	// sequential replay would
+	var first *replayPartition
+	for _, p := range partitions {
+		if p.err != nil && (first == nil || p.errSeq < first.errSeq) {
+			first = p
+		}
+	}
+	if first != nil {
+		return first.err
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Info("WAL replayed in parallel", "workers", workers)
+	return nil
+}
+
+// applyPartitioned applies one event to the partition's shard and records
+// when its job was first queued
+func (c *Controller) applyPartitioned(p *replayPartition, event *wal.Event) error {
+	// Only events that append to the queue set a job's queue position;
+	// an ENQUEUE of a job that is already known appends nothing
+	queues := false
+	switch event.Type {
+	case wal.EventEnqueue:
+		queues = event.HasJob() && p.jobs.GetJob(event.JobID) == nil
+	case wal.EventRetry, wal.EventTimeout:
+		queues = true
+	}
+
+	if err := c.applyEventTo(p.jobs, event); err != nil {
+		return err
+	}
+	if _, known := p.queued[event.JobID]; queues && !known {
+		p.queued[event.JobID] = event.Seq
+	}
+	return nil
+}
@@ -0,0 +1,508 @@
+// ============================================================================
+// Beaver-Raft Encryption - AES-GCM Envelope Encryption at Rest
+// ============================================================================
+//
+// Package: internal/encryption
+// File: keyring.go
+// Purpose: Seal WAL payloads and snapshot files with rotatable master keys
+//
+// Design (envelope encryption):
+//   - Master keys (AES-256) come from a keyfile and/or an environment
+//     variable; each has a short ID chosen by the operator
+//   - A Sealer generates a random data key (DEK), wraps it once with the
+//     active master key and encrypts every message with the DEK
+//   - Every envelope carries the master key ID and the wrapped DEK, so any
+//     envelope can be opened by a keyring that still holds that key
+//
+// Key Rotation:
+//   Add a new key to the keyfile (last entry = active by default) and
+//   restart. New data is sealed with the new key; existing WAL segments
+//   and snapshots keep their old key ID and stay readable as long as the
+//   old key remains in the keyring. Nothing is rewritten. Drop an old key
+//   only once no retained file references it (e.g. after a snapshot and
+//   WAL prune).
+//
+// Envelope Format:
+//   version   byte      envelopeVersion
+//   key_id    uint8 length + bytes
+//   dek_nonce [12]byte
+//   dek       [48]byte  DEK sealed with the master key (AAD: "dek:" + key_id)
+//   nonce     [12]byte
+//   data      []byte    message sealed with the DEK (AAD: caller supplied)
+//
+// Key Sources (YAML):
+//   encryption:
+//     key_file: /etc/beaver-raft/keys   # One "id:base64-key" per line, mode 0600
+//     key_env: BEAVER_RAFT_KEYS         # Same entries, comma separated
+//     active_key: ""                    # Key for new data (default: last listed)
+//
+//   Generate a key with: head -c 32 /dev/urandom | base64
+//
+// ============================================================================
+
+package encryption
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ============================================================================
+// Error Definitions
+// ============================================================================
+
+var (
+	ErrKeyNotFound      = errors.New("encryption key not found in keyring")
+	ErrInvalidEnvelope  = errors.New("invalid encryption envelope")
+	ErrDecryptionFailed = errors.New("decryption failed (wrong key or tampered data)")
+)
+
+// ============================================================================
+// Configuration
+// ============================================================================
+
+// Config selects where master keys are loaded from
+type Config struct {
+	KeyFile   string `yaml:"key_file"`   // File with one "id:base64-key" entry per line
+	KeyEnv    string `yaml:"key_env"`    // Environment variable with comma-separated entries
+	ActiveKey string `yaml:"active_key"` // Key ID for new data ("" = last key listed)
+}
+
+// Enabled reports whether any key source is configured
+func (c Config) Enabled() bool {
+	return c.KeyFile != "" || c.KeyEnv != ""
+}
+
+const (
+	keySize         = 32 // AES-256
+	nonceSize       = 12 // GCM standard nonce
+	envelopeVersion = 1
+	maxKeyIDLen     = 255
+
+	// maxSealsPerDEK bounds messages per data key, far below the 2^32
+	// random-nonce limit of GCM
+	maxSealsPerDEK = 1 << 24
+
+	// maxCachedDEKs bounds the unwrapped data keys kept by Open
+	maxCachedDEKs = 1024
+)
+
+// ============================================================================
+// Keyring
+// ============================================================================
+
+// Keyring holds the master keys and the ID of the key used for new data
+//
+// A Keyring is safe for concurrent use.
+type Keyring struct {
+	keys   map[string]cipher.AEAD // Master keys by ID
+	active string                 // ID of the key that seals new data
+
+	mu   sync.Mutex
+	deks map[string]cipher.AEAD // Unwrapped data keys by wrapped bytes
+}
+
+// LoadKeyring loads the master keys named by cfg
+//
+// Keys from the keyfile come before keys from the environment variable;
+// an ID listed twice must carry the same key.
+//
+// Parameters:
+//   - cfg: Key sources and active key
+//
+// Returns:
+//   - *Keyring: Loaded keyring (nil if no key source is configured)
+//   - error: Unreadable source, malformed entry or unknown active key
+func LoadKeyring(cfg Config) (*Keyring, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+
+	var ids []string
+	keys := make(map[string][]byte)
+	add := func(source string, entries []keyEntry) error {
+		for _, e := range entries {
+			if old, ok := keys[e.id]; ok {
+				if string(old) != string(e.key) {
+					return fmt.Errorf("%s: key %q is listed twice with different values", source, e.id)
+				}
+				continue
+			}
+			keys[e.id] = e.key
+			ids = append(ids, e.id)
+		}
+		return nil
+	}
+
+	if cfg.KeyFile != "" {
+		file, err := os.Open(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open encryption keyfile: %w", err)
+		}
+		entries, err := parseKeys(file, cfg.KeyFile)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		if err := add(cfg.KeyFile, entries); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.KeyEnv != "" {
+		value, ok := os.LookupEnv(cfg.KeyEnv)
+		if !ok {
+			return nil, fmt.Errorf("encryption key variable %s is not set", cfg.KeyEnv)
+		}
+		source := "$" + cfg.KeyEnv
+		entries, err := parseKeys(strings.NewReader(strings.ReplaceAll(value, ",", "\n")), source)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(source, entries); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no encryption keys found in the configured key sources")
+	}
+	active := cfg.ActiveKey
+	if active == "" {
+		active = ids[len(ids)-1]
+	}
+	return NewKeyring(keys, active)
+}
+
+// NewKeyring builds a keyring from raw 32-byte master keys
+//
+// Parameters:
+//   - keys: Master keys by ID
+//   - active: ID of the key that seals new data
+//
+// Returns:
+//   - *Keyring: Keyring
+//   - error: Invalid key size or ID, or active is not in keys
+func NewKeyring(keys map[string][]byte, active string) (*Keyring, error) {
+	k := &Keyring{
+		keys:   make(map[string]cipher.AEAD, len(keys)),
+		active: active,
+		deks:   make(map[string]cipher.AEAD),
+	}
+	for id, key := range keys {
+		if err := validateKeyID(id); err != nil {
+			return nil, err
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q: %w", id, err)
+		}
+		k.keys[id] = aead
+	}
+	if _, ok := k.keys[active]; !ok {
+		return nil, fmt.Errorf("%w: active key %q (available: %s)", ErrKeyNotFound, active, k.describeIDs())
+	}
+	return k, nil
+}
+
+// ActiveKeyID returns the ID of the key that seals new data
+func (k *Keyring) ActiveKeyID() string {
+	return k.active
+}
+
+// KeyIDs returns the IDs of all master keys, sorted
+func (k *Keyring) KeyIDs() []string {
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Describe summarizes the keyring for status output
+func (k *Keyring) Describe() string {
+	if k == nil {
+		return "off"
+	}
+	return fmt.Sprintf("aes-256-gcm (active key %q, %d keys)", k.active, len(k.keys))
+}
+
+func (k *Keyring) describeIDs() string {
+	if len(k.keys) == 0 {
+		return "none"
+	}
+	return strings.Join(k.KeyIDs(), ", ")
+}
+
+// NewSealer starts a new data key wrapped with the active master key
+func (k *Keyring) NewSealer() (*Sealer, error) {
+	s := &Sealer{keyring: k}
+	if err := s.rotate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Seal encrypts one message with a fresh data key
+//
+// Use a Sealer instead when sealing many messages.
+func (k *Keyring) Seal(plaintext, aad []byte) ([]byte, error) {
+	s, err := k.NewSealer()
+	if err != nil {
+		return nil, err
+	}
+	return s.Seal(plaintext, aad)
+}
+
+// Open decrypts an envelope sealed by any key in the keyring
+//
+// Parameters:
+//   - envelope: Sealed message
+//   - aad: Additional data passed to Seal
+//
+// Returns:
+//   - []byte: Plaintext
+//   - error: ErrKeyNotFound (naming the missing key ID), ErrInvalidEnvelope
+//     or ErrDecryptionFailed
+func (k *Keyring) Open(envelope, aad []byte) ([]byte, error) {
+	env, err := parseEnvelope(envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	dek, err := k.unwrap(env)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := dek.Open(nil, env.nonce, env.data, aad)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return plaintext, nil
+}
+
+// unwrap returns the data key of an envelope, caching unwrapped keys
+func (k *Keyring) unwrap(env envelope) (cipher.AEAD, error) {
+	master, ok := k.keys[env.keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: data was sealed with key %q (available: %s); add it to the keyfile or key variable",
+			ErrKeyNotFound, env.keyID, k.describeIDs())
+	}
+
+	cacheKey := env.keyID + "\x00" + string(env.wrapped)
+	k.mu.Lock()
+	dek, ok := k.deks[cacheKey]
+	k.mu.Unlock()
+	if ok {
+		return dek, nil
+	}
+
+	raw, err := master.Open(nil, env.dekNonce, env.wrapped, dekAAD(env.keyID))
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	if dek, err = newAEAD(raw); err != nil {
+		return nil, ErrDecryptionFailed
+	}
+
+	k.mu.Lock()
+	if len(k.deks) >= maxCachedDEKs {
+		k.deks = make(map[string]cipher.AEAD)
+	}
+	k.deks[cacheKey] = dek
+	k.mu.Unlock()
+	return dek, nil
+}
+
+// KeyID returns the master key ID recorded in an envelope
+func KeyID(envelope []byte) (string, error) {
+	env, err := parseEnvelope(envelope)
+	if err != nil {
+		return "", err
+	}
+	return env.keyID, nil
+}
+
+// ============================================================================
+// Sealer
+// ============================================================================
+
+// Sealer encrypts messages with one data key under the active master key
+//
+// A Sealer is not safe for concurrent use.
+type Sealer struct {
+	keyring *Keyring
+	dek     cipher.AEAD
+	header  []byte // version, key ID, wrapped DEK
+	seals   int
+}
+
+// rotate generates and wraps a new data key
+func (s *Sealer) rotate() error {
+	raw := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, raw); err != nil {
+		return fmt.Errorf("failed to generate data key: %w", err)
+	}
+	dek, err := newAEAD(raw)
+	if err != nil {
+		return err
+	}
+	dekNonce, err := randomNonce()
+	if err != nil {
+		return err
+	}
+
+	id := s.keyring.active
+	header := []byte{envelopeVersion, byte(len(id))}
+	header = append(header, id...)
+	header = append(header, dekNonce...)
+	header = s.keyring.keys[id].Seal(header, dekNonce, raw, dekAAD(id))
+
+	s.dek, s.header, s.seals = dek, header, 0
+	return nil
+}
+
+// Seal encrypts plaintext bound to aad
+//
+// Parameters:
+//   - plaintext: Message
+//   - aad: Additional authenticated data (e.g. the record's identity);
+//     Open must be given the same bytes
+//
+// Returns:
+//   - []byte: Envelope
+//   - error: Random source failure
+func (s *Sealer) Seal(plaintext, aad []byte) ([]byte, error) {
+	if s.seals >= maxSealsPerDEK {
+		if err := s.rotate(); err != nil {
+			return nil, err
+		}
+	}
+	s.seals++
+
+	nonce, err := randomNonce()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(s.header)+nonceSize+len(plaintext)+s.dek.Overhead())
+	out = append(out, s.header...)
+	out = append(out, nonce...)
+	return s.dek.Seal(out, nonce, plaintext, aad), nil
+}
+
+// KeyID returns the master key ID of the sealer's data key
+func (s *Sealer) KeyID() string {
+	return string(s.header[2 : 2+int(s.header[1])])
+}
+
+// ============================================================================
+// Internal Helpers
+// ============================================================================
+
+// envelope is a parsed sealed message
+type envelope struct {
+	keyID    string
+	dekNonce []byte
+	wrapped  []byte
+	nonce    []byte
+	data     []byte
+}
+
+func parseEnvelope(b []byte) (envelope, error) {
+	var env envelope
+	if len(b) < 2 || b[0] != envelopeVersion {
+		return env, ErrInvalidEnvelope
+	}
+	idLen := int(b[1])
+	wrappedLen := keySize + 16 // GCM tag
+	if len(b) < 2+idLen+nonceSize+wrappedLen+nonceSize {
+		return env, ErrInvalidEnvelope
+	}
+	b = b[2:]
+	env.keyID, b = string(b[:idLen]), b[idLen:]
+	env.dekNonce, b = b[:nonceSize], b[nonceSize:]
+	env.wrapped, b = b[:wrappedLen], b[wrappedLen:]
+	env.nonce, env.data = b[:nonceSize], b[nonceSize:]
+	return env, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", keySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func randomNonce() ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return nonce, nil
+}
+
+func dekAAD(keyID string) []byte {
+	return []byte("dek:" + keyID)
+}
+
+func validateKeyID(id string) error {
+	if id == "" || len(id) > maxKeyIDLen || strings.ContainsAny(id, ":, \t\r\n") {
+		return fmt.Errorf("invalid encryption key ID %q", id)
+	}
+	return nil
+}
+
+// keyEntry is one "id:base64-key" entry of a key source
+type keyEntry struct {
+	id  string
+	key []byte
+}
+
+// parseKeys reads "id:base64-key" entries, one per line; blank lines and
+// lines starting with '#' are ignored
+func parseKeys(r io.Reader, source string) ([]keyEntry, error) {
+	var entries []keyEntry
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		id, encoded, ok := strings.Cut(text, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: want \"id:base64-key\"", source, line)
+		}
+		id = strings.TrimSpace(id)
+		if err := validateKeyID(id); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", source, line, err)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: key %q is not valid base64", source, line, id)
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("%s:%d: key %q must be %d bytes, got %d", source, line, id, keySize, len(key))
+		}
+		entries = append(entries, keyEntry{id: id, key: key})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", source, err)
+	}
+	return entries, nil
+}
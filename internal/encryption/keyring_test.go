@@ -0,0 +1,166 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================================================
+// Test Helpers
+// ============================================================================
+
+// testKey returns a deterministic 32-byte key
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, keySize)
+}
+
+// keyEntryLine formats a keyfile entry
+func keyEntryLine(id string, key []byte) string {
+	return id + ":" + base64.StdEncoding.EncodeToString(key)
+}
+
+// ============================================================================
+// Seal / Open
+// ============================================================================
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	k, err := NewKeyring(map[string][]byte{"k1": testKey(1)}, "k1")
+	require.NoError(t, err)
+
+	sealer, err := k.NewSealer()
+	require.NoError(t, err)
+	assert.Equal(t, "k1", sealer.KeyID())
+
+	for _, msg := range []string{"", "hello", strings.Repeat("x", 4096)} {
+		sealed, err := sealer.Seal([]byte(msg), []byte("aad"))
+		require.NoError(t, err)
+		assert.NotContains(t, string(sealed), "hello")
+
+		id, err := KeyID(sealed)
+		require.NoError(t, err)
+		assert.Equal(t, "k1", id)
+
+		plain, err := k.Open(sealed, []byte("aad"))
+		require.NoError(t, err)
+		assert.Equal(t, msg, string(plain))
+	}
+}
+
+func TestOpenRejectsTampering(t *testing.T) {
+	k, err := NewKeyring(map[string][]byte{"k1": testKey(1)}, "k1")
+	require.NoError(t, err)
+	sealed, err := k.Seal([]byte("payload"), []byte("seq-1"))
+	require.NoError(t, err)
+
+	_, err = k.Open(sealed, []byte("seq-2"))
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+
+	flipped := append([]byte(nil), sealed...)
+	flipped[len(flipped)-1] ^= 1
+	_, err = k.Open(flipped, []byte("seq-1"))
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+
+	_, err = k.Open(sealed[:10], []byte("seq-1"))
+	assert.ErrorIs(t, err, ErrInvalidEnvelope)
+}
+
+func TestKeyRotation(t *testing.T) {
+	old, err := NewKeyring(map[string][]byte{"k1": testKey(1)}, "k1")
+	require.NoError(t, err)
+	sealedOld, err := old.Seal([]byte("old"), nil)
+	require.NoError(t, err)
+
+	// New active key, old key still present
+	rotated, err := NewKeyring(map[string][]byte{"k1": testKey(1), "k2": testKey(2)}, "k2")
+	require.NoError(t, err)
+	sealedNew, err := rotated.Seal([]byte("new"), nil)
+	require.NoError(t, err)
+
+	id, err := KeyID(sealedNew)
+	require.NoError(t, err)
+	assert.Equal(t, "k2", id)
+
+	plain, err := rotated.Open(sealedOld, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(plain))
+
+	// Old key dropped: a clear error naming the missing key
+	dropped, err := NewKeyring(map[string][]byte{"k2": testKey(2)}, "k2")
+	require.NoError(t, err)
+	_, err = dropped.Open(sealedOld, nil)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	assert.Contains(t, err.Error(), `"k1"`)
+	assert.Contains(t, err.Error(), "available: k2")
+}
+
+// ============================================================================
+// Key Sources
+// ============================================================================
+
+func TestLoadKeyring(t *testing.T) {
+	keyfile := filepath.Join(t.TempDir(), "keys")
+	content := "# rotated 2026-01\n" + keyEntryLine("k1", testKey(1)) + "\n\n" + keyEntryLine("k2", testKey(2)) + "\n"
+	require.NoError(t, os.WriteFile(keyfile, []byte(content), 0600))
+	t.Setenv("TEST_WAL_KEYS", keyEntryLine("k2", testKey(2))+","+keyEntryLine("k3", testKey(3)))
+
+	// Not configured
+	k, err := LoadKeyring(Config{})
+	require.NoError(t, err)
+	assert.Nil(t, k)
+	assert.Equal(t, "off", k.Describe())
+
+	// Keyfile: the last key is active
+	k, err = LoadKeyring(Config{KeyFile: keyfile})
+	require.NoError(t, err)
+	assert.Equal(t, "k2", k.ActiveKeyID())
+	assert.Equal(t, []string{"k1", "k2"}, k.KeyIDs())
+
+	// Keyfile + environment, explicit active key
+	k, err = LoadKeyring(Config{KeyFile: keyfile, KeyEnv: "TEST_WAL_KEYS", ActiveKey: "k1"})
+	require.NoError(t, err)
+	assert.Equal(t, "k1", k.ActiveKeyID())
+	assert.Equal(t, []string{"k1", "k2", "k3"}, k.KeyIDs())
+
+	// Environment only
+	k, err = LoadKeyring(Config{KeyEnv: "TEST_WAL_KEYS"})
+	require.NoError(t, err)
+	assert.Equal(t, "k3", k.ActiveKeyID())
+}
+
+func TestLoadKeyringErrors(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+		return path
+	}
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"missing file", Config{KeyFile: filepath.Join(dir, "none")}, "failed to open"},
+		{"unset variable", Config{KeyEnv: "TEST_WAL_KEYS_UNSET"}, "is not set"},
+		{"no separator", Config{KeyFile: write("a", "k1\n")}, `want "id:base64-key"`},
+		{"bad base64", Config{KeyFile: write("b", "k1:!!!\n")}, "not valid base64"},
+		{"short key", Config{KeyFile: write("c", keyEntryLine("k1", []byte("short")))}, "must be 32 bytes"},
+		{"conflicting", Config{KeyFile: write("d", keyEntryLine("k1", testKey(1))+"\n"+keyEntryLine("k1", testKey(2)))}, "listed twice"},
+		{"empty", Config{KeyFile: write("e", "# no keys yet\n")}, "no encryption keys"},
+		{"unknown active", Config{KeyFile: write("f", keyEntryLine("k1", testKey(1))), ActiveKey: "k9"}, `active key "k9"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadKeyring(tt.cfg)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
@@ -44,8 +44,16 @@
 // Snapshot Support:
 //   - Snapshot() - Serialize current job state
 //   - Restore() - Recover state from snapshot
+//   - BeginSnapshot() / RestoreStream() - The same, one job at a time
 //   - Enables crash recovery and system migration
 //
+//   BeginSnapshot takes the job IDs under the lock and returns a cursor
+//   that copies jobs in small batches as it is read. Jobs changed before
+//   the cursor reaches them are copied first (copy-on-write), so the
+//   cursor yields the state at BeginSnapshot without copying every job
+//   up front. Jobs are changed in place, so every change goes through a
+//   JobManager method (see IncrementAttempt).
+//
 // Responsibilities:
 //   1. Unified state management (single jobs map)
 //   2. State transition integrity (Pending -> InFlight -> Completed/Dead)
@@ -58,6 +66,8 @@ package jobmanager
 
 import (
 	"errors"
+	"io"
+	"sort"
 	"sync"
 	"time"
 
@@ -72,6 +82,9 @@ var (
 	ErrDuplicateJob = errors.New("job already exists") // Duplicate job ID error
 	ErrNotInFlight  = errors.New("job not in flight")  // Job not in executing state
 	ErrJobNotFound  = errors.New("job not found")      // Job does not exist
+
+	// ErrSnapshotClosed is returned by a snapshot cursor after Close or Restore
+	ErrSnapshotClosed = errors.New("snapshot cursor closed")
 )
 
 // Status constants defined in pkg/types
@@ -93,6 +106,9 @@ type JobManager struct {
 	
 	// Phase 3: Raft integration
 	lastAppliedIndex int64
+
+	// Open snapshot cursors, keeping copies of jobs changed under them
+	cursors map[*SnapshotCursor]struct{}
 }
 
 // ... NewJobManager initialization ...
@@ -110,10 +126,10 @@ func (jm *JobManager) GetLastAppliedIndex() int64 {
 }
 
 // SnapShotData contains complete job state for persistence
-type SnapShotData struct {
-	Jobs      map[types.JobID]*types.Job `json:"jobs"`           // Complete job data
-	SchemaVer int                        `json:"schema_version"` // Schema version
-}
+//
+// Deprecated: Use types.SnapshotData. This used to be a separate type whose
+// version was tagged "schema_version"; the snapshot loader still reads it.
+type SnapShotData = types.SnapshotData
 
 // ============================================================================
 // Core Methods
@@ -180,6 +196,151 @@ func (jm *JobManager) Enqueue(job types.Job) error {
 	return nil
 }
 
+// RestoreJob re-inserts a job rebuilt from the WAL in pending state
+//
+// Unlike Enqueue, the job's original timestamps and attempt count are
+// preserved so that recovery reproduces the pre-crash state.
+//
+// Parameters:
+//   - job: Job reconstructed from a WAL ENQUEUE event
+//
+// Returns:
+//   - error: ErrDuplicateJob if ID already exists (e.g. already in snapshot)
+//
+// Concurrency: Protected by mutex
+func (jm *JobManager) RestoreJob(job types.Job) error {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	if _, exists := jm.jobs[job.ID]; exists {
+		return ErrDuplicateJob
+	}
+
+	job.Status = types.StatusPending
+	job.Deadline = nil
+	job.WorkerID = ""
+	if job.UpdatedAt == 0 {
+		job.UpdatedAt = job.CreatedAt
+	}
+
+	jm.jobs[job.ID] = &job
+	jm.queue = append(jm.queue, job.ID)
+	return nil
+}
+
+// CompactQueue drops queue entries that are no longer pending or duplicated
+//
+// WAL replay moves jobs out of pending via MarkInFlight without popping
+// them (the queue position is unknown), and recovery requeues them again.
+// Call this once after recovery to restore the invariant that every
+// queued ID is pending and appears exactly once.
+//
+// Concurrency: Protected by mutex
+func (jm *JobManager) CompactQueue() {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	seen := make(map[types.JobID]struct{}, len(jm.queue))
+	compacted := jm.queue[:0]
+	for _, jobID := range jm.queue {
+		job, exists := jm.jobs[jobID]
+		if !exists || job.Status != types.StatusPending {
+			continue
+		}
+		if _, dup := seen[jobID]; dup {
+			continue
+		}
+		seen[jobID] = struct{}{}
+		compacted = append(compacted, jobID)
+	}
+	jm.queue = compacted
+}
+
+// Split moves every job into one of n new job managers
+//
+// Parallel WAL replay applies each partition's events to its own shard, so
+// the partitions share no lock. The pending queue stays in jm: shards start
+// with an empty queue and only collect what replay queues, and Merge
+// appends that after jm's queue.
+//
+// Parameters:
+//   - n: Number of shards
+//   - partitionOf: Shard index of a job ID, in [0, n)
+//
+// Returns:
+//   - []*JobManager: Shards holding the jobs of jm
+//
+// Concurrency: Protected by mutex; jm holds no jobs until Merge, so call
+// it only while nothing else uses jm (recovery)
+func (jm *JobManager) Split(n int, partitionOf func(jobID types.JobID) int) []*JobManager {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	shards := make([]*JobManager, n)
+	for i := range shards {
+		shards[i] = NewJobManager()
+	}
+	for jobID, job := range jm.jobs {
+		shard := shards[partitionOf(jobID)]
+		shard.jobs[jobID] = job
+		switch job.Status {
+		case types.StatusInFlight:
+			shard.inFlight[jobID] = job
+		case types.StatusCompleted:
+			shard.completed[jobID] = job
+		case types.StatusDead:
+			shard.dead[jobID] = job
+		}
+	}
+
+	queue := jm.queue
+	jm.reset()
+	jm.queue = queue
+	return shards
+}
+
+// Merge moves the jobs of shards made by Split back into jm
+//
+// The shards' queues are appended after jm's queue, ordered by the key of
+// each job, which gives the order a sequential replay would produce once
+// CompactQueue has run.
+//
+// Parameters:
+//   - shards: Shards returned by Split
+//   - queuedAt: Sort key of a queued job ID, e.g. the seq that first queued it
+//
+// Concurrency: Protected by mutex
+func (jm *JobManager) Merge(shards []*JobManager, queuedAt func(jobID types.JobID) uint64) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	var queued []types.JobID
+	for _, shard := range shards {
+		shard.mu.Lock()
+		for jobID, job := range shard.jobs {
+			jm.jobs[jobID] = job
+		}
+		for jobID, job := range shard.inFlight {
+			jm.inFlight[jobID] = job
+		}
+		for jobID, job := range shard.completed {
+			jm.completed[jobID] = job
+		}
+		for jobID, job := range shard.dead {
+			jm.dead[jobID] = job
+		}
+		queued = append(queued, shard.queue...)
+		shard.reset()
+		shard.mu.Unlock()
+	}
+
+	// Each shard's queue is already in order; entries of one ID share a key
+	sort.SliceStable(queued, func(i, j int) bool {
+		return queuedAt(queued[i]) < queuedAt(queued[j])
+	})
+	jm.queue = append(jm.queue, queued...)
+}
+
 // PopPending retrieves a pending job without changing its state
 //
 // Returns:
@@ -246,6 +407,7 @@ func (jm *JobManager) MarkInFlight(jobID types.JobID, deadline time.Time) error
 	}
 
 	// Update job status
+	jm.preserve(job)
 	deadlineMs := deadline.UnixMilli()
 	job.Status = types.StatusInFlight
 	job.Deadline = &deadlineMs
@@ -293,6 +455,7 @@ func (jm *JobManager) MarkCompleted(jobID types.JobID) error {
 	}
 
 	// Update job status
+	jm.preserve(job)
 	job.Status = types.StatusCompleted
 	job.Deadline = nil
 	job.WorkerID = ""
@@ -341,6 +504,7 @@ func (jm *JobManager) Requeue(jobID types.JobID) error {
 	}
 
 	// Increment retry count and requeue
+	jm.preserve(job)
 	job.Attempt++
 	job.Status = types.StatusPending
 	job.Deadline = nil
@@ -381,6 +545,7 @@ func (jm *JobManager) MarkDead(jobID types.JobID) error {
 	}
 
 	// Update job status
+	jm.preserve(job)
 	job.Status = types.StatusDead
 	job.Deadline = nil
 	job.WorkerID = ""
@@ -393,6 +558,56 @@ func (jm *JobManager) MarkDead(jobID types.JobID) error {
 	return nil
 }
 
+// IncrementAttempt counts a failed attempt without changing the job's state
+//
+// Parameters:
+//   - jobID: ID of the job that failed
+//
+// Returns:
+//   - int: Attempt count after the increment
+//   - error: ErrJobNotFound if the job does not exist
+//
+// Concurrency: Protected by mutex
+func (jm *JobManager) IncrementAttempt(jobID types.JobID) (int, error) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	job, exists := jm.jobs[jobID]
+	if !exists {
+		return 0, ErrJobNotFound
+	}
+	jm.preserve(job)
+	job.Attempt++
+	job.UpdatedAt = time.Now().UnixMilli()
+	return job.Attempt, nil
+}
+
+// RestoreAttempt sets a job's attempt count to a value read from the WAL
+//
+// Unlike IncrementAttempt, the count is not derived from the current
+// state, so replay reproduces the attempt count that was logged.
+//
+// Parameters:
+//   - jobID: ID of the job
+//   - attempt: Attempt count recorded in the event
+//
+// Returns:
+//   - error: ErrJobNotFound if the job does not exist
+//
+// Concurrency: Protected by mutex
+func (jm *JobManager) RestoreAttempt(jobID types.JobID, attempt int) error {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	job, exists := jm.jobs[jobID]
+	if !exists {
+		return ErrJobNotFound
+	}
+	jm.preserve(job)
+	job.Attempt = attempt
+	return nil
+}
+
 // GetExpiredJobs retrieves expired in-flight jobs
 //
 // Parameters:
@@ -495,30 +710,76 @@ func (jm *JobManager) Restore(data types.SnapshotData) error {
 	defer jm.mu.Unlock()
 
 	// Clear existing state
-	jm.jobs = make(map[types.JobID]*types.Job)
-	jm.queue = make([]types.JobID, 0)
-	jm.inFlight = make(map[types.JobID]*types.Job)
-	jm.completed = make(map[types.JobID]*types.Job)
-	jm.dead = make(map[types.JobID]*types.Job)
+	jm.reset()
 
 	// Restore all jobs
 	for jobID, job := range data.Jobs {
-		jm.jobs[jobID] = job
+		jm.restore(jobID, job)
+	}
 
-		// Categorize by status
-		switch job.Status {
-		case types.StatusPending:
-			jm.queue = append(jm.queue, jobID)
-		case types.StatusInFlight:
-			jm.inFlight[jobID] = job
-		case types.StatusCompleted:
-			jm.completed[jobID] = job
-		case types.StatusDead:
-			jm.dead[jobID] = job
+	return nil
+}
+
+// RestoreStream restores state from a snapshot read one job at a time
+//
+// Parameters:
+//   - jobs: Snapshot jobs, e.g. a *snapshot.Reader; io.EOF ends the stream
+//
+// Returns:
+//   - error: The stream's error; the state is then left empty
+//
+// Example:
+//
+//	_, _, err := mgr.LoadNewestStream(func(r *snapshot.Reader) error {
+//	    return jm.RestoreStream(r)
+//	})
+//
+// Concurrency: Protected by mutex, held until the stream ends
+func (jm *JobManager) RestoreStream(jobs types.JobIterator) error {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	jm.reset()
+	for {
+		job, err := jobs.Next()
+		if err == io.EOF {
+			return nil
 		}
+		if err != nil {
+			// A stream may fail after yielding jobs; drop them
+			jm.reset()
+			return err
+		}
+		jm.restore(job.ID, job)
 	}
+}
 
-	return nil
+// reset clears all state and closes open snapshot cursors; caller must
+// hold jm.mu
+func (jm *JobManager) reset() {
+	jm.jobs = make(map[types.JobID]*types.Job)
+	jm.queue = make([]types.JobID, 0)
+	jm.inFlight = make(map[types.JobID]*types.Job)
+	jm.completed = make(map[types.JobID]*types.Job)
+	jm.dead = make(map[types.JobID]*types.Job)
+	jm.cursors = nil
+}
+
+// restore adds one snapshot job, categorized by status; caller must hold
+// jm.mu
+func (jm *JobManager) restore(jobID types.JobID, job *types.Job) {
+	jm.jobs[jobID] = job
+
+	switch job.Status {
+	case types.StatusPending:
+		jm.queue = append(jm.queue, jobID)
+	case types.StatusInFlight:
+		jm.inFlight[jobID] = job
+	case types.StatusCompleted:
+		jm.completed[jobID] = job
+	case types.StatusDead:
+		jm.dead[jobID] = job
+	}
 }
 
 // Snapshot generates snapshot data
@@ -545,7 +806,8 @@ func (jm *JobManager) Snapshot() types.SnapshotData {
 
 	return types.SnapshotData{
 		Jobs:      jobsCopy,
-		SchemaVer: 1,
+		SchemaVer: types.CurrentSnapshotSchema,
+		Kind:      types.SnapshotFull,
 	}
 }
 
@@ -567,7 +829,8 @@ func (jm *JobManager) PartialSnapshot() types.SnapshotData {
 
 	return types.SnapshotData{
 		Jobs:      jobsCopy,
-		SchemaVer: 2, // New schema for partial snapshots
+		SchemaVer: types.CurrentSnapshotSchema,
+		Kind:      types.SnapshotPartial,
 	}
 }
 
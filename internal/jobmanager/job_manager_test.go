@@ -168,6 +168,93 @@ func TestEnqueue(t *testing.T) {
 	}
 }
 
+func TestRestoreJob(t *testing.T) {
+	jm := newTestJobManager()
+
+	job := newTestJob("task-001")
+	job.Attempt = 2
+	job.CreatedAt = 1700000000000
+	job.Status = types.StatusInFlight
+	assertNoError(t, jm.RestoreJob(job))
+
+	assertJobStatus(t, jm, "task-001", types.StatusPending)
+	restored := jm.GetJob("task-001")
+	if restored.CreatedAt != 1700000000000 || restored.Attempt != 2 {
+		t.Errorf("restored job lost state: %+v", restored)
+	}
+	if len(jm.queue) != 1 {
+		t.Errorf("queue length: got %d, want 1", len(jm.queue))
+	}
+
+	assertError(t, jm.RestoreJob(job), ErrDuplicateJob)
+}
+
+func TestCompactQueue(t *testing.T) {
+	jm := newTestJobManager()
+	assertNoError(t, jm.Enqueue(newTestJob("task-001")))
+	assertNoError(t, jm.Enqueue(newTestJob("task-002")))
+
+	// Replay marks task-001 in flight without popping it, then recovery requeues it
+	assertNoError(t, jm.MarkInFlight("task-001", time.Now().Add(time.Minute)))
+	assertNoError(t, jm.Requeue("task-001"))
+
+	jm.CompactQueue()
+
+	if len(jm.queue) != 2 {
+		t.Fatalf("queue length: got %d, want 2 (%v)", len(jm.queue), jm.queue)
+	}
+	if jm.queue[0] != "task-001" || jm.queue[1] != "task-002" {
+		t.Errorf("queue order: got %v", jm.queue)
+	}
+}
+
+func TestSplitMerge(t *testing.T) {
+	jm := newTestJobManager()
+	for _, id := range []string{"task-000", "task-001", "task-002", "task-003"} {
+		assertNoError(t, jm.Enqueue(newTestJob(id)))
+	}
+	assertNoError(t, jm.MarkInFlight("task-001", time.Now().Add(time.Minute)))
+	assertNoError(t, jm.MarkInFlight("task-002", time.Now().Add(time.Minute)))
+	assertNoError(t, jm.MarkCompleted("task-002"))
+
+	// Even IDs go to shard 0, odd IDs to shard 1
+	shards := jm.Split(2, func(jobID types.JobID) int { return int(jobID[len(jobID)-1]-'0') % 2 })
+	if jm.GetTotalJobs() != 0 {
+		t.Fatalf("jobs left after split: %d", jm.GetTotalJobs())
+	}
+	if shards[0].GetTotalJobs() != 2 || shards[1].GetTotalJobs() != 2 {
+		t.Fatalf("shard sizes: got %d and %d, want 2 and 2", shards[0].GetTotalJobs(), shards[1].GetTotalJobs())
+	}
+	if !shards[0].IsCompleted("task-002") {
+		t.Errorf("task-002 should be completed in shard 0")
+	}
+
+	// Replay queues task-001 again (seq 10) and a new task-004 (seq 20)
+	assertNoError(t, shards[0].RestoreJob(newTestJob("task-004")))
+	assertNoError(t, shards[1].Requeue("task-001"))
+
+	keys := map[types.JobID]uint64{"task-001": 10, "task-004": 20}
+	jm.Merge(shards, func(jobID types.JobID) uint64 { return keys[jobID] })
+
+	if jm.GetTotalJobs() != 5 {
+		t.Fatalf("jobs after merge: got %d, want 5", jm.GetTotalJobs())
+	}
+	assertJobStatus(t, jm, "task-001", types.StatusPending)
+	assertJobStatus(t, jm, "task-002", types.StatusCompleted)
+	assertJobStatus(t, jm, "task-004", types.StatusPending)
+
+	// The queue from before the split comes first, then replay's in key order
+	want := []types.JobID{"task-000", "task-001", "task-002", "task-003", "task-001", "task-004"}
+	if len(jm.queue) != len(want) {
+		t.Fatalf("queue: got %v, want %v", jm.queue, want)
+	}
+	for i, id := range want {
+		if jm.queue[i] != id {
+			t.Fatalf("queue: got %v, want %v", jm.queue, want)
+		}
+	}
+}
+
 func TestPopPending(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -693,6 +780,21 @@ func TestJobLifecycleWithRetry(t *testing.T) {
 	}
 }
 
+func TestRestoreAttempt(t *testing.T) {
+	jm := newTestJobManager()
+	assertNoError(t, jm.Enqueue(newTestJob("task-001")))
+
+	assertNoError(t, jm.RestoreAttempt("task-001", 4))
+	if got := jm.GetJob("task-001").Attempt; got != 4 {
+		t.Errorf("Attempt = %d, want 4", got)
+	}
+	assertJobStatus(t, jm, "task-001", types.StatusPending)
+
+	if err := jm.RestoreAttempt("missing", 1); err != ErrJobNotFound {
+		t.Errorf("RestoreAttempt() error = %v, want ErrJobNotFound", err)
+	}
+}
+
 func TestStateInvariants(t *testing.T) {
 	jm := newTestJobManager()
 
@@ -957,7 +1059,7 @@ func TestSnapshot(t *testing.T) {
 			name:  "Empty state snapshot",
 			setup: func(jm *JobManager) {},
 			want: func(data types.SnapshotData) bool {
-				return len(data.Jobs) == 0 && data.SchemaVer == 1
+				return len(data.Jobs) == 0 && data.SchemaVer == types.CurrentSnapshotSchema && data.Kind == types.SnapshotFull
 			},
 		},
 		{
@@ -985,7 +1087,7 @@ func TestSnapshot(t *testing.T) {
 				if len(data.Jobs) != 4 {
 					return false
 				}
-				if data.SchemaVer != 1 {
+				if data.SchemaVer != types.CurrentSnapshotSchema || data.IsPartial() {
 					return false
 				}
 				// verify each job's state
@@ -1020,6 +1122,24 @@ func TestSnapshot(t *testing.T) {
 	}
 }
 
+func TestPartialSnapshot(t *testing.T) {
+	jm := NewJobManager()
+	jm.Enqueue(newTestJob("task-001"))
+	jm.Enqueue(newTestJob("task-002"))
+	jm.MarkDead("task-002")
+
+	data := jm.PartialSnapshot()
+	if !data.IsPartial() {
+		t.Errorf("Kind = %q, want %q", data.Kind, types.SnapshotPartial)
+	}
+	if data.SchemaVer != types.CurrentSnapshotSchema {
+		t.Errorf("SchemaVer = %d, want %d", data.SchemaVer, types.CurrentSnapshotSchema)
+	}
+	if len(data.Jobs) != 1 || data.Jobs["task-001"] == nil {
+		t.Errorf("Jobs = %v, want only task-001", data.Jobs)
+	}
+}
+
 func TestRestore(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -0,0 +1,190 @@
+// ============================================================================
+// Beaver-Raft Job Manager - Streaming Snapshots
+// ============================================================================
+//
+// Package: internal/jobmanager
+// File: snapshot_cursor.go
+// Purpose: Point-in-time snapshots read one job at a time
+//
+// Snapshot() copies every job under the read lock, so a large queue pays
+// for a second copy of its state and blocks writers while it is made. A
+// SnapshotCursor only takes the job IDs and status counts under the lock:
+//
+//   BeginSnapshot (Lock)    IDs + counts, cursor registered
+//   Next (RLock per batch)  copies the next cursorBatch jobs
+//   Close (Lock)            cursor unregistered, saved copies dropped
+//
+// Copy-on-write:
+//   Every method changing a job in place calls preserve first, which saves
+//   a copy of the job for each open cursor that has none yet. Next prefers
+//   that copy, so the cursor yields every job as it was at BeginSnapshot
+//   and its counts stay exact. Only jobs changed while a cursor is open are
+//   copied twice.
+//
+// Restore and RestoreStream replace all jobs; they close open cursors,
+// whose Next then returns ErrSnapshotClosed.
+//
+// ============================================================================
+
+package jobmanager
+
+import (
+	"io"
+	"sort"
+
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+)
+
+// cursorBatch is the number of jobs a cursor copies per read lock
+const cursorBatch = 256
+
+// SnapshotCursor yields the jobs of a point-in-time snapshot one by one
+//
+// Implements types.JobIterator. Not safe for concurrent use; Close it when
+// done so changes stop being copied for it.
+type SnapshotCursor struct {
+	jm     *JobManager
+	kind   types.SnapshotKind
+	counts map[types.JobStatus]int
+	ids    []types.JobID
+	sorted bool
+	pos    int                        // Next ID to copy
+	batch  []*types.Job               // Copied, not yet returned
+	saved  map[types.JobID]*types.Job // Jobs as of BeginSnapshot, guarded by jm.mu
+	closed bool
+}
+
+// BeginSnapshot starts a snapshot read through the returned cursor
+//
+// Parameters:
+//   - kind: types.SnapshotFull for all jobs, types.SnapshotPartial for
+//     pending and in-flight jobs only (as PartialSnapshot)
+//
+// Returns:
+//   - *SnapshotCursor: Cursor yielding jobs in ID order
+//
+// Example:
+//
+//	cursor := jm.BeginSnapshot(types.SnapshotFull)
+//	defer cursor.Close()
+//	err := mgr.WriteStream(snapshot.Stream{JobCounts: cursor.Counts(), Jobs: cursor})
+//
+// Concurrency: Protected by mutex; the cursor's reads take the read lock
+func (jm *JobManager) BeginSnapshot(kind types.SnapshotKind) *SnapshotCursor {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	c := &SnapshotCursor{
+		jm:     jm,
+		kind:   kind,
+		counts: make(map[types.JobStatus]int),
+		ids:    make([]types.JobID, 0, len(jm.jobs)),
+		saved:  make(map[types.JobID]*types.Job),
+	}
+	for id, job := range jm.jobs {
+		if kind == types.SnapshotPartial && job.Status != types.StatusPending && job.Status != types.StatusInFlight {
+			continue
+		}
+		c.ids = append(c.ids, id)
+		c.counts[job.Status]++
+	}
+
+	if jm.cursors == nil {
+		jm.cursors = make(map[*SnapshotCursor]struct{})
+	}
+	jm.cursors[c] = struct{}{}
+	return c
+}
+
+// Kind returns the snapshot kind the cursor was started with
+func (c *SnapshotCursor) Kind() types.SnapshotKind {
+	return c.kind
+}
+
+// Counts returns the number of jobs the cursor yields, by status
+func (c *SnapshotCursor) Counts() map[types.JobStatus]int {
+	return c.counts
+}
+
+// Len returns the number of jobs the cursor yields
+func (c *SnapshotCursor) Len() int {
+	return len(c.ids)
+}
+
+// Next returns the next job, or io.EOF after the last one
+//
+// The job is a copy owned by the caller.
+//
+// Returns:
+//   - *types.Job: Next job in ID order
+//   - error: io.EOF when done, ErrSnapshotClosed after Close or Restore
+func (c *SnapshotCursor) Next() (*types.Job, error) {
+	if c.closed {
+		return nil, ErrSnapshotClosed
+	}
+	if len(c.batch) == 0 {
+		if c.pos == len(c.ids) {
+			return nil, io.EOF
+		}
+		if err := c.fill(); err != nil {
+			return nil, err
+		}
+	}
+	job := c.batch[0]
+	c.batch[0] = nil
+	c.batch = c.batch[1:]
+	return job, nil
+}
+
+// fill copies the next batch of jobs
+func (c *SnapshotCursor) fill() error {
+	// Sorted on first use, outside the lock
+	if !c.sorted {
+		sort.Slice(c.ids, func(i, j int) bool { return c.ids[i] < c.ids[j] })
+		c.sorted = true
+	}
+	end := min(c.pos+cursorBatch, len(c.ids))
+
+	c.jm.mu.RLock()
+	defer c.jm.mu.RUnlock()
+	if _, open := c.jm.cursors[c]; !open {
+		return ErrSnapshotClosed
+	}
+	c.batch = c.batch[:0]
+	for _, id := range c.ids[c.pos:end] {
+		job, ok := c.saved[id]
+		if !ok {
+			jobCopy := *c.jm.jobs[id] // Jobs are only removed by Restore
+			job = &jobCopy
+		}
+		c.batch = append(c.batch, job)
+	}
+	c.pos = end
+	return nil
+}
+
+// Close releases the cursor; Next returns ErrSnapshotClosed afterwards
+//
+// Concurrency: Protected by mutex; safe to call more than once
+func (c *SnapshotCursor) Close() {
+	c.jm.mu.Lock()
+	defer c.jm.mu.Unlock()
+	delete(c.jm.cursors, c)
+	c.saved = nil
+	c.ids, c.batch = nil, nil
+	c.closed = true
+}
+
+// preserve saves a copy of job for every open cursor before it changes;
+// caller must hold jm.mu for writing
+//
+// Copies are kept even for jobs a cursor has passed or does not cover
+// (partial snapshots); looking that up would cost more than the copy.
+func (jm *JobManager) preserve(job *types.Job) {
+	for c := range jm.cursors {
+		if _, ok := c.saved[job.ID]; !ok {
+			jobCopy := *job
+			c.saved[job.ID] = &jobCopy
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package jobmanager
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+)
+
+// ============================================================================
+// Snapshot Cursor Tests
+// ============================================================================
+
+// readAll drains a job iterator
+func readAll(t *testing.T, it types.JobIterator) []*types.Job {
+	t.Helper()
+	var jobs []*types.Job
+	for {
+		job, err := it.Next()
+		if err == io.EOF {
+			return jobs
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		jobs = append(jobs, job)
+	}
+}
+
+// failingIterator yields its jobs, then err
+type failingIterator struct {
+	jobs []*types.Job
+	err  error
+}
+
+func (it *failingIterator) Next() (*types.Job, error) {
+	if len(it.jobs) == 0 {
+		return nil, it.err
+	}
+	job := it.jobs[0]
+	it.jobs = it.jobs[1:]
+	return job, nil
+}
+
+func TestSnapshotCursorPointInTime(t *testing.T) {
+	jm := newTestJobManager()
+	const n = 3*cursorBatch + 10
+	for i := 0; i < n; i++ {
+		assertNoError(t, jm.Enqueue(newTestJob(fmt.Sprintf("task-%04d", i))))
+	}
+
+	cursor := jm.BeginSnapshot(types.SnapshotFull)
+	defer cursor.Close()
+	if cursor.Len() != n || cursor.Counts()[types.StatusPending] != n {
+		t.Fatalf("cursor has %d jobs, counts %v, want %d pending", cursor.Len(), cursor.Counts(), n)
+	}
+
+	first, err := cursor.Next()
+	assertNoError(t, err)
+	if first.ID != "task-0000" {
+		t.Errorf("first job = %s, want task-0000", first.ID)
+	}
+
+	// Change jobs the cursor has not reached yet
+	late := types.JobID(fmt.Sprintf("task-%04d", n-1))
+	jm.PopPending()
+	assertNoError(t, jm.MarkInFlight("task-0500", time.Now().Add(time.Minute)))
+	assertNoError(t, jm.MarkDead("task-0600"))
+	if attempt, err := jm.IncrementAttempt(late); err != nil || attempt != 1 {
+		t.Errorf("IncrementAttempt() = %d, %v, want 1", attempt, err)
+	}
+	assertNoError(t, jm.Enqueue(newTestJob("task-new")))
+
+	jobs := append([]*types.Job{first}, readAll(t, cursor)...)
+	if len(jobs) != n {
+		t.Fatalf("cursor yielded %d jobs, want %d", len(jobs), n)
+	}
+	for i, job := range jobs {
+		if want := types.JobID(fmt.Sprintf("task-%04d", i)); job.ID != want {
+			t.Errorf("job %d = %s, want %s", i, job.ID, want)
+		}
+		if job.Status != types.StatusPending || job.Attempt != 0 {
+			t.Errorf("job %s = %s attempt %d, want the state at BeginSnapshot", job.ID, job.Status, job.Attempt)
+		}
+	}
+
+	// The live jobs changed
+	assertJobStatus(t, jm, "task-0500", types.StatusInFlight)
+	assertJobStatus(t, jm, "task-0600", types.StatusDead)
+	if got := jm.GetJob(late).Attempt; got != 1 {
+		t.Errorf("live attempt = %d, want 1", got)
+	}
+
+	cursor.Close()
+	if _, err := cursor.Next(); !errors.Is(err, ErrSnapshotClosed) {
+		t.Errorf("Next() after Close error = %v, want ErrSnapshotClosed", err)
+	}
+	if len(jm.cursors) != 0 {
+		t.Errorf("%d cursors still open", len(jm.cursors))
+	}
+}
+
+func TestSnapshotCursorPartial(t *testing.T) {
+	jm := newTestJobManager()
+	for _, id := range []string{"task-001", "task-002", "task-003"} {
+		assertNoError(t, jm.Enqueue(newTestJob(id)))
+	}
+	jm.PopPending()
+	assertNoError(t, jm.MarkInFlight("task-001", time.Now().Add(time.Minute)))
+	assertNoError(t, jm.MarkCompleted("task-001"))
+	jm.PopPending()
+	assertNoError(t, jm.MarkInFlight("task-002", time.Now().Add(time.Minute)))
+
+	cursor := jm.BeginSnapshot(types.SnapshotPartial)
+	defer cursor.Close()
+	jobs := readAll(t, cursor)
+	if len(jobs) != 2 || jobs[0].ID != "task-002" || jobs[1].ID != "task-003" {
+		t.Errorf("partial cursor yielded %v, want task-002 and task-003", jobs)
+	}
+	want := map[types.JobStatus]int{types.StatusInFlight: 1, types.StatusPending: 1}
+	if fmt.Sprint(cursor.Counts()) != fmt.Sprint(want) {
+		t.Errorf("Counts() = %v, want %v", cursor.Counts(), want)
+	}
+	if cursor.Kind() != types.SnapshotPartial {
+		t.Errorf("Kind() = %s, want partial", cursor.Kind())
+	}
+}
+
+func TestSnapshotCursorClosedByRestore(t *testing.T) {
+	jm := newTestJobManager()
+	assertNoError(t, jm.Enqueue(newTestJob("task-001")))
+
+	cursor := jm.BeginSnapshot(types.SnapshotFull)
+	defer cursor.Close()
+	assertNoError(t, jm.Restore(types.SnapshotData{}))
+	if _, err := cursor.Next(); !errors.Is(err, ErrSnapshotClosed) {
+		t.Errorf("Next() after Restore error = %v, want ErrSnapshotClosed", err)
+	}
+}
+
+func TestRestoreStream(t *testing.T) {
+	jm1 := newTestJobManager()
+	for _, id := range []string{"task-001", "task-002", "task-003"} {
+		assertNoError(t, jm1.Enqueue(newTestJob(id)))
+	}
+	jm1.PopPending()
+	assertNoError(t, jm1.MarkInFlight("task-001", time.Now().Add(time.Minute)))
+	assertNoError(t, jm1.MarkDead("task-001"))
+
+	cursor := jm1.BeginSnapshot(types.SnapshotFull)
+	defer cursor.Close()
+	jm2 := newTestJobManager()
+	assertNoError(t, jm2.Enqueue(newTestJob("stale")))
+	assertNoError(t, jm2.RestoreStream(cursor))
+
+	stats1, stats2 := jm1.Stats(), jm2.Stats()
+	for key, value := range stats1 {
+		if stats2[key] != value {
+			t.Errorf("stats[%s]: jm1=%d, jm2=%d", key, value, stats2[key])
+		}
+	}
+	if jm2.GetJob("stale") != nil {
+		t.Error("RestoreStream kept a job from before")
+	}
+	if job := jm2.PopPending(); job == nil || job.ID != "task-002" {
+		t.Errorf("PopPending() = %v, want task-002 (stream order)", job)
+	}
+
+	// A stream failing halfway leaves nothing behind
+	broken := errors.New("checksum mismatch")
+	err := jm2.RestoreStream(&failingIterator{
+		jobs: []*types.Job{{ID: "task-009", Status: types.StatusPending}},
+		err:  broken,
+	})
+	assertError(t, err, broken)
+	if total := jm2.GetTotalJobs(); total != 0 {
+		t.Errorf("GetTotalJobs() = %d after a failed stream, want 0", total)
+	}
+}
@@ -29,6 +29,16 @@
 //      - jobs_pending: Current pending jobs
 //      - jobs_in_flight: Current executing jobs
 //
+//   4. WAL Group Commit (Histogram) - Observed by the WAL writer:
+//      - wal_group_commit_events: Events written per fsync group
+//      - wal_sync_latency_seconds: Write + sync time of one group
+//      - wal_append_latency_seconds: Append request to end of its group
+//
+//   5. Snapshots - Observed by the snapshot manager:
+//      - snapshot_encode_seconds (Histogram): Encode + compress time
+//      - snapshot_compression_ratio (Gauge): JSON size / file size of the last snapshot
+//      - snapshot_size_bytes (Gauge): File size of the last snapshot
+//
 // Use Cases:
 //
 //   Alerting:
@@ -73,8 +83,6 @@
 //
 // Future Extensions:
 //   Possible additional metrics:
-//   - WAL write latency
-//   - Snapshot size and creation time
 //   - Worker pool saturation
 //   - Memory usage
 //
@@ -89,6 +97,7 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -111,6 +120,16 @@ type Collector struct {
 	jobsPending  prometheus.Gauge
 	jobsInFlight prometheus.Gauge
 
+	// WAL group commit metrics
+	walGroupEvents   prometheus.Histogram
+	walSyncLatency   prometheus.Histogram
+	walAppendLatency prometheus.Histogram
+
+	// Snapshot metrics
+	snapshotEncode prometheus.Histogram
+	snapshotRatio  prometheus.Gauge
+	snapshotSize   prometheus.Gauge
+
 	mu sync.Mutex
 }
 
@@ -154,6 +173,34 @@ func NewCollector() *Collector {
 			Name: "queue_jobs_in_flight",
 			Help: "Current number of in-flight jobs",
 		}),
+		walGroupEvents: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "wal_group_commit_events",
+			Help:    "Events written per WAL fsync group",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 13),
+		}),
+		walSyncLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "wal_sync_latency_seconds",
+			Help:    "Time to write and sync one WAL fsync group",
+			Buckets: prometheus.ExponentialBuckets(0.00005, 2, 16),
+		}),
+		walAppendLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "wal_append_latency_seconds",
+			Help:    "Time from a WAL append request to the end of its fsync group",
+			Buckets: prometheus.ExponentialBuckets(0.00005, 2, 16),
+		}),
+		snapshotEncode: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "snapshot_encode_seconds",
+			Help:    "Time to encode and compress one snapshot, before sync",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 16),
+		}),
+		snapshotRatio: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "snapshot_compression_ratio",
+			Help: "Uncompressed size divided by file size of the last snapshot",
+		}),
+		snapshotSize: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "snapshot_size_bytes",
+			Help: "File size of the last snapshot in bytes",
+		}),
 	}
 
 	// Register all metrics
@@ -166,6 +213,12 @@ func NewCollector() *Collector {
 	prometheus.MustRegister(c.recoveryTime)
 	prometheus.MustRegister(c.jobsPending)
 	prometheus.MustRegister(c.jobsInFlight)
+	prometheus.MustRegister(c.walGroupEvents)
+	prometheus.MustRegister(c.walSyncLatency)
+	prometheus.MustRegister(c.walAppendLatency)
+	prometheus.MustRegister(c.snapshotEncode)
+	prometheus.MustRegister(c.snapshotRatio)
+	prometheus.MustRegister(c.snapshotSize)
 
 	return c
 }
@@ -207,6 +260,24 @@ func (c *Collector) UpdateQueueStats(pending, inFlight int) {
 	c.jobsInFlight.Set(float64(inFlight))
 }
 
+// ObserveWALGroup records one WAL fsync group (implements wal.Metrics)
+func (c *Collector) ObserveWALGroup(events int, syncTime time.Duration) {
+	c.walGroupEvents.Observe(float64(events))
+	c.walSyncLatency.Observe(syncTime.Seconds())
+}
+
+// ObserveWALAppend records the latency of one WAL append (implements wal.Metrics)
+func (c *Collector) ObserveWALAppend(latency time.Duration) {
+	c.walAppendLatency.Observe(latency.Seconds())
+}
+
+// ObserveSnapshot records one written snapshot (implements snapshot.Metrics)
+func (c *Collector) ObserveSnapshot(encode time.Duration, ratio float64, size int64) {
+	c.snapshotEncode.Observe(encode.Seconds())
+	c.snapshotRatio.Set(ratio)
+	c.snapshotSize.Set(float64(size))
+}
+
 // StartServer starts Prometheus metrics HTTP server
 //
 // Parameters:
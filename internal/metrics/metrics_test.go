@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
@@ -108,6 +109,52 @@ func TestSetRecoveryTime(t *testing.T) {
 	}
 }
 
+func TestObserveWAL(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	prometheus.DefaultRegisterer = registry
+	collector := NewCollector()
+
+	collector.ObserveWALGroup(8, 2*time.Millisecond)
+	collector.ObserveWALAppend(3 * time.Millisecond)
+	collector.ObserveWALAppend(time.Millisecond)
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	counts := make(map[string]uint64)
+	for _, family := range families {
+		if h := family.GetMetric()[0].GetHistogram(); h != nil {
+			counts[family.GetName()] = h.GetSampleCount()
+		}
+	}
+	assert.Equal(t, uint64(1), counts["wal_group_commit_events"])
+	assert.Equal(t, uint64(1), counts["wal_sync_latency_seconds"])
+	assert.Equal(t, uint64(2), counts["wal_append_latency_seconds"])
+}
+
+func TestObserveSnapshot(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	prometheus.DefaultRegisterer = registry
+	collector := NewCollector()
+
+	collector.ObserveSnapshot(40*time.Millisecond, 4.5, 2048)
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	values := make(map[string]float64)
+	for _, family := range families {
+		metric := family.GetMetric()[0]
+		switch {
+		case metric.GetHistogram() != nil:
+			values[family.GetName()] = float64(metric.GetHistogram().GetSampleCount())
+		case metric.GetGauge() != nil:
+			values[family.GetName()] = metric.GetGauge().GetValue()
+		}
+	}
+	assert.Equal(t, 1.0, values["snapshot_encode_seconds"])
+	assert.Equal(t, 4.5, values["snapshot_compression_ratio"])
+	assert.Equal(t, 2048.0, values["snapshot_size_bytes"])
+}
+
 func TestUpdateQueueStats(t *testing.T) {
 	prometheus.DefaultRegisterer = prometheus.NewRegistry()
 	collector := NewCollector()
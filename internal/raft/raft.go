@@ -50,6 +50,13 @@ type Transport interface {
 	SendAppendEntries(peer string, args *AppendEntriesArgs) (*AppendEntriesReply, error)
 }
 
+// PeerHealthChecker is optionally implemented by transports that track
+// peer liveness (e.g. GrpcTransport). The leader skips unhealthy peers
+// instead of spawning RPCs that are bound to time out.
+type PeerHealthChecker interface {
+	IsPeerHealthy(peer string) bool
+}
+
 // Raft implements the Raft consensus algorithm
 type Raft struct {
 	mu sync.Mutex
@@ -178,10 +185,14 @@ func (rf *Raft) convertToLeader() {
 }
 
 func (rf *Raft) broadcastHeartbeats() {
+	health, _ := rf.transport.(PeerHealthChecker)
 	for _, peer := range rf.config.Peers {
 		if peer == rf.config.ID {
 			continue
 		}
+		if health != nil && !health.IsPeerHealthy(peer) {
+			continue
+		}
 		go rf.replicateToPeer(peer)
 	}
 }
@@ -395,6 +406,8 @@ func (rf *Raft) Propose(command []byte) (int64, int64, bool) {
 }
 
 // Snapshot truncates the log up to index and saves snapshot data.
+// The bytes are not kept: the state machine persists its own snapshot
+// files, so callers may pass nil.
 func (rf *Raft) Snapshot(index int64, snapshot []byte) {
 	rf.mu.Lock()
 	defer rf.mu.Unlock()
@@ -417,3 +430,19 @@ func (rf *Raft) Snapshot(index int64, snapshot []byte) {
 	
 	rf.logger.Info("Raft log compacted", "lastIncludedIndex", index)
 }
+
+// TermAt returns the term of the log entry at index, or false if the
+// entry is neither in the log nor the last one compacted into a snapshot.
+func (rf *Raft) TermAt(index int64) (int64, bool) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if index == rf.lastIncludedIndex {
+		return rf.lastIncludedTerm, true
+	}
+	entry, err := rf.logStore.GetLog(index)
+	if err != nil {
+		return 0, false
+	}
+	return entry.Term, true
+}
@@ -2,42 +2,291 @@ package raft
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	pb "github.com/ChuLiYu/raft-recovery/api/proto/v1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
 )
 
+// ErrTransportClosed is returned by RPCs issued after Close
+var ErrTransportClosed = errors.New("raft transport is closed")
+
+// TransportConfig tunes connection management for GrpcTransport
+//
+// Durations accept YAML strings such as "100ms" or "2s".
+type TransportConfig struct {
+	// Per-RPC deadlines
+	RequestVoteTimeout   time.Duration `yaml:"request_vote_timeout"`
+	AppendEntriesTimeout time.Duration `yaml:"append_entries_timeout"`
+
+	// Client keepalive: ping idle connections so dead peers are detected
+	// even when no RPC is in flight
+	KeepaliveTime    time.Duration `yaml:"keepalive_time"`
+	KeepaliveTimeout time.Duration `yaml:"keepalive_timeout"`
+
+	// Reconnect backoff, used both by gRPC's dialer and by peer health
+	BackoffBaseDelay time.Duration `yaml:"backoff_base_delay"`
+	BackoffMaxDelay  time.Duration `yaml:"backoff_max_delay"`
+
+	// Consecutive RPC failures before a peer is considered unhealthy
+	FailureThreshold int `yaml:"failure_threshold"`
+
+	// Credentials used when dialing peers (insecure if nil), e.g. from
+	// security.DialCredentials
+	Credentials credentials.TransportCredentials `yaml:"-"`
+}
+
+// DefaultTransportConfig returns conservative defaults for a LAN cluster
+func DefaultTransportConfig() TransportConfig {
+	return TransportConfig{
+		RequestVoteTimeout:   100 * time.Millisecond,
+		AppendEntriesTimeout: 100 * time.Millisecond,
+		KeepaliveTime:        10 * time.Second,
+		KeepaliveTimeout:     3 * time.Second,
+		BackoffBaseDelay:     100 * time.Millisecond,
+		BackoffMaxDelay:      5 * time.Second,
+		FailureThreshold:     3,
+	}
+}
+
+// withDefaults fills zero fields from DefaultTransportConfig
+func (c TransportConfig) withDefaults() TransportConfig {
+	d := DefaultTransportConfig()
+	if c.RequestVoteTimeout <= 0 {
+		c.RequestVoteTimeout = d.RequestVoteTimeout
+	}
+	if c.AppendEntriesTimeout <= 0 {
+		c.AppendEntriesTimeout = d.AppendEntriesTimeout
+	}
+	if c.KeepaliveTime <= 0 {
+		c.KeepaliveTime = d.KeepaliveTime
+	}
+	if c.KeepaliveTimeout <= 0 {
+		c.KeepaliveTimeout = d.KeepaliveTimeout
+	}
+	if c.BackoffBaseDelay <= 0 {
+		c.BackoffBaseDelay = d.BackoffBaseDelay
+	}
+	if c.BackoffMaxDelay <= 0 {
+		c.BackoffMaxDelay = d.BackoffMaxDelay
+	}
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = d.FailureThreshold
+	}
+	if c.Credentials == nil {
+		c.Credentials = insecure.NewCredentials()
+	}
+	return c
+}
+
+// ServerOptions returns the keepalive enforcement policy a server must use
+// to accept pings from clients configured with c
+func (c TransportConfig) ServerOptions() []grpc.ServerOption {
+	c = c.withDefaults()
+	return []grpc.ServerOption{
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             c.KeepaliveTime / 2,
+			PermitWithoutStream: true,
+		}),
+	}
+}
+
+// PeerHealth describes the connection state of one peer
+type PeerHealth struct {
+	Healthy             bool
+	ConsecutiveFailures int
+	LastSuccess         time.Time
+	LastFailure         time.Time
+	RetryAfter          time.Time // Zero unless the peer is in backoff
+	State               string    // gRPC connectivity state
+}
+
+// peerConn holds the cached connection and health tracking for one peer
+type peerConn struct {
+	conn   *grpc.ClientConn
+	client pb.FalconQueueServiceClient
+
+	failures    int
+	lastSuccess time.Time
+	lastFailure time.Time
+	retryAfter  time.Time
+}
+
 // GrpcTransport implements the Transport interface using gRPC
+//
+// Connections are created lazily per peer, shared by all RPC goroutines and
+// kept alive with client pings. Consecutive RPC failures put the peer into
+// exponential backoff; IsPeerHealthy lets the leader skip it until the
+// backoff expires.
 type GrpcTransport struct {
-	// Cache connections to peers to avoid reconnecting every time
-	conns map[string]*grpc.ClientConn
+	config TransportConfig
+
+	mu     sync.Mutex
+	peers  map[string]*peerConn
+	closed bool
 }
 
-// NewGrpcTransport creates a new GrpcTransport
+// NewGrpcTransport creates a new GrpcTransport using plaintext connections
 func NewGrpcTransport() *GrpcTransport {
+	return NewGrpcTransportWithConfig(DefaultTransportConfig())
+}
+
+// NewGrpcTransportWithConfig creates a GrpcTransport with explicit tuning;
+// zero fields fall back to DefaultTransportConfig
+func NewGrpcTransportWithConfig(config TransportConfig) *GrpcTransport {
 	return &GrpcTransport{
-		conns: make(map[string]*grpc.ClientConn),
+		config: config.withDefaults(),
+		peers:  make(map[string]*peerConn),
 	}
 }
 
 // getClient returns a gRPC client for the given peer address
 func (t *GrpcTransport) getClient(peerAddr string) (pb.FalconQueueServiceClient, error) {
-	if conn, ok := t.conns[peerAddr]; ok {
-		return pb.NewFalconQueueServiceClient(conn), nil
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil, ErrTransportClosed
+	}
+	if pc, ok := t.peers[peerAddr]; ok && pc.conn != nil {
+		return pc.client, nil
 	}
 
-	// Create new connection
-	// In production, we should handle connection lifecycle better (e.g. keepalive, backoff)
-	conn, err := grpc.NewClient(peerAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.NewClient(peerAddr,
+		grpc.WithTransportCredentials(t.config.Credentials),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                t.config.KeepaliveTime,
+			Timeout:             t.config.KeepaliveTimeout,
+			PermitWithoutStream: true,
+		}),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff: backoff.Config{
+				BaseDelay:  t.config.BackoffBaseDelay,
+				Multiplier: backoff.DefaultConfig.Multiplier,
+				Jitter:     backoff.DefaultConfig.Jitter,
+				MaxDelay:   t.config.BackoffMaxDelay,
+			},
+		}),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial peer %s: %w", peerAddr, err)
 	}
 
-	t.conns[peerAddr] = conn
-	return pb.NewFalconQueueServiceClient(conn), nil
+	pc := t.peers[peerAddr]
+	if pc == nil {
+		pc = &peerConn{}
+		t.peers[peerAddr] = pc
+	}
+	pc.conn = conn
+	pc.client = pb.NewFalconQueueServiceClient(conn)
+	return pc.client, nil
+}
+
+// recordResult updates peer health after an RPC
+func (t *GrpcTransport) recordResult(peerAddr string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pc := t.peers[peerAddr]
+	if pc == nil {
+		return
+	}
+
+	now := time.Now()
+	if err == nil {
+		pc.failures = 0
+		pc.lastSuccess = now
+		pc.retryAfter = time.Time{}
+		return
+	}
+
+	pc.failures++
+	pc.lastFailure = now
+	if pc.failures >= t.config.FailureThreshold {
+		pc.retryAfter = now.Add(t.backoffDelay(pc.failures - t.config.FailureThreshold))
+	}
+}
+
+// backoffDelay returns base * 2^attempt capped at the max delay
+func (t *GrpcTransport) backoffDelay(attempt int) time.Duration {
+	delay := t.config.BackoffBaseDelay
+	for i := 0; i < attempt && delay < t.config.BackoffMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > t.config.BackoffMaxDelay {
+		delay = t.config.BackoffMaxDelay
+	}
+	return delay
+}
+
+// IsPeerHealthy reports whether RPCs should be sent to peer right now
+//
+// A peer is unhealthy while it is inside its failure backoff window. Once
+// the window expires the peer is reported healthy again so the next RPC
+// acts as a probe.
+func (t *GrpcTransport) IsPeerHealthy(peerAddr string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pc := t.peers[peerAddr]
+	if pc == nil {
+		return true // Never contacted, give it a chance
+	}
+	return pc.retryAfter.IsZero() || time.Now().After(pc.retryAfter)
+}
+
+// PeerHealth returns a health report for every peer contacted so far
+func (t *GrpcTransport) PeerHealth() map[string]PeerHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	report := make(map[string]PeerHealth, len(t.peers))
+	for addr, pc := range t.peers {
+		h := PeerHealth{
+			Healthy:             pc.retryAfter.IsZero() || now.After(pc.retryAfter),
+			ConsecutiveFailures: pc.failures,
+			LastSuccess:         pc.lastSuccess,
+			LastFailure:         pc.lastFailure,
+			RetryAfter:          pc.retryAfter,
+			State:               connectivity.Shutdown.String(),
+		}
+		if pc.conn != nil {
+			h.State = pc.conn.GetState().String()
+		}
+		report[addr] = h
+	}
+	return report
+}
+
+// Close closes every peer connection; further RPCs return ErrTransportClosed
+func (t *GrpcTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+
+	var errs []error
+	for addr, pc := range t.peers {
+		if pc.conn != nil {
+			if err := pc.conn.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("close %s: %w", addr, err))
+			}
+			pc.conn = nil
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // SendRequestVote sends a RequestVote RPC to a peer
@@ -47,7 +296,7 @@ func (t *GrpcTransport) SendRequestVote(peer string, args *RequestVoteArgs) (*Re
 		return nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond) // Short timeout for RPCs
+	ctx, cancel := context.WithTimeout(context.Background(), t.config.RequestVoteTimeout)
 	defer cancel()
 
 	req := &pb.RequestVoteRequest{
@@ -58,6 +307,7 @@ func (t *GrpcTransport) SendRequestVote(peer string, args *RequestVoteArgs) (*Re
 	}
 
 	resp, err := client.RequestVote(ctx, req)
+	t.recordResult(peer, err)
 	if err != nil {
 		return nil, err
 	}
@@ -75,7 +325,7 @@ func (t *GrpcTransport) SendAppendEntries(peer string, args *AppendEntriesArgs)
 		return nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), t.config.AppendEntriesTimeout)
 	defer cancel()
 
 	// Convert log entries
@@ -101,6 +351,7 @@ func (t *GrpcTransport) SendAppendEntries(peer string, args *AppendEntriesArgs)
 	}
 
 	resp, err := client.AppendEntries(ctx, req)
+	t.recordResult(peer, err)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,114 @@
+package raft
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/ChuLiYu/raft-recovery/api/proto/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// peerStub answers Raft RPCs with a fixed term
+type peerStub struct {
+	pb.UnimplementedFalconQueueServiceServer
+}
+
+func (peerStub) RequestVote(context.Context, *pb.RequestVoteRequest) (*pb.RequestVoteResponse, error) {
+	return &pb.RequestVoteResponse{Term: 7, VoteGranted: true}, nil
+}
+
+func (peerStub) AppendEntries(context.Context, *pb.AppendEntriesRequest) (*pb.AppendEntriesResponse, error) {
+	return &pb.AppendEntriesResponse{Term: 7, Success: true}, nil
+}
+
+func startPeer(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := grpc.NewServer(DefaultTransportConfig().ServerOptions()...)
+	pb.RegisterFalconQueueServiceServer(srv, peerStub{})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String()
+}
+
+// TestTransportConcurrentRPCs exercises the shared connection cache from many goroutines
+func TestTransportConcurrentRPCs(t *testing.T) {
+	addr := startPeer(t)
+	trans := NewGrpcTransportWithConfig(TransportConfig{
+		RequestVoteTimeout:   time.Second,
+		AppendEntriesTimeout: time.Second,
+	})
+	defer trans.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				reply, err := trans.SendAppendEntries(addr, &AppendEntriesArgs{Term: 1})
+				assert.NoError(t, err)
+				assert.True(t, reply.Success)
+			} else {
+				reply, err := trans.SendRequestVote(addr, &RequestVoteArgs{Term: 1})
+				assert.NoError(t, err)
+				assert.True(t, reply.VoteGranted)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	health := trans.PeerHealth()
+	require.Contains(t, health, addr)
+	assert.True(t, health[addr].Healthy)
+	assert.Zero(t, health[addr].ConsecutiveFailures)
+}
+
+// TestTransportPeerBackoff verifies dead peers are reported unhealthy after repeated failures
+func TestTransportPeerBackoff(t *testing.T) {
+	// Reserve a port and close it so nothing is listening
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	deadAddr := lis.Addr().String()
+	lis.Close()
+
+	trans := NewGrpcTransportWithConfig(TransportConfig{
+		AppendEntriesTimeout: 50 * time.Millisecond,
+		BackoffBaseDelay:     time.Hour,
+		BackoffMaxDelay:      time.Hour,
+		FailureThreshold:     2,
+	})
+	defer trans.Close()
+
+	assert.True(t, trans.IsPeerHealthy(deadAddr), "unknown peers start healthy")
+
+	for i := 0; i < 2; i++ {
+		_, err := trans.SendAppendEntries(deadAddr, &AppendEntriesArgs{})
+		assert.Error(t, err)
+	}
+
+	assert.False(t, trans.IsPeerHealthy(deadAddr))
+	assert.Equal(t, 2, trans.PeerHealth()[deadAddr].ConsecutiveFailures)
+}
+
+// TestTransportClose verifies RPCs fail fast after Close
+func TestTransportClose(t *testing.T) {
+	addr := startPeer(t)
+	trans := NewGrpcTransport()
+
+	_, err := trans.SendRequestVote(addr, &RequestVoteArgs{})
+	require.NoError(t, err)
+
+	require.NoError(t, trans.Close())
+	require.NoError(t, trans.Close(), "Close is idempotent")
+
+	_, err = trans.SendRequestVote(addr, &RequestVoteArgs{})
+	assert.ErrorIs(t, err, ErrTransportClosed)
+}
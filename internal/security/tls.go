@@ -0,0 +1,348 @@
+// ============================================================================
+// Beaver-Raft Security - Mutual TLS for gRPC Transports
+// ============================================================================
+//
+// Package: internal/security
+// File: tls.go
+// Purpose: Build reloadable mTLS credentials for the master, Raft peers and workers
+//
+// Design:
+//   Every gRPC endpoint in the cluster (Raft transport, worker pull source,
+//   enqueue client, master server) authenticates both sides with X.509:
+//   - Server side requires and verifies a client certificate signed by the CA
+//   - Client side verifies the server certificate against the same CA
+//   - Identity (CN / SANs) of the verified peer is used for authorization
+//     (see authz.go)
+//
+//   Raft peer mTLS is deferred: the CLI starts no Raft node yet, so no Raft
+//   transport dials with these credentials. The raft_peers allowlist only
+//   guards the master's RequestVote / AppendEntries handlers.
+//
+// Certificate Reload:
+//   Certificates are short-lived in most deployments, so restarting a node
+//   on every rotation is not acceptable:
+//   - CA, cert and key files are re-read when their modification time changes
+//   - Files are checked lazily on handshake, at most once per ReloadInterval
+//   - A failed reload keeps serving the last good material and logs a warning
+//   - Existing connections are unaffected; new handshakes pick up new files
+//
+// Configuration (YAML):
+//   tls:
+//     enabled: true
+//     reload_interval_seconds: 30
+//     server:
+//       ca_file: certs/ca.pem
+//       cert_file: certs/node-1.pem
+//       key_file: certs/node-1-key.pem
+//     client:
+//       ca_file: certs/ca.pem
+//       cert_file: certs/node-1.pem
+//       key_file: certs/node-1-key.pem
+//       server_name: ""            # Optional SNI / verification override
+//     authorization:
+//       raft_peers: ["node-1", "node-2", "node-3"]
+//       workers: ["worker-*"]
+//       watchers: ["cdc-*"]          # WatchEvents streams every job payload
+//
+// ============================================================================
+
+package security
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+var log = slog.Default()
+
+// ============================================================================
+// Error Definitions
+// ============================================================================
+
+var (
+	ErrTLSDisabled  = errors.New("tls is not enabled")
+	ErrMissingFiles = errors.New("tls requires ca_file, cert_file and key_file")
+	ErrInvalidCA    = errors.New("no valid certificates found in CA file")
+)
+
+// ============================================================================
+// Configuration
+// ============================================================================
+
+// DefaultReloadInterval is how often certificate files are checked for changes
+const DefaultReloadInterval = 30 * time.Second
+
+// Config holds the mTLS configuration for one node
+type Config struct {
+	Enabled               bool          `yaml:"enabled"`
+	ReloadIntervalSeconds int           `yaml:"reload_interval_seconds"`
+	Server                EndpointFiles `yaml:"server"`
+	Client                EndpointFiles `yaml:"client"`
+	Authorization         Policy        `yaml:"authorization"`
+}
+
+// EndpointFiles holds the PEM file paths for one side of a connection
+type EndpointFiles struct {
+	CAFile     string `yaml:"ca_file"`
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+	ServerName string `yaml:"server_name,omitempty"` // Client only: override verified server name
+}
+
+// reloadInterval returns the configured reload interval or the default
+func (c Config) reloadInterval() time.Duration {
+	if c.ReloadIntervalSeconds <= 0 {
+		return DefaultReloadInterval
+	}
+	return time.Duration(c.ReloadIntervalSeconds) * time.Second
+}
+
+func (f EndpointFiles) validate() error {
+	if f.CAFile == "" || f.CertFile == "" || f.KeyFile == "" {
+		return ErrMissingFiles
+	}
+	return nil
+}
+
+// ============================================================================
+// Public Constructors
+// ============================================================================
+
+// ServerCredentials builds reloadable mTLS credentials for a gRPC server
+//
+// The server requires every client to present a certificate signed by
+// the configured CA.
+func ServerCredentials(cfg Config) (credentials.TransportCredentials, error) {
+	if !cfg.Enabled {
+		return nil, ErrTLSDisabled
+	}
+	r, err := newReloader(cfg.Server, cfg.reloadInterval())
+	if err != nil {
+		return nil, fmt.Errorf("server tls: %w", err)
+	}
+	return &reloadingCreds{reloader: r}, nil
+}
+
+// ClientCredentials builds reloadable mTLS credentials for a gRPC client
+func ClientCredentials(cfg Config) (credentials.TransportCredentials, error) {
+	if !cfg.Enabled {
+		return nil, ErrTLSDisabled
+	}
+	r, err := newReloader(cfg.Client, cfg.reloadInterval())
+	if err != nil {
+		return nil, fmt.Errorf("client tls: %w", err)
+	}
+	return &reloadingCreds{reloader: r, serverName: cfg.Client.ServerName}, nil
+}
+
+// ServerOptions returns the gRPC server options for the given config
+//
+// With TLS disabled no options are returned and the server stays plaintext.
+// With TLS enabled the options install mTLS credentials and the
+// authorization interceptors.
+func ServerOptions(cfg Config) ([]grpc.ServerOption, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	creds, err := ServerCredentials(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return []grpc.ServerOption{
+		grpc.Creds(creds),
+		grpc.UnaryInterceptor(cfg.Authorization.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(cfg.Authorization.StreamServerInterceptor()),
+	}, nil
+}
+
+// DialCredentials returns client transport credentials for the given config
+//
+// Falls back to insecure credentials when TLS is disabled, so callers can
+// always pass the result to grpc.WithTransportCredentials.
+func DialCredentials(cfg Config) (credentials.TransportCredentials, error) {
+	if !cfg.Enabled {
+		return insecure.NewCredentials(), nil
+	}
+	return ClientCredentials(cfg)
+}
+
+// ============================================================================
+// Reloading Credentials
+// ============================================================================
+
+// reloadingCreds implements credentials.TransportCredentials on top of a
+// certReloader. A fresh tls.Config is built for every handshake so that
+// rotated CA bundles and certificates take effect without a restart.
+type reloadingCreds struct {
+	reloader   *certReloader
+	serverName string
+}
+
+func (c *reloadingCreds) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	cfg, err := c.reloader.clientConfig(c.serverName)
+	if err != nil {
+		return nil, nil, err
+	}
+	return credentials.NewTLS(cfg).ClientHandshake(ctx, authority, conn)
+}
+
+func (c *reloadingCreds) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	cfg, err := c.reloader.serverConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	return credentials.NewTLS(cfg).ServerHandshake(conn)
+}
+
+func (c *reloadingCreds) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{
+		SecurityProtocol: "tls",
+		SecurityVersion:  "1.2",
+		ServerName:       c.serverName,
+	}
+}
+
+func (c *reloadingCreds) Clone() credentials.TransportCredentials {
+	clone := *c
+	return &clone
+}
+
+// OverrideServerName is part of the TransportCredentials interface (deprecated upstream)
+func (c *reloadingCreds) OverrideServerName(name string) error {
+	c.serverName = name
+	return nil
+}
+
+// ============================================================================
+// Certificate Reloader
+// ============================================================================
+
+// certReloader caches parsed key material and re-reads the PEM files when
+// their modification times change
+type certReloader struct {
+	files    EndpointFiles
+	interval time.Duration
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	pool      *x509.CertPool
+	modTimes  [3]time.Time // CA, cert, key
+	lastCheck time.Time
+}
+
+func newReloader(files EndpointFiles, interval time.Duration) (*certReloader, error) {
+	if err := files.validate(); err != nil {
+		return nil, err
+	}
+	r := &certReloader{files: files, interval: interval}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load reads and parses all files unconditionally
+func (r *certReloader) load() error {
+	caPEM, err := os.ReadFile(r.files.CAFile)
+	if err != nil {
+		return fmt.Errorf("failed to read CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("%w: %s", ErrInvalidCA, r.files.CAFile)
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load key pair: %w", err)
+	}
+
+	modTimes, err := r.statFiles()
+	if err != nil {
+		return err
+	}
+
+	r.pool = pool
+	r.cert = &cert
+	r.modTimes = modTimes
+	r.lastCheck = time.Now()
+	return nil
+}
+
+func (r *certReloader) statFiles() ([3]time.Time, error) {
+	var times [3]time.Time
+	for i, path := range []string{r.files.CAFile, r.files.CertFile, r.files.KeyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return times, fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		times[i] = info.ModTime()
+	}
+	return times, nil
+}
+
+// current returns the active key material, reloading it if the files
+// changed since the last check
+func (r *certReloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.lastCheck) < r.interval {
+		return r.cert, r.pool
+	}
+	r.lastCheck = time.Now()
+
+	modTimes, err := r.statFiles()
+	if err != nil {
+		log.Warn("TLS reload check failed, keeping previous certificates", "error", err)
+		return r.cert, r.pool
+	}
+	if modTimes == r.modTimes {
+		return r.cert, r.pool
+	}
+
+	if err := r.load(); err != nil {
+		log.Warn("TLS reload failed, keeping previous certificates", "error", err)
+		return r.cert, r.pool
+	}
+	log.Info("TLS certificates reloaded", "cert", r.files.CertFile)
+	return r.cert, r.pool
+}
+
+func (r *certReloader) serverConfig() (*tls.Config, error) {
+	cert, pool := r.current()
+	if cert == nil {
+		return nil, errors.New("tls: no server certificate loaded")
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{*cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+func (r *certReloader) clientConfig(serverName string) (*tls.Config, error) {
+	cert, pool := r.current()
+	if cert == nil {
+		return nil, errors.New("tls: no client certificate loaded")
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{*cert},
+		RootCAs:      pool,
+		ServerName:   serverName,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
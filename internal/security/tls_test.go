@@ -0,0 +1,292 @@
+package security
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "github.com/ChuLiYu/raft-recovery/api/proto/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ============================================================================
+// Test Helpers
+// ============================================================================
+
+// testCA is a throwaway certificate authority for tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "beaver-raft-test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue writes a leaf certificate with the given CN into dir and
+// returns the cert and key paths
+func (ca *testCA) issue(t *testing.T, dir, cn string, serial int64) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn, "localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPath := filepath.Join(dir, cn+".pem")
+	keyPath := filepath.Join(dir, cn+"-key.pem")
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certPath, keyPath
+}
+
+// stubServer answers every RPC with an empty response
+type stubServer struct {
+	pb.UnimplementedFalconQueueServiceServer
+}
+
+func (stubServer) PollJobs(context.Context, *pb.PollJobsRequest) (*pb.PollJobsResponse, error) {
+	return &pb.PollJobsResponse{}, nil
+}
+
+func (stubServer) RequestVote(context.Context, *pb.RequestVoteRequest) (*pb.RequestVoteResponse, error) {
+	return &pb.RequestVoteResponse{}, nil
+}
+
+func (stubServer) SubmitJob(context.Context, *pb.SubmitJobRequest) (*pb.SubmitJobResponse, error) {
+	return &pb.SubmitJobResponse{Success: true}, nil
+}
+
+func (stubServer) WatchEvents(*pb.WatchEventsRequest, pb.FalconQueueService_WatchEventsServer) error {
+	return nil
+}
+
+// startServer starts an mTLS gRPC server and returns its address
+func startServer(t *testing.T, cfg Config) string {
+	t.Helper()
+	opts, err := ServerOptions(cfg)
+	require.NoError(t, err)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := grpc.NewServer(opts...)
+	pb.RegisterFalconQueueServiceServer(srv, stubServer{})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	return lis.Addr().String()
+}
+
+func dialAs(t *testing.T, addr, caFile, certFile, keyFile string) pb.FalconQueueServiceClient {
+	t.Helper()
+	creds, err := ClientCredentials(Config{
+		Enabled: true,
+		Client:  EndpointFiles{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, ServerName: "localhost"},
+	})
+	require.NoError(t, err)
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewFalconQueueServiceClient(conn)
+}
+
+// ============================================================================
+// Tests
+// ============================================================================
+
+// TestMutualTLSAuthorization verifies per-method identity checks
+func TestMutualTLSAuthorization(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, ca.pem, 0600))
+
+	serverCert, serverKey := ca.issue(t, dir, "node-1", 2)
+	peerCert, peerKey := ca.issue(t, dir, "node-2", 3)
+	workerCert, workerKey := ca.issue(t, dir, "worker-7", 4)
+	clientCert, clientKey := ca.issue(t, dir, "submitter", 5)
+
+	addr := startServer(t, Config{
+		Enabled: true,
+		Server:  EndpointFiles{CAFile: caFile, CertFile: serverCert, KeyFile: serverKey},
+		Authorization: Policy{
+			RaftPeers: []string{"node-1", "node-2", "node-3"},
+			Workers:   []string{"worker-*"},
+		},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	peerClient := dialAs(t, addr, caFile, peerCert, peerKey)
+	workerClient := dialAs(t, addr, caFile, workerCert, workerKey)
+	otherClient := dialAs(t, addr, caFile, clientCert, clientKey)
+
+	// Cluster member may vote, worker may not
+	_, err := peerClient.RequestVote(ctx, &pb.RequestVoteRequest{})
+	assert.NoError(t, err)
+	_, err = workerClient.RequestVote(ctx, &pb.RequestVoteRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Worker may poll, cluster member and plain client may not
+	_, err = workerClient.PollJobs(ctx, &pb.PollJobsRequest{})
+	assert.NoError(t, err)
+	_, err = otherClient.PollJobs(ctx, &pb.PollJobsRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Unrestricted RPCs only need a CA-signed certificate
+	_, err = otherClient.SubmitJob(ctx, &pb.SubmitJobRequest{})
+	assert.NoError(t, err)
+}
+
+// TestStreamAuthorization verifies streaming RPCs are checked like unary ones
+func TestStreamAuthorization(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, ca.pem, 0600))
+
+	serverCert, serverKey := ca.issue(t, dir, "node-1", 2)
+	workerCert, workerKey := ca.issue(t, dir, "worker-7", 3)
+	watcherCert, watcherKey := ca.issue(t, dir, "cdc-1", 4)
+
+	addr := startServer(t, Config{
+		Enabled: true,
+		Server:  EndpointFiles{CAFile: caFile, CertFile: serverCert, KeyFile: serverKey},
+		Authorization: Policy{
+			Workers:  []string{"worker-*"},
+			Watchers: []string{"cdc-*"},
+		},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// A worker certificate may not read the change stream
+	stream, err := dialAs(t, addr, caFile, workerCert, workerKey).WatchEvents(ctx, &pb.WatchEventsRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	stream, err = dialAs(t, addr, caFile, watcherCert, watcherKey).WatchEvents(ctx, &pb.WatchEventsRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+// TestUntrustedClientRejected verifies certificates from a foreign CA fail the handshake
+func TestUntrustedClientRejected(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, ca.pem, 0600))
+	serverCert, serverKey := ca.issue(t, dir, "node-1", 2)
+
+	rogueDir := t.TempDir()
+	rogue := newTestCA(t)
+	rogueCert, rogueKey := rogue.issue(t, rogueDir, "worker-1", 2)
+
+	addr := startServer(t, Config{
+		Enabled:       true,
+		Server:        EndpointFiles{CAFile: caFile, CertFile: serverCert, KeyFile: serverKey},
+		Authorization: Policy{Workers: []string{"worker-*"}},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	client := dialAs(t, addr, caFile, rogueCert, rogueKey)
+	_, err := client.PollJobs(ctx, &pb.PollJobsRequest{})
+	assert.Error(t, err)
+}
+
+// TestCertificateReload verifies rotated certificates are picked up without restart
+func TestCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, ca.pem, 0600))
+	certFile, keyFile := ca.issue(t, dir, "node-1", 2)
+
+	r, err := newReloader(EndpointFiles{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}, time.Millisecond)
+	require.NoError(t, err)
+	before, _ := r.current()
+
+	// Issue a new certificate into the same paths with a newer mtime
+	time.Sleep(10 * time.Millisecond)
+	ca.issue(t, dir, "node-1", 99)
+	future := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+
+	time.Sleep(5 * time.Millisecond)
+	after, _ := r.current()
+	require.NotNil(t, after)
+
+	leaf, err := x509.ParseCertificate(after.Certificate[0])
+	require.NoError(t, err)
+	assert.Equal(t, int64(99), leaf.SerialNumber.Int64())
+	assert.NotSame(t, before, after)
+}
+
+// TestDisabledConfig verifies plaintext fallbacks when TLS is disabled
+func TestDisabledConfig(t *testing.T) {
+	opts, err := ServerOptions(Config{})
+	assert.NoError(t, err)
+	assert.Empty(t, opts)
+
+	creds, err := DialCredentials(Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, "insecure", creds.Info().SecurityProtocol)
+
+	_, err = ServerCredentials(Config{Enabled: true})
+	assert.ErrorIs(t, err, ErrMissingFiles)
+}
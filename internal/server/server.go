@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -10,8 +11,11 @@ import (
 	pb "github.com/ChuLiYu/raft-recovery/api/proto/v1"
 	"github.com/ChuLiYu/raft-recovery/internal/controller"
 	"github.com/ChuLiYu/raft-recovery/internal/raft"
+	"github.com/ChuLiYu/raft-recovery/internal/storage/wal"
 	"github.com/ChuLiYu/raft-recovery/internal/worker"
 	"github.com/ChuLiYu/raft-recovery/pkg/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // Server implements the gRPC server for FalconQueueService.
@@ -274,6 +278,30 @@ func (s *Server) AcknowledgeJob(ctx context.Context, req *pb.AcknowledgeJobReque
 	return &pb.AcknowledgeJobResponse{Success: true}, nil
 }
 
+// WatchEvents streams committed WAL events (change data capture).
+// from_seq is the first seq to send; 0 streams only new events. A stream
+// that cannot resume because the history was pruned or compacted fails
+// with OutOfRange; clients should then resync from a snapshot.
+func (s *Server) WatchEvents(req *pb.WatchEventsRequest, stream pb.FalconQueueService_WatchEventsServer) error {
+	afterSeq := s.controller.LastSeq()
+	if req.FromSeq > 0 {
+		afterSeq = req.FromSeq - 1
+	}
+
+	err := s.controller.WatchEvents(stream.Context(), afterSeq, func(event *wal.Event) error {
+		return stream.Send(mapEventToPb(event))
+	})
+	switch {
+	case errors.Is(err, wal.ErrCompacted):
+		return status.Error(codes.OutOfRange, err.Error())
+	case errors.Is(err, wal.ErrWALClosed):
+		return status.Error(codes.Unavailable, "server is shutting down")
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	}
+	return err
+}
+
 // Helpers
 
 func mapStatusToPb(s types.JobStatus) pb.JobStatus {
@@ -305,3 +333,22 @@ func mapPbStatusToType(s pb.JobStatus) types.JobStatus {
 		return types.StatusPending // Fallback
 	}
 }
+
+func mapEventToPb(e *wal.Event) *pb.WalEvent {
+	event := &pb.WalEvent{
+		Seq:       e.Seq,
+		Type:      string(e.Type),
+		JobId:     string(e.JobID),
+		Timestamp: e.Timestamp,
+		Attempt:   int32(e.Attempt),
+		TimeoutMs: e.TimeoutMs,
+		CreatedAt: e.CreatedAt,
+	}
+	if e.Payload != nil {
+		event.Payload, _ = json.Marshal(e.Payload)
+	}
+	if e.Deadline != nil {
+		event.DeadlineMs = *e.Deadline
+	}
+	return event
+}
@@ -0,0 +1,147 @@
+// ============================================================================
+// Beaver-Raft Snapshot Compression
+// ============================================================================
+//
+// Package: internal/snapshot
+// File: compression.go
+// Purpose: Shrink large snapshots, detected by magic bytes on load
+//
+// Formats (Options.Compression):
+//   none   plain JSON (default)
+//   gzip   gzip at the default level: smallest files, slowest to write
+//   flate  "BRSF" + raw DEFLATE at BestSpeed: several times faster to
+//          write than gzip, somewhat larger files
+//
+//   Both use the standard library. The body checksum (header.go) covers
+//   the compressed data, so raw DEFLATE needs no checksum of its own.
+//
+// Layering:
+//   JSON → compression → encryption (BRSE envelope) → header → file
+//   Load peels the layers off by their magic bytes, so snapshots written
+//   with any setting, including old uncompressed ones, stay readable.
+//
+// Metrics (Options.Metrics, exported by metrics.Collector):
+//   snapshot_encode_seconds      encode + compress time per snapshot
+//   snapshot_compression_ratio   JSON size / file size of the last snapshot
+//   snapshot_size_bytes          file size of the last snapshot
+//
+// ============================================================================
+
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Compression selects how snapshot files are compressed
+type Compression string
+
+const (
+	CompressionNone  Compression = "none"  // Plain JSON (default)
+	CompressionGzip  Compression = "gzip"  // gzip, default level
+	CompressionFlate Compression = "flate" // Raw DEFLATE, fastest level
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	flateMagic = []byte("BRSF")
+)
+
+// Metrics observes written snapshots
+// metrics.Collector implements it and exports the observations to
+// Prometheus.
+type Metrics interface {
+	ObserveSnapshot(encode time.Duration, ratio float64, size int64) // After each successful write
+}
+
+// ParseCompression parses a config value; an empty string selects none
+func ParseCompression(s string) (Compression, error) {
+	switch Compression(s) {
+	case "", CompressionNone:
+		return CompressionNone, nil
+	case CompressionGzip, CompressionFlate:
+		return Compression(s), nil
+	default:
+		return "", fmt.Errorf("unknown snapshot compression %q (want %q, %q or %q)",
+			s, CompressionNone, CompressionGzip, CompressionFlate)
+	}
+}
+
+// WriteStats describes the last snapshot written
+type WriteStats struct {
+	Compression Compression
+	RawBytes    int64         // Encoded JSON size
+	Size        int64         // File size
+	Encode      time.Duration // Encoding, compression and encryption time
+}
+
+// Ratio returns the uncompressed size divided by the file size
+func (s WriteStats) Ratio() float64 {
+	if s.Size == 0 {
+		return 0
+	}
+	return float64(s.RawBytes) / float64(s.Size)
+}
+
+// record passes the stats to m (nil = not exported)
+func (s WriteStats) record(m Metrics) {
+	if m != nil {
+		m.ObserveSnapshot(s.Encode, s.Ratio(), s.Size)
+	}
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// nopWriteCloser adds a no-op Close to an uncompressed writer
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// newCompressor returns a writer compressing into w; Close flushes it
+func newCompressor(w io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c {
+	case CompressionGzip:
+		return gzip.NewWriterLevel(w, gzip.DefaultCompression)
+	case CompressionFlate:
+		if _, err := w.Write(flateMagic); err != nil {
+			return nil, err
+		}
+		return flate.NewWriter(w, flate.BestSpeed)
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+// newDecompressor detects the compression of r by its magic bytes
+func newDecompressor(r *bufio.Reader) (io.Reader, error) {
+	head, _ := r.Peek(len(flateMagic)) // Shorter files are plain (or corrupted)
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptedSnapshot, err)
+		}
+		return zr, nil
+	case bytes.Equal(head, flateMagic):
+		r.Discard(len(flateMagic))
+		return flate.NewReader(r), nil
+	default:
+		return r, nil
+	}
+}
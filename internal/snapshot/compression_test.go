@@ -0,0 +1,118 @@
+package snapshot
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/ChuLiYu/raft-recovery/internal/encryption"
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================================================
+// Compression tests
+// ============================================================================
+
+// manyJobs returns a snapshot with n similar jobs
+func manyJobs(n int, seq uint64) types.SnapshotData {
+	data := types.SnapshotData{Jobs: make(map[types.JobID]*types.Job, n), LastSeq: seq}
+	for i := 0; i < n; i++ {
+		id := types.JobID(fmt.Sprintf("job-%05d", i))
+		data.Jobs[id] = &types.Job{ID: id, Status: types.StatusPending, Payload: map[string]interface{}{"index": i}}
+	}
+	return data
+}
+
+// TestParseCompression tests config values
+func TestParseCompression(t *testing.T) {
+	for s, want := range map[string]Compression{"": CompressionNone, "none": CompressionNone, "gzip": CompressionGzip, "flate": CompressionFlate} {
+		got, err := ParseCompression(s)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := ParseCompression("zstd")
+	assert.Error(t, err)
+}
+
+// TestCompressedRoundTrip tests every format, with and without encryption
+func TestCompressedRoundTrip(t *testing.T) {
+	keyring, err := encryption.NewKeyring(map[string][]byte{"k1": make([]byte, 32)}, "k1")
+	require.NoError(t, err)
+
+	for _, compression := range []Compression{CompressionNone, CompressionGzip, CompressionFlate} {
+		for _, kr := range []*encryption.Keyring{nil, keyring} {
+			name := fmt.Sprintf("%s/encrypted=%v", compression, kr != nil)
+			fsys := vfs.NewMemFS()
+			manager := NewManagerWithOptions("/data/snapshot.json", Options{FS: fsys, Keyring: kr, Compression: compression})
+			require.NoError(t, manager.Write(manyJobs(1000, 42)), name)
+
+			raw, err := vfs.ReadFile(fsys, "/data/snapshot.json")
+			require.NoError(t, err, name)
+			stats := manager.LastWrite()
+			assert.Equal(t, int64(len(raw)), stats.Size, name)
+			raw = snapshotBody(t, raw)
+			switch {
+			case kr != nil:
+				assert.Equal(t, encryptedMagic, raw[:4], name)
+			case compression == CompressionGzip:
+				assert.Equal(t, gzipMagic, raw[:2], name)
+			case compression == CompressionFlate:
+				assert.Equal(t, flateMagic, raw[:4], name)
+			default:
+				assert.Equal(t, byte('{'), raw[0], name)
+			}
+
+			assert.Equal(t, compression, stats.Compression, name)
+			assert.Positive(t, stats.Encode, name)
+			if compression != CompressionNone {
+				assert.Greater(t, stats.Ratio(), 2.0, name)
+			}
+
+			data, err := NewManagerWithOptions("/data/snapshot.json", Options{FS: fsys, Keyring: kr}).Load()
+			require.NoError(t, err, name)
+			assert.Equal(t, uint64(42), data.LastSeq, name)
+			assert.Len(t, data.Jobs, 1000, name)
+		}
+	}
+}
+
+// TestCompressionChangeKeepsOldSnapshotsReadable tests that formats can be
+// mixed across generations
+func TestCompressionChangeKeepsOldSnapshotsReadable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	require.NoError(t, NewManager(path).Write(manyJobs(10, 10)))
+
+	manager := NewManagerWithOptions(path, Options{Compression: CompressionGzip, Retain: 2})
+	data, err := manager.Load()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(10), data.LastSeq)
+	require.NoError(t, manager.Write(manyJobs(10, 20)))
+
+	infos, err := manager.List()
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+	old, err := manager.LoadFile(infos[0].Path)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(10), old.LastSeq)
+}
+
+// TestCorruptedCompressedSnapshot tests damage inside compressed data
+func TestCorruptedCompressedSnapshot(t *testing.T) {
+	for _, compression := range []Compression{CompressionGzip, CompressionFlate} {
+		path := filepath.Join(t.TempDir(), "snapshot.json")
+		require.NoError(t, NewManagerWithOptions(path, Options{Compression: compression}).Write(manyJobs(100, 10)))
+
+		// Without the manifest only the format itself can catch it
+		require.NoError(t, vfs.OS.Remove(path+manifestSuffix))
+		raw, err := vfs.ReadFile(vfs.OS, path)
+		require.NoError(t, err)
+		raw[len(raw)/2] ^= 0xff
+		require.NoError(t, vfs.WriteFile(vfs.OS, path, raw, 0644))
+
+		_, err = NewManager(path).Load()
+		assert.ErrorIs(t, err, ErrCorruptedSnapshot, compression)
+	}
+}
@@ -0,0 +1,455 @@
+// ============================================================================
+// Beaver-Raft Snapshot Generations - Retention and Fallback
+// ============================================================================
+//
+// Package: internal/snapshot
+// File: generations.go
+// Purpose: Keep the last N snapshots so a corrupted one is not fatal
+//
+// Layout (for a snapshot path P):
+//   P                  newest generation
+//   P.gen-<N>          older generations (N = generation number, 20 digits)
+//   P.manifest         generations in order, each with LastSeq, size and a
+//                      CRC32C of the file
+//
+// Write protocol (under Manager.mu):
+//   1. Write the new snapshot to P.tmp and sync it
+//   2. Rename the current P to P.gen-<N> (keeps it reachable by name)
+//   3. Rename P.tmp to P and sync the directory
+//   4. Write the manifest atomically: the commit point
+//   5. Delete generation files the manifest no longer lists
+//
+//   A crash before step 4 leaves the old manifest, whose newest entry is
+//   still found at P.gen-<N> or P. A generation file is looked up at
+//   P.gen-<N> first, then at P, and only accepted if its checksum matches.
+//
+// Load:
+//   Generations are tried newest first; the first one that verifies and
+//   decodes wins. The caller replays the WAL after its LastSeq, so the WAL
+//   must keep every event after the oldest retained generation
+//   (RetainedSeq).
+//
+//   LoadNewestStream hands each generation tried to a consumer as a
+//   Reader instead of collecting it; the manifest checksum is verified
+//   before the Reader reports the end of the jobs.
+//
+// Without a manifest (snapshots written before generations existed) P is
+// loaded as before and becomes the first generation on the next write.
+//
+// ============================================================================
+
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+)
+
+// manifestSuffix is appended to the snapshot path to name the manifest
+const manifestSuffix = ".manifest"
+
+// manifestVersion is the current manifest format
+const manifestVersion = 1
+
+// generationInfix separates the snapshot path from a generation number
+const generationInfix = ".gen-"
+
+// crcTable is the CRC32C table for snapshot checksums
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// generation is one manifest entry
+type generation struct {
+	Generation uint64 `json:"generation"` // Increases with every write
+	LastSeq    uint64 `json:"last_seq"`   // Last WAL sequence number covered
+	CreatedAt  int64  `json:"created_at"` // Unix milliseconds
+	Size       int64  `json:"size"`       // File size in bytes
+	Checksum   uint32 `json:"checksum"`   // CRC32C of the file
+}
+
+// manifest lists the retained generations, oldest first
+type manifest struct {
+	Version     int          `json:"version"`
+	Generations []generation `json:"generations"`
+}
+
+// Skipped describes a generation Load could not use
+type Skipped struct {
+	Path    string // File tried
+	LastSeq uint64 // LastSeq recorded in the manifest
+	Err     error  // Why it was skipped
+}
+
+// checksumWriter computes the CRC32C and size of everything written through it
+type checksumWriter struct {
+	w    io.Writer
+	crc  uint32
+	size int64
+}
+
+func (c *checksumWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.crc = crc32.Update(c.crc, crcTable, p[:n])
+	c.size += int64(n)
+	return n, err
+}
+
+// manifestPath returns the manifest path
+func (m *Manager) manifestPath() string {
+	return m.path + manifestSuffix
+}
+
+// generationPath returns the file name of an older generation
+func (m *Manager) generationPath(gen uint64) string {
+	return fmt.Sprintf("%s%s%020d", m.path, generationInfix, gen)
+}
+
+// locate returns the file currently holding a generation (step 2 may or
+// may not have run for it)
+func (m *Manager) locate(gen uint64) string {
+	if path := m.generationPath(gen); fileExists(m.fs, path) {
+		return path
+	}
+	return m.path
+}
+
+// fileExists reports whether path exists
+func fileExists(fsys vfs.FS, path string) bool {
+	_, err := fsys.Stat(path)
+	return err == nil
+}
+
+// readManifest reads the manifest (nil if there is none)
+func (m *Manager) readManifest() (*manifest, error) {
+	raw, err := vfs.ReadFile(m.fs, m.manifestPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read snapshot manifest: %w", err)
+	}
+	var mf manifest
+	if err := json.Unmarshal(raw, &mf); err != nil || mf.Version != manifestVersion {
+		return nil, fmt.Errorf("%w: invalid manifest %s", ErrCorruptedSnapshot, m.manifestPath())
+	}
+	return &mf, nil
+}
+
+// writeManifest atomically replaces the manifest (step 4)
+func (m *Manager) writeManifest(mf *manifest) error {
+	raw, err := json.Marshal(mf)
+	if err != nil {
+		return err
+	}
+	path := m.manifestPath()
+	tmpPath := path + ".tmp"
+	f, err := vfs.Create(m.fs, tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(raw); err != nil {
+		f.Close()
+		m.fs.Remove(tmpPath)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		m.fs.Remove(tmpPath)
+		return err
+	}
+	f.Close()
+	if err := m.fs.Rename(tmpPath, path); err != nil {
+		m.fs.Remove(tmpPath)
+		return err
+	}
+	return m.fs.SyncDir(filepath.Dir(path))
+}
+
+// verify checks the checksum of a whole generation file against its
+// manifest entry
+func verify(sum *checksumWriter, gen generation) error {
+	if sum.size != gen.Size || sum.crc != gen.Checksum {
+		return fmt.Errorf("%w: checksum mismatch for generation %d", ErrCorruptedSnapshot, gen.Generation)
+	}
+	return nil
+}
+
+// fileChecksum computes the checksum of a file without holding it in memory
+func fileChecksum(fsys vfs.FS, path string) (*checksumWriter, error) {
+	f, err := vfs.Open(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sum := &checksumWriter{w: io.Discard}
+	if _, err := io.Copy(sum, f); err != nil {
+		return nil, err
+	}
+	return sum, nil
+}
+
+// loadGeneration hands a generation file to consume, verifying its
+// checksum on the way
+//
+// The manifest checksum is checked before the Reader returns io.EOF, so
+// consume never sees a clean end of a damaged file.
+func (m *Manager) loadGeneration(path string, gen generation, consume func(*Reader) error) (types.SnapshotData, error) {
+	f, err := vfs.Open(m.fs, path)
+	if err != nil {
+		return types.SnapshotData{}, err
+	}
+	defer f.Close()
+
+	sum := &checksumWriter{w: io.Discard}
+	tee := io.TeeReader(f, sum)
+	check := func(decodeErr error) error {
+		if _, err := io.Copy(io.Discard, tee); err != nil {
+			return fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		// A checksum mismatch explains any decoding error
+		if err := verify(sum, gen); err != nil {
+			return err
+		}
+		return decodeErr
+	}
+
+	rd, err := openReader(tee, path, m.keyring)
+	if err != nil {
+		return types.SnapshotData{}, check(err)
+	}
+	inner := rd.finish
+	rd.finish = func(decodeErr error) error {
+		if inner != nil {
+			decodeErr = inner(decodeErr)
+		}
+		return check(decodeErr)
+	}
+	return consumeAll(rd, consume)
+}
+
+// currentGeneration returns the generation stored at the snapshot path
+// (0 if unknown or none)
+//
+// Known after a write or load; otherwise the file is checked against the
+// manifest once.
+func (m *Manager) currentGeneration(mf *manifest) uint64 {
+	if m.pathGen != 0 {
+		return m.pathGen
+	}
+	sum, err := fileChecksum(m.fs, m.path)
+	if err != nil {
+		return 0
+	}
+	for _, gen := range mf.Generations {
+		if verify(sum, gen) == nil {
+			return gen.Generation
+		}
+	}
+	return 0
+}
+
+// legacyManifest builds a manifest for a snapshot written without one
+func (m *Manager) legacyManifest() *manifest {
+	mf := &manifest{Version: manifestVersion}
+	data, err := loadFile(m.fs, m.path, m.keyring)
+	if err != nil {
+		return mf // Missing or unreadable: overwritten, as before generations
+	}
+	sum, err := fileChecksum(m.fs, m.path)
+	if err != nil {
+		return mf
+	}
+	mf.Generations = append(mf.Generations, generation{
+		Generation: 1,
+		LastSeq:    data.LastSeq,
+		CreatedAt:  data.CreatedAt,
+		Size:       sum.size,
+		Checksum:   sum.crc,
+	})
+	return mf
+}
+
+// commitGeneration installs a synced temporary snapshot as the newest
+// generation (steps 2-5); caller must hold m.mu
+//
+// Generations at or after the new LastSeq are dropped: after point-in-time
+// recovery they describe history the WAL no longer holds.
+//
+// Parameters:
+//   - tmpPath: Synced snapshot file
+//   - gen: Its manifest entry (Generation is assigned here)
+//   - retain: Generations to keep, including the new one
+//
+// Returns:
+//   - error: Rename, directory sync or manifest failure
+func (m *Manager) commitGeneration(tmpPath string, gen generation, retain int) error {
+	mf, err := m.readManifest()
+	if err != nil || mf == nil {
+		mf = m.legacyManifest() // A corrupted manifest is rebuilt the same way
+		if len(mf.Generations) > 0 {
+			m.pathGen = mf.Generations[0].Generation
+		}
+	}
+	current := m.currentGeneration(mf)
+
+	var kept []generation
+	for _, g := range mf.Generations {
+		if g.LastSeq < gen.LastSeq {
+			kept = append(kept, g)
+		}
+		gen.Generation = max(gen.Generation, g.Generation)
+	}
+	gen.Generation++
+	kept = append(kept, gen)
+	if len(kept) > max(retain, 1) {
+		kept = kept[len(kept)-max(retain, 1):]
+	}
+
+	// Until the rename below is done, the file at m.path is unknown
+	m.pathGen = 0
+	dir := filepath.Dir(m.path)
+	if current != 0 {
+		if err := m.fs.Rename(m.path, m.generationPath(current)); err != nil {
+			m.fs.Remove(tmpPath)
+			return fmt.Errorf("failed to keep previous snapshot: %w", err)
+		}
+	}
+	if err := m.fs.Rename(tmpPath, m.path); err != nil {
+		m.fs.Remove(tmpPath)
+		return fmt.Errorf("failed to rename snapshot: %w", err)
+	}
+	if err := m.fs.SyncDir(dir); err != nil {
+		return fmt.Errorf("failed to sync snapshot directory: %w", err)
+	}
+	m.pathGen = gen.Generation
+
+	if err := m.writeManifest(&manifest{Version: manifestVersion, Generations: kept}); err != nil {
+		return fmt.Errorf("failed to write snapshot manifest: %w", err)
+	}
+	m.retainedSeq = kept[0].LastSeq
+
+	m.removeStaleGenerations(kept)
+	return nil
+}
+
+// removeStaleGenerations deletes generation files the manifest does not
+// list (step 5); failures are retried on the next write
+func (m *Manager) removeStaleGenerations(kept []generation) {
+	listed := make(map[uint64]bool, len(kept))
+	for _, g := range kept {
+		listed[g.Generation] = true
+	}
+	entries, err := m.fs.ReadDir(filepath.Dir(m.path))
+	if err != nil {
+		return
+	}
+	prefix := filepath.Base(m.path) + generationInfix
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		gen, err := strconv.ParseUint(entry.Name()[len(prefix):], 10, 64)
+		if err == nil && !listed[gen] {
+			m.fs.Remove(filepath.Join(filepath.Dir(m.path), entry.Name()))
+		}
+	}
+}
+
+// LoadNewest reads the newest snapshot generation that verifies
+//
+// Behavior:
+//   - Returns empty SnapshotData if there is no snapshot (first startup)
+//   - Tries older generations if newer ones are missing or corrupted
+//   - Without a manifest, loads the snapshot path only (no checksum)
+//
+// Returns:
+//   - types.SnapshotData: Snapshot data
+//   - []Skipped: Newer generations that could not be used
+//   - error: Error if no generation can be loaded
+func (m *Manager) LoadNewest() (types.SnapshotData, []Skipped, error) {
+	var data types.SnapshotData
+	_, skipped, err := m.LoadNewestStream(collectInto(&data))
+	if err != nil {
+		return types.SnapshotData{}, skipped, err
+	}
+	return data, skipped, nil
+}
+
+// LoadNewestStream is LoadNewest without holding the jobs in memory:
+// each generation tried is handed to consume as a Reader
+//
+// consume reads jobs until io.EOF. When it returns an error (its own or
+// the Reader's) the next older generation is tried with a new Reader, so
+// it must start over on every call. With no snapshot at all, consume gets
+// a Reader without jobs.
+//
+// Parameters:
+//   - consume: Called once per generation tried
+//
+// Returns:
+//   - types.SnapshotData: Metadata of the generation loaded (Jobs is nil)
+//   - []Skipped: Newer generations that could not be used
+//   - error: Error if no generation can be loaded
+func (m *Manager) LoadNewestStream(consume func(*Reader) error) (types.SnapshotData, []Skipped, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var skipped []Skipped
+	mf, err := m.readManifest()
+	if err != nil {
+		skipped = append(skipped, Skipped{Path: m.manifestPath(), Err: err})
+	}
+	if mf == nil || len(mf.Generations) == 0 {
+		meta, err := streamFile(m.fs, m.path, m.keyring, consume)
+		if os.IsNotExist(err) {
+			meta, err = consumeAll(emptyReader(), consume)
+			return meta, skipped, err
+		}
+		m.retainedSeq = meta.LastSeq
+		return meta, skipped, err
+	}
+
+	var firstErr error
+	for i := len(mf.Generations) - 1; i >= 0; i-- {
+		gen := mf.Generations[i]
+		path := m.locate(gen.Generation)
+		meta, err := m.loadGeneration(path, gen, consume)
+		if err == nil {
+			if path == m.path {
+				m.pathGen = gen.Generation
+			}
+			m.retainedSeq = mf.Generations[0].LastSeq
+			return meta, skipped, nil
+		}
+		skipped = append(skipped, Skipped{Path: path, LastSeq: gen.LastSeq, Err: err})
+		if firstErr == nil && !errors.Is(err, os.ErrNotExist) {
+			firstErr = err
+		}
+	}
+
+	// Only missing files: nothing was ever committed, the WAL has it all
+	if firstErr == nil {
+		meta, err := consumeAll(emptyReader(), consume)
+		return meta, skipped, err
+	}
+	return types.SnapshotData{}, skipped, fmt.Errorf("no valid snapshot generation: %w", firstErr)
+}
+
+// RetainedSeq returns the LastSeq of the oldest retained generation
+//
+// Load may fall back to any retained generation, so the WAL must keep
+// every event after this seq. Known after the first Write or Load.
+func (m *Manager) RetainedSeq() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.retainedSeq
+}
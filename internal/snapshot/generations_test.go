@@ -0,0 +1,166 @@
+package snapshot
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================================================
+// Generation tests
+// ============================================================================
+
+// seqSnapshot returns a snapshot covering seq
+func seqSnapshot(seq uint64) types.SnapshotData {
+	return types.SnapshotData{Jobs: map[types.JobID]*types.Job{"job-1": {ID: "job-1"}}, LastSeq: seq}
+}
+
+// generationFiles returns the older generation files next to the snapshot
+func generationFiles(t *testing.T, fsys vfs.FS, path string) []string {
+	t.Helper()
+	files, err := vfs.Glob(fsys, path+generationInfix+"*")
+	require.NoError(t, err)
+	return files
+}
+
+// TestGenerationRetention tests that only the newest generations are kept
+func TestGenerationRetention(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	manager := NewManagerWithOptions("/data/snapshot.json", Options{FS: fsys, Retain: 3})
+	for seq := uint64(10); seq <= 50; seq += 10 {
+		require.NoError(t, manager.Write(seqSnapshot(seq)))
+	}
+
+	assert.Len(t, generationFiles(t, fsys, "/data/snapshot.json"), 2)
+	assert.Equal(t, uint64(30), manager.RetainedSeq())
+
+	infos, err := manager.List()
+	require.NoError(t, err)
+	require.Len(t, infos, 3)
+	assert.Equal(t, uint64(30), infos[0].LastSeq)
+	assert.Equal(t, "/data/snapshot.json", infos[2].Path)
+
+	// Retain 1 keeps no older files
+	single := NewManagerWithOptions("/other/snapshot.json", Options{FS: fsys})
+	require.NoError(t, single.Write(seqSnapshot(10)))
+	require.NoError(t, single.Write(seqSnapshot(20)))
+	assert.Empty(t, generationFiles(t, fsys, "/other/snapshot.json"))
+	assert.Equal(t, uint64(20), single.RetainedSeq())
+}
+
+// TestLoadFallsBackToOlderGeneration tests loading past corrupted generations
+func TestLoadFallsBackToOlderGeneration(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	path := "/data/snapshot.json"
+	manager := NewManagerWithOptions(path, Options{FS: fsys, Retain: 3})
+	for _, seq := range []uint64{10, 20, 30} {
+		require.NoError(t, manager.Write(seqSnapshot(seq)))
+	}
+
+	// Still valid JSON, so only a checksum catches it
+	valid, err := vfs.ReadFile(fsys, path)
+	require.NoError(t, err)
+	valid[len(valid)-trailerSize-3] ^= 1
+	require.NoError(t, vfs.WriteFile(fsys, path, valid, 0644))
+
+	reopened := NewManagerWithOptions(path, Options{FS: fsys, Retain: 3})
+	data, skipped, err := reopened.LoadNewest()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(20), data.LastSeq)
+	require.Len(t, skipped, 1)
+	assert.Equal(t, uint64(30), skipped[0].LastSeq)
+	assert.ErrorIs(t, skipped[0].Err, ErrCorruptedSnapshot)
+	assert.Equal(t, uint64(10), reopened.RetainedSeq())
+
+	// The next write replaces the corrupted file and keeps the valid ones
+	require.NoError(t, reopened.Write(seqSnapshot(40)))
+	data, skipped, err = reopened.LoadNewest()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(40), data.LastSeq)
+	assert.Empty(t, skipped)
+
+	// Nothing valid left: an error, not an empty state
+	for _, file := range append(generationFiles(t, fsys, path), path) {
+		require.NoError(t, vfs.WriteFile(fsys, file, []byte("{}"), 0644))
+	}
+	_, err = reopened.Load()
+	assert.ErrorIs(t, err, ErrCorruptedSnapshot)
+}
+
+// TestWriteDropsAbandonedGenerations tests that a snapshot older than the
+// retained ones (after point-in-time recovery) replaces them
+func TestWriteDropsAbandonedGenerations(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	manager := NewManagerWithOptions("/data/snapshot.json", Options{FS: fsys, Retain: 5})
+	for _, seq := range []uint64{10, 20, 30, 15} {
+		require.NoError(t, manager.Write(seqSnapshot(seq)))
+	}
+
+	infos, err := manager.List()
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+	assert.Equal(t, uint64(10), infos[0].LastSeq)
+	assert.Equal(t, uint64(15), infos[1].LastSeq)
+}
+
+// TestLegacySnapshotBecomesGeneration tests a snapshot written before
+// manifests existed
+func TestLegacySnapshotBecomesGeneration(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	path := "/data/snapshot.json"
+	manager := NewManagerWithOptions(path, Options{FS: fsys, Retain: 2})
+	require.NoError(t, manager.Write(seqSnapshot(10)))
+	require.NoError(t, fsys.Remove(path+manifestSuffix))
+
+	reopened := NewManagerWithOptions(path, Options{FS: fsys, Retain: 2})
+	data, err := reopened.Load()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(10), data.LastSeq)
+
+	require.NoError(t, reopened.Write(seqSnapshot(20)))
+	assert.Len(t, generationFiles(t, fsys, path), 1)
+	assert.Equal(t, uint64(10), reopened.RetainedSeq())
+}
+
+// TestGenerationCrashAtEveryStep cuts power after each file system
+// operation of a write and checks a committed generation always loads
+func TestGenerationCrashAtEveryStep(t *testing.T) {
+	path := "/data/snapshot.json"
+	for step := 0; ; step++ {
+		require.Less(t, step, 100, "write never completed")
+		fsys := vfs.NewMemFS()
+		manager := NewManagerWithOptions(path, Options{FS: fsys, Retain: 2})
+		require.NoError(t, manager.Write(seqSnapshot(10)))
+		require.NoError(t, manager.Write(seqSnapshot(20)))
+
+		fsys.Inject(vfs.Fault{Op: vfs.OpAny, After: step})
+		writeErr := manager.Write(seqSnapshot(30))
+		_, probeErr := fsys.OpenFile("/data/probe", os.O_CREATE|os.O_WRONLY, 0644)
+		crashed := fsys.Crash()
+
+		recovered := NewManagerWithOptions(path, Options{FS: crashed, Retain: 2})
+		data, err := recovered.Load()
+		require.NoError(t, err, "step %d", step)
+		assert.Contains(t, []uint64{20, 30}, data.LastSeq, "step %d", step)
+		if writeErr == nil {
+			assert.Equal(t, uint64(30), data.LastSeq, "step %d: acknowledged snapshot lost", step)
+		}
+
+		// Writing on goes on from whatever survived
+		require.NoError(t, recovered.Write(seqSnapshot(40)), "step %d", step)
+		data, err = recovered.Load()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(40), data.LastSeq, "step %d", step)
+		infos, err := recovered.List()
+		require.NoError(t, err)
+		assert.Len(t, infos, 2, "step %d", step)
+
+		if probeErr == nil {
+			break // The fault never fired: every step is covered
+		}
+	}
+}
@@ -0,0 +1,314 @@
+// ============================================================================
+// Beaver-Raft Snapshot Header
+// ============================================================================
+//
+// Package: internal/snapshot
+// File: header.go
+// Purpose: Self-describing, checksummed snapshot files
+//
+// File Layout:
+//   magic     [4]byte  "BRSH"
+//   length    uint32   Header JSON size (big-endian)
+//   header    []byte   Header JSON
+//   crc       uint32   CRC32C of the header JSON
+//   body      []byte   The snapshot itself (encrypted, compressed or plain)
+//   trailer   [16]byte body size uint64, body CRC32C uint32, magic "BRST"
+//
+//   The trailer is written last, so a truncated file has no valid trailer
+//   and bit rot anywhere in the body fails the checksum, even where the
+//   JSON would still parse. The manifest checksum (generations.go) only
+//   covers generations listed in a manifest; this one travels with the file.
+//
+// Metadata:
+//   The header repeats what operators ask about a snapshot without loading
+//   it: format and schema version, LastSeq (and Raft index and term), job
+//   counts by status, creation time and node ID. ReadHeader reads only the
+//   header and the trailer. The header is never encrypted; it holds no job
+//   data.
+//
+// Compatibility:
+//   Files without the magic were written before headers existed and still
+//   load, unverified.
+//
+// ============================================================================
+
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+)
+
+// HeaderFormatVersion is the header layout written by this version
+const HeaderFormatVersion = 1
+
+const (
+	maxHeaderSize = 1 << 20 // Sanity limit for a damaged length field
+	trailerSize   = 16
+)
+
+var (
+	headerMagic  = []byte("BRSH")
+	trailerMagic = []byte("BRST")
+)
+
+// ErrNoHeader is returned by ReadHeader for snapshots written before
+// headers existed
+var ErrNoHeader = errors.New("snapshot has no header (written by an older version)")
+
+// Header describes a snapshot file
+type Header struct {
+	FormatVersion int                     `json:"format_version"`
+	SchemaVer     int                     `json:"schema_ver"`
+	Kind          types.SnapshotKind      `json:"kind,omitempty"`
+	LastSeq       uint64                  `json:"last_seq"`             // Last WAL seq (or Raft index) covered
+	RaftIndex     uint64                  `json:"raft_index,omitempty"` // Set for Raft state machine snapshots
+	RaftTerm      uint64                  `json:"raft_term,omitempty"`  // Term of the entry at RaftIndex
+	JobCounts     map[types.JobStatus]int `json:"job_counts"`
+	CreatedAt     int64                   `json:"created_at"` // Unix milliseconds
+	NodeID        string                  `json:"node_id,omitempty"`
+	Compression   Compression             `json:"compression"`
+	Encrypted     bool                    `json:"encrypted"`
+
+	// From the trailer, filled in by ReadHeader
+	BodySize     int64  `json:"-"`
+	BodyChecksum uint32 `json:"-"`
+}
+
+// Jobs returns the total number of jobs
+func (h *Header) Jobs() int {
+	total := 0
+	for _, n := range h.JobCounts {
+		total += n
+	}
+	return total
+}
+
+// countJobs returns the number of jobs by status
+func countJobs(jobs map[types.JobID]*types.Job) map[types.JobStatus]int {
+	counts := make(map[types.JobStatus]int)
+	for _, job := range jobs {
+		counts[job.Status]++
+	}
+	return counts
+}
+
+// writeHeader writes the magic, the header and its checksum
+func writeHeader(w io.Writer, h *Header) error {
+	raw, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 0, len(headerMagic)+8+len(raw))
+	buf = append(buf, headerMagic...)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(raw)))
+	buf = append(buf, raw...)
+	buf = binary.BigEndian.AppendUint32(buf, crc32.Checksum(raw, crcTable))
+	_, err = w.Write(buf)
+	return err
+}
+
+// writeTrailer writes the body size and checksum
+func writeTrailer(w io.Writer, body *checksumWriter) error {
+	buf := make([]byte, 0, trailerSize)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(body.size))
+	buf = binary.BigEndian.AppendUint32(buf, body.crc)
+	buf = append(buf, trailerMagic...)
+	_, err := w.Write(buf)
+	return err
+}
+
+// hasHeader reports whether r starts with a header
+func hasHeader(r *bufio.Reader) bool {
+	head, _ := r.Peek(len(headerMagic))
+	return bytes.Equal(head, headerMagic)
+}
+
+// parseHeader reads and verifies the header at the start of r
+//
+// Returns:
+//   - *Header: The header, without trailer fields
+//   - int64: Header size in bytes, where the body starts
+//   - error: ErrCorruptedSnapshot or ErrIncompatibleVersion
+func parseHeader(r io.Reader) (*Header, int64, error) {
+	var prefix [8]byte
+	k, err := io.ReadFull(r, prefix[:])
+	if k < len(headerMagic) || !bytes.Equal(prefix[:len(headerMagic)], headerMagic) {
+		return nil, 0, ErrNoHeader
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: truncated header", ErrCorruptedSnapshot)
+	}
+	n := binary.BigEndian.Uint32(prefix[4:])
+	if n > maxHeaderSize {
+		return nil, 0, fmt.Errorf("%w: header length %d", ErrCorruptedSnapshot, n)
+	}
+	raw := make([]byte, n+4)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return nil, 0, fmt.Errorf("%w: truncated header", ErrCorruptedSnapshot)
+	}
+	raw, sum := raw[:n], binary.BigEndian.Uint32(raw[n:])
+	if crc32.Checksum(raw, crcTable) != sum {
+		return nil, 0, fmt.Errorf("%w: header checksum mismatch", ErrCorruptedSnapshot)
+	}
+
+	var h Header
+	if err := json.Unmarshal(raw, &h); err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrCorruptedSnapshot, err)
+	}
+	if h.FormatVersion < 1 || h.FormatVersion > HeaderFormatVersion {
+		return nil, 0, fmt.Errorf("%w: header format %d, want at most %d",
+			ErrIncompatibleVersion, h.FormatVersion, HeaderFormatVersion)
+	}
+	return &h, int64(len(prefix)) + int64(n) + 4, nil
+}
+
+// parseTrailer fills in the trailer fields of h
+func parseTrailer(h *Header, trailer []byte) error {
+	if len(trailer) != trailerSize || !bytes.Equal(trailer[12:], trailerMagic) {
+		return fmt.Errorf("%w: missing trailer (truncated file?)", ErrCorruptedSnapshot)
+	}
+	h.BodySize = int64(binary.BigEndian.Uint64(trailer))
+	h.BodyChecksum = binary.BigEndian.Uint32(trailer[8:])
+	return nil
+}
+
+// verifyBody compares a body read through sum with the trailer
+func verifyBody(h *Header, sum *checksumWriter) error {
+	if sum.size != h.BodySize {
+		return fmt.Errorf("%w: body is %d bytes, header says %d", ErrCorruptedSnapshot, sum.size, h.BodySize)
+	}
+	if sum.crc != h.BodyChecksum {
+		return fmt.Errorf("%w: body checksum mismatch", ErrCorruptedSnapshot)
+	}
+	return nil
+}
+
+// checkHeader compares the header with the snapshot it describes
+func checkHeader(h *Header, lastSeq uint64, jobs int) error {
+	if h.LastSeq != lastSeq || h.Jobs() != jobs {
+		return fmt.Errorf("%w: header does not match snapshot (last seq %d vs %d, %d vs %d jobs)",
+			ErrCorruptedSnapshot, h.LastSeq, lastSeq, h.Jobs(), jobs)
+	}
+	return nil
+}
+
+// ReadHeader reads the header and trailer of a snapshot file without
+// reading the body
+//
+// Returns:
+//   - *Header: The header with trailer fields set
+//   - error: ErrNoHeader for older snapshots, ErrCorruptedSnapshot if the
+//     header is damaged or the file truncated
+func ReadHeader(fsys vfs.FS, path string) (*Header, error) {
+	f, err := vfs.Open(vfs.Default(fsys), path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h, _, err := readHeaderAt(f)
+	return h, err
+}
+
+// readHeaderAt implements ReadHeader and returns where the body starts
+func readHeaderAt(f vfs.File) (*Header, int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	h, bodyStart, err := parseHeader(io.NewSectionReader(f, 0, info.Size()))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	trailer := make([]byte, trailerSize)
+	if info.Size() < bodyStart+trailerSize {
+		return nil, 0, fmt.Errorf("%w: missing trailer (truncated file?)", ErrCorruptedSnapshot)
+	}
+	if _, err := f.ReadAt(trailer, info.Size()-trailerSize); err != nil {
+		return nil, 0, fmt.Errorf("failed to read snapshot trailer: %w", err)
+	}
+	if err := parseTrailer(h, trailer); err != nil {
+		return nil, 0, err
+	}
+	if h.BodySize != info.Size()-bodyStart-trailerSize {
+		return nil, 0, fmt.Errorf("%w: file is %d bytes, header says %d",
+			ErrCorruptedSnapshot, info.Size(), bodyStart+h.BodySize+trailerSize)
+	}
+	return h, bodyStart, nil
+}
+
+// VerifyFile checks the header and body checksums of a snapshot file
+// without decrypting or decoding it
+func VerifyFile(fsys vfs.FS, path string) (*Header, error) {
+	f, err := vfs.Open(vfs.Default(fsys), path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h, bodyStart, err := readHeaderAt(f)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := &checksumWriter{w: io.Discard}
+	if _, err := io.Copy(sum, io.NewSectionReader(f, bodyStart, h.BodySize)); err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	return h, verifyBody(h, sum)
+}
+
+// ============================================================================
+// Trailer Handling for Streams
+// ============================================================================
+
+// holdbackReader passes a stream through except for its last n bytes,
+// so the body can be decoded before the trailer is known to follow it
+type holdbackReader struct {
+	r   io.Reader
+	n   int
+	buf []byte // Read ahead; the last n bytes may be the trailer
+	err error
+}
+
+func (h *holdbackReader) Read(p []byte) (int, error) {
+	for len(h.buf) <= h.n && h.err == nil {
+		h.fill()
+	}
+	avail := len(h.buf) - h.n
+	if avail <= 0 {
+		return 0, h.err
+	}
+	k := copy(p, h.buf[:avail])
+	h.buf = h.buf[k:]
+	return k, nil
+}
+
+// fill reads more of the stream into buf
+func (h *holdbackReader) fill() {
+	if cap(h.buf)-len(h.buf) < 4096 {
+		grown := make([]byte, len(h.buf), len(h.buf)+32*1024)
+		copy(grown, h.buf)
+		h.buf = grown
+	}
+	n, err := h.r.Read(h.buf[len(h.buf):cap(h.buf)])
+	h.buf = h.buf[:len(h.buf)+n]
+	h.err = err
+}
+
+// trailer returns the held back bytes once the stream is drained
+func (h *holdbackReader) trailer() []byte {
+	if h.err != io.EOF {
+		return nil
+	}
+	return h.buf
+}
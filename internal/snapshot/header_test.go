@@ -0,0 +1,114 @@
+package snapshot
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================================================
+// Header tests
+// ============================================================================
+
+// snapshotBody returns the body of a snapshot file with a header
+func snapshotBody(t *testing.T, raw []byte) []byte {
+	t.Helper()
+	_, start, err := parseHeader(bytes.NewReader(raw))
+	require.NoError(t, err)
+	return raw[start : len(raw)-trailerSize]
+}
+
+// TestHeaderRoundTrip tests the metadata recorded in the header
+func TestHeaderRoundTrip(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	path := "/data/snapshot.json"
+	manager := NewManagerWithOptions(path, Options{FS: fsys, NodeID: "node-a", Compression: CompressionGzip})
+	data := manyJobs(1000, 42)
+	data.Jobs["job-00000"].Status = types.StatusCompleted
+	data.Jobs["job-00001"].Status = types.StatusDead
+	require.NoError(t, manager.WriteRaft(data, 7))
+
+	header, err := ReadHeader(fsys, path)
+	require.NoError(t, err)
+	assert.Equal(t, HeaderFormatVersion, header.FormatVersion)
+	assert.Equal(t, types.CurrentSnapshotSchema, header.SchemaVer)
+	assert.Equal(t, types.SnapshotFull, header.Kind)
+	assert.Equal(t, uint64(42), header.LastSeq)
+	assert.Equal(t, uint64(42), header.RaftIndex)
+	assert.Equal(t, uint64(7), header.RaftTerm)
+	assert.Equal(t, map[types.JobStatus]int{types.StatusPending: 998, types.StatusCompleted: 1, types.StatusDead: 1}, header.JobCounts)
+	assert.Equal(t, 1000, header.Jobs())
+	assert.Equal(t, "node-a", header.NodeID)
+	assert.Equal(t, CompressionGzip, header.Compression)
+	assert.False(t, header.Encrypted)
+	assert.Positive(t, header.CreatedAt)
+	assert.Positive(t, header.BodySize)
+
+	verified, err := VerifyFile(fsys, path)
+	require.NoError(t, err)
+	assert.Equal(t, header.BodyChecksum, verified.BodyChecksum)
+
+	loaded, err := manager.Load()
+	require.NoError(t, err)
+	assert.Len(t, loaded.Jobs, 1000)
+
+	// Plain writes carry no Raft position
+	require.NoError(t, manager.Write(seqSnapshot(50)))
+	header, err = ReadHeader(fsys, path)
+	require.NoError(t, err)
+	assert.Zero(t, header.RaftIndex)
+	assert.Zero(t, header.RaftTerm)
+}
+
+// TestHeaderDetectsDamage tests bit rot and truncation that the JSON
+// decoder alone would miss or misreport
+func TestHeaderDetectsDamage(t *testing.T) {
+	path := "/data/snapshot.json"
+	damage := map[string]func(raw []byte) []byte{
+		"body bit rot": func(raw []byte) []byte {
+			raw[len(raw)-trailerSize-3] ^= 1 // A digit of created_at: still valid JSON
+			return raw
+		},
+		"header bit rot": func(raw []byte) []byte {
+			raw[12] ^= 1
+			return raw
+		},
+		"truncated body": func(raw []byte) []byte { return raw[:len(raw)/2] },
+		"lost trailer":   func(raw []byte) []byte { return raw[:len(raw)-trailerSize] },
+	}
+
+	for name, corrupt := range damage {
+		fsys := vfs.NewMemFS()
+		require.NoError(t, NewManagerWithOptions(path, Options{FS: fsys}).Write(seqSnapshot(10)), name)
+		// Without the manifest only the file itself can tell
+		require.NoError(t, fsys.Remove(path+manifestSuffix), name)
+		raw, err := vfs.ReadFile(fsys, path)
+		require.NoError(t, err, name)
+		require.NoError(t, vfs.WriteFile(fsys, path, corrupt(raw), 0644), name)
+
+		_, err = NewManagerWithOptions(path, Options{FS: fsys}).Load()
+		assert.ErrorIs(t, err, ErrCorruptedSnapshot, name)
+		_, err = VerifyFile(fsys, path)
+		assert.ErrorIs(t, err, ErrCorruptedSnapshot, name)
+	}
+}
+
+// TestSnapshotWithoutHeader tests files written before headers existed
+func TestSnapshotWithoutHeader(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	path := "/data/snapshot.json"
+	legacy := []byte(`{"jobs":{"job-1":{"id":"job-1"}},"schema_ver":1,"last_seq":10}`)
+	require.NoError(t, fsys.MkdirAll("/data", 0755))
+	require.NoError(t, vfs.WriteFile(fsys, path, legacy, 0644))
+
+	data, err := NewManagerWithOptions(path, Options{FS: fsys}).Load()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(10), data.LastSeq)
+
+	_, err = ReadHeader(fsys, path)
+	assert.ErrorIs(t, err, ErrNoHeader)
+}
@@ -0,0 +1,186 @@
+// ============================================================================
+// Beaver-Raft Snapshot Schema Versions
+// ============================================================================
+//
+// Package: internal/snapshot
+// File: schema.go
+// Purpose: Decode snapshots of every schema version into the current one
+//
+// Versions (types.SnapshotSchemaV*):
+//   v1  {"jobs", "schema_ver": 1, "last_seq", "created_at"}; always full
+//   v2  adds "kind": "full" or "partial". JobManager.PartialSnapshot
+//       produced v2 before kinds were recorded, so a v2 snapshot without
+//       a kind is partial
+//
+//   Some early in-memory snapshots spelled the version "schema_version"
+//   (the old jobmanager.SnapShotData); both spellings are read.
+//
+// Migrations:
+//   The registry holds one step per version, upgrading a snapshot to the
+//   next version. Loading runs every step from the snapshot's version to
+//   the current one, so each step only knows about its neighbor:
+//     v1 --step--> v2 --step--> ... --> current --> types.SnapshotData
+//   A step changes the top-level fields, each job, or both, working on
+//   raw JSON fields. Jobs are migrated one at a time as the Reader streams
+//   them (stream.go); when no step touches jobs, they are decoded straight
+//   into types.Job.
+//
+// Adding a version:
+//   1. Bump types.CurrentSnapshotSchema and describe the version above
+//   2. Register the step from the previous version in schemas
+//   3. Keep the step forever: snapshots of any age must still load
+//
+//   Fields added to types.Job with a usable zero value need no step;
+//   JSON decoding leaves them zero. A step is needed for renames, type
+//   changes or defaults other than zero.
+//
+// ============================================================================
+
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+)
+
+// document is a snapshot's top-level JSON object
+type document map[string]json.RawMessage
+
+// rawJob is one job's JSON object
+type rawJob map[string]json.RawMessage
+
+// schemaStep upgrades a snapshot to the next schema version
+type schemaStep struct {
+	doc func(doc document) error // Upgrades top-level fields (nil = unchanged)
+	job func(job rawJob) error   // Upgrades one job (nil = unchanged)
+}
+
+// schemaRegistry holds the step from each version to the next
+type schemaRegistry struct {
+	current int
+	steps   map[int]schemaStep // Keyed by the version a step upgrades from
+}
+
+// schemas is the registry used by Load
+var schemas = schemaRegistry{
+	current: types.CurrentSnapshotSchema,
+	steps: map[int]schemaStep{
+		types.SnapshotSchemaV1: {doc: upgradeV1},
+	},
+}
+
+// upgradeV1 records the kind: v1 only had full snapshots
+func upgradeV1(doc document) error {
+	return setField(doc, "kind", types.SnapshotFull)
+}
+
+// setField stores v as a top-level field
+func setField(doc document, key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	doc[key] = raw
+	return nil
+}
+
+// version returns the schema version a document was written with
+func (doc document) version() (int, error) {
+	raw, ok := doc["schema_ver"]
+	if !ok {
+		raw, ok = doc["schema_version"]
+	}
+	if !ok {
+		return 0, fmt.Errorf("%w: no schema version", ErrIncompatibleVersion)
+	}
+	var v int
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return 0, fmt.Errorf("%w: schema version: %v", ErrCorruptedSnapshot, err)
+	}
+	return v, nil
+}
+
+// decode reads one snapshot document of any known version from r
+func (reg *schemaRegistry) decode(r io.Reader) (types.SnapshotData, error) {
+	return collect(newReader(r, reg, nil))
+}
+
+// plan returns the steps from version to the current one
+func (reg *schemaRegistry) plan(version int) (docSteps []func(document) error, jobSteps []func(rawJob) error, err error) {
+	if version < 1 || version > reg.current {
+		return nil, nil, fmt.Errorf("%w: got %d, want 1 to %d", ErrIncompatibleVersion, version, reg.current)
+	}
+	for v := version; v < reg.current; v++ {
+		step, ok := reg.steps[v]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: no migration from version %d", ErrIncompatibleVersion, v)
+		}
+		if step.doc != nil {
+			docSteps = append(docSteps, step.doc)
+		}
+		if step.job != nil {
+			jobSteps = append(jobSteps, step.job)
+		}
+	}
+	return docSteps, jobSteps, nil
+}
+
+// hasJobSteps reports whether any step changes jobs
+func (reg *schemaRegistry) hasJobSteps() bool {
+	for _, step := range reg.steps {
+		if step.job != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// upgradeDoc runs doc steps on the top-level fields (without jobs) and
+// decodes them
+func (reg *schemaRegistry) upgradeDoc(doc document, version int, steps []func(document) error) (types.SnapshotData, error) {
+	var data types.SnapshotData
+	for i, step := range steps {
+		if err := step(doc); err != nil {
+			return data, fmt.Errorf("%w: migrating from version %d: %v", ErrCorruptedSnapshot, version+i, err)
+		}
+	}
+	delete(doc, "schema_version")
+	if err := setField(doc, "schema_ver", reg.current); err != nil {
+		return data, err
+	}
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return data, err
+	}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return data, fmt.Errorf("%w: %v", ErrCorruptedSnapshot, err)
+	}
+	if data.Kind == "" {
+		data.Kind = types.SnapshotPartial // v2 without a kind, see above
+	}
+	if data.Kind != types.SnapshotFull && data.Kind != types.SnapshotPartial {
+		return data, fmt.Errorf("%w: unknown snapshot kind %q", ErrIncompatibleVersion, data.Kind)
+	}
+	return data, nil
+}
+
+// upgradeJob runs job steps on one job and decodes it
+func upgradeJob(id types.JobID, fields rawJob, steps []func(rawJob) error) (*types.Job, error) {
+	for _, step := range steps {
+		if err := step(fields); err != nil {
+			return nil, fmt.Errorf("%w: migrating job %s: %v", ErrCorruptedSnapshot, id, err)
+		}
+	}
+	upgraded, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	var job types.Job
+	if err := json.Unmarshal(upgraded, &job); err != nil {
+		return nil, fmt.Errorf("%w: job %s: %v", ErrCorruptedSnapshot, id, err)
+	}
+	return &job, nil
+}
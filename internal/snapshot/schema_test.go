@@ -0,0 +1,120 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================================================
+// Schema version tests
+// ============================================================================
+
+// loadRaw loads a snapshot file with the given content
+func loadRaw(t *testing.T, content string) (types.SnapshotData, error) {
+	t.Helper()
+	fsys := vfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("/data", 0755))
+	require.NoError(t, vfs.WriteFile(fsys, "/data/snapshot.json", []byte(content), 0644))
+	return NewManagerWithOptions("/data/snapshot.json", Options{FS: fsys}).Load()
+}
+
+// TestLoadOlderSchemas tests that every older spelling loads as current
+func TestLoadOlderSchemas(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		kind    types.SnapshotKind
+	}{
+		{"v1", `{"jobs":{"job-1":{"id":"job-1","status":"completed"}},"schema_ver":1,"last_seq":10}`, types.SnapshotFull},
+		{"v2 full", `{"jobs":{"job-1":{"id":"job-1"}},"schema_ver":2,"kind":"full","last_seq":10}`, types.SnapshotFull},
+		{"v2 without kind", `{"jobs":{"job-1":{"id":"job-1"}},"schema_ver":2,"last_seq":10}`, types.SnapshotPartial},
+		{"old jobmanager tag", `{"jobs":{"job-1":{"id":"job-1"}},"schema_version":1,"last_seq":10}`, types.SnapshotFull},
+	}
+	for _, tt := range tests {
+		data, err := loadRaw(t, tt.content)
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, types.CurrentSnapshotSchema, data.SchemaVer, tt.name)
+		assert.Equal(t, tt.kind, data.Kind, tt.name)
+		assert.Equal(t, uint64(10), data.LastSeq, tt.name)
+		require.Contains(t, data.Jobs, types.JobID("job-1"), tt.name)
+	}
+
+	for _, content := range []string{
+		`{"jobs":{},"last_seq":10}`,
+		`{"jobs":{},"schema_ver":0}`,
+		`{"jobs":{},"schema_ver":2,"kind":"sparse"}`,
+	} {
+		_, err := loadRaw(t, content)
+		assert.ErrorIs(t, err, ErrIncompatibleVersion, content)
+	}
+}
+
+// TestPartialSnapshotRoundTrip tests that the kind survives a write
+func TestPartialSnapshotRoundTrip(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	manager := NewManagerWithOptions("/data/snapshot.json", Options{FS: fsys})
+	data := seqSnapshot(10)
+	data.Kind = types.SnapshotPartial
+	require.NoError(t, manager.Write(data))
+
+	loaded, err := manager.Load()
+	require.NoError(t, err)
+	assert.True(t, loaded.IsPartial())
+	header, err := ReadHeader(fsys, "/data/snapshot.json")
+	require.NoError(t, err)
+	assert.Equal(t, types.SnapshotPartial, header.Kind)
+}
+
+// TestMigrationChain tests that steps run in order from the snapshot's
+// version, on the document and on every job
+func TestMigrationChain(t *testing.T) {
+	var ran []string
+	reg := schemaRegistry{
+		current: 4,
+		steps: map[int]schemaStep{
+			1: {doc: func(doc document) error {
+				ran = append(ran, "doc 1")
+				return upgradeV1(doc)
+			}},
+			2: {job: func(job rawJob) error {
+				ran = append(ran, "job 2")
+				job["attempt"], job["retries"] = job["retries"], nil // Renamed field
+				delete(job, "retries")
+				return nil
+			}},
+			3: {job: func(job rawJob) error {
+				ran = append(ran, "job 3")
+				if _, ok := job["status"]; !ok {
+					job["status"] = json.RawMessage(`"pending"`) // New field with a non-zero default
+				}
+				return nil
+			}},
+		},
+	}
+
+	data, err := reg.decode(strings.NewReader(`{"jobs":{"job-1":{"id":"job-1","retries":2}},"schema_ver":1,"last_seq":7}`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"doc 1", "job 2", "job 3"}, ran)
+	assert.Equal(t, 4, data.SchemaVer)
+	assert.Equal(t, types.SnapshotFull, data.Kind)
+	assert.Equal(t, uint64(7), data.LastSeq)
+	assert.Equal(t, 2, data.Jobs["job-1"].Attempt)
+	assert.Equal(t, types.StatusPending, data.Jobs["job-1"].Status)
+
+	// Starting later skips the earlier steps
+	ran = nil
+	_, err = reg.decode(strings.NewReader(`{"jobs":{"job-1":{"id":"job-1","status":"dead"}},"schema_ver":3,"kind":"full"}`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"job 3"}, ran)
+
+	// A gap in the registry cannot be crossed
+	delete(reg.steps, 2)
+	_, err = reg.decode(strings.NewReader(`{"jobs":{},"schema_ver":1}`))
+	assert.ErrorIs(t, err, ErrIncompatibleVersion)
+}
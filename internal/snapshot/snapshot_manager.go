@@ -34,33 +34,62 @@
 //   1. Write to temp file snapshot.json.tmp
 //   2. Call os.Rename() when complete
 //   3. os.Rename() is atomic (POSIX guarantee)
-//   4. Ensures snapshot is either complete or non-existent
+//   4. Sync the directory so the rename itself survives power loss
+//   5. Ensures snapshot is either complete or non-existent
+//
+// Generations:
+//   The last Options.Retain snapshots are kept and listed in a manifest
+//   with their checksums. Load falls back to an older generation if the
+//   newest is corrupted (see generations.go).
+//
+//   All file access goes through vfs.FS (Options.FS), so tests can run the
+//   manager on vfs.MemFS and cut power at any step.
 //
 // Data Format:
 //   JSON snapshot contains:
 //   {
+//     "schema_ver": 2,       // Schema version
+//     "kind": "full",        // Or "partial": active jobs only
+//     "last_seq": 12345,     // Last WAL sequence number
 //     "jobs": {              // Complete job states
 //       "job-1": {...},
 //       "job-2": {...}
-//     },
-//     "schema_ver": 1,       // Schema version
-//     "last_seq": 12345      // Last WAL sequence number
+//     }
 //   }
 //
+//   WriteStream and Reader write and read it one job at a time, so a
+//   snapshot of millions of jobs is never held in memory (see stream.go).
+//   Write, Load and friends collect the jobs into types.SnapshotData.
+//
+//   The file wraps it between a checksummed header (format version,
+//   LastSeq, Raft index and term, job counts, creation time, node ID) and
+//   a trailer with the body checksum, verified on every load; ReadHeader
+//   reads the metadata alone (see header.go).
+//
+// Encryption at Rest:
+//   With Options.Keyring set, the JSON document is sealed with AES-GCM
+//   envelope encryption (see internal/encryption) and written as:
+//     magic    [4]byte  "BRSE"
+//     envelope []byte   key ID, wrapped data key, nonce, ciphertext
+//   The key ID inside the envelope lets old snapshots open after the
+//   active key is rotated. Plain JSON snapshots stay readable, so
+//   encryption can be turned on for an existing queue.
+//
 // Schema Versioning:
-//   - V1: Current version with basic job info
-//   - Future versions: Add new fields, maintain backward compatibility
-//   - Load-time version check, error if incompatible
+//   - V1: Full snapshots with basic job info
+//   - V2: Current version, full or partial (kind field)
+//   - Older versions are migrated step by step on load (see schema.go)
+//   - Versions newer than this build are rejected
 //
 // Error Handling:
 //   - ErrSnapshotNotFound: First startup, no snapshot (normal)
-//   - ErrCorruptedSnapshot: JSON parse failure, corrupted
+//   - ErrCorruptedSnapshot: JSON parse failure, checksum mismatch, truncated
 //   - ErrIncompatibleVersion: Schema version mismatch
 //
 // Performance:
 //   - sync.Mutex ensures write atomicity
-//   - Indented JSON (debugging friendly, acceptable overhead)
-//   - Future: Consider compression for size reduction
+//   - Compact JSON, encoded and decoded job by job
+//   - Optional gzip or flate compression (see compression.go)
 //
 // Responsibilities:
 //   1. Serialize system state to JSON snapshot files
@@ -74,14 +103,19 @@ package snapshot
 
 import (
 	"bufio"
-	"encoding/json"
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/ChuLiYu/raft-recovery/internal/encryption"
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
 	"github.com/ChuLiYu/raft-recovery/pkg/types"
 )
 
@@ -95,19 +129,51 @@ var (
 	ErrSnapshotNotFound    = errors.New("snapshot file not found")
 )
 
+// encryptedMagic starts an encrypted snapshot file
+var encryptedMagic = []byte("BRSE")
+
+// encryptedAAD is the additional data sealed with every snapshot
+var encryptedAAD = []byte("beaver-raft snapshot")
+
 // ============================================================================
 // Data Structure Definitions
 // ============================================================================
 
 // Manager handles snapshot persistence
 type Manager struct {
-	path string     // Snapshot file path
-	mu   sync.Mutex // Protects file operations
+	path        string              // Snapshot file path
+	fs          vfs.FS              // Filesystem holding the snapshot files
+	keyring     *encryption.Keyring // Encrypts written snapshots (nil = plain JSON)
+	retain      int                 // Generations to keep, including the newest
+	pathGen     uint64              // Generation stored at path (0 = unknown)
+	retainedSeq uint64              // LastSeq of the oldest retained generation
+	compression Compression         // Compression of written snapshots
+	nodeID      string              // Recorded in snapshot headers
+	lastWrite   WriteStats          // Stats of the last successful write
+	metrics     Metrics             // Observes written snapshots (nil = not exported)
+	mu          sync.Mutex          // Protects file operations
+}
+
+// Options configures a Manager created with NewManagerWithOptions
+type Options struct {
+	Keyring *encryption.Keyring // Encrypt snapshots at rest (nil = off)
+	FS      vfs.FS              // Filesystem for snapshot files (default vfs.OS)
+	Retain  int                 // Snapshot generations to keep (<= 1 = newest only)
+
+	// Compression of written snapshots ("" = none); any format loads
+	Compression Compression
+
+	// NodeID identifies the writing node in snapshot headers (header.go)
+	NodeID string
+
+	// Metrics observes written snapshots (nil = not exported)
+	Metrics Metrics
 }
 
 // Uses pkg/types.SnapshotData structure (defined in pkg/types/types.go):
 //   - Jobs: map[JobID]*Job  // Unified job storage
-//   - SchemaVer: int        // Version number (currently 1)
+//   - SchemaVer: int        // Version number (see schema.go)
+//   - Kind: SnapshotKind    // Full or partial
 //   - LastSeq: uint64       // Last WAL sequence number
 
 // ============================================================================
@@ -116,8 +182,19 @@ type Manager struct {
 
 // NewManager creates a snapshot manager instance
 func NewManager(path string) *Manager {
+	return NewManagerWithOptions(path, Options{})
+}
+
+// NewManagerWithOptions creates a snapshot manager with optional features
+func NewManagerWithOptions(path string, opts Options) *Manager {
 	return &Manager{
-		path: path,
+		path:        path,
+		fs:          vfs.Default(opts.FS),
+		keyring:     opts.Keyring,
+		retain:      max(opts.Retain, 1),
+		compression: opts.Compression,
+		nodeID:      opts.NodeID,
+		metrics:     opts.Metrics,
 	}
 }
 
@@ -125,7 +202,7 @@ func NewManager(path string) *Manager {
 //
 // Atomic write process:
 // 1. Write to temp file (.tmp)
-// 2. Use os.Rename to atomically replace original
+// 2. Rename it into place and commit it to the manifest (generations.go)
 //
 // Parameters:
 //   - data: Snapshot data (uses pkg/types.SnapshotData)
@@ -135,114 +212,236 @@ func NewManager(path string) *Manager {
 func (m *Manager) Write(data types.SnapshotData) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	return m.writeLocked(streamOf(data, 0), m.retain)
+}
+
+// WriteRaft writes a snapshot of the Raft state machine
+//
+// Parameters:
+//   - data: Snapshot data; LastSeq is the last applied Raft index
+//   - term: Term of the log entry at that index, recorded in the header
+//
+// Returns:
+//   - error: Error on write failure
+func (m *Manager) WriteRaft(data types.SnapshotData, term uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.writeLocked(streamOf(data, term), m.retain)
+}
+
+// WriteStream writes a snapshot job by job, holding one job in memory at
+// a time (see stream.go)
+//
+// Parameters:
+//   - s: Snapshot metadata and its jobs; s.JobCounts must match the jobs
+//
+// Returns:
+//   - error: Error on write failure or if the jobs do not match s.JobCounts
+func (m *Manager) WriteStream(s Stream) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.writeLocked(s, m.retain)
+}
 
+// writeLocked implements the writes, keeping retain generations; caller
+// must hold m.mu
+func (m *Manager) writeLocked(s Stream, retain int) error {
 	// Ensure the directory exists before writing snapshot
 	dir := filepath.Dir(m.path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	if err := m.fs.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("failed to create snapshot directory: %w", err)
 	}
 
-	// Set version number (currently 1)
-	data.SchemaVer = 1
+	// Always written in the current schema (see writeBody)
+	if s.Kind == "" {
+		s.Kind = types.SnapshotFull
+	}
+	if s.CreatedAt == 0 {
+		s.CreatedAt = time.Now().UnixMilli()
+	}
 
 	// Atomic write process with buffered I/O for performance
 	tmpPath := m.path + ".tmp"
 
 	// 1. Create temp file with buffered writer (10x faster for large snapshots)
-	tmpFile, err := os.Create(tmpPath)
+	tmpFile, err := vfs.Create(m.fs, tmpPath)
 	if err != nil {
 		return fmt.Errorf("failed to create temp snapshot: %w", err)
 	}
 	defer tmpFile.Close()
 
 	// Use buffered writer to reduce syscalls (major performance boost!)
-	bufWriter := bufio.NewWriterSize(tmpFile, 64*1024) // 64KB buffer
+	// The checksum for the manifest is computed on the way out
+	sum := &checksumWriter{w: tmpFile}
+	bufWriter := bufio.NewWriterSize(sum, 64*1024) // 64KB buffer
+
+	// Header first, then the body with its own checksum for the trailer
+	header := &Header{
+		FormatVersion: HeaderFormatVersion,
+		SchemaVer:     types.CurrentSnapshotSchema,
+		Kind:          s.Kind,
+		LastSeq:       s.LastSeq,
+		JobCounts:     s.JobCounts,
+		CreatedAt:     s.CreatedAt,
+		NodeID:        m.nodeID,
+		Compression:   m.compression,
+		Encrypted:     m.keyring != nil,
+	}
+	if s.RaftTerm > 0 {
+		header.RaftIndex, header.RaftTerm = s.LastSeq, s.RaftTerm
+	}
+	if header.Compression == "" {
+		header.Compression = CompressionNone
+	}
+	if err := writeHeader(bufWriter, header); err != nil {
+		m.fs.Remove(tmpPath)
+		return fmt.Errorf("failed to write snapshot header: %w", err)
+	}
+	body := &checksumWriter{w: bufWriter}
 
-	// Use streaming encoder (no intermediate memory allocation)
-	encoder := json.NewEncoder(bufWriter)
-	// Remove indentation for production (smaller file, faster write)
-	// encoder.SetIndent("", "  ") // Uncomment for debugging
+	// Encryption seals the whole document, so it is encoded in memory first
+	var plain bytes.Buffer
+	var out io.Writer = body
+	if m.keyring != nil {
+		out = &plain
+	}
 
-	if err := encoder.Encode(data); err != nil {
-		os.Remove(tmpPath)
+	// Stream the jobs one by one through the compressor (see
+	// compression.go and stream.go)
+	start := time.Now()
+	compressor, err := newCompressor(out, m.compression)
+	if err != nil {
+		m.fs.Remove(tmpPath)
+		return fmt.Errorf("failed to compress snapshot: %w", err)
+	}
+	raw := &countingWriter{w: compressor}
+	if err := writeBody(raw, &s); err != nil {
+		m.fs.Remove(tmpPath)
 		return fmt.Errorf("failed to encode snapshot: %w", err)
 	}
+	if err := compressor.Close(); err != nil {
+		m.fs.Remove(tmpPath)
+		return fmt.Errorf("failed to compress snapshot: %w", err)
+	}
+
+	if m.keyring != nil {
+		sealed, err := m.keyring.Seal(plain.Bytes(), encryptedAAD)
+		if err != nil {
+			m.fs.Remove(tmpPath)
+			return fmt.Errorf("failed to encrypt snapshot: %w", err)
+		}
+		body.Write(encryptedMagic)
+		body.Write(sealed) // Errors surface in Flush
+	}
+	writeTrailer(bufWriter, body)
 
 	// Flush buffer to ensure all data is written
 	if err := bufWriter.Flush(); err != nil {
-		os.Remove(tmpPath)
+		m.fs.Remove(tmpPath)
 		return fmt.Errorf("failed to flush snapshot: %w", err)
 	}
+	stats := WriteStats{
+		Compression: m.compression,
+		RawBytes:    raw.n,
+		Size:        sum.size,
+		Encode:      time.Since(start),
+	}
 
 	// Sync to disk before rename (ensure durability)
 	if err := tmpFile.Sync(); err != nil {
-		os.Remove(tmpPath)
+		m.fs.Remove(tmpPath)
 		return fmt.Errorf("failed to sync snapshot: %w", err)
 	}
 
 	tmpFile.Close() // Close before rename
 
-	// 2. Atomic rename (critical step)
-	if err := os.Rename(tmpPath, m.path); err != nil {
-		// Rename failed, cleanup temp file
-		os.Remove(tmpPath)
-		return fmt.Errorf("failed to rename snapshot: %w", err)
+	// 2. Atomic rename and manifest commit (critical step)
+	err = m.commitGeneration(tmpPath, generation{
+		LastSeq:   s.LastSeq,
+		CreatedAt: s.CreatedAt,
+		Size:      sum.size,
+		Checksum:  sum.crc,
+	}, retain)
+	if err != nil {
+		return err
 	}
-
+	m.lastWrite = stats
+	stats.record(m.metrics)
 	return nil
 }
 
+// LastWrite returns the stats of the last successful write
+func (m *Manager) LastWrite() WriteStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastWrite
+}
+
 // Load reads snapshot from disk
 //
 // Behavior:
 //   - Returns empty SnapshotData if file doesn't exist (first startup)
 //   - Validates schema version compatibility
 //   - Detects corrupted snapshot files
+//   - Falls back to older generations (see LoadNewest)
 //
 // Returns:
 //   - types.SnapshotData: Snapshot data
 //   - error: Error on load failure or version incompatibility
 func (m *Manager) Load() (types.SnapshotData, error) {
+	data, _, err := m.LoadNewest()
+	return data, err
+}
+
+// emptySnapshot returns the state of a first startup
+func emptySnapshot() types.SnapshotData {
+	return types.SnapshotData{
+		Jobs:      make(map[types.JobID]*types.Job),
+		SchemaVer: types.CurrentSnapshotSchema,
+		Kind:      types.SnapshotFull,
+		LastSeq:   0,
+	}
+}
+
+// LoadFile reads a specific snapshot file, e.g. a backup returned by List
+//
+// Unlike Load, a missing file is an error.
+func (m *Manager) LoadFile(path string) (types.SnapshotData, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	return loadFile(m.fs, path, m.keyring)
+}
 
+// loadFile reads, decrypts and validates one snapshot file
+// Returns an error satisfying os.IsNotExist if the file is missing
+func loadFile(fsys vfs.FS, path string, keyring *encryption.Keyring) (types.SnapshotData, error) {
 	var data types.SnapshotData
+	_, err := streamFile(fsys, path, keyring, collectInto(&data))
+	return data, err
+}
 
-	// Read file
-	jsonBytes, err := os.ReadFile(m.path)
+// streamFile hands one snapshot file to consume as a Reader (see
+// stream.go) and returns its metadata
+func streamFile(fsys vfs.FS, path string, keyring *encryption.Keyring, consume func(*Reader) error) (types.SnapshotData, error) {
+	f, err := vfs.Open(fsys, path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			// First startup, no snapshot, return empty state
-			return types.SnapshotData{
-				Jobs:      make(map[types.JobID]*types.Job),
-				SchemaVer: 1,
-				LastSeq:   0,
-			}, nil
+			return types.SnapshotData{}, err
 		}
-		return data, fmt.Errorf("failed to read snapshot: %w", err)
+		return types.SnapshotData{}, fmt.Errorf("failed to read snapshot: %w", err)
 	}
+	defer f.Close()
 
-	// Deserialize
-	if err := json.Unmarshal(jsonBytes, &data); err != nil {
-		return data, fmt.Errorf("%w: %v", ErrCorruptedSnapshot, err)
-	}
-
-	// Validate version
-	if data.SchemaVer != 1 {
-		return data, fmt.Errorf("%w: got %d, want 1", ErrIncompatibleVersion, data.SchemaVer)
-	}
-
-	// Ensure Jobs map is not nil
-	if data.Jobs == nil {
-		data.Jobs = make(map[types.JobID]*types.Job)
+	rd, err := openReader(f, path, keyring)
+	if err != nil {
+		return types.SnapshotData{}, err
 	}
-
-	return data, nil
+	return consumeAll(rd, consume)
 }
 
 // Exists checks if snapshot file exists
 func (m *Manager) Exists() bool {
-	_, err := os.Stat(m.path)
+	_, err := m.fs.Stat(m.path)
 	return err == nil
 }
 
@@ -252,59 +451,140 @@ func (m *Manager) GetPath() string {
 }
 
 // ============================================================================
-// ✅ Completed TODOs
+// Snapshot History (point-in-time recovery)
 // ============================================================================
 
-// ✅ TODO 1: Implement Write with atomic write logic (prevent corruption)
-// ✅ TODO 2: Implement Load with version validation (ensure compatibility)
-// ⏳ TODO 3: Add compression support (optional, skip in Phase 1)
+// backupTimeFormat is the suffix format of timestamped snapshot backups
+const backupTimeFormat = "20060102_150405"
 
-// ============================================================================
-// Advanced Features (Future Optimization)
-// ============================================================================
+// Info describes one snapshot file on disk
+type Info struct {
+	Path      string    // Snapshot file
+	LastSeq   uint64    // Last WAL sequence number covered
+	CreatedAt time.Time // Creation time (file modification time for older snapshots)
+	Header    *Header   // File header (nil for snapshots written before headers existed)
+}
 
-// WriteWithBackup writes snapshot and keeps old version backups
+// List returns the current snapshot, its older generations and its
+// timestamped backups, ordered by LastSeq (oldest first)
 //
-// For safer snapshot management, retains recent versions
-func (m *Manager) WriteWithBackup(data types.SnapshotData, keepBackups int) error {
+// Unreadable files are skipped. Files with a header are verified by
+// checksum instead of being decoded.
+//
+// Returns:
+//   - []Info: Snapshots found (empty if none)
+//   - error: Directory read failure
+func (m *Manager) List() ([]Info, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// If old snapshot exists, backup first
-	if m.Exists() {
-		backupPath := fmt.Sprintf("%s.%s", m.path, time.Now().Format("20060102_150405"))
-		if err := os.Rename(m.path, backupPath); err != nil {
-			return fmt.Errorf("failed to backup old snapshot: %w", err)
+	dir := filepath.Dir(m.path)
+	prefix := filepath.Base(m.path) + "."
+	entries, err := m.fs.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
 		}
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
 
-		// TODO: Cleanup old backups (keep recent keepBackups count)
+	paths := []string{m.path}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		_, err := time.Parse(backupTimeFormat, name[len(prefix):])
+		if err == nil || strings.HasPrefix(name, filepath.Base(m.path)+generationInfix) {
+			paths = append(paths, filepath.Join(dir, name))
+		}
 	}
 
-	// Unlock and call original Write method
-	m.mu.Unlock()
-	err := m.Write(data)
+	var infos []Info
+	for _, path := range paths {
+		info, err := m.fileInfo(path)
+		if err != nil {
+			continue
+		}
+		if info.CreatedAt.IsZero() {
+			if stat, err := m.fs.Stat(path); err == nil {
+				info.CreatedAt = stat.ModTime()
+			}
+		}
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].LastSeq < infos[j].LastSeq
+	})
+	return infos, nil
+}
+
+// fileInfo describes one valid snapshot file, loading only older files
+// without a header
+func (m *Manager) fileInfo(path string) (Info, error) {
+	header, err := VerifyFile(m.fs, path)
+	if errors.Is(err, ErrNoHeader) {
+		data, err := loadFile(m.fs, path, m.keyring)
+		if err != nil {
+			return Info{}, err
+		}
+		info := Info{Path: path, LastSeq: data.LastSeq}
+		if data.CreatedAt != 0 {
+			info.CreatedAt = time.UnixMilli(data.CreatedAt)
+		}
+		return info, nil
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Path: path, LastSeq: header.LastSeq, CreatedAt: time.UnixMilli(header.CreatedAt), Header: header}, nil
+}
+
+// Backup copies the current snapshot to a timestamped backup file
+//
+// Returns:
+//   - string: Backup path ("" if there is no snapshot)
+//   - error: Copy failure
+func (m *Manager) Backup() (string, error) {
 	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	return err
+	data, err := vfs.ReadFile(m.fs, m.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	backupPath := fmt.Sprintf("%s.%s", m.path, time.Now().Format(backupTimeFormat))
+	if err := vfs.WriteFile(m.fs, backupPath, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write snapshot backup: %w", err)
+	}
+	return backupPath, nil
 }
 
 // ============================================================================
-// Advanced Features (Optional in Phase 1)
+// ✅ Completed TODOs
 // ============================================================================
 
-/*
-Compression Support (Future Implementation):
-
-  import "compress/gzip"
-
-  Write():
-    gzipWriter := gzip.NewWriter(tmpFile)
-    json.NewEncoder(gzipWriter).Encode(data)
-    gzipWriter.Close()
+// ✅ TODO 1: Implement Write with atomic write logic (prevent corruption)
+// ✅ TODO 2: Implement Load with version validation (ensure compatibility)
+// ✅ TODO 3: Add compression support (compression.go)
+// ✅ TODO 4: Keep older generations and fall back on load (generations.go)
 
-  Load():
-    gzipReader, _ := gzip.NewReader(file)
-    json.NewDecoder(gzipReader).Decode(&data)
+// ============================================================================
+// Advanced Features (Future Optimization)
+// ============================================================================
 
-  Benefit: Save 70% disk space for large queues (100k jobs)
-*/
+// WriteWithBackup writes snapshot and keeps old version backups
+//
+// For safer snapshot management, retains recent versions: the previous
+// keepBackups generations stay next to the new snapshot, whatever
+// Options.Retain says
+func (m *Manager) WriteWithBackup(data types.SnapshotData, keepBackups int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.writeLocked(streamOf(data, 0), keepBackups+1)
+}
@@ -6,13 +6,17 @@ package snapshot
 // ============================================================================
 
 import (
+	"bytes"
 	"encoding/json"
 	"os"
 	"path/filepath"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/ChuLiYu/raft-recovery/internal/encryption"
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
 	"github.com/ChuLiYu/raft-recovery/pkg/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -70,7 +74,8 @@ func TestWriteAndLoad(t *testing.T) {
 	require.NoError(t, err)
 
 	// verify contents match
-	assert.Equal(t, originalData.SchemaVer, loadedData.SchemaVer)
+	assert.Equal(t, types.CurrentSnapshotSchema, loadedData.SchemaVer)
+	assert.Equal(t, types.SnapshotFull, loadedData.Kind)
 	assert.Equal(t, originalData.LastSeq, loadedData.LastSeq)
 	assert.Equal(t, len(originalData.Jobs), len(loadedData.Jobs))
 
@@ -182,7 +187,7 @@ func TestFirstBoot(t *testing.T) {
 	// Loading a non-existent snapshot should return empty state, not error
 	loadedData, err := manager.Load()
 	require.NoError(t, err)
-	assert.Equal(t, 1, loadedData.SchemaVer)
+	assert.Equal(t, types.CurrentSnapshotSchema, loadedData.SchemaVer)
 	assert.Equal(t, uint64(0), loadedData.LastSeq)
 	assert.NotNil(t, loadedData.Jobs)
 	assert.Equal(t, 0, len(loadedData.Jobs))
@@ -194,10 +199,10 @@ func TestVersionMismatch(t *testing.T) {
 	snapshotPath := filepath.Join(tempDir, "test_snapshot.json")
 	manager := NewManager(snapshotPath)
 
-	// Manually create a snapshot with version 2 (incompatible)
+	// Manually create a snapshot from a newer version (incompatible)
 	invalidData := types.SnapshotData{
 		Jobs:      make(map[types.JobID]*types.Job),
-		SchemaVer: 2, // incompatible version
+		SchemaVer: types.CurrentSnapshotSchema + 1, // incompatible version
 		LastSeq:   0,
 	}
 	jsonBytes, err := json.MarshalIndent(invalidData, "", "  ")
@@ -309,6 +314,132 @@ func TestWriteWithBackup(t *testing.T) {
 	assert.True(t, backupFound, "Backup file should exist")
 }
 
+// TestListAndBackup tests listing the current snapshot with its backups
+func TestListAndBackup(t *testing.T) {
+	tempDir := t.TempDir()
+	manager := NewManager(filepath.Join(tempDir, "test_snapshot.json"))
+
+	infos, err := manager.List()
+	require.NoError(t, err)
+	assert.Empty(t, infos)
+	backupPath, err := manager.Backup()
+	require.NoError(t, err)
+	assert.Empty(t, backupPath, "nothing to back up yet")
+
+	require.NoError(t, manager.Write(types.SnapshotData{Jobs: map[types.JobID]*types.Job{}, SchemaVer: 1, LastSeq: 50}))
+	backupPath, err = manager.Backup()
+	require.NoError(t, err)
+	require.NoError(t, manager.Write(types.SnapshotData{Jobs: map[types.JobID]*types.Job{}, SchemaVer: 1, LastSeq: 100}))
+
+	// Unrelated files next to the snapshot are ignored
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "test_snapshot.json.tmp"), []byte("{}"), 0644))
+
+	infos, err = manager.List()
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+	assert.Equal(t, backupPath, infos[0].Path)
+	assert.Equal(t, uint64(50), infos[0].LastSeq)
+	assert.Equal(t, manager.GetPath(), infos[1].Path)
+	assert.Equal(t, uint64(100), infos[1].LastSeq)
+	assert.WithinDuration(t, time.Now(), infos[1].CreatedAt, time.Minute)
+
+	data, err := manager.LoadFile(backupPath)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(50), data.LastSeq)
+}
+
+// TestEncryptedSnapshot tests sealed snapshots, key rotation and missing keys
+func TestEncryptedSnapshot(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "test_snapshot.json")
+	keyring := func(active string, ids ...string) *encryption.Keyring {
+		keys := make(map[string][]byte)
+		for _, id := range ids {
+			keys[id] = bytes.Repeat([]byte(id[len(id)-1:]), 32)
+		}
+		k, err := encryption.NewKeyring(keys, active)
+		require.NoError(t, err)
+		return k
+	}
+	data := types.SnapshotData{
+		Jobs:    map[types.JobID]*types.Job{"job-001": {ID: "job-001", Payload: map[string]interface{}{"secret": "s3cr3t"}}},
+		LastSeq: 7,
+	}
+
+	// Plain snapshots written before encryption stay readable
+	require.NoError(t, NewManager(path).Write(data))
+	manager := NewManagerWithOptions(path, Options{Keyring: keyring("k1", "k1")})
+	loaded, err := manager.Load()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(7), loaded.LastSeq)
+
+	// Sealed with k1
+	require.NoError(t, manager.Write(data))
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "s3cr3t")
+	keyID, err := encryption.KeyID(snapshotBody(t, raw)[len(encryptedMagic):])
+	require.NoError(t, err)
+	assert.Equal(t, "k1", keyID)
+
+	// Rotated to k2: the k1 snapshot still loads
+	loaded, err = NewManagerWithOptions(path, Options{Keyring: keyring("k2", "k1", "k2")}).Load()
+	require.NoError(t, err)
+	assert.Equal(t, "s3cr3t", loaded.Jobs["job-001"].Payload["secret"])
+
+	// Missing keys give a clear error
+	_, err = NewManagerWithOptions(path, Options{Keyring: keyring("k2", "k2")}).Load()
+	assert.ErrorIs(t, err, encryption.ErrKeyNotFound)
+	assert.Contains(t, err.Error(), `"k1"`)
+	_, err = NewManager(path).Load()
+	assert.ErrorIs(t, err, encryption.ErrKeyNotFound)
+	assert.Contains(t, err.Error(), "no encryption keys are configured")
+}
+
+// TestCrashConsistency cuts power after every write step on an in-memory
+// filesystem: Load always returns the last acknowledged snapshot
+func TestCrashConsistency(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	manager := NewManagerWithOptions("/data/snapshot.json", Options{FS: fsys})
+	snapshot := func(seq uint64) types.SnapshotData {
+		return types.SnapshotData{Jobs: map[types.JobID]*types.Job{"job-1": {ID: "job-1"}}, LastSeq: seq}
+	}
+	loadAfterCrash := func() uint64 {
+		data, err := NewManagerWithOptions("/data/snapshot.json", Options{FS: fsys.Crash()}).Load()
+		require.NoError(t, err)
+		return data.LastSeq
+	}
+
+	require.NoError(t, manager.Write(snapshot(10)))
+	assert.Equal(t, uint64(10), loadAfterCrash(), "acknowledged snapshot lost")
+
+	// Each failing step leaves the previous snapshot in place
+	faults := []vfs.Fault{
+		{Op: vfs.OpWrite, Partial: true},
+		{Op: vfs.OpSync},
+		{Op: vfs.OpRename},
+		{Op: vfs.OpWrite, Err: syscall.ENOSPC},
+	}
+	for _, fault := range faults {
+		fsys.Inject(fault)
+		assert.Error(t, manager.Write(snapshot(20)), "fault %s", fault.Op)
+		fsys.ClearFaults()
+		assert.Equal(t, uint64(10), loadAfterCrash(), "fault %s", fault.Op)
+		data, err := manager.Load()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(10), data.LastSeq, "fault %s", fault.Op)
+	}
+
+	// A failed directory sync reports the error; either version may survive
+	fsys.Inject(vfs.Fault{Op: vfs.OpSyncDir})
+	assert.Error(t, manager.Write(snapshot(30)))
+	fsys.ClearFaults()
+	assert.Contains(t, []uint64{10, 30}, loadAfterCrash())
+
+	require.NoError(t, manager.Write(snapshot(40)))
+	assert.Equal(t, uint64(40), loadAfterCrash())
+}
+
 // TestLargeSnapshot tests writing and loading a large snapshot
 func TestLargeSnapshot(t *testing.T) {
 	tempDir := t.TempDir()
@@ -393,7 +524,7 @@ func TestConcurrentWrites(t *testing.T) {
 	// verify final snapshot is valid
 	loadedData, err := manager.Load()
 	require.NoError(t, err)
-	assert.Equal(t, 1, loadedData.SchemaVer)
+	assert.Equal(t, types.CurrentSnapshotSchema, loadedData.SchemaVer)
 	assert.NotNil(t, loadedData.Jobs)
 }
 
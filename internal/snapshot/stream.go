@@ -0,0 +1,564 @@
+// ============================================================================
+// Beaver-Raft Snapshot Streaming
+// ============================================================================
+//
+// Package: internal/snapshot
+// File: stream.go
+// Purpose: Write and read snapshots one job at a time with bounded memory
+//
+// Writing (Manager.WriteStream):
+//   The caller hands over the metadata and a types.JobIterator. Top-level
+//   fields are written first, then the jobs one by one:
+//     {"schema_ver":2,"kind":"full","last_seq":N,"created_at":T,"jobs":{"id":{...},...}}
+//   Only the job being encoded is held in memory. The header (header.go)
+//   comes before the body, so Stream.JobCounts must be known up front; a
+//   stream yielding different jobs fails the write.
+//
+// Reading (Reader):
+//   The document is decoded token by token, so only the current job is
+//   held. Next returns jobs as they are read, but io.EOF only once the
+//   whole file verified (trailer checksum, header, manifest): a consumer
+//   must discard what it built if Next fails. Files written before
+//   streaming list jobs before the schema version; they still stream,
+//   unless a registered step rewrites jobs (schema.go), in which case jobs
+//   are held until the version is known.
+//
+// Memory:
+//   Encryption seals the body as one envelope, so encrypted snapshots keep
+//   the compressed body in memory on write and read.
+//
+// ============================================================================
+
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/ChuLiYu/raft-recovery/internal/encryption"
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+)
+
+// Stream is a snapshot handed to Manager.WriteStream one job at a time
+type Stream struct {
+	Kind      types.SnapshotKind      // Full or partial ("" = full)
+	LastSeq   uint64                  // Last WAL seq (or Raft index) covered
+	CreatedAt int64                   // Unix milliseconds (0 = now)
+	RaftTerm  uint64                  // Term of the entry at LastSeq (Raft snapshots only)
+	JobCounts map[types.JobStatus]int // Jobs by status, recorded in the header before the jobs
+	Jobs      types.JobIterator       // The jobs, each exactly once
+}
+
+// streamOf streams an in-memory snapshot in job ID order
+func streamOf(data types.SnapshotData, raftTerm uint64) Stream {
+	jobs := make([]*types.Job, 0, len(data.Jobs))
+	for _, job := range data.Jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return Stream{
+		Kind:      data.Kind,
+		LastSeq:   data.LastSeq,
+		CreatedAt: data.CreatedAt,
+		RaftTerm:  raftTerm,
+		JobCounts: countJobs(data.Jobs),
+		Jobs:      &sliceIterator{jobs: jobs},
+	}
+}
+
+// sliceIterator yields the jobs of a slice
+type sliceIterator struct {
+	jobs []*types.Job
+}
+
+func (it *sliceIterator) Next() (*types.Job, error) {
+	if len(it.jobs) == 0 {
+		return nil, io.EOF
+	}
+	job := it.jobs[0]
+	it.jobs = it.jobs[1:]
+	return job, nil
+}
+
+// streamMeta is the top-level fields written before the jobs
+type streamMeta struct {
+	SchemaVer int                `json:"schema_ver"`
+	Kind      types.SnapshotKind `json:"kind"`
+	LastSeq   uint64             `json:"last_seq"`
+	CreatedAt int64              `json:"created_at,omitempty"`
+}
+
+// writeBody encodes the snapshot document job by job
+func writeBody(w io.Writer, s *Stream) error {
+	meta, err := json.Marshal(streamMeta{
+		SchemaVer: types.CurrentSnapshotSchema,
+		Kind:      s.Kind,
+		LastSeq:   s.LastSeq,
+		CreatedAt: s.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(append(meta[:len(meta)-1], `,"jobs":{`...)); err != nil {
+		return err
+	}
+
+	counts := make(map[types.JobStatus]int)
+	for n := 0; ; n++ {
+		job, err := s.Jobs.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if job == nil {
+			return errors.New("snapshot stream yielded a nil job")
+		}
+		counts[job.Status]++
+
+		id, err := json.Marshal(job.ID)
+		if err != nil {
+			return err
+		}
+		raw, err := json.Marshal(job)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			id = append([]byte{','}, id...)
+		}
+		if _, err := w.Write(append(append(id, ':'), raw...)); err != nil {
+			return err
+		}
+	}
+	if !sameCounts(counts, s.JobCounts) {
+		return fmt.Errorf("snapshot stream yielded %v jobs, header says %v", counts, s.JobCounts)
+	}
+	_, err = io.WriteString(w, "}}\n")
+	return err
+}
+
+// sameCounts compares job counts, ignoring zero entries
+func sameCounts(a, b map[types.JobStatus]int) bool {
+	for status, n := range a {
+		if b[status] != n {
+			return false
+		}
+	}
+	for status, n := range b {
+		if a[status] != n {
+			return false
+		}
+	}
+	return true
+}
+
+// ============================================================================
+// Reader
+// ============================================================================
+
+// readerState is where a Reader is in the document
+type readerState int
+
+const (
+	readStart   readerState = iota // Before the opening brace
+	readFields                     // Top-level fields
+	readJobs                       // Inside "jobs"
+	readPending                    // Held jobs, after the document verified
+	readDone                       // Verified; Next returns io.EOF
+)
+
+// pendingJob is a job held until the schema version is known
+type pendingJob struct {
+	id     types.JobID
+	fields rawJob
+}
+
+// Reader streams the jobs of one snapshot
+//
+// Next yields jobs in file order and returns io.EOF once the snapshot
+// verified; Meta is complete from then on.
+type Reader struct {
+	dec    *json.Decoder
+	reg    *schemaRegistry
+	header *Header                     // File header (nil for older files)
+	finish func(decodeErr error) error // Verifies the rest of the file (nil = bare JSON)
+
+	state    readerState
+	doc      document // Top-level fields read so far
+	version  int      // Schema version, once planned
+	planned  bool
+	docSteps []func(document) error
+	jobSteps []func(rawJob) error
+	buffered bool // Jobs are held until the version is known
+	pending  []pendingJob
+	jobs     int // Jobs read
+	meta     types.SnapshotData
+	err      error // Sticky
+}
+
+// newReader reads a snapshot document from the decoded JSON stream r
+func newReader(r io.Reader, reg *schemaRegistry, header *Header) *Reader {
+	return &Reader{dec: json.NewDecoder(r), reg: reg, header: header, doc: document{}}
+}
+
+// emptyReader reads the snapshot of a first startup
+func emptyReader() *Reader {
+	return &Reader{state: readDone, meta: emptySnapshot()}
+}
+
+// openReader verifies and peels off the header, encryption and
+// compression of a snapshot file stream
+func openReader(r io.Reader, path string, keyring *encryption.Keyring) (*Reader, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	if !hasHeader(br) {
+		// Written before headers existed
+		body, err := openBody(br, path, keyring)
+		if err != nil {
+			return nil, err
+		}
+		return newReader(body, &schemas, nil), nil
+	}
+
+	header, _, err := parseHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	trailer := &holdbackReader{r: br, n: trailerSize}
+	sum := &checksumWriter{w: io.Discard}
+	tee := io.TeeReader(trailer, sum)
+	finish := func(decodeErr error) error {
+		// A damaged body fails the checksum; report that over decode errors
+		if _, err := io.Copy(io.Discard, tee); err != nil {
+			return fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		if err := parseTrailer(header, trailer.trailer()); err != nil {
+			return err
+		}
+		if err := verifyBody(header, sum); err != nil {
+			return err
+		}
+		return decodeErr
+	}
+
+	body, err := openBody(tee, path, keyring)
+	if err != nil {
+		return nil, finish(err)
+	}
+	rd := newReader(body, &schemas, header)
+	rd.finish = finish
+	return rd, nil
+}
+
+// openBody decrypts and decompresses a snapshot body
+//
+// Layers are detected by their magic bytes. Only an encrypted body is
+// read into memory as a whole.
+func openBody(r io.Reader, path string, keyring *encryption.Keyring) (io.Reader, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+
+	// Decrypt
+	if head, _ := br.Peek(len(encryptedMagic)); bytes.Equal(head, encryptedMagic) {
+		br.Discard(len(encryptedMagic))
+		sealed, err := io.ReadAll(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		if keyring == nil {
+			keyID, _ := encryption.KeyID(sealed)
+			return nil, fmt.Errorf("%w: snapshot %s is encrypted with key %q, but no encryption keys are configured",
+				encryption.ErrKeyNotFound, path, keyID)
+		}
+		plain, err := keyring.Open(sealed, encryptedAAD)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt snapshot %s: %w", path, err)
+		}
+		br = bufio.NewReader(bytes.NewReader(plain))
+	}
+
+	// Decompress
+	return newDecompressor(br)
+}
+
+// Meta returns the snapshot without its jobs; complete once Next has
+// returned io.EOF
+func (r *Reader) Meta() types.SnapshotData {
+	return r.meta
+}
+
+// Next returns the next job, or io.EOF once the snapshot is read and
+// verified
+func (r *Reader) Next() (*types.Job, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	job, err := r.next()
+	if err != nil && err != io.EOF {
+		if r.finish != nil && r.state != readPending && r.state != readDone {
+			err = r.finish(err)
+		}
+		r.err = err
+	}
+	return job, err
+}
+
+// next implements Next without the error handling
+func (r *Reader) next() (*types.Job, error) {
+	for {
+		switch r.state {
+		case readStart:
+			if err := r.expect(json.Delim('{')); err != nil {
+				return nil, err
+			}
+			r.state = readFields
+
+		case readFields:
+			if !r.dec.More() {
+				if err := r.expect(json.Delim('}')); err != nil {
+					return nil, err
+				}
+				if err := r.finishDoc(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			key, err := r.key()
+			if err != nil {
+				return nil, err
+			}
+			if key == "jobs" {
+				if err := r.startJobs(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			var raw json.RawMessage
+			if err := r.dec.Decode(&raw); err != nil {
+				return nil, corrupted(err)
+			}
+			r.doc[key] = raw
+			if key == "schema_ver" || key == "schema_version" {
+				if err := r.planFromDoc(); err != nil {
+					return nil, err
+				}
+			}
+
+		case readJobs:
+			if !r.dec.More() {
+				if err := r.expect(json.Delim('}')); err != nil {
+					return nil, err
+				}
+				r.state = readFields
+				continue
+			}
+			key, err := r.key()
+			if err != nil {
+				return nil, err
+			}
+			id := types.JobID(key)
+			r.jobs++
+			if r.buffered || len(r.jobSteps) > 0 {
+				var fields rawJob
+				if err := r.dec.Decode(&fields); err != nil {
+					return nil, corrupted(err)
+				}
+				if r.buffered {
+					r.pending = append(r.pending, pendingJob{id: id, fields: fields})
+					continue
+				}
+				job, err := upgradeJob(id, fields, r.jobSteps)
+				if err != nil {
+					return nil, err
+				}
+				return withID(job, id), nil
+			}
+			var job types.Job
+			if err := r.dec.Decode(&job); err != nil {
+				return nil, corrupted(err)
+			}
+			return withID(&job, id), nil
+
+		case readPending:
+			if len(r.pending) == 0 {
+				r.state = readDone
+				continue
+			}
+			p := r.pending[0]
+			r.pending = r.pending[1:]
+			job, err := upgradeJob(p.id, p.fields, r.jobSteps)
+			if err != nil {
+				return nil, err
+			}
+			return withID(job, p.id), nil
+
+		default:
+			return nil, io.EOF
+		}
+	}
+}
+
+// expect reads one delimiter
+func (r *Reader) expect(delim json.Delim) error {
+	tok, err := r.dec.Token()
+	if err != nil {
+		return corrupted(err)
+	}
+	if tok != delim {
+		return fmt.Errorf("%w: expected %v, got %v", ErrCorruptedSnapshot, delim, tok)
+	}
+	return nil
+}
+
+// key reads an object key
+func (r *Reader) key() (string, error) {
+	tok, err := r.dec.Token()
+	if err != nil {
+		return "", corrupted(err)
+	}
+	key, ok := tok.(string)
+	if !ok {
+		return "", fmt.Errorf("%w: expected a key, got %v", ErrCorruptedSnapshot, tok)
+	}
+	return key, nil
+}
+
+// plan selects the migration steps for version
+func (r *Reader) plan(version int) error {
+	docSteps, jobSteps, err := r.reg.plan(version)
+	if err != nil {
+		return err
+	}
+	r.version, r.planned = version, true
+	r.docSteps, r.jobSteps = docSteps, jobSteps
+	return nil
+}
+
+// planFromDoc plans from the version field once it is read
+func (r *Reader) planFromDoc() error {
+	version, err := r.doc.version()
+	if err != nil {
+		return err
+	}
+	if r.planned {
+		if version != r.version {
+			return fmt.Errorf("%w: schema version %d does not match header (%d)", ErrCorruptedSnapshot, version, r.version)
+		}
+		return nil
+	}
+	return r.plan(version)
+}
+
+// startJobs enters the jobs object, deciding how jobs are decoded
+func (r *Reader) startJobs() error {
+	tok, err := r.dec.Token()
+	if err != nil {
+		return corrupted(err)
+	}
+	if tok == nil {
+		return nil // "jobs": null
+	}
+	if tok != json.Delim('{') {
+		return fmt.Errorf("%w: jobs is %v, not an object", ErrCorruptedSnapshot, tok)
+	}
+	r.state = readJobs
+
+	switch {
+	case r.planned:
+	case r.header != nil:
+		return r.plan(r.header.SchemaVer)
+	case r.reg.hasJobSteps():
+		r.buffered = true // Older layout: the version follows the jobs
+	}
+	return nil
+}
+
+// finishDoc migrates the top-level fields and verifies the file
+func (r *Reader) finishDoc() error {
+	if _, err := r.dec.Token(); err != io.EOF {
+		return fmt.Errorf("%w: unexpected data after snapshot (%v)", ErrCorruptedSnapshot, err)
+	}
+	if err := r.planFromDoc(); err != nil {
+		return err
+	}
+	meta, err := r.reg.upgradeDoc(r.doc, r.version, r.docSteps)
+	if err != nil {
+		return err
+	}
+	r.meta = meta
+	r.doc = nil
+
+	if r.finish != nil {
+		r.state = readPending // finish runs once
+		if err := r.finish(nil); err != nil {
+			return err
+		}
+	}
+	if r.header != nil {
+		if err := checkHeader(r.header, r.meta.LastSeq, r.jobs); err != nil {
+			return err
+		}
+	}
+	r.state = readPending
+	return nil
+}
+
+// corrupted wraps a decoding error
+func corrupted(err error) error {
+	return fmt.Errorf("%w: %v", ErrCorruptedSnapshot, err)
+}
+
+// withID fills in a missing job ID from its key
+func withID(job *types.Job, id types.JobID) *types.Job {
+	if job.ID == "" {
+		job.ID = id
+	}
+	return job
+}
+
+// consumeAll runs consume on r and checks that it read the whole snapshot
+func consumeAll(r *Reader, consume func(*Reader) error) (types.SnapshotData, error) {
+	if err := consume(r); err != nil {
+		return types.SnapshotData{}, err
+	}
+	// Only io.EOF means the snapshot verified
+	if _, err := r.Next(); err != io.EOF {
+		if err == nil {
+			err = errors.New("snapshot consumer stopped before the last job")
+		}
+		return types.SnapshotData{}, err
+	}
+	return r.Meta(), nil
+}
+
+// collectInto returns a consumer that reads the whole snapshot into data
+func collectInto(data *types.SnapshotData) func(*Reader) error {
+	return func(r *Reader) error {
+		collected, err := collect(r)
+		*data = collected
+		return err
+	}
+}
+
+// collect reads all jobs of a snapshot into memory
+func collect(r *Reader) (types.SnapshotData, error) {
+	jobs := make(map[types.JobID]*types.Job)
+	for {
+		job, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return types.SnapshotData{}, err
+		}
+		jobs[job.ID] = job
+	}
+	data := r.Meta()
+	data.Jobs = jobs
+	return data, nil
+}
@@ -0,0 +1,171 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================================================
+// Streaming tests
+// ============================================================================
+
+// countJobsIn returns a consumer counting the jobs it reads
+func countJobsIn(n *int) func(*Reader) error {
+	return func(r *Reader) error {
+		*n = 0
+		for {
+			_, err := r.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			*n++
+		}
+	}
+}
+
+// TestStreamRoundTrip tests WriteStream and LoadNewestStream
+func TestStreamRoundTrip(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	path := "/data/snapshot.json"
+	manager := NewManagerWithOptions(path, Options{FS: fsys, Compression: CompressionGzip})
+
+	data := manyJobs(1000, 42)
+	require.NoError(t, manager.WriteStream(streamOf(data, 0)))
+
+	header, err := ReadHeader(fsys, path)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, header.Jobs())
+
+	var ids []types.JobID
+	meta, skipped, err := manager.LoadNewestStream(func(r *Reader) error {
+		ids = ids[:0]
+		for {
+			job, err := r.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			assert.Equal(t, data.Jobs[job.ID].Payload["index"], int(job.Payload["index"].(float64)))
+			ids = append(ids, job.ID)
+		}
+	})
+	require.NoError(t, err)
+	assert.Empty(t, skipped)
+	assert.Equal(t, uint64(42), meta.LastSeq)
+	assert.Equal(t, types.SnapshotFull, meta.Kind)
+	assert.Equal(t, types.CurrentSnapshotSchema, meta.SchemaVer)
+	assert.Nil(t, meta.Jobs)
+	require.Len(t, ids, 1000)
+	assert.Equal(t, types.JobID("job-00000"), ids[0], "jobs are written in ID order")
+	assert.Equal(t, types.JobID("job-00999"), ids[999])
+
+	// The metadata comes first, so it is readable without the jobs
+	raw, err := vfs.ReadFile(fsys, path)
+	require.NoError(t, err)
+	plain, err := newDecompressor(bufio.NewReader(bytes.NewReader(snapshotBody(t, raw))))
+	require.NoError(t, err)
+	body, err := io.ReadAll(plain)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(body, []byte(`{"schema_ver":2,"kind":"full","last_seq":42,`)), string(body[:60]))
+}
+
+// TestStreamCountMismatch tests that a stream disagreeing with its header fails
+func TestStreamCountMismatch(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	path := "/data/snapshot.json"
+	manager := NewManagerWithOptions(path, Options{FS: fsys})
+	require.NoError(t, manager.Write(seqSnapshot(5)))
+
+	s := streamOf(manyJobs(3, 10), 0)
+	s.JobCounts = map[types.JobStatus]int{types.StatusPending: 4}
+	assert.Error(t, manager.WriteStream(s))
+
+	// The previous snapshot is still the newest
+	data, err := manager.Load()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), data.LastSeq)
+}
+
+// TestStreamOlderLayout tests files listing jobs before the schema version
+func TestStreamOlderLayout(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	path := "/data/snapshot.json"
+	require.NoError(t, fsys.MkdirAll("/data", 0755))
+	require.NoError(t, vfs.WriteFile(fsys, path,
+		[]byte(`{"jobs":{"a":{"id":"a","status":"pending"},"b":{"status":"dead"}},"schema_ver":1,"last_seq":3}`), 0644))
+
+	manager := NewManagerWithOptions(path, Options{FS: fsys})
+	var n int
+	meta, _, err := manager.LoadNewestStream(countJobsIn(&n))
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, uint64(3), meta.LastSeq)
+	assert.Equal(t, types.SnapshotFull, meta.Kind)
+
+	// Job IDs missing from the job come from the key
+	data, err := manager.Load()
+	require.NoError(t, err)
+	assert.Equal(t, types.JobID("b"), data.Jobs["b"].ID)
+}
+
+// TestStreamVerifiesBeforeEOF tests that bit rot in a job that still
+// parses fails the stream instead of ending it
+func TestStreamVerifiesBeforeEOF(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	path := "/data/snapshot.json"
+	manager := NewManagerWithOptions(path, Options{FS: fsys, Retain: 1})
+	require.NoError(t, manager.Write(manyJobs(10, 7)))
+
+	raw, err := vfs.ReadFile(fsys, path)
+	require.NoError(t, err)
+	i := bytes.LastIndex(raw, []byte(`"job-00009"`))
+	require.Positive(t, i)
+	raw[i+1] = 'k' // Still valid JSON
+	require.NoError(t, vfs.WriteFile(fsys, path, raw, 0644))
+
+	var n int
+	_, skipped, err := manager.LoadNewestStream(countJobsIn(&n))
+	assert.ErrorIs(t, err, ErrCorruptedSnapshot)
+	assert.Len(t, skipped, 1)
+	assert.Equal(t, 10, n, "every job was read before the checksum failed")
+
+	// Without the manifest, the trailer checksum catches it too
+	f, err := vfs.Open(fsys, path)
+	require.NoError(t, err)
+	defer f.Close()
+	rd, err := openReader(f, path, nil)
+	require.NoError(t, err)
+	_, err = collect(rd)
+	assert.ErrorIs(t, err, ErrCorruptedSnapshot)
+}
+
+// TestStreamEmpty tests the consumer of a first startup
+func TestStreamEmpty(t *testing.T) {
+	manager := NewManagerWithOptions("/data/snapshot.json", Options{FS: vfs.NewMemFS()})
+	n := -1
+	meta, skipped, err := manager.LoadNewestStream(countJobsIn(&n))
+	require.NoError(t, err)
+	assert.Empty(t, skipped)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, uint64(0), meta.LastSeq)
+	assert.Equal(t, types.SnapshotFull, meta.Kind)
+
+	// A consumer must read to the end
+	_, _, err = manager.LoadNewestStream(func(r *Reader) error { return nil })
+	assert.NoError(t, err, "an empty snapshot is at its end")
+	require.NoError(t, manager.Write(manyJobs(2, 1)))
+	_, _, err = manager.LoadNewestStream(func(r *Reader) error { return nil })
+	assert.Error(t, err)
+}
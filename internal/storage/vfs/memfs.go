@@ -0,0 +1,564 @@
+package vfs
+
+// ============================================================================
+// In-Memory Filesystem with Fault Injection
+// Responsibility: Model what survives a power failure and fail operations
+// on demand, for crash-consistency tests
+// ============================================================================
+//
+// Durability model (stricter than most real filesystems, on purpose):
+//
+//   state            visible to readers       survives Crash()
+//   file contents    after Write              only what the last Sync saw
+//   directory entry  after create / rename /  only as of the last SyncDir
+//                    remove                   of the parent directory
+//   directories      after MkdirAll           always (simplification)
+//
+// Crash returns a new MemFS holding only the durable state, as a machine
+// restarted after a power failure would see it. The old MemFS stays
+// usable, so goroutines of the "crashed" process cannot disturb the
+// recovered state. CrashTorn additionally keeps a random part of unsynced
+// appends, like a write that was in flight when power was lost.
+//
+// Faults (see Inject) make matching operations fail:
+//   - failed fsync (OpSync, OpSyncDir): nothing becomes durable
+//   - torn write (OpWrite with Partial): half the bytes land, then an error
+//   - failed rename / remove / open / truncate
+//   - ENOSPC: SetCapacity limits the total size of all files
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Op names an operation that a Fault can match
+type Op string
+
+const (
+	OpOpen     Op = "open"     // OpenFile
+	OpWrite    Op = "write"    // File.Write
+	OpSync     Op = "sync"     // File.Sync
+	OpTruncate Op = "truncate" // File.Truncate and FS.Truncate
+	OpRename   Op = "rename"   // FS.Rename (matched on the old path)
+	OpRemove   Op = "remove"   // FS.Remove
+	OpSyncDir  Op = "syncdir"  // FS.SyncDir
+	OpAny      Op = "*"        // Every operation above, e.g. to stop all I/O at a crash point
+)
+
+// Fault makes matching operations fail
+type Fault struct {
+	Op      Op     // Operation to fail
+	Path    string // filepath.Match pattern for the path ("" = any path)
+	After   int    // Let this many matching operations succeed first
+	Times   int    // Fail this many times, then succeed again (0 = forever)
+	Err     error  // Returned error (default syscall.EIO)
+	Partial bool   // OpWrite only: write the first half of the data before failing
+
+	seen   int
+	failed int
+}
+
+// MemFS is an in-memory FS with a power-failure model and fault injection
+//
+// A MemFS is safe for concurrent use.
+type MemFS struct {
+	mu       sync.Mutex
+	files    map[string]*memInode // Visible directory entries
+	durable  map[string]*memInode // Directory entries as of the last SyncDir
+	dirs     map[string]bool      // Existing directories
+	faults   []*Fault
+	capacity int64 // Max total file bytes (0 = unlimited)
+}
+
+// memInode is the contents of one file
+type memInode struct {
+	data    []byte    // Current contents
+	synced  []byte    // Contents at the last successful Sync
+	modTime time.Time // Last modification
+}
+
+// NewMemFS creates an empty in-memory filesystem
+func NewMemFS() *MemFS {
+	return &MemFS{
+		files:   make(map[string]*memInode),
+		durable: make(map[string]*memInode),
+		dirs:    map[string]bool{"/": true, ".": true},
+	}
+}
+
+// ============================================================================
+// Fault Injection and Crashes
+// ============================================================================
+
+// Inject adds a fault; faults are checked in the order they were added
+func (m *MemFS) Inject(f Fault) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.faults = append(m.faults, &f)
+}
+
+// ClearFaults removes every fault
+func (m *MemFS) ClearFaults() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.faults = nil
+}
+
+// SetCapacity limits the total size of all files; writes past it fail
+// with ENOSPC after writing what fits (0 = unlimited)
+func (m *MemFS) SetCapacity(bytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.capacity = bytes
+}
+
+// Crash returns the filesystem as it would be found after a power failure:
+// only synced contents under durable directory entries
+func (m *MemFS) Crash() *MemFS {
+	return m.crash(nil)
+}
+
+// CrashTorn is Crash, except that files keep a random prefix of their
+// unsynced appends; sometimes that prefix is zeroed, as when the file size
+// reached the disk before the data
+func (m *MemFS) CrashTorn(rng *rand.Rand) *MemFS {
+	return m.crash(rng)
+}
+
+func (m *MemFS) crash(rng *rand.Rand) *MemFS {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	after := NewMemFS()
+	for dir := range m.dirs {
+		after.dirs[dir] = true
+	}
+	copied := make(map[*memInode]*memInode)
+	for name, inode := range m.durable {
+		c, ok := copied[inode]
+		if !ok {
+			data := append([]byte(nil), inode.synced...)
+			if rng != nil && len(inode.data) > len(inode.synced) && strings.HasPrefix(string(inode.data), string(inode.synced)) {
+				keep := rng.Intn(len(inode.data) - len(inode.synced) + 1)
+				torn := inode.data[len(inode.synced) : len(inode.synced)+keep]
+				if rng.Intn(4) == 0 {
+					torn = make([]byte, len(torn))
+				}
+				data = append(data, torn...)
+			}
+			c = &memInode{data: data, synced: append([]byte(nil), data...), modTime: inode.modTime}
+			copied[inode] = c
+		}
+		after.files[name] = c
+		after.durable[name] = c
+	}
+	return after
+}
+
+// fault returns the error of the first fault matching op on name; caller
+// must hold m.mu
+func (m *MemFS) fault(op Op, name string) (*Fault, error) {
+	for _, f := range m.faults {
+		if f.Op != op && f.Op != OpAny {
+			continue
+		}
+		if f.Path != "" {
+			if ok, _ := filepath.Match(f.Path, name); !ok {
+				continue
+			}
+		}
+		f.seen++
+		if f.seen <= f.After || (f.Times > 0 && f.failed >= f.Times) {
+			continue
+		}
+		f.failed++
+		err := f.Err
+		if err == nil {
+			err = syscall.EIO
+		}
+		return f, &fs.PathError{Op: string(op), Path: name, Err: err}
+	}
+	return nil, nil
+}
+
+// ============================================================================
+// FS Implementation
+// ============================================================================
+
+func (m *MemFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	name = filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.fault(OpOpen, name); err != nil {
+		return nil, err
+	}
+	if m.dirs[name] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+	inode, ok := m.files[name]
+	switch {
+	case ok && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case !ok:
+		if !m.dirs[filepath.Dir(name)] {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		inode = &memInode{modTime: time.Now()}
+		m.files[name] = inode
+	}
+	if flag&os.O_TRUNC != 0 && flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		inode.data = inode.data[:0:0]
+		inode.modTime = time.Now()
+	}
+	return &memFile{fs: m, name: name, inode: inode, flag: flag}, nil
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	name = filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.statLocked(name)
+}
+
+func (m *MemFS) statLocked(name string) (fs.FileInfo, error) {
+	if m.dirs[name] {
+		return memFileInfo{name: filepath.Base(name), dir: true}, nil
+	}
+	inode, ok := m.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return memFileInfo{name: filepath.Base(name), size: int64(len(inode.data)), modTime: inode.modTime}, nil
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	name = filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.dirs[name] {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	var entries []fs.DirEntry
+	add := func(path string) {
+		if path != name && filepath.Dir(path) == name {
+			info, _ := m.statLocked(path)
+			entries = append(entries, fs.FileInfoToDirEntry(info))
+		}
+	}
+	for path := range m.files {
+		add(path)
+	}
+	for path := range m.dirs {
+		add(path)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (m *MemFS) MkdirAll(path string, perm fs.FileMode) error {
+	path = filepath.Clean(path)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for dir := path; !m.dirs[dir]; dir = filepath.Dir(dir) {
+		if _, ok := m.files[dir]; ok {
+			return &fs.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+		}
+		m.dirs[dir] = true
+	}
+	return nil
+}
+
+func (m *MemFS) Rename(oldpath, newpath string) error {
+	oldpath, newpath = filepath.Clean(oldpath), filepath.Clean(newpath)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.fault(OpRename, oldpath); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: errors.Unwrap(err)}
+	}
+	inode, ok := m.files[oldpath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+	}
+	if !m.dirs[filepath.Dir(newpath)] {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+	}
+	delete(m.files, oldpath)
+	m.files[newpath] = inode
+	return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	name = filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.fault(OpRemove, name); err != nil {
+		return err
+	}
+	if _, ok := m.files[name]; ok {
+		delete(m.files, name)
+		return nil
+	}
+	if m.dirs[name] {
+		for path := range m.files {
+			if filepath.Dir(path) == name {
+				return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+			}
+		}
+		delete(m.dirs, name)
+		return nil
+	}
+	return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+}
+
+func (m *MemFS) Truncate(name string, size int64) error {
+	name = filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	inode, ok := m.files[name]
+	if !ok {
+		return &fs.PathError{Op: "truncate", Path: name, Err: fs.ErrNotExist}
+	}
+	return m.truncateLocked(name, inode, size)
+}
+
+func (m *MemFS) truncateLocked(name string, inode *memInode, size int64) error {
+	if _, err := m.fault(OpTruncate, name); err != nil {
+		return err
+	}
+	if size < 0 {
+		return &fs.PathError{Op: "truncate", Path: name, Err: syscall.EINVAL}
+	}
+	if grow := size - int64(len(inode.data)); grow > 0 {
+		if err := m.reserveLocked(name, grow); err != nil {
+			return err
+		}
+		inode.data = append(inode.data, make([]byte, grow)...)
+	} else {
+		inode.data = append([]byte(nil), inode.data[:size]...)
+	}
+	inode.modTime = time.Now()
+	return nil
+}
+
+func (m *MemFS) SyncDir(name string) error {
+	name = filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.fault(OpSyncDir, name); err != nil {
+		return err
+	}
+	if !m.dirs[name] {
+		return &fs.PathError{Op: "sync", Path: name, Err: fs.ErrNotExist}
+	}
+	for path := range m.durable {
+		if filepath.Dir(path) == name {
+			delete(m.durable, path)
+		}
+	}
+	for path, inode := range m.files {
+		if filepath.Dir(path) == name {
+			m.durable[path] = inode
+		}
+	}
+	return nil
+}
+
+// reserveLocked checks that n more bytes fit; caller must hold m.mu
+func (m *MemFS) reserveLocked(name string, n int64) error {
+	if m.capacity <= 0 {
+		return nil
+	}
+	if m.usedLocked()+n > m.capacity {
+		return &fs.PathError{Op: "write", Path: name, Err: syscall.ENOSPC}
+	}
+	return nil
+}
+
+// usedLocked returns the total size of all files; caller must hold m.mu
+func (m *MemFS) usedLocked() int64 {
+	var used int64
+	seen := make(map[*memInode]bool)
+	for _, inode := range m.files {
+		if !seen[inode] {
+			seen[inode] = true
+			used += int64(len(inode.data))
+		}
+	}
+	return used
+}
+
+// ============================================================================
+// Files
+// ============================================================================
+
+// memFile is an open handle to a memInode
+type memFile struct {
+	fs     *MemFS
+	name   string
+	inode  *memInode
+	flag   int
+	offset int64
+	closed bool
+}
+
+func (f *memFile) Name() string { return f.name }
+
+func (f *memFile) check(op string) error {
+	if f.closed {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	}
+	return nil
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("read"); err != nil {
+		return 0, err
+	}
+	if f.offset >= int64(len(f.inode.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.inode.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("read"); err != nil {
+		return 0, err
+	}
+	if off >= int64(len(f.inode.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.inode.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("write"); err != nil {
+		return 0, err
+	}
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: syscall.EBADF}
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = int64(len(f.inode.data))
+	}
+
+	data := p
+	fault, err := f.fs.fault(OpWrite, f.name)
+	if fault != nil {
+		if !fault.Partial {
+			return 0, err
+		}
+		data = p[:len(p)/2]
+	}
+	if f.fs.capacity > 0 {
+		free := f.fs.capacity - f.fs.usedLocked()
+		if grow := f.offset + int64(len(data)) - int64(len(f.inode.data)); grow > free {
+			data = data[:max(0, int64(len(data))-(grow-free))]
+			err = &fs.PathError{Op: "write", Path: f.name, Err: syscall.ENOSPC}
+		}
+	}
+
+	if gap := f.offset - int64(len(f.inode.data)); gap > 0 {
+		f.inode.data = append(f.inode.data, make([]byte, gap)...)
+	}
+	end := f.offset + int64(len(data))
+	if end > int64(len(f.inode.data)) {
+		f.inode.data = append(f.inode.data[:f.offset], data...)
+	} else {
+		copy(f.inode.data[f.offset:], data)
+	}
+	f.offset = end
+	f.inode.modTime = time.Now()
+	return len(data), err
+}
+
+func (f *memFile) Sync() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("sync"); err != nil {
+		return err
+	}
+	if _, err := f.fs.fault(OpSync, f.name); err != nil {
+		return err
+	}
+	f.inode.synced = append(f.inode.synced[:0:0], f.inode.data...)
+	return nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("truncate"); err != nil {
+		return err
+	}
+	return f.fs.truncateLocked(f.name, f.inode, size)
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("stat"); err != nil {
+		return nil, err
+	}
+	return memFileInfo{name: filepath.Base(f.name), size: int64(len(f.inode.data)), modTime: f.inode.modTime}, nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("close"); err != nil {
+		return err
+	}
+	f.closed = true
+	return nil
+}
+
+// memFileInfo implements fs.FileInfo
+type memFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return i.size }
+func (i memFileInfo) ModTime() time.Time { return i.modTime }
+func (i memFileInfo) IsDir() bool        { return i.dir }
+func (i memFileInfo) Sys() interface{}   { return nil }
+
+func (i memFileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
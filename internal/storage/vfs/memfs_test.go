@@ -0,0 +1,198 @@
+package vfs
+
+import (
+	"errors"
+	"io/fs"
+	"math/rand"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================================================
+// Power-Failure Model
+// ============================================================================
+
+func TestMemFSCrashKeepsOnlySyncedData(t *testing.T) {
+	m := NewMemFS()
+	require.NoError(t, m.MkdirAll("/data", 0755))
+
+	f, err := Create(m, "/data/a")
+	require.NoError(t, err)
+	_, err = f.Write([]byte("synced"))
+	require.NoError(t, err)
+	require.NoError(t, f.Sync())
+	_, err = f.Write([]byte("+lost"))
+	require.NoError(t, err)
+
+	// Entry not durable yet: the file disappears
+	_, err = m.Crash().Stat("/data/a")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+	require.NoError(t, m.SyncDir("/data"))
+	data, err := ReadFile(m.Crash(), "/data/a")
+	require.NoError(t, err)
+	assert.Equal(t, "synced", string(data))
+
+	// Still visible before the crash
+	data, err = ReadFile(m, "/data/a")
+	require.NoError(t, err)
+	assert.Equal(t, "synced+lost", string(data))
+}
+
+func TestMemFSCrashRenameNeedsSyncDir(t *testing.T) {
+	m := NewMemFS()
+	require.NoError(t, m.MkdirAll("/data", 0755))
+	require.NoError(t, WriteFile(m, "/data/old", []byte("v1"), 0644))
+	f, err := m.OpenFile("/data/old", os.O_RDWR, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.Sync())
+	require.NoError(t, m.SyncDir("/data"))
+
+	require.NoError(t, m.Rename("/data/old", "/data/new"))
+	after := m.Crash()
+	_, err = after.Stat("/data/new")
+	assert.True(t, os.IsNotExist(err))
+	_, err = after.Stat("/data/old")
+	assert.NoError(t, err)
+
+	require.NoError(t, m.SyncDir("/data"))
+	after = m.Crash()
+	_, err = after.Stat("/data/old")
+	assert.True(t, os.IsNotExist(err))
+	data, err := ReadFile(after, "/data/new")
+	require.NoError(t, err)
+	assert.Equal(t, "v1", string(data))
+}
+
+func TestMemFSCrashTorn(t *testing.T) {
+	m := NewMemFS()
+	f, err := Create(m, "/wal")
+	require.NoError(t, err)
+	_, err = f.Write([]byte("head"))
+	require.NoError(t, err)
+	require.NoError(t, f.Sync())
+	require.NoError(t, m.SyncDir("/"))
+	_, err = f.Write([]byte("-unsynced-tail"))
+	require.NoError(t, err)
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		data, err := ReadFile(m.CrashTorn(rng), "/wal")
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, len(data), len("head"))
+		assert.Equal(t, "head", string(data[:4]))
+		assert.LessOrEqual(t, len(data), len("head-unsynced-tail"))
+	}
+}
+
+// ============================================================================
+// Fault Injection
+// ============================================================================
+
+func TestMemFSFaults(t *testing.T) {
+	m := NewMemFS()
+	m.Inject(Fault{Op: OpSync, Path: "/a*", After: 1, Times: 1})
+	m.Inject(Fault{Op: OpRename, Path: "/b"})
+	m.Inject(Fault{Op: OpWrite, Path: "/c", Partial: true, Err: syscall.EROFS})
+
+	a, err := Create(m, "/a")
+	require.NoError(t, err)
+	require.NoError(t, a.Sync())             // After: 1
+	assert.ErrorIs(t, a.Sync(), syscall.EIO) // Default error
+	require.NoError(t, a.Sync())             // Times: 1
+	require.NoError(t, WriteFile(m, "/b", nil, 0644))
+	assert.ErrorIs(t, m.Rename("/b", "/x"), syscall.EIO)
+	_, err = m.Stat("/b")
+	assert.NoError(t, err, "failed rename must leave the source in place")
+
+	c, err := Create(m, "/c")
+	require.NoError(t, err)
+	n, err := c.Write([]byte("abcd"))
+	assert.Equal(t, 2, n)
+	assert.ErrorIs(t, err, syscall.EROFS)
+	data, err := ReadFile(m, "/c")
+	require.NoError(t, err)
+	assert.Equal(t, "ab", string(data))
+
+	m.ClearFaults()
+	require.NoError(t, m.Rename("/b", "/x"))
+}
+
+func TestMemFSFaultAnyOp(t *testing.T) {
+	m := NewMemFS()
+	f, err := Create(m, "/a") // open
+	require.NoError(t, err)
+	m.Inject(Fault{Op: OpAny, After: 2})
+
+	_, err = f.Write([]byte("data")) // 1
+	require.NoError(t, err)
+	require.NoError(t, f.Sync()) // 2
+
+	// Every operation fails from here on, as after a crash point
+	_, err = f.Write([]byte("more"))
+	assert.ErrorIs(t, err, syscall.EIO)
+	assert.Error(t, m.SyncDir("/"))
+	_, err = Create(m, "/b")
+	assert.Error(t, err)
+}
+
+func TestMemFSCapacity(t *testing.T) {
+	m := NewMemFS()
+	m.SetCapacity(10)
+	f, err := Create(m, "/f")
+	require.NoError(t, err)
+
+	n, err := f.Write([]byte("12345678"))
+	require.NoError(t, err)
+	assert.Equal(t, 8, n)
+	n, err = f.Write([]byte("9abc"))
+	assert.Equal(t, 2, n)
+	assert.ErrorIs(t, err, syscall.ENOSPC)
+	assert.ErrorIs(t, f.Truncate(20), syscall.ENOSPC)
+
+	// Freeing space makes writes succeed again
+	f, err = Create(m, "/f")
+	require.NoError(t, err)
+	_, err = f.Write([]byte("ok"))
+	assert.NoError(t, err)
+}
+
+func TestMemFSFiles(t *testing.T) {
+	m := NewMemFS()
+	require.NoError(t, m.MkdirAll("/d/sub", 0755))
+	require.NoError(t, WriteFile(m, "/d/x.1", []byte("1"), 0644))
+	require.NoError(t, WriteFile(m, "/d/x.2", []byte("2"), 0644))
+
+	_, err := m.OpenFile("/missing/f", os.O_CREATE|os.O_WRONLY, 0644)
+	assert.True(t, os.IsNotExist(err))
+
+	matches, err := Glob(m, "/d/x.*")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/d/x.1", "/d/x.2"}, matches)
+
+	entries, err := m.ReadDir("/d")
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.True(t, entries[0].IsDir())
+
+	// O_APPEND writes at the end, read-only handles cannot write
+	f, err := m.OpenFile("/d/x.1", os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("+"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	data, err := ReadFile(m, "/d/x.1")
+	require.NoError(t, err)
+	assert.Equal(t, "1+", string(data))
+
+	r, err := Open(m, "/d/x.1")
+	require.NoError(t, err)
+	_, err = r.Write([]byte("x"))
+	assert.ErrorIs(t, err, syscall.EBADF)
+	require.NoError(t, r.Close())
+	assert.ErrorIs(t, r.Close(), fs.ErrClosed)
+}
@@ -0,0 +1,332 @@
+package wal
+
+// ============================================================================
+// WAL Archive
+// Responsibility: Keep pruned segments as compressed files for audits and
+// point-in-time restores
+// ============================================================================
+//
+// Layout (for WAL path "data/beaver-raft.wal" and archive dir "archive"):
+//   archive/beaver-raft.wal.00000000000000000001.gz   pruned segment from seq 1
+//   archive/beaver-raft.wal.20240501_120000.gz        legacy rotated file
+//   archive/beaver-raft.wal.index.json                seq range of every file
+//
+// Prune compresses a segment into the archive and records it in the index
+// before deleting it, so a crash in between only leaves a duplicate that
+// the next Prune overwrites. Retention (file count, age, total size) is
+// enforced from the oldest end after every Prune, so the archive plus the
+// local segments always form one gapless history.
+//
+// ReplayFrom reads archived segments transparently when it is asked for
+// events older than the oldest local segment. Legacy files (rotated with
+// a timestamp by older versions, whose seq numbers may restart) are
+// archived on open for audits but never replayed.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+)
+
+// legacyRotateFormat is the timestamp suffix older versions gave rotated files
+const legacyRotateFormat = "20060102_150405"
+
+// ArchiveOptions configures the WAL archive
+type ArchiveOptions struct {
+	Dir      string        // Archive directory ("" = pruned segments are deleted)
+	MaxFiles int           // Keep at most this many archive files (0 = no limit)
+	MaxAge   time.Duration // Delete archive files older than this (0 = no limit)
+	MaxBytes int64         // Keep the archive at most this large (0 = no limit)
+}
+
+func (o ArchiveOptions) enabled() bool {
+	return o.Dir != ""
+}
+
+// ArchiveEntry describes one compressed file in the archive index
+type ArchiveEntry struct {
+	File       string `json:"file"`             // File name inside the archive directory
+	StartSeq   uint64 `json:"start_seq"`        // Start seq of the original segment
+	FirstSeq   uint64 `json:"first_seq"`        // First event seq stored (0 if empty)
+	LastSeq    uint64 `json:"last_seq"`         // Last event seq stored (0 if empty)
+	Events     int    `json:"events"`           // Number of events
+	Size       int64  `json:"size"`             // Compressed size in bytes
+	ArchivedAt int64  `json:"archived_at"`      // Unix milliseconds
+	Legacy     bool   `json:"legacy,omitempty"` // Timestamp-rotated file, not replayed
+}
+
+// archiveIndexPath returns the index path of the WAL at walPath
+func archiveIndexPath(dir, walPath string) string {
+	return filepath.Join(dir, filepath.Base(walPath)+".index.json")
+}
+
+// ReadArchiveIndex returns the archive index of the WAL at walPath, ordered
+// by StartSeq (empty if nothing was archived yet)
+func ReadArchiveIndex(dir, walPath string) ([]ArchiveEntry, error) {
+	return readArchiveIndex(vfs.OS, dir, walPath)
+}
+
+// readArchiveIndex implements ReadArchiveIndex on fsys
+func readArchiveIndex(fsys vfs.FS, dir, walPath string) ([]ArchiveEntry, error) {
+	data, err := vfs.ReadFile(fsys, archiveIndexPath(dir, walPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read WAL archive index: %w", err)
+	}
+	var entries []ArchiveEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse WAL archive index: %w", err)
+	}
+	return entries, nil
+}
+
+// writeArchiveIndex replaces the archive index atomically
+func writeArchiveIndex(fsys vfs.FS, dir, walPath string, entries []ArchiveEntry) error {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].StartSeq < entries[j].StartSeq
+	})
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(fsys, archiveIndexPath(dir, walPath), data); err != nil {
+		return fmt.Errorf("failed to write WAL archive index: %w", err)
+	}
+	return nil
+}
+
+// archiveFile compresses one WAL file into the archive and records it in
+// the index; the source file is left in place
+//
+// Parameters:
+//   - src: Sealed segment (or legacy rotated file) to archive
+//   - startSeq: Start seq of the segment (ignored for legacy files)
+//   - legacy: src is a timestamp-rotated file from an older version
+//
+// Returns:
+//   - ArchiveEntry: The index entry written
+//   - error: Read, compression or index failure
+func archiveFile(fsys vfs.FS, opts ArchiveOptions, walPath, src string, startSeq uint64, legacy bool) (ArchiveEntry, error) {
+	scan, err := scanSegment(fsys, src)
+	if err != nil {
+		var corruption *CorruptionError
+		if !errors.As(err, &corruption) {
+			return ArchiveEntry{}, err
+		}
+		// Archive the damaged file as is; the index covers the readable part
+		fmt.Printf("Warning: archiving damaged WAL file: %v\n", err)
+	}
+	if legacy {
+		startSeq = scan.First
+	}
+
+	if err := fsys.MkdirAll(opts.Dir, 0755); err != nil {
+		return ArchiveEntry{}, fmt.Errorf("failed to create WAL archive directory: %w", err)
+	}
+	name := filepath.Base(src) + ".gz"
+	dst := filepath.Join(opts.Dir, name)
+	if err := compressFile(fsys, src, dst+".tmp"); err != nil {
+		fsys.Remove(dst + ".tmp")
+		return ArchiveEntry{}, fmt.Errorf("failed to compress %s: %w", src, err)
+	}
+	if err := fsys.Rename(dst+".tmp", dst); err != nil {
+		fsys.Remove(dst + ".tmp")
+		return ArchiveEntry{}, err
+	}
+	info, err := fsys.Stat(dst)
+	if err != nil {
+		return ArchiveEntry{}, err
+	}
+
+	entry := ArchiveEntry{
+		File:       name,
+		StartSeq:   startSeq,
+		FirstSeq:   scan.First,
+		LastSeq:    scan.Last,
+		Events:     scan.Count,
+		Size:       info.Size(),
+		ArchivedAt: time.Now().UnixMilli(),
+		Legacy:     legacy,
+	}
+
+	entries, err := readArchiveIndex(fsys, opts.Dir, walPath)
+	if err != nil {
+		return entry, err
+	}
+	kept := entries[:0]
+	for _, e := range entries {
+		if e.File != name {
+			kept = append(kept, e)
+		}
+	}
+	return entry, writeArchiveIndex(fsys, opts.Dir, walPath, append(kept, entry))
+}
+
+// enforceArchiveRetention deletes the oldest archive files until the
+// count, age and size limits hold
+//
+// Returns:
+//   - int: Number of archive files deleted
+//   - error: Index or deletion failure
+func enforceArchiveRetention(fsys vfs.FS, opts ArchiveOptions, walPath string) (int, error) {
+	entries, err := readArchiveIndex(fsys, opts.Dir, walPath)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+
+	now := time.Now()
+	drop := 0
+	for drop < len(entries) {
+		e := entries[drop]
+		overCount := opts.MaxFiles > 0 && len(entries)-drop > opts.MaxFiles
+		overSize := opts.MaxBytes > 0 && total > opts.MaxBytes
+		overAge := opts.MaxAge > 0 && now.Sub(time.UnixMilli(e.ArchivedAt)) > opts.MaxAge
+		if !overCount && !overSize && !overAge {
+			break
+		}
+		total -= e.Size
+		drop++
+	}
+	if drop == 0 {
+		return 0, nil
+	}
+
+	// Update the index first so it never lists a missing file
+	if err := writeArchiveIndex(fsys, opts.Dir, walPath, entries[drop:]); err != nil {
+		return 0, err
+	}
+	for _, e := range entries[:drop] {
+		if err := fsys.Remove(filepath.Join(opts.Dir, e.File)); err != nil && !os.IsNotExist(err) {
+			return 0, fmt.Errorf("failed to delete WAL archive file: %w", err)
+		}
+	}
+	return drop, fsys.SyncDir(opts.Dir)
+}
+
+// archiveLegacyFiles moves files rotated by older versions
+// (<path>.<20060102_150405>) into the archive
+func archiveLegacyFiles(fsys vfs.FS, opts ArchiveOptions, walPath string) error {
+	dir := filepath.Dir(walPath)
+	prefix := filepath.Base(walPath) + "."
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	archived := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if _, err := time.Parse(legacyRotateFormat, name[len(prefix):]); err != nil {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if _, err := archiveFile(fsys, opts, walPath, path, 0, true); err != nil {
+			return err
+		}
+		if err := fsys.Remove(path); err != nil {
+			return err
+		}
+		archived++
+	}
+	if archived > 0 {
+		fmt.Printf("Archived %d legacy WAL file(s) to %s\n", archived, opts.Dir)
+		return fsys.SyncDir(dir)
+	}
+	return nil
+}
+
+// readArchived decompresses an archive file into memory
+func readArchived(fsys vfs.FS, path string) (*bytes.Reader, error) {
+	file, err := vfs.Open(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WAL archive file %s: %w", path, err)
+	}
+	defer gz.Close()
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WAL archive file %s: %w", path, err)
+	}
+	return bytes.NewReader(data), nil
+}
+
+// archivedBefore returns the replayable archive entries that hold events
+// after afterSeq and precede the local segment starting at firstLocal
+func (w *WAL) archivedBefore(afterSeq, firstLocal uint64) ([]ArchiveEntry, error) {
+	if !w.archive.enabled() || afterSeq+1 >= firstLocal {
+		return nil, nil
+	}
+	entries, err := readArchiveIndex(w.fs, w.archive.Dir, w.path)
+	if err != nil {
+		return nil, err
+	}
+	var needed []ArchiveEntry
+	for _, e := range entries {
+		if e.Legacy || e.Events == 0 || e.StartSeq >= firstLocal || e.LastSeq <= afterSeq {
+			continue
+		}
+		needed = append(needed, e)
+	}
+	return needed, nil
+}
+
+// OldestSeq returns the oldest sequence number ReplayFrom can still reach,
+// counting archived segments
+//
+// Replaying from a snapshot needs OldestSeq() <= LastSeq+1.
+func (w *WAL) OldestSeq() (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.oldestSeqLocked()
+}
+
+// oldestSeqLocked implements OldestSeq; caller must hold w.mu
+func (w *WAL) oldestSeqLocked() (uint64, error) {
+	oldest := w.segmentStart
+	sealed, err := listSealedSegments(w.fs, w.path)
+	if err != nil {
+		return 0, err
+	}
+	if len(sealed) > 0 {
+		oldest = sealed[0].StartSeq
+	}
+	if !w.archive.enabled() {
+		return oldest, nil
+	}
+
+	entries, err := readArchiveIndex(w.fs, w.archive.Dir, w.path)
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range entries {
+		if !e.Legacy && e.StartSeq < oldest {
+			oldest = e.StartSeq
+		}
+	}
+	return oldest, nil
+}
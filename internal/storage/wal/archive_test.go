@@ -0,0 +1,126 @@
+package wal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================================================
+// WAL Archive Tests
+// ============================================================================
+
+// writeArchivedWAL writes seqs 1-3 and 4-6 to sealed segments and 7-8 to
+// the active one, then prunes everything up to seq 6 into the archive
+func writeArchivedWAL(t *testing.T, archive ArchiveOptions) (*WAL, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "wal", "test.wal")
+	w, err := NewWALWithOptions(path, Options{BufferSize: 10, FlushInterval: time.Millisecond, Archive: archive})
+	require.NoError(t, err)
+
+	appendJobs(t, w, 1, 3)
+	require.NoError(t, w.Rotate())
+	appendJobs(t, w, 4, 6)
+	require.NoError(t, w.Rotate())
+	appendJobs(t, w, 7, 8)
+
+	deleted, err := w.Prune(6)
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	assert.NoFileExists(t, segmentName(path, 1))
+	assert.NoFileExists(t, segmentName(path, 4))
+	return w, path
+}
+
+func TestPruneArchivesSegments(t *testing.T) {
+	archive := ArchiveOptions{Dir: filepath.Join(t.TempDir(), "archive")}
+	w, path := writeArchivedWAL(t, archive)
+	defer w.Close()
+
+	entries, err := ReadArchiveIndex(archive.Dir, path)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, ArchiveEntry{File: "test.wal.00000000000000000001.gz", StartSeq: 1, FirstSeq: 1, LastSeq: 3, Events: 3,
+		Size: entries[0].Size, ArchivedAt: entries[0].ArchivedAt}, entries[0])
+	assert.Equal(t, uint64(6), entries[1].LastSeq)
+	assert.FileExists(t, filepath.Join(archive.Dir, entries[1].File))
+
+	// Replay reaches back into the archive only when it has to
+	assert.Equal(t, []uint64{1, 2, 3, 4, 5, 6, 7, 8}, collectSeqs(t, w, 0))
+	assert.Equal(t, []uint64{5, 6, 7, 8}, collectSeqs(t, w, 4))
+	assert.Equal(t, []uint64{7, 8}, collectSeqs(t, w, 6))
+
+	oldest, err := w.OldestSeq()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), oldest)
+}
+
+func TestArchiveRetention(t *testing.T) {
+	archive := ArchiveOptions{Dir: filepath.Join(t.TempDir(), "archive"), MaxFiles: 1}
+	w, path := writeArchivedWAL(t, archive)
+	defer w.Close()
+
+	// Count: only the newest archive file is kept
+	entries, err := ReadArchiveIndex(archive.Dir, path)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, uint64(4), entries[0].StartSeq)
+	assert.NoFileExists(t, filepath.Join(archive.Dir, "test.wal.00000000000000000001.gz"))
+
+	oldest, err := w.OldestSeq()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), oldest)
+	assert.Equal(t, []uint64{4, 5, 6, 7, 8}, collectSeqs(t, w, 0))
+
+	// Age and size
+	entries[0].ArchivedAt = time.Now().Add(-2 * time.Hour).UnixMilli()
+	require.NoError(t, writeArchiveIndex(vfs.OS, archive.Dir, path, entries))
+	dropped, err := enforceArchiveRetention(vfs.OS, ArchiveOptions{Dir: archive.Dir, MaxAge: 3 * time.Hour}, path)
+	require.NoError(t, err)
+	assert.Zero(t, dropped)
+	dropped, err = enforceArchiveRetention(vfs.OS, ArchiveOptions{Dir: archive.Dir, MaxBytes: entries[0].Size - 1}, path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, dropped)
+
+	entries, err = ReadArchiveIndex(archive.Dir, path)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestArchiveLegacyRotatedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+	writeTestWAL(t, path, EncodingJSON, 3)
+	legacy := path + ".20240501_120000"
+	require.NoError(t, os.Rename(path, legacy))
+
+	archive := ArchiveOptions{Dir: filepath.Join(t.TempDir(), "archive")}
+	w, err := NewWALWithOptions(path, Options{BufferSize: 10, FlushInterval: time.Millisecond, Archive: archive})
+	require.NoError(t, err)
+	defer w.Close()
+
+	assert.NoFileExists(t, legacy)
+	entries, err := ReadArchiveIndex(archive.Dir, path)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.True(t, entries[0].Legacy)
+	assert.Equal(t, "test.wal.20240501_120000.gz", entries[0].File)
+	assert.Equal(t, 3, entries[0].Events)
+
+	// Kept for audits, not replayed
+	appendJobs(t, w, 1, 1)
+	assert.Equal(t, []uint64{1}, collectSeqs(t, w, 0))
+
+	src, err := readArchived(vfs.OS, filepath.Join(archive.Dir, entries[0].File))
+	require.NoError(t, err)
+	var seqs []uint64
+	require.NoError(t, replayRecords(src, entries[0].File, 0, false, func(e *Event) error {
+		seqs = append(seqs, e.Seq)
+		return nil
+	}))
+	assert.Equal(t, []uint64{1, 2, 3}, seqs)
+}
@@ -1,133 +1,90 @@
 package wal
 
 // ============================================================================
-// Batch Writer (Optional Optimization)
-// Purpose: Batch accumulate events to reduce fsync count and improve performance
+// Batch and Asynchronous Appends
+// Purpose: Let callers hand the batch writer many events at once, or keep
+// working while their events wait for the next fsync
 // ============================================================================
+//
+// Append blocks until the batch holding its event is synced, so a caller
+// writing N events one by one waits for up to N flushes. Two alternatives:
+//
+//   - AppendBatch sends all events as one request: they get consecutive
+//     seqs and are acknowledged or rolled back together in one fsync group
+//   - AppendAsync returns as soon as the event is queued; the future
+//     reports the result of its fsync group
+//
+// Both go through the same batch writer as Append, so ordering, sync modes,
+// encryption and subscriptions behave the same.
 
 import (
 	"sync"
 	"time"
+
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
 )
 
-// BatchWriter batch writer
-//
-// Design Philosophy:
-// - Accumulate multiple events, write and fsync at once
-// - Trade-off: Latency vs Throughput
-//
-// Use Cases:
-// - High throughput scenarios (> 1000 events/s)
-// - Acceptable small delay (< 10ms)
-type BatchWriter struct {
-	wal *WAL // Underlying WAL instance
+// BatchEntry is one event of an AppendBatch call
+type BatchEntry struct {
+	Type EventType  // Event type
+	Job  *types.Job // Job the event is about
+}
 
-	mu     sync.Mutex
-	buffer []Event     // Pending event buffer
-	timer  *time.Timer // Periodic flush timer
+// AppendFuture is the pending result of AppendAsync
+type AppendFuture struct {
+	errCh <-chan error
+	once  sync.Once
+	err   error
+}
 
-	// Configuration
-	maxBatchSize  int           // Buffer size threshold
-	flushInterval time.Duration // Maximum wait time
+// Wait blocks until the event is durable (or failed) and returns the
+// result; it may be called any number of times
+func (f *AppendFuture) Wait() error {
+	f.once.Do(func() {
+		f.err = <-f.errCh
+	})
+	return f.err
 }
 
-// NewBatchWriter creates a batch writer
+// AppendAsync queues an event and returns without waiting for the flush
 //
-// Parameters:
+// Events are written in the order AppendAsync is called from a single
+// goroutine. The event is not durable until Wait returns nil.
 //
-//	wal           - Underlying WAL instance
-//	maxBatchSize  - Flush immediately after accumulating this many events
-//	flushInterval - Maximum wait time before flush (even if not full)
-func NewBatchWriter(wal *WAL, maxBatchSize int, flushInterval time.Duration) *BatchWriter {
-	// TODO: Implement constructor
-	// 1. Create BatchWriter struct
-	// 2. Start background goroutine for periodic flush:
-	//    go bw.flushLoop()
-	// 3. Consider:
-	//    - How to gracefully stop background goroutine?
-	//    - Need context.Context?
-
-	return nil
-}
-
-// Append adds event to buffer
+// Parameters:
+//   - eventType: Event type (ENQUEUE, DISPATCH, ACK, etc.)
+//   - job: Job instance; only read before AppendAsync returns
 //
-// Behavior:
-// - Add to buffer
-// - If buffer is full, flush immediately
-// - Otherwise wait for periodic flush
-func (bw *BatchWriter) Append(eventType EventType, jobID string) error {
-	// TODO: Implement batch append
-	// 1. Create Event (but don't write to file immediately)
-	// 2. Add to buffer
-	// 3. Check if flush is needed:
-	//    if len(buffer) >= maxBatchSize {
-	//      return bw.flush()
-	//    }
-	// 4. Consider:
-	//    - Should Append block until flush completes?
-	//    - Or async flush and return immediately?
-
-	return nil
+// Returns:
+//   - *AppendFuture: Result of the event's fsync group
+func (w *WAL) AppendAsync(eventType EventType, job *types.Job) *AppendFuture {
+	// Seq and checksum are assigned by the batch writer so that seq
+	// order always matches file order
+	event := newEvent(0, eventType, job, time.Now().UnixMilli())
+	return &AppendFuture{errCh: w.submit([]Event{event})}
 }
 
-// Flush immediately writes all buffered events
-func (bw *BatchWriter) Flush() error {
-	// TODO: Implement forced flush
-	// 1. Acquire lock
-	// 2. Iterate buffer, write each to WAL
-	// 3. Sync once
-	// 4. Clear buffer
-	// 5. Consider:
-	//    - If one event write fails midway, how to handle?
-	//    - Should written events be rolled back? Or accept partial write?
-
-	return nil
-}
-
-// Close closes batch writer
-func (bw *BatchWriter) Close() error {
-	// TODO: Implement close logic
-	// 1. Stop background goroutine
-	// 2. Flush remaining buffered events
-	// 3. Don't close underlying WAL (caller's responsibility)
-
-	return nil
-}
-
-// ============================================================================
-// Private Methods
-// ============================================================================
-
-// flushLoop background periodic flush loop
-func (bw *BatchWriter) flushLoop() {
-	// TODO: Implement periodic flush
-	// ticker := time.NewTicker(flushInterval)
-	// for range ticker.C {
-	//   bw.Flush()
-	// }
-	//
-	// Consider:
-	// - How to stop this goroutine? (context or done channel)
-	// - How to handle Flush failure? Log? Notify user?
-}
-
-// TODO: Advanced considerations for batch writing
+// AppendBatch appends several events as one group
 //
-// 1. Performance testing:
-//    - Test impact of different maxBatchSize (1, 10, 100, 1000)
-//    - Test impact of different flushInterval (1ms, 10ms, 100ms)
-//    - Find optimal balance point
+// The events get consecutive sequence numbers and are written and synced
+// in the same fsync group, so they are acknowledged or rolled back
+// together. As with any unacknowledged events, a crash during the call may
+// leave a prefix of the batch in the WAL. A batch larger than the
+// configured buffer size is still flushed as a whole.
 //
-// 2. Memory management:
-//    - Large buffer consumes memory
-//    - Consider using sync.Pool to reuse Event objects
-//
-// 3. Latency sensitivity:
-//    - Batch writing increases latency (worst case = flushInterval)
-//    - Should we provide both "immediate mode" and "batch mode" options?
+// Parameters:
+//   - entries: Events to append, in order
 //
-// 4. Crash recovery:
-//    - Unwritten events in buffer will be lost on crash
-//    - How to balance performance vs reliability?
-//    - Mission-critical systems may not be suitable for batch writing
+// Returns:
+//   - error: Write or sync failure (the whole batch was rolled back)
+func (w *WAL) AppendBatch(entries []BatchEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	now := time.Now().UnixMilli()
+	events := make([]Event, len(entries))
+	for i, entry := range entries {
+		events[i] = newEvent(0, entry.Type, entry.Job, now)
+	}
+	return <-w.submit(events)
+}
@@ -0,0 +1,121 @@
+package wal
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================================================
+// Batch and Asynchronous Append Tests
+// ============================================================================
+
+func batchEntries(prefix string, n int) []BatchEntry {
+	entries := make([]BatchEntry, n)
+	for i := range entries {
+		entries[i] = BatchEntry{Type: EventEnqueue, Job: &types.Job{ID: types.JobID(fmt.Sprintf("%s_%d", prefix, i))}}
+	}
+	return entries
+}
+
+func TestAppendBatchFailsAsAWhole(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	// Batches larger than the buffer size are not split
+	w := openMemWAL(t, fsys, Options{BufferSize: 4})
+	defer w.Close()
+
+	require.NoError(t, w.AppendBatch(batchEntries("first", 10)))
+	fsys.Inject(vfs.Fault{Op: vfs.OpSync, Path: crashWALPath, Times: 1})
+	assert.ErrorIs(t, w.AppendBatch(batchEntries("failed", 10)), syscall.EIO)
+	require.NoError(t, w.AppendBatch(batchEntries("second", 10)))
+	require.NoError(t, w.AppendBatch(nil))
+
+	jobs := replayedJobs(t, w)
+	assert.Len(t, jobs, 20)
+	for id := range jobs {
+		assert.False(t, strings.HasPrefix(id, "failed"), "rolled back event %s replayed", id)
+	}
+	assert.Equal(t, uint64(20), w.GetLastSeq())
+}
+
+func TestAppendBatchKeepsEventsTogether(t *testing.T) {
+	w := openMemWAL(t, vfs.NewMemFS(), Options{BufferSize: 8})
+	defer w.Close()
+
+	// Single appends race with the batches
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				assert.NoError(t, appendJob(w, fmt.Sprintf("single_%d_%d", g, i)))
+			}
+		}(g)
+	}
+	for b := 0; b < 10; b++ {
+		wg.Add(1)
+		go func(b int) {
+			defer wg.Done()
+			assert.NoError(t, w.AppendBatch(batchEntries(fmt.Sprintf("batch%d", b), 20)))
+		}(b)
+	}
+	wg.Wait()
+
+	// Each batch occupies a consecutive seq range, in order
+	first := make(map[string]uint64)
+	require.NoError(t, w.Replay(func(e *Event) error {
+		id := string(e.JobID)
+		if !strings.HasPrefix(id, "batch") {
+			return nil
+		}
+		prefix := id[:strings.IndexByte(id, '_')]
+		var index int
+		fmt.Sscanf(id[len(prefix)+1:], "%d", &index)
+		if index == 0 {
+			first[prefix] = e.Seq
+		}
+		assert.Equal(t, first[prefix]+uint64(index), e.Seq, "event %s", id)
+		return nil
+	}))
+	assert.Len(t, first, 10)
+	assert.Equal(t, uint64(400), w.GetLastSeq())
+}
+
+func TestAppendAsync(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	w := openMemWAL(t, fsys, Options{BufferSize: 16})
+
+	futures := make([]*AppendFuture, 100)
+	for i := range futures {
+		futures[i] = w.AppendAsync(EventEnqueue, &types.Job{ID: types.JobID(fmt.Sprintf("job_%d", i))})
+	}
+	for _, f := range futures {
+		require.NoError(t, f.Wait())
+		require.NoError(t, f.Wait()) // Repeated Wait returns the same result
+	}
+
+	// Queued in call order, and durable once Wait returns
+	crashed := openMemWAL(t, fsys.Crash(), Options{})
+	var ids []string
+	require.NoError(t, crashed.Replay(func(e *Event) error {
+		ids = append(ids, string(e.JobID))
+		return nil
+	}))
+	require.NoError(t, crashed.Close())
+	require.Len(t, ids, 100)
+	for i, id := range ids {
+		assert.Equal(t, fmt.Sprintf("job_%d", i), id)
+	}
+
+	require.NoError(t, w.Close())
+	assert.Error(t, w.AppendAsync(EventAck, &types.Job{ID: "late"}).Wait())
+	assert.Error(t, w.AppendBatch(batchEntries("late", 2)))
+}
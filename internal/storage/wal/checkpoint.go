@@ -0,0 +1,113 @@
+package wal
+
+// ============================================================================
+// Checkpoint Support
+// Responsibility: Keep sequence numbers above every snapshot, so that a
+// snapshot's LastSeq always names one point in the log
+// ============================================================================
+//
+// Sequence numbers are global across segments (see segment.go) and never
+// restart on rotation. A snapshot records the last seq it includes, and
+// checkpointing follows this protocol (see Controller.takeSnapshot):
+//
+//   1. Capture the state and LastSeq while no append is half applied
+//   2. Sync, so every event up to LastSeq is durable before the snapshot
+//   3. Write the snapshot atomically (temporary file, sync, rename)
+//   4. Rotate, then Prune the segments that LastSeq covers
+//
+// Recovery loads the newest snapshot and replays strictly after its
+// LastSeq. A crash before step 3 completes leaves the old snapshot and a
+// WAL holding everything after it. From step 3 on, any event up to LastSeq
+// still in the WAL is already in the snapshot and is skipped.
+//
+// One case remains: a WAL that ends before the snapshot's LastSeq, e.g. a
+// SyncNone WAL after a power failure or a WAL directory restored from an
+// older backup. Numbering would restart inside the covered range, and the
+// next recovery would skip the new events as covered. AdvanceTo moves the
+// sequence number past LastSeq and records it as a floor in <path>.floor,
+// which every open honors. The floor is never lowered.
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+)
+
+// floorSuffix is appended to the WAL path to name the seq floor file
+const floorSuffix = ".floor"
+
+// floorVersion is the current floor file format
+const floorVersion = 1
+
+// seqFloor is the content of the floor file
+type seqFloor struct {
+	Version int    `json:"version"`
+	LastSeq uint64 `json:"last_seq"` // Seqs up to here are used; new events get higher ones
+}
+
+// floorPath returns the seq floor path of the WAL at path
+func floorPath(path string) string {
+	return path + floorSuffix
+}
+
+// readFloor returns the seq floor of the WAL at path (0 if none is set)
+func readFloor(fsys vfs.FS, path string) (uint64, error) {
+	data, err := vfs.ReadFile(fsys, floorPath(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read WAL seq floor: %w", err)
+	}
+	var floor seqFloor
+	if err := json.Unmarshal(data, &floor); err != nil || floor.Version != floorVersion {
+		return 0, fmt.Errorf("invalid WAL seq floor %s", floorPath(path))
+	}
+	return floor.LastSeq, nil
+}
+
+// Sync makes every event appended so far durable (step 2 above)
+//
+// Events queued concurrently may or may not be included. In SyncNone mode
+// nothing is synced.
+//
+// Returns:
+//   - error: Sync failure
+func (w *WAL) Sync() error {
+	return w.runInWriter(w.syncDirtyLocked)
+}
+
+// AdvanceTo makes seq the last used sequence number if the WAL ends
+// before it
+//
+// Called on recovery with the loaded snapshot's LastSeq. The current
+// active segment is sealed first, so a segment never holds events from
+// both sides of the skipped range. Calling it again with the same or a
+// lower seq does nothing.
+//
+// Parameters:
+//   - seq: Last sequence number covered elsewhere (e.g. snapshot LastSeq)
+//
+// Returns:
+//   - error: Seal or floor write failure (the sequence number is unchanged)
+func (w *WAL) AdvanceTo(seq uint64) error {
+	return w.runInWriter(func() error {
+		if w.seq >= seq {
+			return nil
+		}
+		if err := w.sealActiveLocked(); err != nil {
+			return err
+		}
+		data, err := json.Marshal(seqFloor{Version: floorVersion, LastSeq: seq})
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(w.fs, floorPath(w.path), data); err != nil {
+			return fmt.Errorf("failed to write WAL seq floor: %w", err)
+		}
+		w.seq, w.segmentStart = seq, seq+1
+		return nil
+	})
+}
@@ -0,0 +1,69 @@
+package wal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================================================
+// Checkpoint Tests
+// ============================================================================
+
+// TestAdvanceTo verifies the seq floor survives reopening and validation
+func TestAdvanceTo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+	w, err := NewWAL(path, false, 10, time.Millisecond)
+	require.NoError(t, err)
+	appendJobs(t, w, 1, 5)
+
+	// Not behind: nothing changes
+	require.NoError(t, w.AdvanceTo(3))
+	assert.Equal(t, uint64(5), w.GetLastSeq())
+
+	require.NoError(t, w.AdvanceTo(100))
+	assert.Equal(t, uint64(100), w.GetLastSeq())
+	require.NoError(t, w.Close())
+
+	// An empty active segment still resumes after the floor
+	w, err = NewWAL(path, false, 10, time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(100), w.GetLastSeq())
+	appendJobs(t, w, 6, 7)
+	assert.Equal(t, []uint64{1, 2, 3, 4, 5, 101, 102}, collectSeqs(t, w, 0))
+	assert.Equal(t, []uint64{101, 102}, collectSeqs(t, w, 100))
+	require.NoError(t, w.Close())
+
+	// The skipped range is not reported as lost
+	require.NoError(t, ValidateWAL(path))
+
+	w, err = NewWAL(path, false, 10, time.Millisecond)
+	require.NoError(t, err)
+	defer w.Close()
+	assert.Equal(t, uint64(102), w.GetLastSeq())
+}
+
+// TestAdvanceToAfterLostTail verifies numbering cannot fall back into a
+// range a snapshot covers when unsynced events are lost
+func TestAdvanceToAfterLostTail(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	w := openMemWAL(t, fsys, Options{SyncMode: SyncNone})
+	appendJobs(t, w, 1, 10)
+
+	// A snapshot covers seq 10, but none of it reached the disk
+	crashed := fsys.Crash()
+	w = openMemWAL(t, crashed, Options{})
+	assert.Zero(t, w.GetLastSeq())
+	require.NoError(t, w.AdvanceTo(10))
+	require.NoError(t, appendJob(w, "after"))
+	require.NoError(t, w.Close())
+
+	// Crash again: the floor and the new event are durable
+	w = openMemWAL(t, crashed.Crash(), Options{})
+	defer w.Close()
+	assert.Equal(t, []uint64{11}, collectSeqs(t, w, 10))
+}
@@ -4,14 +4,34 @@ package wal
 // Checksum Calculation
 // Responsibility: Calculate and verify CRC32 checksum for WAL events
 // ============================================================================
+//
+// Schema V3 events are checksummed over the whole serialized record:
+//   - JSON: CRC32C of the encoded line with the checksum field set to 0
+//   - Binary: the record frame CRC32C (the body's checksum field is 0)
+// so corruption in any field, including payload and timestamp, is caught.
+// The decoders verify these while reading.
+//
+// V1/V2 events use the legacy CalculateChecksum below, which only covers
+// type, job ID and seq. It is kept so existing WAL files stay readable.
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"hash/crc32"
+	"strconv"
 
 	"github.com/ChuLiYu/raft-recovery/pkg/types"
 )
 
-// CalculateChecksum calculates the CRC32 checksum for an event
+// jsonChecksumField is the key the checksum is stored under in JSON records
+var jsonChecksumField = []byte(`"checksum":`)
+
+// CalculateChecksum calculates the legacy (schema V1/V2) CRC32 checksum
+//
+// Only type, job ID and seq are covered, and string(rune(seq)) maps every
+// seq outside the valid rune range to the same character. New events use
+// whole-record checksums instead; this remains for verifying old files.
 //
 // Algorithm:
 // - Concatenate key fields of the event into a string
@@ -36,7 +56,10 @@ func CalculateChecksum(eventType EventType, jobID types.Job, seq uint64) uint32
 	return crc32.ChecksumIEEE([]byte(data))
 }
 
-// VerifyChecksum verifies if the event's checksum is correct
+// VerifyChecksum verifies a legacy (V1/V2) event checksum
+//
+// V3 checksums cover the serialized record and are verified by the
+// decoders while reading, so V3 events are reported as valid here.
 //
 // Parameters:
 //
@@ -46,6 +69,10 @@ func CalculateChecksum(eventType EventType, jobID types.Job, seq uint64) uint32
 //
 //	bool - true indicates checksum is correct
 func VerifyChecksum(event Event) bool {
+	if event.SchemaVersion() >= EventSchemaV3 {
+		return true
+	}
+
 	// Recalculate expected checksum
 	// Note: Need to create a types.Job to match CalculateChecksum's signature
 	job := types.Job{ID: event.JobID}
@@ -55,6 +82,77 @@ func VerifyChecksum(event Event) bool {
 	return event.Checksum == expected
 }
 
+// ============================================================================
+// Whole-Record Checksums (schema V3)
+// ============================================================================
+
+// recordChecksum returns the CRC32C of a serialized record
+func recordChecksum(data []byte) uint32 {
+	return crc32.Checksum(data, castagnoliTable)
+}
+
+// marshalJSONRecord encodes a V3 event as one JSON line and stores the
+// checksum of that line in event.Checksum
+//
+// The line is first marshaled with checksum 0, hashed, and the value is
+// then written into the checksum field. Quotes inside JSON strings are
+// escaped, so the first match of `"checksum":` is always the field itself.
+func marshalJSONRecord(event *Event) ([]byte, error) {
+	event.Checksum = 0
+	line, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := bytes.Index(line, jsonChecksumField)
+	if idx < 0 {
+		return nil, fmt.Errorf("checksum field missing from encoded event")
+	}
+	valueStart := idx + len(jsonChecksumField)
+
+	event.Checksum = recordChecksum(line)
+	out := make([]byte, 0, len(line)+11)
+	out = append(out, line[:valueStart]...)
+	out = strconv.AppendUint(out, uint64(event.Checksum), 10)
+	out = append(out, line[valueStart+1:]...) // Skip the "0" placeholder
+	return append(out, '\n'), nil
+}
+
+// verifyJSONRecord checks a decoded JSON line against its stored checksum
+//
+// Parameters:
+//   - line: Raw record bytes without the trailing newline
+//   - event: Event decoded from line
+//
+// Returns:
+//   - error: *ChecksumError on mismatch, nil otherwise
+func verifyJSONRecord(line []byte, event *Event) error {
+	var expected uint32
+	if event.SchemaVersion() >= EventSchemaV3 {
+		idx := bytes.Index(line, jsonChecksumField)
+		if idx < 0 {
+			return &ChecksumError{Seq: event.Seq, Expected: 0, Actual: event.Checksum}
+		}
+		valueStart := idx + len(jsonChecksumField)
+		valueEnd := valueStart
+		for valueEnd < len(line) && line[valueEnd] >= '0' && line[valueEnd] <= '9' {
+			valueEnd++
+		}
+
+		// Hash the line as it was before the checksum was filled in
+		crc := crc32.Update(0, castagnoliTable, line[:valueStart])
+		crc = crc32.Update(crc, castagnoliTable, []byte{'0'})
+		expected = crc32.Update(crc, castagnoliTable, line[valueEnd:])
+	} else {
+		expected = CalculateChecksum(event.Type, types.Job{ID: event.JobID}, event.Seq)
+	}
+
+	if event.Checksum != expected {
+		return &ChecksumError{Seq: event.Seq, Expected: expected, Actual: event.Checksum}
+	}
+	return nil
+}
+
 // TODO: Advanced feature considerations
 //
 // 1. Multiple checksum algorithm support:
@@ -62,11 +160,6 @@ func VerifyChecksum(event Event) bool {
 //    - SHA256 (secure, prevents tampering)
 //    - Let user choose?
 //
-// 2. Checksum scope:
-//    - Currently only checksums Type + JobID + Seq
-//    - Should Timestamp be included?
-//    - Should entire Event JSON be included?
-//
-// 3. Performance optimization:
+// 2. Performance optimization:
 //    - Pre-allocate string buffer to avoid repeated allocation
 //    - Use strings.Builder
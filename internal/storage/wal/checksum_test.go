@@ -0,0 +1,197 @@
+package wal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================================================
+// Record Checksum and Torn-Tail Recovery Tests
+// ============================================================================
+
+// writeTestWAL writes jobs 1..n (each with a payload) and closes the WAL
+func writeTestWAL(t *testing.T, path string, encoding Encoding, n int) {
+	t.Helper()
+	w, err := NewWALWithOptions(path, Options{BufferSize: 10, FlushInterval: time.Millisecond, Encoding: encoding})
+	require.NoError(t, err)
+	for i := 1; i <= n; i++ {
+		job := &types.Job{ID: types.JobID(fmt.Sprintf("job_%d", i)), Payload: map[string]interface{}{"url": "https://example.com/aaaa"}}
+		require.NoError(t, w.Append(EventEnqueue, job))
+	}
+	require.NoError(t, w.Close())
+}
+
+// recordOffsets returns the byte offset of every record in a segment file
+func recordOffsets(t *testing.T, path string) []int64 {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var offsets []int64
+	if bytes.HasPrefix(data, binaryMagic) {
+		for off := int64(fileHeaderSize); off < int64(len(data)); {
+			offsets = append(offsets, off)
+			off += recordHeaderSize + int64(binary.LittleEndian.Uint32(data[off:]))
+		}
+		return offsets
+	}
+	for off := 0; off < len(data); {
+		offsets = append(offsets, int64(off))
+		off += bytes.IndexByte(data[off:], '\n') + 1
+	}
+	return offsets
+}
+
+// TestRecordChecksumCoversPayload verifies payload corruption is detected
+func TestRecordChecksumCoversPayload(t *testing.T) {
+	for _, encoding := range []Encoding{EncodingJSON, EncodingBinary} {
+		t.Run(string(encoding), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.wal")
+			writeTestWAL(t, path, encoding, 3)
+
+			// Same-length change inside the second record's payload
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			offsets := recordOffsets(t, path)
+			idx := offsets[1] + int64(bytes.Index(data[offsets[1]:], []byte("aaaa")))
+			data[idx] = 'b'
+			require.NoError(t, os.WriteFile(path, data, 0644))
+
+			w, err := NewWALWithOptions(path, Options{Encoding: encoding})
+			require.NoError(t, err)
+			defer w.Close()
+
+			err = w.Replay(func(*Event) error { return nil })
+			var corruption *CorruptionError
+			require.True(t, errors.As(err, &corruption), "got %v", err)
+			assert.Equal(t, offsets[1], corruption.Offset)
+			assert.Equal(t, path, corruption.Path)
+			assert.True(t, errors.Is(err, ErrChecksumMismatch))
+			assert.True(t, errors.Is(err, ErrCorruptedWAL))
+		})
+	}
+}
+
+// TestTornTailTruncatedOnOpen verifies a partial final record is dropped
+func TestTornTailTruncatedOnOpen(t *testing.T) {
+	for _, encoding := range []Encoding{EncodingJSON, EncodingBinary} {
+		t.Run(string(encoding), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.wal")
+			writeTestWAL(t, path, encoding, 5)
+			offsets := recordOffsets(t, path)
+			require.NoError(t, os.Truncate(path, fileSize(t, path)-3))
+
+			w, err := NewWALWithOptions(path, Options{BufferSize: 10, FlushInterval: time.Millisecond, Encoding: encoding})
+			require.NoError(t, err)
+			defer w.Close()
+
+			assert.Equal(t, uint64(4), w.GetLastSeq())
+			assert.Equal(t, offsets[4], fileSize(t, path))
+
+			// New appends follow the surviving records
+			appendJobs(t, w, 5, 6)
+			assert.Equal(t, []uint64{1, 2, 3, 4, 5, 6}, collectSeqs(t, w, 0))
+		})
+	}
+}
+
+// TestZeroFilledTailTruncatedOnOpen verifies a zero-filled tail counts as torn
+func TestZeroFilledTailTruncatedOnOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+	writeTestWAL(t, path, EncodingBinary, 3)
+	size := fileSize(t, path)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.Write(make([]byte, 4096))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	w, err := NewWALWithOptions(path, Options{Encoding: EncodingBinary})
+	require.NoError(t, err)
+	defer w.Close()
+
+	assert.Equal(t, size, fileSize(t, path))
+	assert.Equal(t, []uint64{1, 2, 3}, collectSeqs(t, w, 0))
+}
+
+// TestMidFileCorruption verifies corruption before the tail fails replay
+// with the offset of the bad record
+func TestMidFileCorruption(t *testing.T) {
+	for _, encoding := range []Encoding{EncodingJSON, EncodingBinary} {
+		t.Run(string(encoding), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.wal")
+			writeTestWAL(t, path, encoding, 5)
+			offsets := recordOffsets(t, path)
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			for i := offsets[2]; i < offsets[2]+6; i++ {
+				data[i] = 'X'
+			}
+			require.NoError(t, os.WriteFile(path, data, 0644))
+
+			w, err := NewWALWithOptions(path, Options{Encoding: encoding})
+			require.NoError(t, err)
+			defer w.Close()
+
+			var replayed int
+			err = w.Replay(func(*Event) error {
+				replayed++
+				return nil
+			})
+			var corruption *CorruptionError
+			require.True(t, errors.As(err, &corruption), "got %v", err)
+			assert.Equal(t, offsets[2], corruption.Offset)
+			assert.Equal(t, 2, replayed)
+
+			// The file is left untouched for inspection
+			assert.Equal(t, int64(len(data)), fileSize(t, path))
+		})
+	}
+}
+
+// TestTornRecordInSealedSegment verifies only the active segment may be torn
+func TestTornRecordInSealedSegment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+	w, err := NewWAL(path, false, 10, time.Millisecond)
+	require.NoError(t, err)
+	appendJobs(t, w, 1, 3)
+	require.NoError(t, w.Rotate())
+	appendJobs(t, w, 4, 5)
+	require.NoError(t, w.Close())
+
+	sealed := segmentName(path, 1)
+	require.NoError(t, os.Truncate(sealed, fileSize(t, sealed)-2))
+
+	w, err = NewWAL(path, false, 10, time.Millisecond)
+	require.NoError(t, err)
+	defer w.Close()
+
+	err = w.Replay(func(*Event) error { return nil })
+	var corruption *CorruptionError
+	require.True(t, errors.As(err, &corruption), "got %v", err)
+	assert.Equal(t, sealed, corruption.Path)
+}
+
+// TestErrorMessages verifies the formatting of the detailed error types
+func TestErrorMessages(t *testing.T) {
+	checksumErr := &ChecksumError{Seq: 42, Expected: 0x12345678, Actual: 0x87654321}
+	assert.Equal(t, "wal: checksum mismatch at seq=42 (expected=0x12345678, got=0x87654321)", checksumErr.Error())
+	assert.True(t, errors.Is(checksumErr, ErrChecksumMismatch))
+
+	corruption := &CorruptionError{Path: "a.wal", Seq: 42, Offset: 1024, Cause: checksumErr}
+	assert.Equal(t, "wal: corrupted record in a.wal at offset 1024 (seq=42): "+checksumErr.Error(), corruption.Error())
+	assert.True(t, errors.Is(corruption, ErrChecksumMismatch))
+	assert.Equal(t, "wal: corrupted record at offset 7", (&CorruptionError{Offset: 7}).Error())
+}
@@ -0,0 +1,488 @@
+package wal
+
+// ============================================================================
+// WAL Record Codecs
+// Responsibility: Encode and decode events in the JSON and binary formats
+// ============================================================================
+//
+// JSON format (legacy, human readable):
+//   One JSON object per line, no file header. For V3 events "checksum" is
+//   the CRC32C of the line as encoded with "checksum":0.
+//
+// Binary format:
+//   File header (8 bytes, written before the first record):
+//     magic   [4]byte  "BRWL"
+//     version uint16   binaryFormatVersion (little endian)
+//     _       uint16   reserved, zero
+//
+//   Record:
+//     length  uint32   body length in bytes (little endian)
+//     crc     uint32   CRC32C (Castagnoli) over length + body
+//     body    []byte
+//
+//   Body (binaryFormatVersion 1, varints as in encoding/binary):
+//     uvarint schema version | uvarint seq | string type | string job_id |
+//     varint timestamp | uint32 event checksum (0 for V3) | varint timeout_ms |
+//     varint attempt | byte flags (bit 0: deadline present, bit 1: sealed) |
+//     [varint deadline_ms] | varint created_at | bytes payload (JSON, may be empty)
+//
+//   With the sealed flag the payload bytes are an encryption envelope
+//   (see encryption.go) instead of JSON.
+//
+//   Strings and bytes are a uvarint length followed by the raw bytes.
+//
+//   For V3 events the record CRC is the event checksum.
+//
+// Readers detect the format from the first bytes of a file, so segments of
+// both formats can coexist in one WAL.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+)
+
+// Encoding selects the on-disk record format
+type Encoding string
+
+const (
+	EncodingJSON   Encoding = "json"   // One JSON object per line (default)
+	EncodingBinary Encoding = "binary" // Length-prefixed, CRC32C-framed records
+)
+
+const (
+	binaryFormatVersion = 1
+	fileHeaderSize      = 8
+	recordHeaderSize    = 8
+	maxRecordSize       = 64 << 20 // Larger lengths can only come from corruption
+)
+
+// Binary body flags
+const (
+	flagDeadline byte = 1 << 0 // deadline_ms follows
+	flagSealed   byte = 1 << 1 // payload is an encryption envelope
+)
+
+var (
+	binaryMagic     = []byte("BRWL")
+	castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// ParseEncoding parses a config value; an empty string selects JSON
+func ParseEncoding(s string) (Encoding, error) {
+	switch Encoding(s) {
+	case "", EncodingJSON:
+		return EncodingJSON, nil
+	case EncodingBinary:
+		return EncodingBinary, nil
+	default:
+		return "", fmt.Errorf("unknown WAL encoding %q (want %q or %q)", s, EncodingJSON, EncodingBinary)
+	}
+}
+
+// ============================================================================
+// Encoders
+// ============================================================================
+
+// recordEncoder writes events to a segment
+type recordEncoder interface {
+	Encode(event *Event) error
+}
+
+// newRecordEncoder returns an encoder appending to w; empty reports
+// whether w is a new file that still needs the format header
+func newRecordEncoder(w io.Writer, encoding Encoding, empty bool) recordEncoder {
+	if encoding == EncodingBinary {
+		return &binaryEncoder{w: w, needHeader: empty}
+	}
+	return jsonEncoder{w: w, enc: json.NewEncoder(w)}
+}
+
+// jsonEncoder writes one JSON object per line
+type jsonEncoder struct {
+	w   io.Writer
+	enc *json.Encoder
+}
+
+func (e jsonEncoder) Encode(event *Event) error {
+	if event.SchemaVersion() < EventSchemaV3 {
+		return e.enc.Encode(event) // Legacy events keep their stored checksum
+	}
+	line, err := marshalJSONRecord(event)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(line)
+	return err
+}
+
+// binaryEncoder writes framed binary records
+type binaryEncoder struct {
+	w          io.Writer
+	needHeader bool
+	buf        []byte
+}
+
+func (e *binaryEncoder) Encode(event *Event) error {
+	buf := e.buf[:0]
+	if e.needHeader {
+		buf = appendFileHeader(buf)
+	}
+
+	// V3 events are checksummed by the record CRC; the body field stays 0
+	wholeRecord := event.SchemaVersion() >= EventSchemaV3
+	if wholeRecord {
+		event.Checksum = 0
+	}
+
+	start := len(buf)
+	buf = append(buf, make([]byte, recordHeaderSize)...)
+	buf, err := appendEventBody(buf, event)
+	if err != nil {
+		return err
+	}
+	crc := finishRecord(buf[start:])
+	if wholeRecord {
+		event.Checksum = crc
+	}
+
+	// One write per record keeps a crash from interleaving partial records
+	if _, err := e.w.Write(buf); err != nil {
+		return err
+	}
+	e.needHeader = false
+	e.buf = buf
+	return nil
+}
+
+func appendFileHeader(buf []byte) []byte {
+	buf = append(buf, binaryMagic...)
+	buf = binary.LittleEndian.AppendUint16(buf, binaryFormatVersion)
+	return binary.LittleEndian.AppendUint16(buf, 0)
+}
+
+// finishRecord fills in the length and CRC of a record whose body follows
+// the reserved header bytes and returns the CRC
+func finishRecord(record []byte) uint32 {
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(record)-recordHeaderSize))
+	crc := crc32.Update(crc32.Checksum(record[0:4], castagnoliTable), castagnoliTable, record[recordHeaderSize:])
+	binary.LittleEndian.PutUint32(record[4:8], crc)
+	return crc
+}
+
+func appendEventBody(buf []byte, e *Event) ([]byte, error) {
+	var payload []byte
+	var flags byte
+	if e.Sealed != nil {
+		payload = e.Sealed
+		flags |= flagSealed
+	} else if e.Payload != nil {
+		var err error
+		if payload, err = json.Marshal(e.Payload); err != nil {
+			return nil, fmt.Errorf("failed to encode payload: %w", err)
+		}
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(e.Version))
+	buf = binary.AppendUvarint(buf, e.Seq)
+	buf = appendBytes(buf, []byte(e.Type))
+	buf = appendBytes(buf, []byte(e.JobID))
+	buf = binary.AppendVarint(buf, e.Timestamp)
+	buf = binary.LittleEndian.AppendUint32(buf, e.Checksum)
+	buf = binary.AppendVarint(buf, e.TimeoutMs)
+	buf = binary.AppendVarint(buf, int64(e.Attempt))
+	if e.Deadline != nil {
+		buf = append(buf, flags|flagDeadline)
+		buf = binary.AppendVarint(buf, *e.Deadline)
+	} else {
+		buf = append(buf, flags)
+	}
+	buf = binary.AppendVarint(buf, e.CreatedAt)
+	return appendBytes(buf, payload), nil
+}
+
+func appendBytes(buf, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// ============================================================================
+// Decoders
+// ============================================================================
+
+// recordDecoder reads events from a segment
+//
+// Decode verifies each record's checksum and returns:
+//   - io.EOF at a clean end of file
+//   - io.ErrUnexpectedEOF when the file ends inside a record (torn write)
+//   - *CorruptionError for a record that is complete but unreadable or
+//     fails its checksum
+//
+// Offset reports the byte offset just past the last good record, i.e. the
+// size to truncate a segment to when dropping a torn tail.
+type recordDecoder interface {
+	Decode(event *Event) error
+	Offset() int64
+}
+
+// newRecordDecoder detects the format of r from its first bytes
+//
+// Returns the detected encoding, or "" for an empty file. A file cut off
+// inside the binary header returns io.ErrUnexpectedEOF.
+func newRecordDecoder(r io.Reader) (recordDecoder, Encoding, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	head, _ := br.Peek(fileHeaderSize)
+	if len(head) == 0 {
+		return &jsonDecoder{r: br}, "", nil
+	}
+
+	if len(head) < len(binaryMagic) && bytes.HasPrefix(binaryMagic, head) {
+		return nil, EncodingBinary, io.ErrUnexpectedEOF
+	}
+	if !bytes.HasPrefix(head, binaryMagic) {
+		return &jsonDecoder{r: br}, EncodingJSON, nil
+	}
+	if len(head) < fileHeaderSize {
+		return nil, EncodingBinary, io.ErrUnexpectedEOF
+	}
+	if version := binary.LittleEndian.Uint16(head[4:6]); version != binaryFormatVersion {
+		return nil, EncodingBinary, fmt.Errorf("%w: unsupported binary WAL version %d", ErrCorruptedWAL, version)
+	}
+	if _, err := br.Discard(fileHeaderSize); err != nil {
+		return nil, EncodingBinary, err
+	}
+	return &binaryDecoder{r: br, offset: fileHeaderSize}, EncodingBinary, nil
+}
+
+// detectEncoding returns the format of the file at path ("" if empty or missing)
+func detectEncoding(fsys vfs.FS, path string) (Encoding, error) {
+	file, err := vfs.Open(fsys, path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	defer file.Close()
+
+	_, encoding, err := newRecordDecoder(file)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil // Torn header, the format is still known
+	}
+	return encoding, err
+}
+
+// jsonDecoder reads newline-delimited JSON events
+//
+// Records are read line by line so offsets are exact. Only the last line
+// can be torn: it has no trailing newline and ends mid-object.
+type jsonDecoder struct {
+	r      *bufio.Reader
+	offset int64 // Byte offset of the next record
+}
+
+func (d *jsonDecoder) Offset() int64 {
+	return d.offset
+}
+
+func (d *jsonDecoder) Decode(event *Event) error {
+	for {
+		line, err := d.r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		complete := err == nil
+		if len(line) == 0 {
+			return io.EOF
+		}
+
+		record := bytes.TrimSpace(line)
+		if len(record) == 0 {
+			if !complete {
+				return io.EOF // Trailing whitespace only
+			}
+			d.offset += int64(len(line))
+			continue
+		}
+
+		*event = Event{}
+		if err := json.Unmarshal(record, event); err != nil {
+			if !complete && isTruncatedJSON(record) {
+				return io.ErrUnexpectedEOF
+			}
+			return &CorruptionError{Offset: d.offset, Cause: err}
+		}
+		if err := verifyJSONRecord(record, event); err != nil {
+			return &CorruptionError{Seq: event.Seq, Offset: d.offset, Cause: err}
+		}
+		d.offset += int64(len(line))
+		return nil
+	}
+}
+
+// isTruncatedJSON reports whether b is a valid JSON prefix that ends early
+func isTruncatedJSON(b []byte) bool {
+	var v json.RawMessage
+	return json.NewDecoder(bytes.NewReader(b)).Decode(&v) == io.ErrUnexpectedEOF
+}
+
+// binaryDecoder reads framed binary records
+type binaryDecoder struct {
+	r      *bufio.Reader
+	offset int64 // Byte offset of the next record
+	body   []byte
+}
+
+func (d *binaryDecoder) Offset() int64 {
+	return d.offset
+}
+
+func (d *binaryDecoder) Decode(event *Event) error {
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(d.r, header[:]); err != nil {
+		return err // io.EOF at a record boundary, io.ErrUnexpectedEOF inside the header
+	}
+
+	length := binary.LittleEndian.Uint32(header[0:4])
+	if length > maxRecordSize {
+		return &CorruptionError{Offset: d.offset, Cause: fmt.Errorf("record claims %d bytes", length)}
+	}
+	if cap(d.body) < int(length) {
+		d.body = make([]byte, length)
+	}
+	body := d.body[:length]
+	if _, err := io.ReadFull(d.r, body); err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	crc := crc32.Update(crc32.Checksum(header[0:4], castagnoliTable), castagnoliTable, body)
+	if stored := binary.LittleEndian.Uint32(header[4:8]); crc != stored {
+		return &CorruptionError{Offset: d.offset, Cause: &ChecksumError{Expected: crc, Actual: stored}}
+	}
+
+	*event = Event{}
+	if err := decodeEventBody(body, event); err != nil {
+		return &CorruptionError{Offset: d.offset, Cause: err}
+	}
+	if event.SchemaVersion() >= EventSchemaV3 {
+		event.Checksum = crc
+	}
+	d.offset += recordHeaderSize + int64(length)
+	return nil
+}
+
+// bodyReader consumes a record body field by field
+type bodyReader struct {
+	b   []byte
+	err error
+}
+
+var errShortBody = errors.New("record body too short")
+
+func (r *bodyReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.err = errShortBody
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *bodyReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.b)
+	if n <= 0 {
+		r.err = errShortBody
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *bodyReader) bytes() []byte {
+	n := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if uint64(len(r.b)) < n {
+		r.err = errShortBody
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *bodyReader) uint32() uint32 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.b) < 4 {
+		r.err = errShortBody
+		return 0
+	}
+	v := binary.LittleEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return v
+}
+
+func (r *bodyReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.b) < 1 {
+		r.err = errShortBody
+		return 0
+	}
+	v := r.b[0]
+	r.b = r.b[1:]
+	return v
+}
+
+func decodeEventBody(body []byte, e *Event) error {
+	r := &bodyReader{b: body}
+	e.Version = int(r.uvarint())
+	e.Seq = r.uvarint()
+	e.Type = EventType(r.bytes())
+	e.JobID = types.JobID(r.bytes())
+	e.Timestamp = r.varint()
+	e.Checksum = r.uint32()
+	e.TimeoutMs = r.varint()
+	e.Attempt = int(r.varint())
+	flags := r.byte()
+	if flags&flagDeadline != 0 {
+		deadline := r.varint()
+		e.Deadline = &deadline
+	}
+	e.CreatedAt = r.varint()
+	payload := r.bytes()
+	if r.err != nil {
+		return r.err
+	}
+	if flags&flagSealed != 0 {
+		e.Sealed = append([]byte(nil), payload...) // The body buffer is reused
+	} else if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &e.Payload); err != nil {
+			return fmt.Errorf("invalid payload: %w", err)
+		}
+	}
+	return nil
+}
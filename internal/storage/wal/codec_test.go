@@ -0,0 +1,165 @@
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================================================
+// Codec Tests
+// ============================================================================
+
+// TestBinaryRoundTrip verifies every event field survives the binary codec
+func TestBinaryRoundTrip(t *testing.T) {
+	deadline := int64(1700000005000)
+	events := []Event{
+		{Version: CurrentEventSchema, Seq: 1, Type: EventEnqueue, JobID: "job_1", Timestamp: 1700000000000,
+			Payload: map[string]interface{}{"url": "https://example.com", "n": float64(3)}, TimeoutMs: 5000, CreatedAt: 1700000000000},
+		{Version: CurrentEventSchema, Seq: 2, Type: EventDispatch, JobID: "job_1", Timestamp: 1700000001000,
+			Attempt: 1, Deadline: &deadline},
+		{Seq: 3, Type: EventAck, JobID: "job_1", Timestamp: 1700000002000}, // Legacy V1 event
+	}
+
+	var buf bytes.Buffer
+	enc := newRecordEncoder(&buf, EncodingBinary, true)
+	for i := range events {
+		events[i].Checksum = CalculateChecksum(events[i].Type, types.Job{ID: events[i].JobID}, events[i].Seq)
+		require.NoError(t, enc.Encode(&events[i]))
+	}
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), binaryMagic))
+
+	dec, encoding, err := newRecordDecoder(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, EncodingBinary, encoding)
+	for i := range events {
+		var got Event
+		require.NoError(t, dec.Decode(&got))
+		assert.Equal(t, events[i], got)
+	}
+	var extra Event
+	assert.Equal(t, io.EOF, dec.Decode(&extra))
+}
+
+// TestBinaryTornAndCorruptRecords verifies framing errors are detected
+func TestBinaryTornAndCorruptRecords(t *testing.T) {
+	var buf bytes.Buffer
+	enc := newRecordEncoder(&buf, EncodingBinary, true)
+	for seq := uint64(1); seq <= 2; seq++ {
+		require.NoError(t, enc.Encode(&Event{Seq: seq, Type: EventEnqueue, JobID: "job"}))
+	}
+	full := buf.Bytes()
+
+	// Torn tail: the last record is cut short
+	dec, _, err := newRecordDecoder(bytes.NewReader(full[:len(full)-3]))
+	require.NoError(t, err)
+	var event Event
+	require.NoError(t, dec.Decode(&event))
+	assert.Equal(t, io.ErrUnexpectedEOF, dec.Decode(&event))
+
+	// Flipped bit in the first record's body
+	corrupt := append([]byte(nil), full...)
+	corrupt[fileHeaderSize+recordHeaderSize+1] ^= 0x01
+	dec, _, err = newRecordDecoder(bytes.NewReader(corrupt))
+	require.NoError(t, err)
+	assert.True(t, errors.Is(dec.Decode(&event), ErrChecksumMismatch))
+}
+
+// TestBinaryWAL verifies a WAL written in binary replays and reopens
+func TestBinaryWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+
+	w, err := NewWALWithOptions(path, Options{BufferSize: 10, FlushInterval: time.Millisecond, Encoding: EncodingBinary})
+	require.NoError(t, err)
+	appendJobs(t, w, 1, 20)
+	require.NoError(t, w.Close())
+
+	encoding, err := detectEncoding(vfs.OS, path)
+	require.NoError(t, err)
+	assert.Equal(t, EncodingBinary, encoding)
+
+	w, err = NewWALWithOptions(path, Options{Encoding: EncodingBinary})
+	require.NoError(t, err)
+	defer w.Close()
+	assert.Equal(t, uint64(20), w.GetLastSeq())
+	appendJobs(t, w, 21, 25)
+	assert.Equal(t, []uint64{21, 22, 23, 24, 25}, collectSeqs(t, w, 20))
+}
+
+// TestEncodingSwitch verifies changing the encoding seals the old segment
+func TestEncodingSwitch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+
+	w, err := NewWAL(path, false, 10, time.Millisecond)
+	require.NoError(t, err)
+	appendJobs(t, w, 1, 5)
+	require.NoError(t, w.Close())
+
+	w, err = NewWALWithOptions(path, Options{Encoding: EncodingBinary})
+	require.NoError(t, err)
+	defer w.Close()
+	appendJobs(t, w, 6, 10)
+
+	sealedEncoding, err := detectEncoding(vfs.OS, segmentName(path, 1))
+	require.NoError(t, err)
+	assert.Equal(t, EncodingJSON, sealedEncoding)
+	activeEncoding, err := detectEncoding(vfs.OS, path)
+	require.NoError(t, err)
+	assert.Equal(t, EncodingBinary, activeEncoding)
+
+	// Mixed-format WAL replays in order
+	assert.Len(t, collectSeqs(t, w, 0), 10)
+}
+
+// TestConvertWAL verifies JSON segments are rewritten to binary in place
+func TestConvertWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+
+	w, err := NewWAL(path, false, 10, time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, w.Append(EventEnqueue, &types.Job{ID: "job_1", Payload: map[string]interface{}{"k": "v"}}))
+	appendJobs(t, w, 2, 10)
+	require.NoError(t, w.Rotate())
+	appendJobs(t, w, 11, 15)
+	require.NoError(t, w.Close())
+	jsonSize := fileSize(t, segmentName(path, 1))
+
+	converted, err := ConvertWAL(path, EncodingBinary)
+	require.NoError(t, err)
+	assert.Equal(t, 2, converted)
+	assert.Less(t, fileSize(t, segmentName(path, 1)), jsonSize)
+
+	// Already converted segments are skipped
+	converted, err = ConvertWAL(path, EncodingBinary)
+	require.NoError(t, err)
+	assert.Zero(t, converted)
+
+	w, err = NewWALWithOptions(path, Options{Encoding: EncodingBinary})
+	require.NoError(t, err)
+	defer w.Close()
+
+	var replayed []Event
+	require.NoError(t, w.Replay(func(e *Event) error {
+		replayed = append(replayed, *e)
+		return nil
+	}))
+	require.Len(t, replayed, 15)
+	assert.Equal(t, "v", replayed[0].Payload["k"])
+	assert.Equal(t, uint64(15), replayed[14].Seq)
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	return info.Size()
+}
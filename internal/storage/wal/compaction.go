@@ -0,0 +1,413 @@
+package wal
+
+// ============================================================================
+// WAL Compaction
+// Responsibility: Drop the event chains of finished jobs from sealed segments
+// ============================================================================
+//
+// Every job leaves ENQUEUE, DISPATCH, RETRY, TIMEOUT and ACK events behind,
+// so a full replay grows with history rather than with live state.
+// Compact rewrites sealed segments without the chains of jobs that are
+// known to be finished:
+//
+//   - The chain starts with ENQUEUE and ends with ACK inside the segments
+//     being compacted, and the ACK is not newer than the cutoff
+//   - The job has no events in newer segments (including the active one)
+//   - Every compacted segment is covered by a snapshot (coveredSeq), so
+//     normal recovery never needs the dropped events
+//
+// DEAD jobs and chains that are still in flight are kept as they are. The
+// newest sealed segment is never compacted: it records the last seq while
+// the active segment is empty (see recoverSeq).
+//
+// Crash safety:
+//   1. Each segment is rewritten to <segment>.compacting and fsynced
+//   2. The manifest (<path>.compaction) is written atomically, listing the
+//      rewritten segments as pending; this is the commit point
+//   3. Each .compacting file is renamed over its segment
+//   4. The manifest is rewritten with the pending entries moved to the
+//      list of compacted segments
+//   On open, recoverCompaction finishes pending renames (redo) and removes
+//   .compacting files that were never committed (undo).
+//
+// Compaction leaves gaps in the seq numbering of a segment. Replay
+// tolerates them; ValidateWAL uses the manifest to tell them from loss.
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+)
+
+// compactingSuffix marks a rewritten segment that is not swapped in yet
+const compactingSuffix = ".compacting"
+
+// CompactedSegment records one compacted segment in the manifest
+type CompactedSegment struct {
+	StartSeq    uint64 `json:"start_seq"`    // First seq of the segment (its name)
+	EndSeq      uint64 `json:"end_seq"`      // Last seq the segment covered before compaction
+	Events      int    `json:"events"`       // Events left after compaction
+	Dropped     int    `json:"dropped"`      // Events removed
+	CompactedAt int64  `json:"compacted_at"` // Unix milliseconds
+}
+
+// compactionManifest is the on-disk state of compaction for one WAL
+type compactionManifest struct {
+	Segments []CompactedSegment `json:"segments"`          // Compacted segments still on disk
+	Pending  []CompactedSegment `json:"pending,omitempty"` // Committed swaps that may not be done yet
+}
+
+// CompactionResult summarizes one Compact run
+type CompactionResult struct {
+	Segments int // Segments rewritten
+	Jobs     int // Finished jobs whose chains were dropped
+	Dropped  int // Events removed
+}
+
+// manifestPath returns the compaction manifest path of the WAL at path
+func manifestPath(path string) string {
+	return path + ".compaction"
+}
+
+// readManifest loads the compaction manifest (empty if there is none)
+func readManifest(fsys vfs.FS, path string) (*compactionManifest, error) {
+	data, err := vfs.ReadFile(fsys, manifestPath(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &compactionManifest{}, nil
+		}
+		return nil, fmt.Errorf("failed to read compaction manifest: %w", err)
+	}
+	var manifest compactionManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse compaction manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// writeManifest replaces the compaction manifest atomically
+func writeManifest(fsys vfs.FS, path string, manifest *compactionManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(fsys, manifestPath(path), data); err != nil {
+		return fmt.Errorf("failed to write compaction manifest: %w", err)
+	}
+	return nil
+}
+
+// compactedRanges returns the compacted segments that replay can still
+// reach (locally or in the archive), given the oldest reachable seq
+func (m *compactionManifest) compactedRanges(oldest uint64) []CompactedSegment {
+	var ranges []CompactedSegment
+	for _, seg := range m.Segments {
+		if seg.EndSeq >= oldest {
+			ranges = append(ranges, seg)
+		}
+	}
+	return ranges
+}
+
+// covers reports whether seqs from..to all lie in compacted segments
+func (m *compactionManifest) covers(from, to uint64) bool {
+	for seq := from; seq <= to; {
+		found := false
+		for _, seg := range m.Segments {
+			if seg.StartSeq <= seq && seq <= seg.EndSeq {
+				seq = seg.EndSeq + 1
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// recoverCompaction completes or rolls back a compaction interrupted by a
+// crash (see the file header)
+func recoverCompaction(fsys vfs.FS, path string) error {
+	manifest, err := readManifest(fsys, path)
+	if err != nil {
+		return err
+	}
+
+	if len(manifest.Pending) > 0 {
+		for _, seg := range manifest.Pending {
+			target := segmentName(path, seg.StartSeq)
+			if _, err := fsys.Stat(target + compactingSuffix); err == nil {
+				if err := removeIndex(fsys, target); err != nil {
+					return err
+				}
+				if err := fsys.Rename(target+compactingSuffix, target); err != nil {
+					return fmt.Errorf("failed to finish WAL compaction: %w", err)
+				}
+			}
+		}
+		manifest.Segments = mergeCompacted(manifest.Segments, manifest.Pending)
+		manifest.Pending = nil
+		if err := writeManifest(fsys, path, manifest); err != nil {
+			return err
+		}
+		fmt.Printf("Warning: finished interrupted WAL compaction of %s\n", path)
+	}
+
+	// Rewrites that were never committed
+	leftovers, _ := vfs.Glob(fsys, path+".*"+compactingSuffix)
+	for _, leftover := range leftovers {
+		fsys.Remove(leftover)
+	}
+	return nil
+}
+
+// mergeCompacted adds (or replaces) entries of a manifest segment list
+func mergeCompacted(segments, updates []CompactedSegment) []CompactedSegment {
+	byStart := make(map[uint64]CompactedSegment, len(segments)+len(updates))
+	for _, seg := range segments {
+		byStart[seg.StartSeq] = seg
+	}
+	for _, seg := range updates {
+		if old, ok := byStart[seg.StartSeq]; ok {
+			seg.Dropped += old.Dropped
+		}
+		byStart[seg.StartSeq] = seg
+	}
+
+	merged := make([]CompactedSegment, 0, len(byStart))
+	for _, seg := range byStart {
+		merged = append(merged, seg)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].StartSeq < merged[j].StartSeq
+	})
+	return merged
+}
+
+// jobChain tracks one job's events across the segments being compacted
+type jobChain struct {
+	first EventType // Type of the job's first event
+	last  *Event    // The job's most recent event
+}
+
+// Compact drops finished job chains from snapshot-covered sealed segments
+//
+// Segments are read and rewritten without holding the WAL lock; only the
+// swap locks out appends, rotation and pruning. A segment that changed in
+// the meantime (e.g. truncated) is left alone until the next run.
+//
+// Parameters:
+//   - coveredSeq: Last sequence number included in a durable snapshot
+//   - finishedBefore: Only drop jobs acknowledged at or before this time
+//
+// Returns:
+//   - *CompactionResult: What was removed (zero if nothing qualified)
+//   - error: Read, write or swap failure; the WAL is unchanged or fully
+//     swapped, never half done
+func (w *WAL) Compact(coveredSeq uint64, finishedBefore time.Time) (*CompactionResult, error) {
+	w.mu.Lock()
+	if w.isClosed {
+		w.mu.Unlock()
+		return nil, ErrWALClosed
+	}
+	sealed, err := listSealedSegments(w.fs, w.path)
+	w.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// Candidates: fully covered sealed segments, except the newest one
+	var candidates []CompactedSegment
+	for i := 0; i+1 < len(sealed); i++ {
+		end := sealed[i+1].StartSeq - 1
+		if end > coveredSeq {
+			break
+		}
+		candidates = append(candidates, CompactedSegment{StartSeq: sealed[i].StartSeq, EndSeq: end})
+	}
+	result := &CompactionResult{}
+	if len(candidates) == 0 {
+		return result, nil
+	}
+
+	// Pass 1: find finished chains
+	chains := make(map[types.JobID]*jobChain)
+	for _, candidate := range candidates {
+		err := walkFile(w.fs, segmentName(w.path, candidate.StartSeq), func(rec *Record, issue *Issue) error {
+			if issue != nil {
+				return fmt.Errorf("not compacting damaged segment: %s", issue)
+			}
+			event := rec.Event
+			chain, ok := chains[event.JobID]
+			if !ok {
+				chain = &jobChain{first: event.Type}
+				chains[event.JobID] = chain
+			}
+			chain.last = &event
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cutoff := finishedBefore.UnixMilli()
+	finished := make(map[types.JobID]bool)
+	for jobID, chain := range chains {
+		if chain.first == EventEnqueue && chain.last.Type == EventAck && chain.last.Timestamp <= cutoff {
+			finished[jobID] = true
+		}
+	}
+
+	// Jobs that show up again later (newer segments or the active one) stay
+	later := make([]string, 0, len(sealed)-len(candidates)+1)
+	for _, seg := range sealed[len(candidates):] {
+		later = append(later, seg.Path)
+	}
+	later = append(later, w.path)
+	for _, path := range later {
+		if len(finished) == 0 {
+			break
+		}
+		err := walkFile(w.fs, path, func(rec *Record, _ *Issue) error {
+			if rec != nil {
+				delete(finished, rec.Event.JobID)
+			}
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	if len(finished) == 0 {
+		return result, nil
+	}
+
+	// Pass 2: rewrite segments that hold finished chains
+	type rewrite struct {
+		seg  CompactedSegment
+		info os.FileInfo // Segment state when it was read
+	}
+	var rewrites []rewrite
+	defer func() {
+		for _, r := range rewrites {
+			w.fs.Remove(segmentName(w.path, r.seg.StartSeq) + compactingSuffix)
+		}
+	}()
+	for _, candidate := range candidates {
+		path := segmentName(w.path, candidate.StartSeq)
+		info, err := w.fs.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		scan, err := scanSegment(w.fs, path)
+		if err != nil {
+			return nil, err
+		}
+		kept, err := rewriteFile(w.fs, path, path+compactingSuffix, scan.Encoding, func(e *Event) bool {
+			return !finished[e.JobID]
+		})
+		if err != nil {
+			w.fs.Remove(path + compactingSuffix)
+			return nil, err
+		}
+		if kept == scan.Count {
+			w.fs.Remove(path + compactingSuffix)
+			continue
+		}
+		candidate.Events = kept
+		candidate.Dropped = scan.Count - kept
+		candidate.CompactedAt = time.Now().UnixMilli()
+		rewrites = append(rewrites, rewrite{seg: candidate, info: info})
+	}
+
+	// Swap: commit in the manifest, then rename
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var pending []CompactedSegment
+	for _, r := range rewrites {
+		info, err := w.fs.Stat(segmentName(w.path, r.seg.StartSeq))
+		if err != nil || info.Size() != r.info.Size() || !info.ModTime().Equal(r.info.ModTime()) {
+			continue // Pruned or rewritten meanwhile
+		}
+		pending = append(pending, r.seg)
+	}
+	if len(pending) == 0 {
+		return result, nil
+	}
+
+	manifest, err := readManifest(w.fs, w.path)
+	if err != nil {
+		return nil, err
+	}
+	oldest, err := w.oldestSeqLocked()
+	if err != nil {
+		return nil, err
+	}
+	manifest.Segments = manifest.compactedRanges(oldest)
+	manifest.Pending = pending
+	if err := writeManifest(w.fs, w.path, manifest); err != nil {
+		return nil, err
+	}
+	for _, seg := range pending {
+		path := segmentName(w.path, seg.StartSeq)
+		if err := removeIndex(w.fs, path); err != nil {
+			return nil, err
+		}
+		if err := w.fs.Rename(path+compactingSuffix, path); err != nil {
+			return nil, fmt.Errorf("failed to swap compacted segment (finished on next open): %w", err)
+		}
+		result.Segments++
+		result.Dropped += seg.Dropped
+	}
+	if err := w.fs.SyncDir(filepath.Dir(w.path)); err != nil {
+		return nil, err
+	}
+	manifest.Segments = mergeCompacted(manifest.Segments, pending)
+	manifest.Pending = nil
+	if err := writeManifest(w.fs, w.path, manifest); err != nil {
+		return nil, err
+	}
+
+	result.Jobs = len(finished)
+	return result, nil
+}
+
+// CompactedThrough returns the highest seq of any compacted segment replay
+// can still reach, locally or in the archive (0 if none)
+//
+// Replaying from a snapshot older than this may miss the end of a dropped
+// chain, so point-in-time recovery must start at or after it.
+func (w *WAL) CompactedThrough() (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.compactedThroughLocked()
+}
+
+// compactedThroughLocked implements CompactedThrough; caller must hold w.mu
+func (w *WAL) compactedThroughLocked() (uint64, error) {
+	manifest, err := readManifest(w.fs, w.path)
+	if err != nil {
+		return 0, err
+	}
+	oldest, err := w.oldestSeqLocked()
+	if err != nil {
+		return 0, err
+	}
+	var through uint64
+	for _, seg := range manifest.compactedRanges(oldest) {
+		if seg.EndSeq > through {
+			through = seg.EndSeq
+		}
+	}
+	return through, nil
+}
@@ -0,0 +1,123 @@
+package wal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================================================
+// WAL Compaction Tests
+// ============================================================================
+
+// appendChain appends one event per type for a job
+func appendChain(t *testing.T, w *WAL, jobID types.JobID, eventTypes ...EventType) {
+	t.Helper()
+	for _, eventType := range eventTypes {
+		require.NoError(t, w.Append(eventType, &types.Job{ID: jobID}))
+	}
+}
+
+// writeHistoryWAL writes three sealed segments and an active one:
+//
+//	seq 1-8:  job_1 finished, job_2 dead, job_3 dispatched
+//	seq 9-10: job_4 finished
+//	seq 11:   job_5 enqueued (newest sealed segment)
+//	seq 12:   job_3 finished (active segment)
+func writeHistoryWAL(t *testing.T) (*WAL, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.wal")
+	w, err := NewWAL(path, false, 10, time.Millisecond)
+	require.NoError(t, err)
+
+	appendChain(t, w, "job_1", EventEnqueue, EventDispatch, EventAck)
+	appendChain(t, w, "job_2", EventEnqueue, EventDispatch, EventDead)
+	appendChain(t, w, "job_3", EventEnqueue, EventDispatch)
+	require.NoError(t, w.Rotate())
+	appendChain(t, w, "job_4", EventEnqueue, EventAck)
+	require.NoError(t, w.Rotate())
+	appendChain(t, w, "job_5", EventEnqueue)
+	require.NoError(t, w.Rotate())
+	appendChain(t, w, "job_3", EventAck)
+	return w, path
+}
+
+func TestCompactDropsFinishedChains(t *testing.T) {
+	w, path := writeHistoryWAL(t)
+	defer w.Close()
+	finishedBefore := time.Now().Add(time.Second)
+
+	// Nothing finished long enough ago
+	result, err := w.Compact(11, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, result.Segments)
+
+	// Only the first segment is covered by a snapshot at seq 8
+	result, err = w.Compact(8, finishedBefore)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Segments)
+	assert.Equal(t, 1, result.Jobs)
+	assert.Equal(t, 3, result.Dropped)
+
+	result, err = w.Compact(11, finishedBefore)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Segments)
+	assert.Equal(t, 2, result.Dropped)
+
+	// job_2 (dead) and job_3 (finished later) keep their chains; the
+	// newest sealed segment is untouched
+	assert.Equal(t, []uint64{4, 5, 6, 7, 8, 11, 12}, collectSeqs(t, w, 0))
+	require.NoError(t, ValidateWAL(path))
+
+	through, err := w.CompactedThrough()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(10), through)
+
+	// Nothing left to drop
+	result, err = w.Compact(11, finishedBefore)
+	require.NoError(t, err)
+	assert.Zero(t, result.Segments)
+}
+
+func TestCompactionCrashRecovery(t *testing.T) {
+	w, path := writeHistoryWAL(t)
+	require.NoError(t, w.Close())
+	first := segmentName(path, 1)
+
+	// Crash before the commit point: the rewrite is discarded
+	_, err := rewriteFile(vfs.OS, first, first+compactingSuffix, EncodingJSON, func(e *Event) bool { return e.JobID != "job_1" })
+	require.NoError(t, err)
+	w, err = NewWAL(path, false, 10, time.Millisecond)
+	require.NoError(t, err)
+	assert.NoFileExists(t, first+compactingSuffix)
+	assert.Len(t, collectSeqs(t, w, 0), 12)
+	require.NoError(t, w.Close())
+
+	// Crash after the commit point: the swap is finished on open
+	_, err = rewriteFile(vfs.OS, first, first+compactingSuffix, EncodingJSON, func(e *Event) bool { return e.JobID != "job_1" })
+	require.NoError(t, err)
+	require.NoError(t, writeManifest(vfs.OS, path, &compactionManifest{
+		Pending: []CompactedSegment{{StartSeq: 1, EndSeq: 8, Events: 5, Dropped: 3}},
+	}))
+	w, err = NewWAL(path, false, 10, time.Millisecond)
+	require.NoError(t, err)
+	defer w.Close()
+	assert.NoFileExists(t, first+compactingSuffix)
+	assert.Equal(t, []uint64{4, 5, 6, 7, 8, 9, 10, 11, 12}, collectSeqs(t, w, 0))
+
+	manifest, err := readManifest(vfs.OS, path)
+	require.NoError(t, err)
+	assert.Empty(t, manifest.Pending)
+	require.Len(t, manifest.Segments, 1)
+	assert.Equal(t, 3, manifest.Segments[0].Dropped)
+	require.NoError(t, ValidateWAL(path))
+
+	_, err = os.Stat(manifestPath(path) + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,245 @@
+package wal
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================================================
+// Crash Consistency Tests (in-memory filesystem)
+// ============================================================================
+
+const crashWALPath = "/data/test.wal"
+
+func openMemWAL(t *testing.T, fsys vfs.FS, opts Options) *WAL {
+	t.Helper()
+	opts.FS = fsys
+	if opts.FlushInterval == 0 {
+		opts.FlushInterval = time.Millisecond
+	}
+	w, err := NewWALWithOptions(crashWALPath, opts)
+	require.NoError(t, err)
+	return w
+}
+
+func appendJob(w *WAL, id string) error {
+	return w.Append(EventEnqueue, &types.Job{ID: types.JobID(id)})
+}
+
+// replayedJobs replays the whole WAL, checking that seqs have no gaps
+func replayedJobs(t *testing.T, w *WAL) map[string]bool {
+	t.Helper()
+	jobs := make(map[string]bool)
+	var last uint64
+	require.NoError(t, w.Replay(func(e *Event) error {
+		require.Equal(t, last+1, e.Seq, "seq gap after %d", last)
+		last = e.Seq
+		jobs[string(e.JobID)] = true
+		return nil
+	}))
+	return jobs
+}
+
+func TestCrashNeverLosesAcknowledgedEvents(t *testing.T) {
+	for _, encoding := range []Encoding{EncodingJSON, EncodingBinary} {
+		for seed := int64(1); seed <= 10; seed++ {
+			t.Run(fmt.Sprintf("%s/seed-%d", encoding, seed), func(t *testing.T) {
+				rng := rand.New(rand.NewSource(seed))
+				fsys := vfs.NewMemFS()
+				opts := Options{BufferSize: 8, Encoding: encoding, MaxSegmentSize: 2048}
+				w := openMemWAL(t, fsys, opts)
+
+				// Concurrent writers; power is cut while they are running
+				var mu sync.Mutex
+				acked := make(map[string]bool)
+				stop := make(chan struct{})
+				var wg sync.WaitGroup
+				for g := 0; g < 4; g++ {
+					wg.Add(1)
+					go func(g int) {
+						defer wg.Done()
+						for i := 0; ; i++ {
+							select {
+							case <-stop:
+								return
+							default:
+							}
+							id := fmt.Sprintf("job_%d_%d", g, i)
+							if appendJob(w, id) == nil {
+								mu.Lock()
+								acked[id] = true
+								mu.Unlock()
+							}
+						}
+					}(g)
+				}
+				time.Sleep(time.Duration(5+rng.Intn(20)) * time.Millisecond)
+
+				mu.Lock()
+				mustSurvive := make([]string, 0, len(acked))
+				for id := range acked {
+					mustSurvive = append(mustSurvive, id)
+				}
+				mu.Unlock()
+				crashed := fsys.CrashTorn(rng)
+
+				close(stop)
+				wg.Wait()
+				w.Close()
+
+				// Recovery repairs the torn tail and keeps every acknowledged event
+				w = openMemWAL(t, crashed, opts)
+				defer w.Close()
+				jobs := replayedJobs(t, w)
+				for _, id := range mustSurvive {
+					require.True(t, jobs[id], "acknowledged %s lost (%d acknowledged)", id, len(mustSurvive))
+				}
+
+				// The recovered WAL accepts appends that survive the next crash
+				require.NoError(t, appendJob(w, "after_recovery"))
+				w2 := openMemWAL(t, crashed.Crash(), opts)
+				defer w2.Close()
+				assert.True(t, replayedJobs(t, w2)["after_recovery"])
+			})
+		}
+	}
+}
+
+func TestCrashAfterRotateAndPrune(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	w := openMemWAL(t, fsys, Options{BufferSize: 1})
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, appendJob(w, fmt.Sprintf("job_%d", i)))
+		require.NoError(t, w.Rotate())
+	}
+	require.NoError(t, appendJob(w, "job_4"))
+	_, err := w.Prune(2)
+	require.NoError(t, err)
+
+	w2 := openMemWAL(t, fsys.Crash(), Options{})
+	defer w2.Close()
+	var seqs []uint64
+	require.NoError(t, w2.Replay(func(e *Event) error {
+		seqs = append(seqs, e.Seq)
+		return nil
+	}))
+	assert.Equal(t, []uint64{3, 4}, seqs)
+	w.Close()
+}
+
+// ============================================================================
+// I/O Faults
+// ============================================================================
+
+func TestFailedSyncIsRolledBack(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	w := openMemWAL(t, fsys, Options{BufferSize: 1})
+	defer w.Close()
+
+	require.NoError(t, appendJob(w, "job_1"))
+	fsys.Inject(vfs.Fault{Op: vfs.OpSync, Path: crashWALPath, Times: 1})
+	err := appendJob(w, "job_2")
+	assert.ErrorIs(t, err, syscall.EIO)
+	require.NoError(t, appendJob(w, "job_3"))
+
+	// The failed event neither survives a crash nor leaves a seq gap
+	w2 := openMemWAL(t, fsys.Crash(), Options{})
+	defer w2.Close()
+	assert.Equal(t, map[string]bool{"job_1": true, "job_3": true}, replayedJobs(t, w2))
+}
+
+func TestTornWriteIsRolledBack(t *testing.T) {
+	for _, encoding := range []Encoding{EncodingJSON, EncodingBinary} {
+		t.Run(string(encoding), func(t *testing.T) {
+			fsys := vfs.NewMemFS()
+			// Tear the very first write too, so the binary header is rewritten
+			fsys.Inject(vfs.Fault{Op: vfs.OpWrite, Path: crashWALPath, Times: 1, Partial: true})
+			w := openMemWAL(t, fsys, Options{BufferSize: 1, Encoding: encoding})
+			defer w.Close()
+
+			assert.Error(t, appendJob(w, "job_torn"))
+			require.NoError(t, appendJob(w, "job_1"))
+			fsys.Inject(vfs.Fault{Op: vfs.OpWrite, Path: crashWALPath, Times: 1, Partial: true})
+			assert.Error(t, appendJob(w, "job_torn2"))
+			require.NoError(t, appendJob(w, "job_2"))
+			require.NoError(t, walkWAL(fsys, crashWALPath, func(_ *Record, issue *Issue) error {
+				if issue != nil {
+					return fmt.Errorf("damaged WAL: %s", issue)
+				}
+				return nil
+			}))
+
+			w2 := openMemWAL(t, fsys.Crash(), Options{})
+			defer w2.Close()
+			assert.Equal(t, map[string]bool{"job_1": true, "job_2": true}, replayedJobs(t, w2))
+		})
+	}
+}
+
+func TestDiskFull(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	w := openMemWAL(t, fsys, Options{BufferSize: 1})
+	defer w.Close()
+	require.NoError(t, appendJob(w, "job_1"))
+	info, err := fsys.Stat(crashWALPath)
+	require.NoError(t, err)
+
+	fsys.SetCapacity(info.Size() + 10)
+	assert.ErrorIs(t, appendJob(w, "job_full"), syscall.ENOSPC)
+
+	// Space freed: appends continue after the acknowledged events
+	fsys.SetCapacity(0)
+	require.NoError(t, appendJob(w, "job_2"))
+	w2 := openMemWAL(t, fsys.Crash(), Options{})
+	defer w2.Close()
+	assert.Equal(t, map[string]bool{"job_1": true, "job_2": true}, replayedJobs(t, w2))
+}
+
+func TestFailedRenameKeepsWALUsable(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	w := openMemWAL(t, fsys, Options{BufferSize: 1})
+	defer w.Close()
+	require.NoError(t, appendJob(w, "job_1"))
+
+	fsys.Inject(vfs.Fault{Op: vfs.OpRename, Path: crashWALPath})
+	assert.Error(t, w.Rotate())
+	require.NoError(t, appendJob(w, "job_2"))
+
+	fsys.ClearFaults()
+	require.NoError(t, w.Rotate())
+	require.NoError(t, appendJob(w, "job_3"))
+
+	w2 := openMemWAL(t, fsys.Crash(), Options{})
+	defer w2.Close()
+	assert.Equal(t, map[string]bool{"job_1": true, "job_2": true, "job_3": true}, replayedJobs(t, w2))
+	segments, err := w2.Segments()
+	require.NoError(t, err)
+	assert.Len(t, segments, 2)
+}
+
+func TestFailedRollbackDisablesWAL(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	w := openMemWAL(t, fsys, Options{BufferSize: 1})
+	require.NoError(t, appendJob(w, "job_1"))
+
+	fsys.Inject(vfs.Fault{Op: vfs.OpWrite, Path: crashWALPath, Times: 1, Partial: true})
+	fsys.Inject(vfs.Fault{Op: vfs.OpTruncate, Path: crashWALPath, Times: 1})
+	assert.Error(t, appendJob(w, "job_torn"))
+	assert.ErrorIs(t, appendJob(w, "job_2"), ErrSyncFailed)
+	w.Close()
+
+	// Reopening repairs the torn tail
+	w2 := openMemWAL(t, fsys.Crash(), Options{BufferSize: 1})
+	defer w2.Close()
+	assert.Equal(t, map[string]bool{"job_1": true}, replayedJobs(t, w2))
+	require.NoError(t, appendJob(w2, "job_2"))
+}
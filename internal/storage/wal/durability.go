@@ -0,0 +1,172 @@
+package wal
+
+// ============================================================================
+// WAL Durability Policies
+// Responsibility: Decide when appended batches reach stable storage
+// ============================================================================
+//
+//   Mode      Append returns after          Lost on power failure
+//   batch     write + fsync of the batch    nothing acknowledged
+//   datasync  write + fdatasync             nothing acknowledged
+//   periodic  write (fsync every interval)  up to one interval of appends
+//   none      write (OS flushes eventually) anything not yet flushed by the OS
+//
+// fdatasync skips flushing metadata that is not needed to read the data
+// back (e.g. mtime); it falls back to fsync where unsupported. A process
+// crash without a power failure loses nothing in any mode, since written
+// data is already in the OS page cache.
+//
+// Preallocation reserves disk blocks for a new segment up front (without
+// changing its size), so appends do not run out of space midway and the
+// segment stays contiguous on disk. It does not make syncs cheaper: each
+// append still grows the file size, and writing into reserved blocks
+// marks them as written, so fdatasync persists that metadata as well. It
+// is a no-op where unsupported.
+//
+// A batch whose write or sync fails is rolled back: the active segment is
+// truncated to where the batch started and its seqs are reused, so later
+// acknowledged batches never follow a torn record. If the rollback itself
+// fails, the WAL refuses all further appends (the on-disk tail is unknown)
+// until it is reopened, which repairs the tail during recovery.
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// SyncMode selects when appended batches are synced to disk
+type SyncMode string
+
+const (
+	SyncBatch    SyncMode = "batch"    // fsync after every batch (default)
+	SyncData     SyncMode = "datasync" // fdatasync after every batch
+	SyncPeriodic SyncMode = "periodic" // fsync in the background every SyncInterval
+	SyncNone     SyncMode = "none"     // Never sync; for throwaway test queues
+)
+
+// defaultSyncInterval is the periodic sync interval if none is configured
+const defaultSyncInterval = 100 * time.Millisecond
+
+// ParseSyncMode validates a sync mode name ("" means SyncBatch)
+func ParseSyncMode(s string) (SyncMode, error) {
+	switch mode := SyncMode(s); mode {
+	case "":
+		return SyncBatch, nil
+	case SyncBatch, SyncData, SyncPeriodic, SyncNone:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown WAL sync mode %q (want batch, datasync, periodic or none)", s)
+	}
+}
+
+// DescribeDurability explains a sync mode for status output
+//
+// Parameters:
+//   - mode: Sync mode
+//   - interval: Background sync interval (periodic mode only)
+//
+// Returns:
+//   - string: The mode and what a power failure can lose
+func DescribeDurability(mode SyncMode, interval time.Duration) string {
+	switch mode {
+	case SyncData:
+		return "datasync (fdatasync per batch, no acknowledged writes lost)"
+	case SyncPeriodic:
+		if interval <= 0 {
+			interval = defaultSyncInterval
+		}
+		return fmt.Sprintf("periodic (fsync every %s, up to %s of acknowledged writes lost on power failure)", interval, interval)
+	case SyncNone:
+		return "none (no fsync, acknowledged writes lost on power failure)"
+	default:
+		return "batch (fsync per batch, no acknowledged writes lost)"
+	}
+}
+
+// Durability describes the active sync mode for status output
+func (w *WAL) Durability() string {
+	return DescribeDurability(w.syncMode, w.syncInterval)
+}
+
+// syncBatchLocked makes a written batch durable according to the sync
+// mode; caller must hold w.mu
+func (w *WAL) syncBatchLocked() error {
+	switch w.syncMode {
+	case SyncData:
+		return datasync(w.file)
+	case SyncPeriodic, SyncNone:
+		w.dirty = true
+		return nil
+	default:
+		return w.file.Sync()
+	}
+}
+
+// syncDirtyLocked syncs batches the sync mode left unsynced before the
+// active segment is closed; caller must hold w.mu
+func (w *WAL) syncDirtyLocked() error {
+	if !w.dirty || w.syncMode == SyncNone {
+		return nil
+	}
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync WAL: %w", err)
+	}
+	w.dirty = false
+	return nil
+}
+
+// rollbackLocked undoes a failed batch that started at seq+1 and byte
+// offset size of the active segment, when the segment's index was index;
+// caller must hold w.mu
+func (w *WAL) rollbackLocked(seq uint64, size int64, index segmentIndex) {
+	w.seq = seq
+	*w.index = index
+	if w.segmentSize == size {
+		return // Nothing reached the file
+	}
+	f, ok := w.file.(interface{ Truncate(int64) error })
+	if !ok {
+		w.failed = fmt.Errorf("%w: cannot roll back a partially written batch", ErrSyncFailed)
+	} else if err := f.Truncate(size); err != nil {
+		w.failed = fmt.Errorf("%w: failed to roll back a partially written batch: %v", ErrSyncFailed, err)
+	} else {
+		w.segmentSize = size
+		w.encoder = newRecordEncoder(countingWriter{w: w.file, n: &w.segmentSize}, w.encoding, size == 0)
+		return
+	}
+	fmt.Printf("Warning: WAL disabled until reopened: %v\n", w.failed)
+}
+
+// syncLoop syncs the active segment every syncInterval (periodic mode)
+func (w *WAL) syncLoop() {
+	ticker := time.NewTicker(w.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.mu.Lock()
+			select {
+			case <-w.shutdown: // Close synced and closed the file
+				w.mu.Unlock()
+				return
+			default:
+			}
+			if err := w.syncDirtyLocked(); err != nil {
+				fmt.Printf("Warning: periodic WAL sync failed: %v\n", err)
+			}
+			w.mu.Unlock()
+		case <-w.shutdown:
+			return
+		}
+	}
+}
+
+// datasync flushes file data with fdatasync where the file supports it
+func datasync(file FileInterface) error {
+	if f, ok := file.(*os.File); ok {
+		return fdatasync(f)
+	}
+	return file.Sync()
+}
@@ -0,0 +1,28 @@
+//go:build linux
+
+package wal
+
+import (
+	"os"
+	"syscall"
+)
+
+// fallocKeepSize is FALLOC_FL_KEEP_SIZE: allocate blocks past EOF without
+// changing the file size, so readers never see the reserved space. Appends
+// into those blocks still update the size and extent state, which
+// fdatasync must persist.
+const fallocKeepSize = 0x1
+
+// fdatasync flushes file data and only the metadata needed to read it
+func fdatasync(f *os.File) error {
+	return syscall.Fdatasync(int(f.Fd()))
+}
+
+// preallocate reserves size bytes of disk blocks for f
+func preallocate(f *os.File, size int64) error {
+	err := syscall.Fallocate(int(f.Fd()), fallocKeepSize, 0, size)
+	if err == syscall.EOPNOTSUPP || err == syscall.ENOSYS {
+		return nil // Filesystem cannot preallocate; appends still work
+	}
+	return err
+}
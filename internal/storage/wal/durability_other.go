@@ -0,0 +1,15 @@
+//go:build !linux
+
+package wal
+
+import "os"
+
+// fdatasync falls back to fsync where fdatasync is unavailable
+func fdatasync(f *os.File) error {
+	return f.Sync()
+}
+
+// preallocate is a no-op where fallocate is unavailable
+func preallocate(f *os.File, size int64) error {
+	return nil
+}
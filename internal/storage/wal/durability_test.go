@@ -0,0 +1,92 @@
+package wal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================================================
+// WAL Durability Tests
+// ============================================================================
+
+func TestParseSyncMode(t *testing.T) {
+	mode, err := ParseSyncMode("")
+	require.NoError(t, err)
+	assert.Equal(t, SyncBatch, mode)
+
+	for _, name := range []string{"batch", "datasync", "periodic", "none"} {
+		mode, err := ParseSyncMode(name)
+		require.NoError(t, err)
+		assert.Equal(t, SyncMode(name), mode)
+	}
+
+	_, err = ParseSyncMode("always")
+	assert.Error(t, err)
+	_, err = NewWALWithOptions(filepath.Join(t.TempDir(), "test.wal"), Options{SyncMode: "always"})
+	assert.Error(t, err)
+}
+
+func TestSyncModesPersistEvents(t *testing.T) {
+	for _, mode := range []SyncMode{SyncBatch, SyncData, SyncPeriodic, SyncNone} {
+		t.Run(string(mode), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.wal")
+			opts := Options{BufferSize: 10, FlushInterval: time.Millisecond, SyncMode: mode}
+			w, err := NewWALWithOptions(path, opts)
+			require.NoError(t, err)
+			assert.Contains(t, w.Durability(), string(mode))
+
+			appendJobs(t, w, 1, 3)
+			require.NoError(t, w.Rotate())
+			appendJobs(t, w, 4, 5)
+			require.NoError(t, w.Close())
+
+			w, err = NewWALWithOptions(path, opts)
+			require.NoError(t, err)
+			defer w.Close()
+			assert.Equal(t, []uint64{1, 2, 3, 4, 5}, collectSeqs(t, w, 0))
+		})
+	}
+}
+
+func TestPeriodicSync(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+	w, err := NewWALWithOptions(path, Options{BufferSize: 10, FlushInterval: time.Millisecond,
+		SyncMode: SyncPeriodic, SyncInterval: 20 * time.Millisecond})
+	require.NoError(t, err)
+	defer w.Close()
+	assert.Contains(t, w.Durability(), "every 20ms")
+
+	appendJobs(t, w, 1, 1)
+	assert.Eventually(t, func() bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return !w.dirty
+	}, time.Second, 5*time.Millisecond, "background sync should clear the dirty flag")
+}
+
+func TestPreallocateKeepsSegmentSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+	w, err := NewWALWithOptions(path, Options{BufferSize: 10, FlushInterval: time.Millisecond, Preallocate: 1 << 20})
+	require.NoError(t, err)
+
+	// Reserved space is invisible to readers
+	assert.Zero(t, fileSize(t, path))
+	appendJobs(t, w, 1, 3)
+	size := fileSize(t, path)
+	assert.Less(t, size, int64(1<<20))
+
+	require.NoError(t, w.Rotate())
+	assert.Equal(t, size, fileSize(t, segmentName(path, 1)))
+	appendJobs(t, w, 4, 4)
+	require.NoError(t, w.Close())
+
+	w, err = NewWALWithOptions(path, Options{})
+	require.NoError(t, err)
+	defer w.Close()
+	assert.Equal(t, []uint64{1, 2, 3, 4}, collectSeqs(t, w, 0))
+	require.NoError(t, ValidateWAL(path))
+}
@@ -0,0 +1,160 @@
+package wal
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ChuLiYu/raft-recovery/internal/encryption"
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================================================
+// WAL Encryption Tests
+// ============================================================================
+
+// testKeyring builds a keyring whose key "k<n>" is always the byte n
+// repeated, so keys stay the same across reopens
+func testKeyring(t *testing.T, active string, ids ...string) *encryption.Keyring {
+	t.Helper()
+	keys := make(map[string][]byte)
+	for _, id := range ids {
+		keys[id] = bytes.Repeat([]byte{id[len(id)-1]}, 32)
+	}
+	k, err := encryption.NewKeyring(keys, active)
+	require.NoError(t, err)
+	return k
+}
+
+func appendSecret(t *testing.T, w *WAL, id string) {
+	t.Helper()
+	require.NoError(t, w.Append(EventEnqueue, &types.Job{ID: types.JobID(id), Payload: map[string]interface{}{"secret": "s-" + id}}))
+}
+
+func replayPayloads(w *WAL) (map[string]interface{}, error) {
+	payloads := make(map[string]interface{})
+	err := w.Replay(func(e *Event) error {
+		if e.Payload != nil {
+			payloads[string(e.JobID)] = e.Payload["secret"]
+		}
+		return nil
+	})
+	return payloads, err
+}
+
+func TestEncryptedRoundTrip(t *testing.T) {
+	for _, encoding := range []Encoding{EncodingJSON, EncodingBinary} {
+		t.Run(string(encoding), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.wal")
+			keyring := testKeyring(t, "k1", "k1")
+			w, err := NewWALWithOptions(path, Options{BufferSize: 10, FlushInterval: time.Millisecond, Encoding: encoding, Keyring: keyring})
+			require.NoError(t, err)
+			appendSecret(t, w, "job_1")
+			appendSecret(t, w, "job_2")
+			require.NoError(t, w.Close())
+
+			// Nothing readable on disk, headers still readable without keys
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.NotContains(t, string(data), "s-job_1")
+			count, err := CountEvents(path)
+			require.NoError(t, err)
+			assert.Equal(t, 2, count)
+			require.NoError(t, ValidateWAL(path))
+
+			w, err = NewWALWithOptions(path, Options{Encoding: encoding, Keyring: keyring})
+			require.NoError(t, err)
+			defer w.Close()
+			payloads, err := replayPayloads(w)
+			require.NoError(t, err)
+			assert.Equal(t, map[string]interface{}{"job_1": "s-job_1", "job_2": "s-job_2"}, payloads)
+			assert.Contains(t, w.Encryption(), `"k1"`)
+		})
+	}
+}
+
+func TestEncryptedKeyRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+
+	// Plain records from before encryption was enabled
+	w, err := NewWALWithOptions(path, Options{BufferSize: 10, FlushInterval: time.Millisecond})
+	require.NoError(t, err)
+	appendSecret(t, w, "job_0")
+	require.NoError(t, w.Close())
+
+	// Written with k1
+	w, err = NewWALWithOptions(path, Options{BufferSize: 10, FlushInterval: time.Millisecond, Keyring: testKeyring(t, "k1", "k1")})
+	require.NoError(t, err)
+	appendSecret(t, w, "job_1")
+	require.NoError(t, w.Rotate())
+	require.NoError(t, w.Close())
+
+	// Rotated to k2: new records use k2, old ones still open with k1
+	w, err = NewWALWithOptions(path, Options{BufferSize: 10, FlushInterval: time.Millisecond, Keyring: testKeyring(t, "k2", "k1", "k2")})
+	require.NoError(t, err)
+	appendSecret(t, w, "job_2")
+
+	var keyIDs []string
+	require.NoError(t, WalkWAL(path, func(rec *Record, issue *Issue) error {
+		if rec != nil && rec.Event.Sealed != nil {
+			id, err := encryption.KeyID(rec.Event.Sealed)
+			require.NoError(t, err)
+			keyIDs = append(keyIDs, id)
+		}
+		return nil
+	}))
+	assert.Equal(t, []string{"k1", "k2"}, keyIDs)
+
+	payloads, err := replayPayloads(w)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"job_0": "s-job_0", "job_1": "s-job_1", "job_2": "s-job_2"}, payloads)
+	require.NoError(t, w.Close())
+
+	// k1 removed from the keyring: replay names the missing key
+	w, err = NewWALWithOptions(path, Options{Keyring: testKeyring(t, "k2", "k2")})
+	require.NoError(t, err)
+	_, err = replayPayloads(w)
+	assert.ErrorIs(t, err, encryption.ErrKeyNotFound)
+	assert.Contains(t, err.Error(), "seq 2")
+	assert.Contains(t, err.Error(), `"k1"`)
+	require.NoError(t, w.Close())
+
+	// No keyring at all
+	w, err = NewWALWithOptions(path, Options{})
+	require.NoError(t, err)
+	defer w.Close()
+	_, err = replayPayloads(w)
+	assert.ErrorIs(t, err, encryption.ErrKeyNotFound)
+	assert.Contains(t, err.Error(), "no encryption keys are configured")
+}
+
+func TestEncryptedSubscribe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+	w, err := NewWALWithOptions(path, Options{BufferSize: 10, FlushInterval: time.Millisecond, Keyring: testKeyring(t, "k1", "k1")})
+	require.NoError(t, err)
+	defer w.Close()
+	appendSecret(t, w, "job_1")
+
+	// Catch-up from disk and live batches both deliver plaintext
+	secrets := make(chan interface{}, 2)
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Subscribe(context.Background(), 0, func(e *Event) error {
+			assert.Nil(t, e.Sealed)
+			secrets <- e.Payload["secret"]
+			if e.Seq == 2 {
+				return ErrStopReplay
+			}
+			return nil
+		})
+	}()
+	assert.Equal(t, "s-job_1", <-secrets)
+	appendSecret(t, w, "job_2")
+	assert.Equal(t, "s-job_2", <-secrets)
+	require.NoError(t, <-done)
+}
@@ -5,7 +5,10 @@ package wal
 // Purpose: Define all WAL-related error types
 // ============================================================================
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // Predefined errors
 var (
@@ -23,6 +26,18 @@ var (
 
 	// ErrSyncFailed indicates fsync failed (critical error)
 	ErrSyncFailed = errors.New("wal: sync to disk failed")
+
+	// ErrStopReplay can be returned by a replay handler to end the replay
+	// early; Replay and ReplayFrom then return nil
+	ErrStopReplay = errors.New("wal: stop replay")
+
+	// ErrCompacted indicates the requested events were pruned or compacted
+	// away and can no longer be read (see Subscribe)
+	ErrCompacted = errors.New("wal: requested events have been compacted")
+
+	// ErrBelowFloor indicates a truncation would drop events a snapshot
+	// already covers, i.e. at or below the seq floor (see checkpoint.go)
+	ErrBelowFloor = errors.New("wal: cannot truncate below the seq floor")
 )
 
 // TODO: Consider error handling strategies
@@ -50,27 +65,65 @@ type ChecksumError struct {
 }
 
 func (e *ChecksumError) Error() string {
-	// TODO: Implement error message formatting
-	// Example: "wal: checksum mismatch at seq=42 (expected=0x12345678, got=0x87654321)"
-	return ""
+	if e.Seq == 0 { // Unknown, e.g. the record could not be decoded
+		return fmt.Sprintf("wal: checksum mismatch (expected=0x%08x, got=0x%08x)", e.Expected, e.Actual)
+	}
+	return fmt.Sprintf("wal: checksum mismatch at seq=%d (expected=0x%08x, got=0x%08x)", e.Seq, e.Expected, e.Actual)
+}
+
+// Is lets errors.Is(err, ErrChecksumMismatch) match a *ChecksumError
+func (e *ChecksumError) Is(target error) bool {
+	return target == ErrChecksumMismatch
 }
 
 // CorruptionError represents WAL corruption error
+//
+// Returned for damage that cannot be explained by a crash during a write,
+// i.e. an unreadable record followed by more data. A torn final record is
+// not a CorruptionError; the WAL truncates it when opened.
 type CorruptionError struct {
+	Path   string // Segment file (if known)
 	Seq    uint64 // Sequence number of failed event (if known)
 	Offset int64  // Byte offset in file
 	Cause  error  // Underlying error
 }
 
 func (e *CorruptionError) Error() string {
-	// TODO: Implement error message formatting
-	return ""
+	msg := fmt.Sprintf("wal: corrupted record at offset %d", e.Offset)
+	if e.Path != "" {
+		msg = fmt.Sprintf("wal: corrupted record in %s at offset %d", e.Path, e.Offset)
+	}
+	if e.Seq != 0 {
+		msg += fmt.Sprintf(" (seq=%d)", e.Seq)
+	}
+	if e.Cause != nil {
+		msg += ": " + e.Cause.Error()
+	}
+	return msg
+}
+
+// Is lets errors.Is(err, ErrCorruptedWAL) match a *CorruptionError
+func (e *CorruptionError) Is(target error) bool {
+	return target == ErrCorruptedWAL
 }
 
 func (e *CorruptionError) Unwrap() error {
 	return e.Cause
 }
 
+// ValidationError lists every problem ValidateWAL found in a WAL
+type ValidationError struct {
+	Path   string  // WAL path
+	Issues []Issue // Problems in file order
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Issues) == 1 {
+		return fmt.Sprintf("wal: %s is invalid: %s", e.Path, e.Issues[0].Detail)
+	}
+	return fmt.Sprintf("wal: %s is invalid: %d issues, first: %s", e.Path, len(e.Issues), e.Issues[0].Detail)
+}
+
 // TODO: Advanced error handling considerations
 //
 // 1. Error recovery mechanism:
@@ -0,0 +1,222 @@
+package wal
+
+// ============================================================================
+// Adaptive Group Commit
+// Responsibility: Size fsync groups to meet a p99 Append latency target
+// ============================================================================
+//
+// The fixed policy (batchWriter) flushes after BufferSize events or on the
+// FlushInterval ticker, so a lone Append waits for the ticker and a burst
+// is cut into BufferSize groups no matter how fast the disk is.
+//
+// With Options.LatencyTarget set, the adaptive writer instead:
+//   - Flushes as soon as no further request is expected in time (the
+//     pipeline is idle), so light load costs one fsync and no waiting
+//   - Otherwise keeps collecting for at most a wait budget:
+//
+//       budget = factor * (target - 2 * fsync time)
+//
+//     A request that arrives during an fsync waits for it and then for its
+//     own group's fsync, hence the 2x. The group is also capped at the
+//     number of requests expected within the budget (budget / arrival gap)
+//   - Measures fsync time and the gap between submissions as moving averages, and the p99
+//     of recent Append latencies; factor is halved while the p99 misses
+//     the target and grows back slowly while it is well below
+//
+// Group sizes, fsync times and Append latencies go to Options.Metrics in
+// both modes.
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	maxGroupEvents = 4096 // Upper bound on events per fsync group
+	latencyWindow  = 1024 // Recent Append latencies kept for the p99 estimate
+	adjustEvery    = 256  // Latencies between two factor adjustments
+	ewmaWeight     = 0.2  // Weight of a new sample in the moving averages
+	minFactor      = 0.05 // Lower bound on the share of the budget in use
+)
+
+// Metrics observes the group commit of the WAL writer
+// metrics.Collector implements it and exports the observations as
+// Prometheus histograms.
+type Metrics interface {
+	ObserveWALGroup(events int, syncTime time.Duration) // After each synced fsync group
+	ObserveWALAppend(latency time.Duration)             // For each append request in the group
+}
+
+// groupCommit holds the adaptive writer's estimates
+// Only the batch writer goroutine uses it, except for the p99 read by
+// GroupCommit.
+type groupCommit struct {
+	target      time.Duration   // p99 Append latency to aim for
+	syncTime    time.Duration   // Moving average of the write + sync time of a group
+	gap         time.Duration   // Moving average of the time between requests
+	lastArrival time.Time       // When the previous request arrived
+	factor      float64         // Share of the wait budget in use, in [minFactor, 1]
+	window      []time.Duration // Ring of recent Append latencies
+	next        int             // Next slot in window once it is full
+	seen        int             // Latencies since the last adjustment
+	p99         atomic.Int64    // Last p99 estimate in nanoseconds
+}
+
+// newGroupCommit returns estimates for a latency target
+func newGroupCommit(target time.Duration) *groupCommit {
+	return &groupCommit{target: target, factor: 0.5, window: make([]time.Duration, 0, latencyWindow)}
+}
+
+// ewma mixes a new sample into a moving average
+func ewma(avg, sample time.Duration) time.Duration {
+	if avg == 0 {
+		return sample
+	}
+	return avg + time.Duration(ewmaWeight*float64(sample-avg))
+}
+
+// arrived records a request submitted at queued
+// Submission times are used rather than receive times, which bunch up
+// while the writer is busy syncing.
+func (g *groupCommit) arrived(queued time.Time) {
+	if !queued.After(g.lastArrival) {
+		g.gap = ewma(g.gap, 0) // Submitted concurrently with the previous one
+		return
+	}
+	if !g.lastArrival.IsZero() {
+		// Cap idle periods so one pause does not hide the next burst for long
+		g.gap = ewma(g.gap, min(queued.Sub(g.lastArrival), 10*g.target))
+	}
+	g.lastArrival = queued
+}
+
+// budget returns how long the oldest request of a group may wait before
+// the group is flushed
+func (g *groupCommit) budget() time.Duration {
+	b := time.Duration(g.factor * float64(g.target-2*g.syncTime))
+	return max(b, 0)
+}
+
+// limit returns the number of events to collect at most
+func (g *groupCommit) limit() int {
+	if g.gap <= 0 {
+		return maxGroupEvents
+	}
+	return min(int(g.budget()/g.gap)+1, maxGroupEvents)
+}
+
+// linger returns how long to wait for one more request once the channel is
+// empty, or 0 to flush now because none is expected within the budget
+//
+// Parameters:
+//   - waited: How long the oldest request of the group has waited
+func (g *groupCommit) linger(waited time.Duration) time.Duration {
+	remaining := g.budget() - waited
+	if g.gap <= 0 || g.gap > remaining {
+		return 0
+	}
+	return min(remaining, 2*g.gap)
+}
+
+// flushed records the write + sync time of a group
+func (g *groupCommit) flushed(syncTime time.Duration) {
+	g.syncTime = ewma(g.syncTime, syncTime)
+}
+
+// observe records one Append latency and adjusts the budget share every
+// adjustEvery latencies
+func (g *groupCommit) observe(latency time.Duration) {
+	if len(g.window) < latencyWindow {
+		g.window = append(g.window, latency)
+	} else {
+		g.window[g.next] = latency
+		g.next = (g.next + 1) % latencyWindow
+	}
+	if g.seen++; g.seen < adjustEvery {
+		return
+	}
+	g.seen = 0
+
+	sorted := append([]time.Duration(nil), g.window...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	p99 := sorted[len(sorted)*99/100]
+	g.p99.Store(int64(p99))
+
+	switch {
+	case p99 > g.target:
+		g.factor = max(g.factor/2, minFactor)
+	case p99 < g.target*8/10:
+		g.factor = min(g.factor+0.1, 1)
+	}
+}
+
+// GroupCommit describes the batching policy for status output
+func (w *WAL) GroupCommit() string {
+	if w.commit == nil {
+		return fmt.Sprintf("fixed (%d events or %s)", w.bufferSize, w.flushInterval)
+	}
+	if p99 := w.commit.p99.Load(); p99 > 0 {
+		return fmt.Sprintf("adaptive (p99 target %s, observed %s)", w.commit.target, time.Duration(p99))
+	}
+	return fmt.Sprintf("adaptive (p99 target %s)", w.commit.target)
+}
+
+// ============================================================================
+// Adaptive Batch Writer
+// ============================================================================
+
+// adaptiveBatchWriter replaces batchWriter's loop when a latency target is
+// set; control requests and shutdown are handled the same way
+func (w *WAL) adaptiveBatchWriter() {
+	g := w.commit
+	batch := make([]batchRequest, 0, w.bufferSize)
+	pending := 0 // Events in batch
+	add := func(req batchRequest) {
+		g.arrived(req.queued)
+		batch = append(batch, req)
+		pending += len(req.events)
+	}
+
+	for {
+		// Wait for the first request of a group
+		select {
+		case req := <-w.batchChan:
+			add(req)
+		case req := <-w.controlChan:
+			w.runControl(req)
+			continue
+		case <-w.closed:
+			w.drainAndFlush(batch)
+			return
+		}
+
+		// Collect more while the budget allows
+		limit := g.limit()
+	collect:
+		for pending < limit {
+			select {
+			case req := <-w.batchChan:
+				add(req)
+				continue
+			default:
+			}
+			wait := g.linger(time.Since(batch[0].queued))
+			if wait <= 0 {
+				break collect // Idle: nothing expected in time
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case req := <-w.batchChan:
+				timer.Stop()
+				add(req)
+			case <-timer.C:
+				break collect
+			}
+		}
+
+		w.flushBatch(batch)
+		batch, pending = batch[:0], 0
+	}
+}
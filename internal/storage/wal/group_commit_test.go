@@ -0,0 +1,153 @@
+package wal
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================================================
+// Adaptive Group Commit Tests
+// ============================================================================
+
+func TestGroupCommitEstimates(t *testing.T) {
+	g := newGroupCommit(10 * time.Millisecond)
+
+	// Nothing observed yet: flush at once
+	assert.Equal(t, maxGroupEvents, g.limit())
+	assert.Zero(t, g.linger(0))
+
+	// A request every 100µs and 1ms syncs: wait up to 0.5 * (10ms - 2ms)
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		g.arrived(start.Add(time.Duration(i) * 100 * time.Microsecond))
+	}
+	g.flushed(time.Millisecond)
+	assert.Equal(t, 4*time.Millisecond, g.budget())
+	assert.InDelta(t, 41, g.limit(), 1)
+	assert.Equal(t, 200*time.Microsecond, g.linger(0))
+	assert.Zero(t, g.linger(3950*time.Microsecond), "next request not expected within the budget")
+
+	// Syncs alone use up the target: no waiting at all
+	for i := 0; i < 50; i++ {
+		g.flushed(6 * time.Millisecond)
+	}
+	assert.Zero(t, g.budget())
+	assert.Equal(t, 1, g.limit())
+	assert.Zero(t, g.linger(0))
+}
+
+func TestGroupCommitFeedback(t *testing.T) {
+	g := newGroupCommit(10 * time.Millisecond)
+
+	// p99 above the target halves the budget share
+	for i := 0; i < adjustEvery; i++ {
+		g.observe(20 * time.Millisecond)
+	}
+	assert.Equal(t, 0.25, g.factor)
+	assert.Equal(t, int64(20*time.Millisecond), g.p99.Load())
+
+	// While slow samples remain in the window the share keeps shrinking;
+	// once they are gone it grows back by 0.1 per adjustment
+	for i := 0; i < 8*adjustEvery; i++ {
+		g.observe(time.Millisecond)
+	}
+	assert.Equal(t, int64(time.Millisecond), g.p99.Load())
+	assert.InDelta(t, minFactor+5*0.1, g.factor, 0.001)
+}
+
+func TestAdaptiveFlushesWhenIdle(t *testing.T) {
+	// The fixed ticker would hold a lone append for a second
+	w := openMemWAL(t, vfs.NewMemFS(), Options{FlushInterval: time.Second, LatencyTarget: 5 * time.Millisecond})
+	defer w.Close()
+	assert.Contains(t, w.GroupCommit(), "adaptive (p99 target 5ms")
+
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		require.NoError(t, appendJob(w, fmt.Sprintf("job_%d", i)))
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+	}
+	require.NoError(t, w.Rotate())
+	require.NoError(t, appendJob(w, "after_rotate"))
+	assert.Equal(t, uint64(4), w.GetLastSeq())
+}
+
+// countingMetrics counts the observations of the WAL writer
+type countingMetrics struct {
+	groups  atomic.Uint64
+	appends atomic.Uint64
+}
+
+func (m *countingMetrics) ObserveWALGroup(events int, syncTime time.Duration) { m.groups.Add(1) }
+func (m *countingMetrics) ObserveWALAppend(latency time.Duration)             { m.appends.Add(1) }
+
+func TestAdaptiveConcurrentAppends(t *testing.T) {
+	metrics := &countingMetrics{}
+	fsys := vfs.NewMemFS()
+	w := openMemWAL(t, fsys, Options{LatencyTarget: 20 * time.Millisecond, Metrics: metrics})
+	defer w.Close()
+
+	const writers, perWriter = 8, 100
+	var wg sync.WaitGroup
+	for g := 0; g < writers; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				assert.NoError(t, appendJob(w, fmt.Sprintf("job_%d_%d", g, i)))
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	assert.Len(t, replayedJobs(t, w), writers*perWriter)
+	assert.Contains(t, w.GroupCommit(), "observed")
+
+	groups := metrics.groups.Load()
+	assert.Positive(t, groups)
+	assert.LessOrEqual(t, groups, uint64(writers*perWriter))
+	assert.Equal(t, uint64(writers*perWriter), metrics.appends.Load())
+
+	// Still durable: every acknowledged event survives a crash
+	crashed := openMemWAL(t, fsys.Crash(), Options{})
+	defer crashed.Close()
+	assert.Len(t, replayedJobs(t, crashed), writers*perWriter)
+}
+
+// BenchmarkGroupCommit compares fixed and adaptive batching under
+// concurrent appends on the real disk
+func BenchmarkGroupCommit(b *testing.B) {
+	for _, tc := range []struct {
+		name string
+		opts Options
+	}{
+		{"fixed", Options{BufferSize: 100, FlushInterval: 10 * time.Millisecond}},
+		{"adaptive", Options{LatencyTarget: 10 * time.Millisecond}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			w, err := NewWALWithOptions(filepath.Join(b.TempDir(), "bench.wal"), tc.opts)
+			if err != nil {
+				b.Fatalf("Failed to create WAL: %v", err)
+			}
+			defer w.Close()
+
+			b.SetParallelism(16)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					if err := appendJob(w, fmt.Sprintf("job_%d", i)); err != nil {
+						b.Errorf("Failed to append event: %v", err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package wal
+
+// ============================================================================
+// Sparse Segment Index
+// Responsibility: Map sequence numbers to byte offsets so reads can start
+// in the middle of a segment
+// ============================================================================
+//
+// Layout (next to each segment, see segment.go):
+//   data/beaver-raft.wal.00000000000000000001       sealed segment
+//   data/beaver-raft.wal.00000000000000000001.idx   its index
+//   data/beaver-raft.wal.idx                        active segment index (written on Close)
+//
+// An index lists the offset of the first record and then of one record
+// every indexInterval bytes, plus the segment's last seq, record count and
+// the number of bytes it covers. Seqs increase within a segment, so every
+// record before an entry with Seq <= afterSeq+1 is already covered and
+// ReplayFrom can start reading at that entry. The totals let NewWAL resume
+// numbering without decoding a sealed segment, and only decode the active
+// segment from where its index ends.
+//
+// Indexes are hints, never the source of truth:
+//   - The active segment's index is kept in memory while appending and
+//     saved when the segment is sealed or the WAL is closed
+//   - An index is stale if the segment is shorter than the bytes it
+//     covers (sealed: not exactly as long), or if the record at its last
+//     entry does not decode to the expected seq; stale or missing indexes
+//     of sealed segments are rebuilt by the next read that needs one
+//   - Rewriting a segment (compaction, truncate, convert, repair) deletes
+//     its index first
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+)
+
+// indexSuffix is appended to a segment path to name its index
+const indexSuffix = ".idx"
+
+// indexInterval is the number of bytes between index entries
+const indexInterval = 64 * 1024
+
+// indexVersion is the current index file format
+const indexVersion = 1
+
+// indexEntry locates one record
+type indexEntry struct {
+	Seq    uint64 `json:"seq"`    // Sequence number of the record
+	Offset int64  `json:"offset"` // Byte offset of the record in the segment
+}
+
+// segmentIndex is the sparse index of one segment
+type segmentIndex struct {
+	Version  int          `json:"version"`
+	Encoding Encoding     `json:"encoding"` // Record format of the segment
+	Size     int64        `json:"size"`     // Bytes covered (end of the last indexed record)
+	Count    int          `json:"count"`    // Records covered
+	Last     uint64       `json:"last"`     // Seq of the last record covered
+	Entries  []indexEntry `json:"entries"`  // Sparse entries, first record first
+}
+
+// newSegmentIndex returns an empty index for a segment in encoding
+func newSegmentIndex(encoding Encoding) *segmentIndex {
+	return &segmentIndex{Version: indexVersion, Encoding: encoding}
+}
+
+// indexPath returns the index path of a segment
+func indexPath(segmentPath string) string {
+	return segmentPath + indexSuffix
+}
+
+// add records a record with seq stored at [offset, end)
+func (ix *segmentIndex) add(seq uint64, offset, end int64) {
+	if n := len(ix.Entries); n == 0 || offset-ix.Entries[n-1].Offset >= indexInterval {
+		ix.Entries = append(ix.Entries, indexEntry{Seq: seq, Offset: offset})
+	}
+	ix.Count++
+	ix.Last = seq
+	ix.Size = end
+}
+
+// first returns the seq of the first record (0 if empty)
+func (ix *segmentIndex) first() uint64 {
+	if ix == nil || len(ix.Entries) == 0 {
+		return 0
+	}
+	return ix.Entries[0].Seq
+}
+
+// seek returns the offset of the last entry whose record can be read
+// first when looking for events after afterSeq
+//
+// Returns:
+//   - int64: Offset to start decoding at
+//   - bool: false if reading must start at the beginning of the segment
+func (ix *segmentIndex) seek(afterSeq uint64) (int64, bool) {
+	if ix == nil {
+		return 0, false
+	}
+	offset, ok := int64(0), false
+	for _, e := range ix.Entries {
+		if e.Seq > afterSeq+1 {
+			break
+		}
+		offset, ok = e.Offset, true
+	}
+	return offset, ok
+}
+
+// clone returns a copy that later adds to ix do not change
+func (ix *segmentIndex) clone() *segmentIndex {
+	c := *ix
+	c.Entries = append([]indexEntry(nil), ix.Entries...)
+	return &c
+}
+
+// setIndexLocked installs the index of a freshly opened active segment;
+// caller must hold w.mu
+func (w *WAL) setIndexLocked(index *segmentIndex) {
+	if index.Encoding == "" {
+		index.Encoding = w.encoding // Empty segment: appends use the configured format
+	}
+	w.index = index
+}
+
+// ============================================================================
+// Reading and Writing Index Files
+// ============================================================================
+
+// decoderFrom returns a decoder reading src from offset, a record boundary
+// inside a segment in encoding
+func decoderFrom(src io.ReaderAt, encoding Encoding, offset int64) recordDecoder {
+	return decoderBetween(src, encoding, offset, 1<<62)
+}
+
+// decoderBetween returns a decoder reading the records in [start, end) of
+// src; both must be record boundaries
+func decoderBetween(src io.ReaderAt, encoding Encoding, start, end int64) recordDecoder {
+	r := bufio.NewReaderSize(io.NewSectionReader(src, start, end-start), 64*1024)
+	if encoding == EncodingBinary {
+		return &binaryDecoder{r: r, offset: start}
+	}
+	return &jsonDecoder{r: r, offset: start}
+}
+
+// readIndex loads the index of the segment at path and checks it against
+// the segment
+//
+// Parameters:
+//   - sealed: the segment no longer grows, so its size must match exactly
+//
+// Returns nil if the index is missing, unreadable or stale.
+func readIndex(fsys vfs.FS, path string, sealed bool) *segmentIndex {
+	data, err := vfs.ReadFile(fsys, indexPath(path))
+	if err != nil {
+		return nil
+	}
+	var ix segmentIndex
+	if err := json.Unmarshal(data, &ix); err != nil || ix.Version != indexVersion || len(ix.Entries) == 0 {
+		return nil
+	}
+
+	file, err := vfs.Open(fsys, path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.Size() < ix.Size || (sealed && info.Size() != ix.Size) {
+		return nil
+	}
+
+	last := ix.Entries[len(ix.Entries)-1]
+	var event Event
+	if err := decoderFrom(file, ix.Encoding, last.Offset).Decode(&event); err != nil || event.Seq != last.Seq {
+		return nil
+	}
+	return &ix
+}
+
+// writeIndex saves ix as the index of the segment at path
+func writeIndex(fsys vfs.FS, path string, ix *segmentIndex) error {
+	data, err := json.Marshal(ix)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(fsys, indexPath(path), data); err != nil {
+		return fmt.Errorf("failed to write WAL index: %w", err)
+	}
+	return nil
+}
+
+// removeIndex deletes the index of a segment that is about to change
+func removeIndex(fsys vfs.FS, path string) error {
+	if err := fsys.Remove(indexPath(path)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete WAL index: %w", err)
+	}
+	return nil
+}
+
+// sealedIndex returns the index of a sealed segment, rebuilding and saving
+// it if it is missing or stale
+//
+// Returns nil (no error) if the segment cannot be indexed, e.g. because it
+// is damaged; callers then read it from the beginning and report the
+// damage themselves.
+func sealedIndex(fsys vfs.FS, path string) *segmentIndex {
+	if ix := readIndex(fsys, path, true); ix != nil {
+		return ix
+	}
+	scan, ix, err := scanSegmentFrom(fsys, path, nil)
+	if err != nil || scan.Torn || scan.Count == 0 || scan.ValidSize != scan.Size {
+		return nil
+	}
+	if err := writeIndex(fsys, path, ix); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	return ix
+}
+
+// ============================================================================
+// Indexed Scans
+// ============================================================================
+
+// scanSegmentFrom scans a segment file like scanSegment, building its index
+//
+// If from is a valid index of the file, only the records after it are
+// decoded and the scan's totals continue from the index.
+//
+// Returns:
+//   - segmentScan: Everything readable up to the first bad record
+//   - *segmentIndex: Index covering the readable part
+//   - error: *CorruptionError for mid-file corruption, or an I/O error
+func scanSegmentFrom(fsys vfs.FS, path string, from *segmentIndex) (segmentScan, *segmentIndex, error) {
+	var scan segmentScan
+
+	file, err := vfs.Open(fsys, path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return scan, newSegmentIndex(""), nil
+		}
+		return scan, nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return scan, nil, err
+	}
+	scan.Size = info.Size()
+
+	var decoder recordDecoder
+	var ix *segmentIndex
+	if from != nil {
+		ix = from.clone()
+		decoder = decoderFrom(file, ix.Encoding, ix.Size)
+		scan.Encoding = ix.Encoding
+		scan.First, scan.Last, scan.Count = ix.first(), ix.Last, ix.Count
+	} else {
+		decoder, scan.Encoding, err = newRecordDecoder(file)
+		ix = newSegmentIndex(scan.Encoding)
+		if err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				scan.Torn = true // Cut off inside the file header
+				return scan, ix, nil
+			}
+			return scan, nil, err
+		}
+	}
+
+	for {
+		offset := decoder.Offset()
+		var event Event
+		err := decoder.Decode(&event)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			scan.ValidSize = decoder.Offset()
+			scan.Torn, err = classifyDecodeError(file, path, err)
+			return scan, ix, err
+		}
+		if scan.Count == 0 {
+			scan.First = event.Seq
+		}
+		scan.Last = event.Seq
+		scan.Count++
+		ix.add(event.Seq, offset, decoder.Offset())
+	}
+	scan.ValidSize = decoder.Offset()
+	if scan.Encoding == EncodingJSON && scan.ValidSize < scan.Size {
+		scan.ValidSize = scan.Size // Trailing whitespace after the last line
+		if ix.Count > 0 {
+			ix.Size = scan.Size
+		}
+	}
+	return scan, ix, nil
+}
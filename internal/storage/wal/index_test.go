@@ -0,0 +1,170 @@
+package wal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================================================
+// Sparse Index Tests
+// ============================================================================
+
+// writeIndexedWAL writes 2*perSegment ~1 KiB events split over a sealed and
+// the active segment, so both get several index entries
+func writeIndexedWAL(t *testing.T, encoding Encoding, perSegment int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.wal")
+	w, err := NewWALWithOptions(path, Options{BufferSize: 50, FlushInterval: time.Millisecond, Encoding: encoding})
+	require.NoError(t, err)
+	padding := strings.Repeat("x", 1024)
+	for i := 1; i <= 2*perSegment; i++ {
+		job := &types.Job{ID: types.JobID(fmt.Sprintf("job_%d", i)), Payload: map[string]interface{}{"padding": padding}}
+		require.NoError(t, w.Append(EventEnqueue, job))
+		if i == perSegment {
+			require.NoError(t, w.Rotate())
+		}
+	}
+	require.NoError(t, w.Close())
+	return path
+}
+
+func seqRange(from, to uint64) []uint64 {
+	var seqs []uint64
+	for seq := from; seq <= to; seq++ {
+		seqs = append(seqs, seq)
+	}
+	return seqs
+}
+
+func TestIndexReplayFrom(t *testing.T) {
+	for _, encoding := range []Encoding{EncodingJSON, EncodingBinary} {
+		t.Run(string(encoding), func(t *testing.T) {
+			path := writeIndexedWAL(t, encoding, 300)
+			segments, err := listSealedSegments(vfs.OS, path)
+			require.NoError(t, err)
+			require.Len(t, segments, 1)
+			for _, seg := range []string{segments[0].Path, path} {
+				ix := readIndex(vfs.OS, seg, seg != path)
+				require.NotNil(t, ix, "missing index for %s", seg)
+				assert.Greater(t, len(ix.Entries), 1)
+				assert.Equal(t, 300, ix.Count)
+			}
+
+			w, err := NewWALWithOptions(path, Options{FlushInterval: time.Millisecond})
+			require.NoError(t, err)
+			defer w.Close()
+			assert.Equal(t, uint64(600), w.GetLastSeq())
+			for _, after := range []uint64{0, 1, 63, 150, 299, 300, 301, 450, 599} {
+				assert.Equal(t, seqRange(after+1, 600), collectSeqs(t, w, after), "after %d", after)
+			}
+			assert.Empty(t, collectSeqs(t, w, 600))
+
+			last, err := GetLastEvent(path)
+			require.NoError(t, err)
+			assert.Equal(t, uint64(600), last.Seq)
+
+			var walked []uint64
+			require.NoError(t, WalkWALFrom(path, 250, func(rec *Record, issue *Issue) error {
+				require.Nil(t, issue)
+				walked = append(walked, rec.Event.Seq)
+				return nil
+			}))
+			assert.Equal(t, seqRange(251, 600), walked)
+		})
+	}
+}
+
+func TestIndexSkipsDamagedPrefix(t *testing.T) {
+	path := writeIndexedWAL(t, EncodingBinary, 300)
+	segments, err := listSealedSegments(vfs.OS, path)
+	require.NoError(t, err)
+	sealed := segments[0].Path
+
+	// Damage the first records; the size and the last indexed record are intact
+	data, err := os.ReadFile(sealed)
+	require.NoError(t, err)
+	copy(data[fileHeaderSize+10:], "XXXXXXXX")
+	require.NoError(t, os.WriteFile(sealed, data, 0644))
+
+	w, err := NewWALWithOptions(path, Options{FlushInterval: time.Millisecond})
+	require.NoError(t, err)
+	defer w.Close()
+	assert.Equal(t, seqRange(281, 600), collectSeqs(t, w, 280))
+	assert.Error(t, w.Replay(func(*Event) error { return nil }))
+}
+
+func TestStaleIndexIsRebuilt(t *testing.T) {
+	path := writeIndexedWAL(t, EncodingJSON, 300)
+	segments, err := listSealedSegments(vfs.OS, path)
+	require.NoError(t, err)
+	sealed := segments[0].Path
+
+	// Sealed segment: garbage index, then an index pointing at the wrong seq
+	require.NoError(t, os.WriteFile(indexPath(sealed), []byte("not json"), 0644))
+	assert.Nil(t, readIndex(vfs.OS, sealed, true))
+	w, err := NewWALWithOptions(path, Options{FlushInterval: time.Millisecond})
+	require.NoError(t, err)
+	assert.Equal(t, seqRange(201, 600), collectSeqs(t, w, 200))
+	require.NoError(t, w.Close())
+	rebuilt := readIndex(vfs.OS, sealed, true)
+	require.NotNil(t, rebuilt)
+	assert.Equal(t, uint64(300), rebuilt.Last)
+
+	wrong := rebuilt.clone()
+	wrong.Entries[len(wrong.Entries)-1].Seq++
+	require.NoError(t, writeIndex(vfs.OS, sealed, wrong))
+	assert.Nil(t, readIndex(vfs.OS, sealed, true))
+
+	// Active segment: shorter than its index says
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()/2))
+
+	w, err = NewWALWithOptions(path, Options{FlushInterval: time.Millisecond})
+	require.NoError(t, err)
+	defer w.Close()
+	var last uint64
+	require.NoError(t, w.Replay(func(e *Event) error {
+		require.Equal(t, last+1, e.Seq)
+		last = e.Seq
+		return nil
+	}))
+	assert.Greater(t, last, uint64(300))
+	assert.Less(t, last, uint64(600))
+	assert.Equal(t, last, w.GetLastSeq())
+	assert.Equal(t, seqRange(101, last), collectSeqs(t, w, 100))
+
+	// Numbering continues after the surviving events
+	require.NoError(t, appendJob(w, "after_truncate"))
+	assert.Equal(t, last+1, w.GetLastSeq())
+}
+
+func TestIndexFollowsRollback(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	w := openMemWAL(t, fsys, Options{BufferSize: 1})
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, appendJob(w, fmt.Sprintf("job_%d", i)))
+	}
+	fsys.Inject(vfs.Fault{Op: vfs.OpWrite, Path: crashWALPath, Times: 1, Partial: true})
+	assert.Error(t, appendJob(w, "job_torn"))
+	require.NoError(t, appendJob(w, "job_4"))
+	require.NoError(t, w.Close())
+
+	data, err := vfs.ReadFile(fsys, indexPath(crashWALPath))
+	require.NoError(t, err)
+	var ix segmentIndex
+	require.NoError(t, json.Unmarshal(data, &ix))
+	assert.Equal(t, 4, ix.Count)
+	assert.Equal(t, uint64(4), ix.Last)
+	assert.NotNil(t, readIndex(fsys, crashWALPath, false))
+}
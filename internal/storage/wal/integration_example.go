@@ -192,24 +192,21 @@ func (c *Controller) LoadFromSnapshot() error {
 
 // EnqueueBatch adds tasks in batch
 func (c *Controller) EnqueueBatch(jobs []Job) error {
-    // Use batch writer to improve performance
-    bw := NewBatchWriter(c.wal, 100, 10*time.Millisecond)
-    defer bw.Close()
+    // One request to the batch writer, one fsync for the whole batch
+    entries := make([]BatchEntry, len(jobs))
+    for i := range jobs {
+        entries[i] = BatchEntry{Type: EventEnqueue, Job: &jobs[i]}
+    }
+    if err := c.wal.AppendBatch(entries); err != nil {
+        return err
+    }
 
     for _, job := range jobs {
-        err := bw.Append(EventEnqueue, job.ID)
-        if err != nil {
-            return err
-        }
-
-        err = c.jobManager.Enqueue(job)
-        if err != nil {
+        if err := c.jobManager.Enqueue(job); err != nil {
             return err
         }
     }
-
-    // Ensure all events are written
-    return bw.Flush()
+    return nil
 }
 
 // ============================================================================
@@ -225,7 +222,7 @@ func (c *Controller) RecoverFromCorruption(walPath string) error {
 
         // 2. Attempt repair
         repairedPath := walPath + ".repaired"
-        err = RepairWAL(walPath, repairedPath)
+        _, err = RepairWAL(walPath, repairedPath)
         if err != nil {
             // 3. Repair failed, degrade to using Snapshot only
             log.Println("WAL repair failed, loading from snapshot only")
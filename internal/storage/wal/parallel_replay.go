@@ -0,0 +1,227 @@
+package wal
+
+// ============================================================================
+// Parallel Replay
+// Responsibility: Decode and verify WAL records on several goroutines while
+// still handing events to the caller one by one, in seq order
+// ============================================================================
+//
+// Recovery of a large WAL is dominated by decoding and checksumming, which
+// ReplayFrom does on the caller's goroutine. ReplayParallel splits the
+// segments into chunks at sparse index entries (see index.go):
+//
+//   - A feeder hands chunk numbers to the workers, at most 2 * workers
+//     ahead of the merger, which bounds the decoded events held in memory
+//   - Workers decode, verify and decrypt one chunk at a time
+//   - The merger waits for the chunks in order and calls the handler
+//
+// Archived segments and segments without a usable index are single chunks.
+// Errors surface at the same point as with ReplayFrom: the handler sees
+// every event before the first bad record.
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+)
+
+// replayChunkEntries is the number of index entries per chunk (~1MB)
+const replayChunkEntries = 1024 * 1024 / indexInterval
+
+// replayChunk is a range of records decoded by one worker
+type replayChunk struct {
+	read func(emit func(event *Event) error) error // Decodes the records in order
+}
+
+// chunkResult holds the decoded events of one chunk
+type chunkResult struct {
+	events []Event
+	err    error // Decode error after the events
+}
+
+// ReplayParallel replays events after afterSeq like ReplayFrom, decoding
+// on several goroutines
+//
+// The handler is called sequentially, in seq order, on the caller's
+// goroutine. Appends wait until the replay is done, as with ReplayFrom.
+//
+// Parameters:
+//   - afterSeq: Last sequence number already covered (e.g. snapshot LastSeq)
+//   - workers: Decoding goroutines; 1 or less replays sequentially
+//   - handler: Event handler function; may return ErrStopReplay to stop early
+//
+// Returns:
+//   - error: First decode or handler error
+func (w *WAL) ReplayParallel(afterSeq uint64, workers int, handler func(event *Event) error) error {
+	if workers <= 1 {
+		return w.ReplayFrom(afterSeq, handler)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	chunks, err := w.planReplayLocked(afterSeq)
+	if err != nil {
+		return err
+	}
+	err = w.runReplayChunks(chunks, workers, handler)
+	if errors.Is(err, ErrStopReplay) {
+		return nil
+	}
+	return err
+}
+
+// planReplayLocked splits the events after afterSeq into chunks, in the
+// order replayFromLocked reads them; caller must hold w.mu
+func (w *WAL) planReplayLocked(afterSeq uint64) ([]replayChunk, error) {
+	sealed, err := listSealedSegments(w.fs, w.path)
+	if err != nil {
+		return nil, err
+	}
+
+	firstLocal := w.segmentStart
+	if len(sealed) > 0 {
+		firstLocal = sealed[0].StartSeq
+	}
+	archived, err := w.archivedBefore(afterSeq, firstLocal)
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks []replayChunk
+	for _, entry := range archived {
+		path := filepath.Join(w.archive.Dir, entry.File)
+		chunks = append(chunks, replayChunk{read: func(emit func(event *Event) error) error {
+			src, err := readArchived(w.fs, path)
+			if err != nil {
+				return err
+			}
+			return replayRecords(src, path, afterSeq, false, emit)
+		}})
+	}
+
+	for i, seg := range sealed {
+		nextStart := w.segmentStart
+		if i+1 < len(sealed) {
+			nextStart = sealed[i+1].StartSeq
+		}
+		if nextStart > 0 && nextStart-1 <= afterSeq {
+			continue // Fully covered
+		}
+		// Rebuild a missing index only where replayFromLocked would too
+		index := readIndex(w.fs, seg.Path, true)
+		if index == nil && seg.StartSeq <= afterSeq {
+			index = sealedIndex(w.fs, seg.Path)
+		}
+		chunks = append(chunks, segmentChunks(w.fs, seg.Path, afterSeq, false, index)...)
+	}
+	return append(chunks, segmentChunks(w.fs, w.path, afterSeq, true, w.index)...), nil
+}
+
+// segmentChunks splits one segment at its index entries
+// Without an index the segment is one chunk read from its header.
+func segmentChunks(fsys vfs.FS, path string, afterSeq uint64, active bool, index *segmentIndex) []replayChunk {
+	if index == nil || len(index.Entries) == 0 {
+		return []replayChunk{{read: func(emit func(event *Event) error) error {
+			return replaySegment(fsys, path, afterSeq, active, nil, emit)
+		}}}
+	}
+
+	// Skip the entries before the one seek would start at
+	entries := index.Entries
+	if offset, ok := index.seek(afterSeq); ok {
+		for len(entries) > 1 && entries[0].Offset < offset {
+			entries = entries[1:]
+		}
+	}
+
+	var chunks []replayChunk
+	for len(entries) > 0 {
+		start, end, last := entries[0].Offset, int64(1<<62), true
+		if len(entries) > replayChunkEntries {
+			end, last = entries[replayChunkEntries].Offset, false
+			entries = entries[replayChunkEntries:]
+		} else {
+			entries = nil
+		}
+		chunks = append(chunks, replayChunk{read: func(emit func(event *Event) error) error {
+			file, err := vfs.Open(fsys, path)
+			if err != nil {
+				return fmt.Errorf("failed to open WAL for replay: %w", err)
+			}
+			defer file.Close()
+			// Only the end of the active segment may hold a torn record
+			decoder := decoderBetween(file, index.Encoding, start, end)
+			return replayDecoded(decoder, file, path, afterSeq, active && last, emit)
+		}})
+	}
+	return chunks
+}
+
+// runReplayChunks decodes chunks on workers goroutines and hands their
+// events to handler in chunk order
+func (w *WAL) runReplayChunks(chunks []replayChunk, workers int, handler func(event *Event) error) error {
+	results := make([]chan chunkResult, len(chunks))
+	for i := range results {
+		results[i] = make(chan chunkResult, 1)
+	}
+	ahead := make(chan struct{}, 2*workers) // Chunks issued but not yet merged
+	next := make(chan int)
+	stop := make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(next)
+		for i := range chunks {
+			select {
+			case ahead <- struct{}{}:
+			case <-stop:
+				return
+			}
+			select {
+			case next <- i:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				var res chunkResult
+				res.err = chunks[i].read(func(event *Event) error {
+					if err := w.openEvent(event); err != nil {
+						return err
+					}
+					res.events = append(res.events, *event)
+					return nil
+				})
+				results[i] <- res
+			}
+		}()
+	}
+	// Workers never block on results, so they exit once stop is closed
+	defer wg.Wait()
+	defer close(stop)
+
+	for i := range chunks {
+		res := <-results[i]
+		<-ahead
+		for j := range res.events {
+			if err := handler(&res.events[j]); err != nil {
+				return err
+			}
+		}
+		if res.err != nil {
+			return res.err
+		}
+	}
+	return nil
+}
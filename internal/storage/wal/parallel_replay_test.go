@@ -0,0 +1,117 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================================================
+// Parallel Replay Tests
+// ============================================================================
+
+// fillSegments appends n events in batches, enough to span several chunks
+func fillSegments(t *testing.T, w *WAL, n int) {
+	t.Helper()
+	for i := 0; i < n; i += 1000 {
+		require.NoError(t, w.AppendBatch(batchEntries(fmt.Sprintf("job_%d_%s", i, strings.Repeat("x", 64)), 1000)))
+	}
+}
+
+// replayResult collects what a replay delivered
+func replayResult(replay func(handler func(event *Event) error) error) ([]uint64, error) {
+	var seqs []uint64
+	err := replay(func(e *Event) error {
+		seqs = append(seqs, e.Seq)
+		return nil
+	})
+	return seqs, err
+}
+
+func TestReplayParallelMatchesReplayFrom(t *testing.T) {
+	for _, encoding := range []Encoding{EncodingJSON, EncodingBinary} {
+		t.Run(string(encoding), func(t *testing.T) {
+			w := openMemWAL(t, vfs.NewMemFS(), Options{Encoding: encoding, MaxSegmentSize: 2 << 20})
+			defer w.Close()
+			fillSegments(t, w, 40000)
+
+			segments, err := w.Segments()
+			require.NoError(t, err)
+			require.Greater(t, len(segments), 1)
+
+			for _, afterSeq := range []uint64{0, 1, 12345, 39999, 40000} {
+				expected := collectSeqs(t, w, afterSeq)
+				for _, workers := range []int{1, 2, 8} {
+					seqs, err := replayResult(func(h func(*Event) error) error {
+						return w.ReplayParallel(afterSeq, workers, h)
+					})
+					require.NoError(t, err)
+					require.Equal(t, expected, seqs, "afterSeq %d, %d workers", afterSeq, workers)
+				}
+			}
+		})
+	}
+}
+
+func TestReplayParallelStopsEarly(t *testing.T) {
+	w := openMemWAL(t, vfs.NewMemFS(), Options{})
+	defer w.Close()
+	fillSegments(t, w, 20000)
+
+	var seqs []uint64
+	require.NoError(t, w.ReplayParallel(0, 4, func(e *Event) error {
+		if e.Seq > 100 {
+			return ErrStopReplay
+		}
+		seqs = append(seqs, e.Seq)
+		return nil
+	}))
+	assert.Len(t, seqs, 100)
+
+	failed := errors.New("apply failed")
+	count := 0
+	err := w.ReplayParallel(0, 4, func(e *Event) error {
+		if count++; count == 15000 {
+			return failed
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, failed)
+
+	// The WAL is usable afterwards
+	require.NoError(t, appendJob(w, "after"))
+	assert.Equal(t, uint64(20001), w.GetLastSeq())
+}
+
+// TestReplayParallelCorruption verifies a bad record ends the replay at the
+// same point as ReplayFrom
+func TestReplayParallelCorruption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+	w, err := NewWALWithOptions(path, Options{Encoding: EncodingBinary})
+	require.NoError(t, err)
+	defer w.Close()
+	fillSegments(t, w, 20000)
+	require.NoError(t, w.Rotate())
+	fillSegments(t, w, 5000)
+
+	// Flip a byte in the middle of the sealed segment
+	sealed := segmentName(path, 1)
+	data, err := os.ReadFile(sealed)
+	require.NoError(t, err)
+	data[len(data)/2] ^= 0xff
+	require.NoError(t, os.WriteFile(sealed, data, 0644))
+
+	expected, expectedErr := replayResult(func(h func(*Event) error) error { return w.ReplayFrom(0, h) })
+	require.Error(t, expectedErr)
+	seqs, err := replayResult(func(h func(*Event) error) error { return w.ReplayParallel(0, 4, h) })
+	require.Error(t, err)
+	assert.Equal(t, expected, seqs)
+	assert.Equal(t, expectedErr.Error(), err.Error())
+}
@@ -0,0 +1,541 @@
+package wal
+
+// ============================================================================
+// WAL Segments
+// Responsibility: Name, list, seal and prune the files that make up one WAL
+// ============================================================================
+//
+// Layout (for path "data/beaver-raft.wal"):
+//   data/beaver-raft.wal                        active segment (appends go here)
+//   data/beaver-raft.wal.00000000000000000001   sealed segment starting at seq 1
+//   data/beaver-raft.wal.00000000000000004097   sealed segment starting at seq 4097
+//
+// The active segment keeps the configured path so tools and deployments
+// that point at a single WAL file keep working. When it is sealed (size
+// limit reached or Rotate called) it is renamed after its first sequence
+// number. Sequence numbers never reset, so name order is replay order and
+// a sealed segment holds every seq below the next segment's start.
+//
+// Files with other suffixes (e.g. timestamped backups from older versions)
+// are ignored.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+)
+
+// segmentSeqDigits is the zero-padded width of the sequence number in
+// sealed segment names, wide enough for any uint64
+const segmentSeqDigits = 20
+
+// Segment describes one WAL segment file
+type Segment struct {
+	Path     string    // File path
+	StartSeq uint64    // First sequence number stored in the segment
+	Size     int64     // Size in bytes
+	ModTime  time.Time // Last modification (for sealed segments: roughly when sealed)
+	Active   bool      // True for the segment currently being appended to
+}
+
+// segmentName returns the sealed segment path for a starting sequence number
+func segmentName(path string, startSeq uint64) string {
+	return fmt.Sprintf("%s.%0*d", path, segmentSeqDigits, startSeq)
+}
+
+// listSealedSegments returns the sealed segments of the WAL at path,
+// ordered by starting sequence number
+func listSealedSegments(fsys vfs.FS, path string) ([]Segment, error) {
+	dir := filepath.Dir(path)
+	prefix := filepath.Base(path) + "."
+
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list WAL segments: %w", err)
+	}
+
+	var segments []Segment
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		suffix := name[len(prefix):]
+		if len(suffix) != segmentSeqDigits {
+			continue
+		}
+		startSeq, err := strconv.ParseUint(suffix, 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat WAL segment %s: %w", name, err)
+		}
+		segments = append(segments, Segment{
+			Path:     filepath.Join(dir, name),
+			StartSeq: startSeq,
+			Size:     info.Size(),
+			ModTime:  info.ModTime(),
+		})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].StartSeq < segments[j].StartSeq
+	})
+	return segments, nil
+}
+
+// segmentScan summarizes the readable part of a segment file
+type segmentScan struct {
+	First     uint64   // First sequence number (0 if Count == 0)
+	Last      uint64   // Last sequence number (0 if Count == 0)
+	Count     int      // Number of valid events
+	Encoding  Encoding // Detected record format ("" for an empty file)
+	ValidSize int64    // Bytes up to the end of the last valid event
+	Size      int64    // File size
+	Torn      bool     // File ends in an incomplete record after ValidSize
+}
+
+// scanSegment reads every event of a segment file
+//
+// A missing file scans as empty. A torn final record is reported through
+// Torn rather than as an error.
+//
+// Returns:
+//   - segmentScan: Everything readable up to the first bad record
+//   - error: *CorruptionError for mid-file corruption, or an I/O error
+func scanSegment(fsys vfs.FS, path string) (segmentScan, error) {
+	scan, _, err := scanSegmentFrom(fsys, path, nil)
+	return scan, err
+}
+
+// classifyDecodeError decides whether a decode failure is a torn tail
+//
+// A record cut off by the end of the file is torn. So is an unreadable
+// record followed only by zero bytes, which is what a crash leaves behind
+// when the file size was updated before the data reached the disk.
+// Anything else is mid-file corruption.
+//
+// Returns:
+//   - bool: true if the failure is a torn tail
+//   - error: nil for a torn tail, otherwise the error (with Path set for
+//     a *CorruptionError)
+func classifyDecodeError(file io.ReaderAt, path string, err error) (bool, error) {
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true, nil
+	}
+
+	var corruption *CorruptionError
+	if !errors.As(err, &corruption) {
+		return false, err
+	}
+	if zeroFrom(file, corruption.Offset) {
+		return true, nil
+	}
+	corruption.Path = path
+	return false, corruption
+}
+
+// zeroFrom reports whether every byte of file from offset on is zero
+func zeroFrom(file io.ReaderAt, offset int64) bool {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := file.ReadAt(buf, offset)
+		for _, b := range buf[:n] {
+			if b != 0 {
+				return false
+			}
+		}
+		offset += int64(n)
+		if err == io.EOF {
+			return true
+		}
+		if err != nil {
+			return false
+		}
+	}
+}
+
+// truncateTornTail cuts a torn final record off the active segment so new
+// appends do not land behind it
+//
+// Returns:
+//   - int64: Number of bytes removed
+//   - error: Truncation failure
+func truncateTornTail(fsys vfs.FS, path string, scan segmentScan) (int64, error) {
+	size := scan.ValidSize
+	if scan.Count == 0 {
+		size = 0 // Drop a lone binary header as well
+	}
+	if err := fsys.Truncate(path, size); err != nil {
+		return 0, fmt.Errorf("failed to truncate torn WAL tail: %w", err)
+	}
+	return scan.Size - size, nil
+}
+
+// recoverSeq finds where numbering continues for the WAL at path
+//
+// Only the part of the active segment after its saved index is decoded
+// (see index.go). A torn final record left by a crash is truncated from
+// the active segment first. Mid-file corruption does not prevent opening;
+// Replay reports it.
+//
+// Returns:
+//   - seq: Last sequence number in the newest non-empty segment, or the
+//     seq floor if that is higher
+//   - segmentStart: Starting sequence number of the active segment
+//   - index: Index of the active segment
+//   - error: I/O failure
+func recoverSeq(fsys vfs.FS, path string) (seq, segmentStart uint64, index *segmentIndex, err error) {
+	scan, index, err := scanSegmentFrom(fsys, path, readIndex(fsys, path, false))
+	if err != nil {
+		var corruption *CorruptionError
+		if !errors.As(err, &corruption) {
+			return 0, 0, nil, fmt.Errorf("failed to read WAL file: %w", err)
+		}
+		fmt.Printf("Warning: %v\n", err)
+	}
+	if scan.Torn {
+		dropped, err := truncateTornTail(fsys, path, scan)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		fmt.Printf("Warning: truncated torn record at end of WAL %s (offset %d, %d bytes dropped)\n",
+			path, scan.ValidSize, dropped)
+	}
+	floor, err := readFloor(fsys, path)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if scan.Count > 0 {
+		return max(scan.Last, floor), scan.First, index, nil
+	}
+
+	// Active segment is empty: continue after the newest sealed segment
+	sealed, err := listSealedSegments(fsys, path)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if len(sealed) > 0 {
+		newest := sealed[len(sealed)-1]
+		seq = newest.StartSeq - 1
+		if ix := sealedIndex(fsys, newest.Path); ix != nil {
+			seq = ix.Last
+		} else if newestScan, err := scanSegment(fsys, newest.Path); err != nil {
+			fmt.Printf("Warning: failed to read WAL segment %s: %v\n", newest.Path, err)
+		} else if newestScan.Count > 0 {
+			seq = newestScan.Last
+		}
+	}
+	seq = max(seq, floor) // Never below a recovered snapshot (see checkpoint.go)
+	return seq, seq + 1, newSegmentIndex(scan.Encoding), nil
+}
+
+// writeFileAtomic replaces the file at path with data through a synced
+// temporary file and a rename
+func writeFileAtomic(fsys vfs.FS, path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	file, err := fsys.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		fsys.Remove(tmpPath)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		fsys.Remove(tmpPath)
+		return err
+	}
+	file.Close()
+
+	if err := fsys.Rename(tmpPath, path); err != nil {
+		fsys.Remove(tmpPath)
+		return err
+	}
+	return fsys.SyncDir(filepath.Dir(path))
+}
+
+// countingWriter counts bytes written to the active segment
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// ============================================================================
+// WAL Segment Operations
+// ============================================================================
+
+// openActiveLocked opens (or creates) the active segment file
+// Caller must hold w.mu
+func (w *WAL) openActiveLocked() error {
+	_, statErr := w.fs.Stat(w.path)
+	file, err := w.fs.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open WAL file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat WAL file: %w", err)
+	}
+
+	// A new segment's directory entry must be durable before anything
+	// appended to it is acknowledged
+	if os.IsNotExist(statErr) {
+		if err := w.fs.SyncDir(filepath.Dir(w.path)); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to sync WAL directory: %w", err)
+		}
+	}
+
+	if f, ok := file.(*os.File); ok && w.preallocate > info.Size() {
+		if err := preallocate(f, w.preallocate); err != nil {
+			fmt.Printf("Warning: failed to preallocate WAL segment: %v\n", err)
+		}
+	}
+
+	w.file = file
+	w.segmentSize = info.Size()
+	w.encoder = newRecordEncoder(countingWriter{w: file, n: &w.segmentSize}, w.encoding, w.segmentSize == 0)
+	return nil
+}
+
+// releasePreallocatedLocked frees the reserved space past the end of the
+// active segment before it is sealed; caller must hold w.mu
+func (w *WAL) releasePreallocatedLocked() {
+	if f, ok := w.file.(interface{ Truncate(int64) error }); ok && w.preallocate > w.segmentSize {
+		if err := f.Truncate(w.segmentSize); err != nil {
+			fmt.Printf("Warning: failed to release preallocated WAL space: %v\n", err)
+		}
+	}
+}
+
+// sealActiveLocked renames the active segment after its starting sequence
+// number and opens a fresh active segment. Empty segments are left alone.
+// Caller must hold w.mu and guarantee no concurrent writes.
+func (w *WAL) sealActiveLocked() error {
+	if w.segmentSize == 0 {
+		return nil
+	}
+
+	if err := w.syncDirtyLocked(); err != nil {
+		return err
+	}
+	w.releasePreallocatedLocked()
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("failed to close WAL segment: %w", err)
+	}
+
+	sealed := segmentName(w.path, w.segmentStart)
+	if err := w.fs.Rename(w.path, sealed); err != nil {
+		// Keep appending to the current file rather than leaving the WAL unusable
+		if reopenErr := w.openActiveLocked(); reopenErr != nil {
+			return fmt.Errorf("failed to seal WAL segment: %v (reopen: %w)", err, reopenErr)
+		}
+		return fmt.Errorf("failed to seal WAL segment: %w", err)
+	}
+
+	// Hand the index over to the sealed segment; indexes are hints, so a
+	// failure to save one only costs a rebuild later
+	if len(w.index.Entries) > 0 && w.index.Size == w.segmentSize {
+		if err := writeIndex(w.fs, sealed, w.index); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+	if err := removeIndex(w.fs, w.path); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	w.index = newSegmentIndex(w.encoding)
+
+	if err := w.openActiveLocked(); err != nil {
+		return err
+	}
+	w.segmentStart = w.seq + 1
+
+	if err := w.fs.SyncDir(filepath.Dir(w.path)); err != nil {
+		return fmt.Errorf("failed to sync WAL directory: %w", err)
+	}
+	return nil
+}
+
+// TruncateAfter removes every event with a sequence number above seq
+//
+// Used by point-in-time recovery. The segments are rewritten inside the
+// batch writer (see TruncateWAL), so concurrent appends wait for it and
+// then continue after the last remaining event. If archivePath is set,
+// the removed events are first copied there as a JSON segment so they can
+// be inspected or replayed by hand.
+//
+// Returns:
+//   - int: Number of events removed
+//   - error: Archive or truncation failure (the WAL stays usable);
+//     ErrBelowFloor if seq is below the seq floor
+func (w *WAL) TruncateAfter(seq uint64, archivePath string) (int, error) {
+	removed := 0
+	err := w.runInWriter(func() error {
+		if seq >= w.seq {
+			return nil
+		}
+		if err := w.syncDirtyLocked(); err != nil {
+			return err
+		}
+		if err := w.file.Close(); err != nil {
+			return fmt.Errorf("failed to close WAL segment: %w", err)
+		}
+
+		var truncateErr error
+		if archivePath != "" {
+			_, truncateErr = exportEvents(w.fs, w.path, archivePath, func(e *Event) bool { return e.Seq > seq })
+		}
+		if truncateErr == nil {
+			removed, truncateErr = truncateWAL(w.fs, w.path, seq+1)
+		}
+
+		// Reopen whatever is on disk now, even after a failure
+		lastSeq, segmentStart, index, err := recoverSeq(w.fs, w.path)
+		if err != nil {
+			return err
+		}
+		w.seq, w.segmentStart = lastSeq, segmentStart
+		w.setIndexLocked(index)
+		if err := w.openActiveLocked(); err != nil {
+			return err
+		}
+		return truncateErr
+	})
+	return removed, err
+}
+
+// Segments returns all segments of the WAL, oldest first, ending with the
+// active segment
+func (w *WAL) Segments() ([]Segment, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	segments, err := listSealedSegments(w.fs, w.path)
+	if err != nil {
+		return nil, err
+	}
+
+	active := Segment{Path: w.path, StartSeq: w.segmentStart, Size: w.segmentSize, Active: true}
+	if info, err := w.fs.Stat(w.path); err == nil {
+		active.ModTime = info.ModTime()
+	}
+	return append(segments, active), nil
+}
+
+// Prune deletes sealed segments that are fully covered by a snapshot and
+// older than the retention period
+//
+// Segments are only removed from the oldest end, so the remaining WAL never
+// has gaps. The active segment is never deleted, and neither is the newest
+// sealed one while the active segment is empty: it is the only record of
+// the last sequence number across a restart.
+//
+// With an archive configured, each segment is compressed into the archive
+// before it is deleted (see archive.go). Compression runs without holding
+// the WAL lock so appends are not stalled.
+//
+// Parameters:
+//   - coveredSeq: Last sequence number included in a durable snapshot
+//
+// Returns:
+//   - int: Number of segments deleted
+//   - error: First archive or deletion failure
+func (w *WAL) Prune(coveredSeq uint64) (int, error) {
+	w.mu.Lock()
+	segments, err := listSealedSegments(w.fs, w.path)
+	if err != nil {
+		w.mu.Unlock()
+		return 0, err
+	}
+
+	if w.seq < w.segmentStart && len(segments) > 0 {
+		segments = segments[:len(segments)-1]
+	}
+
+	now := time.Now()
+	var victims []Segment
+	for i, seg := range segments {
+		nextStart := w.segmentStart
+		if i+1 < len(segments) {
+			nextStart = segments[i+1].StartSeq
+		}
+		// Segment holds seqs [StartSeq, nextStart); stop at the first one
+		// the snapshot does not fully cover or that is still retained
+		if nextStart == 0 || nextStart-1 > coveredSeq {
+			break
+		}
+		if now.Sub(seg.ModTime) < w.retention {
+			break
+		}
+		victims = append(victims, seg)
+	}
+	w.mu.Unlock()
+
+	if w.archive.enabled() {
+		for i, seg := range victims {
+			if _, err := archiveFile(w.fs, w.archive, w.path, seg.Path, seg.StartSeq, false); err != nil {
+				// Delete what was archived, keep this segment and newer ones
+				return w.deleteSegments(victims[:i], fmt.Errorf("failed to archive WAL segment: %w", err))
+			}
+		}
+	}
+	deleted, err := w.deleteSegments(victims, nil)
+	if err != nil || !w.archive.enabled() {
+		return deleted, err
+	}
+	if _, err := enforceArchiveRetention(w.fs, w.archive, w.path); err != nil {
+		return deleted, err
+	}
+	return deleted, nil
+}
+
+// deleteSegments removes pruned segments, oldest first
+//
+// Returns:
+//   - int: Number of segments deleted
+//   - error: cause if it is set, otherwise the first deletion failure
+func (w *WAL) deleteSegments(segments []Segment, cause error) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	deleted := 0
+	for _, seg := range segments {
+		if err := w.fs.Remove(seg.Path); err != nil && !os.IsNotExist(err) {
+			return deleted, fmt.Errorf("failed to delete WAL segment: %w", err)
+		}
+		deleted++
+		if err := removeIndex(w.fs, seg.Path); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+
+	if deleted > 0 {
+		if err := w.fs.SyncDir(filepath.Dir(w.path)); err != nil {
+			return deleted, fmt.Errorf("failed to sync WAL directory: %w", err)
+		}
+	}
+	return deleted, cause
+}
@@ -0,0 +1,263 @@
+package wal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================================================
+// Segment Tests
+// ============================================================================
+
+// appendJobs appends ENQUEUE events for job_<from>..job_<to>
+func appendJobs(t *testing.T, w *WAL, from, to int) {
+	t.Helper()
+	for i := from; i <= to; i++ {
+		require.NoError(t, w.Append(EventEnqueue, &types.Job{ID: types.JobID(fmt.Sprintf("job_%d", i))}))
+	}
+}
+
+func collectSeqs(t *testing.T, w *WAL, afterSeq uint64) []uint64 {
+	t.Helper()
+	var seqs []uint64
+	require.NoError(t, w.ReplayFrom(afterSeq, func(e *Event) error {
+		seqs = append(seqs, e.Seq)
+		return nil
+	}))
+	return seqs
+}
+
+// TestSegmentRollover verifies the active segment is sealed at the size limit
+func TestSegmentRollover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+
+	w, err := NewWALWithOptions(path, Options{BufferSize: 1, MaxSegmentSize: 512})
+	require.NoError(t, err)
+	appendJobs(t, w, 1, 40)
+
+	segments, err := w.Segments()
+	require.NoError(t, err)
+	require.Greater(t, len(segments), 2, "40 events should span several 512-byte segments")
+
+	// Segments are named and ordered by starting seq, the active one is last
+	assert.Equal(t, uint64(1), segments[0].StartSeq)
+	assert.Equal(t, segmentName(path, 1), segments[0].Path)
+	for i := 1; i < len(segments); i++ {
+		assert.Greater(t, segments[i].StartSeq, segments[i-1].StartSeq)
+	}
+	assert.True(t, segments[len(segments)-1].Active)
+	require.NoError(t, w.Close())
+
+	// Reopening continues the sequence and replay spans every segment
+	w, err = NewWALWithOptions(path, Options{BufferSize: 1, MaxSegmentSize: 512})
+	require.NoError(t, err)
+	defer w.Close()
+	assert.Equal(t, uint64(40), w.GetLastSeq())
+	appendJobs(t, w, 41, 45)
+
+	seqs := collectSeqs(t, w, 0)
+	require.Len(t, seqs, 45)
+	for i, seq := range seqs {
+		assert.Equal(t, uint64(i+1), seq)
+	}
+}
+
+// TestRotateDuringAppends verifies rotation never fails concurrent appends
+func TestRotateDuringAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+	w, err := NewWALWithOptions(path, Options{BufferSize: 4, FlushInterval: time.Millisecond})
+	require.NoError(t, err)
+	defer w.Close()
+
+	const writers, perWriter = 4, 200
+	errs := make(chan error, writers*perWriter)
+	var wg sync.WaitGroup
+	for g := 0; g < writers; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				errs <- w.Append(EventEnqueue, &types.Job{ID: types.JobID(fmt.Sprintf("job_%d_%d", g, i))})
+			}
+		}(g)
+	}
+	rotations := 0
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+			require.NoError(t, w.Rotate())
+			rotations++
+		}
+	}
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	// Every event was written exactly once, in seq order across segments
+	seqs := collectSeqs(t, w, 0)
+	require.Len(t, seqs, writers*perWriter)
+	for i, seq := range seqs {
+		require.Equal(t, uint64(i+1), seq)
+	}
+	segments, err := w.Segments()
+	require.NoError(t, err)
+	assert.Greater(t, len(segments), 2, "%d rotations", rotations)
+}
+
+// TestReplayFromSkipsCoveredSegments verifies covered segments are not read
+func TestReplayFromSkipsCoveredSegments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+
+	w, err := NewWAL(path, false, 10, time.Millisecond)
+	require.NoError(t, err)
+	defer w.Close()
+
+	appendJobs(t, w, 1, 10)
+	require.NoError(t, w.Rotate())
+	appendJobs(t, w, 11, 20)
+	require.NoError(t, w.Rotate())
+	appendJobs(t, w, 21, 25)
+
+	// Corrupt the first segment: a snapshot at seq 10 means it is never opened
+	require.NoError(t, os.WriteFile(segmentName(path, 1), []byte("garbage"), 0644))
+
+	seqs := collectSeqs(t, w, 10)
+	require.Len(t, seqs, 15)
+	assert.Equal(t, uint64(11), seqs[0])
+	assert.Equal(t, uint64(25), seqs[14])
+
+	// A snapshot in the middle of a segment replays only the tail of it
+	seqs = collectSeqs(t, w, 15)
+	require.Len(t, seqs, 10)
+	assert.Equal(t, uint64(16), seqs[0])
+}
+
+// TestPrune verifies only covered segments past retention are deleted
+func TestPrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+
+	w, err := NewWALWithOptions(path, Options{BufferSize: 10, Retention: time.Hour})
+	require.NoError(t, err)
+	defer w.Close()
+
+	appendJobs(t, w, 1, 10)
+	require.NoError(t, w.Rotate())
+	appendJobs(t, w, 11, 20)
+	require.NoError(t, w.Rotate())
+	appendJobs(t, w, 21, 25)
+
+	// Covered but within retention: kept
+	deleted, err := w.Prune(20)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	// Age the sealed segments past retention
+	old := time.Now().Add(-2 * time.Hour)
+	for _, start := range []uint64{1, 11} {
+		require.NoError(t, os.Chtimes(segmentName(path, start), old, old))
+	}
+
+	// Only the first segment is fully covered by a snapshot at seq 15
+	deleted, err = w.Prune(15)
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	_, err = os.Stat(segmentName(path, 1))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(segmentName(path, 11))
+	assert.NoError(t, err)
+
+	// Remaining events still replay from the snapshot
+	seqs := collectSeqs(t, w, 15)
+	assert.Len(t, seqs, 10)
+}
+
+// TestPruneKeepsLastSeq verifies pruning everything does not reset the
+// sequence number on reopen
+func TestPruneKeepsLastSeq(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+	w, err := NewWAL(path, false, 10, time.Millisecond)
+	require.NoError(t, err)
+	appendJobs(t, w, 1, 3)
+	require.NoError(t, w.Rotate())
+	appendJobs(t, w, 4, 5)
+	require.NoError(t, w.Rotate())
+
+	// The newest sealed segment stays while the active one is empty
+	deleted, err := w.Prune(5)
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	assert.FileExists(t, segmentName(path, 4))
+	require.NoError(t, w.Close())
+
+	w, err = NewWAL(path, false, 10, time.Millisecond)
+	require.NoError(t, err)
+	defer w.Close()
+	assert.Equal(t, uint64(5), w.GetLastSeq())
+
+	// ...and goes once it is followed by new events
+	appendJobs(t, w, 6, 6)
+	deleted, err = w.Prune(5)
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+}
+
+// TestReplayStopsEarly verifies a handler can end the replay with ErrStopReplay
+func TestReplayStopsEarly(t *testing.T) {
+	w, err := NewWAL(filepath.Join(t.TempDir(), "test.wal"), false, 10, time.Millisecond)
+	require.NoError(t, err)
+	defer w.Close()
+	appendJobs(t, w, 1, 10)
+
+	var seqs []uint64
+	require.NoError(t, w.Replay(func(e *Event) error {
+		if e.Seq > 4 {
+			return ErrStopReplay
+		}
+		seqs = append(seqs, e.Seq)
+		return nil
+	}))
+	assert.Equal(t, []uint64{1, 2, 3, 4}, seqs)
+}
+
+// TestTruncateAfter verifies an open WAL can be cut back across segments
+func TestTruncateAfter(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.wal")
+	w, err := NewWAL(path, false, 10, time.Millisecond)
+	require.NoError(t, err)
+	defer w.Close()
+
+	appendJobs(t, w, 1, 5)
+	require.NoError(t, w.Rotate())
+	appendJobs(t, w, 6, 10)
+
+	archive := filepath.Join(dir, "discarded.wal")
+	removed, err := w.TruncateAfter(3, archive)
+	require.NoError(t, err)
+	assert.Equal(t, 7, removed)
+	assert.Equal(t, uint64(3), w.GetLastSeq())
+
+	// Numbering continues after the cut
+	appendJobs(t, w, 11, 12)
+	assert.Equal(t, []uint64{1, 2, 3, 4, 5}, collectSeqs(t, w, 0))
+
+	count, err := CountEvents(archive)
+	require.NoError(t, err)
+	assert.Equal(t, 7, count)
+}
@@ -0,0 +1,256 @@
+package wal
+
+// ============================================================================
+// WAL Change Data Capture
+// Responsibility: Stream committed events to downstream consumers in order
+// ============================================================================
+//
+// A subscriber first catches up from disk (local segments, then the
+// archive if the history is older) and then tails the batches the batch
+// writer commits:
+//
+//   Subscribe(afterSeq) ──► read segments after afterSeq ──┐
+//                                ▲                         │ caught up
+//                                │ gap / lagged            ▼
+//                                └──────────────── tail committed batches
+//
+// flushBatch never blocks on a subscriber: if a subscriber's buffer is
+// full the batch is dropped for it and the subscriber goes back to the
+// disk, so a slow consumer only slows itself down. Sequence numbers are
+// global across segments, so resuming after a rotation is just another
+// catch-up from the last seq the consumer saw.
+//
+// Events only reach subscribers after their batch is committed (fsynced,
+// unless the sync mode defers syncing, see durability.go). A resume
+// point whose history has been pruned (and not archived) or compacted
+// fails with ErrCompacted instead of silently skipping events.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+const (
+	subscriberBuffer = 64   // Committed batches buffered per subscriber
+	catchUpChunk     = 1024 // Events read from disk per catch-up step
+)
+
+// errLagged makes a subscriber catch up from disk again
+var errLagged = errors.New("wal: subscriber lagged")
+
+// subscriber receives committed batches from flushBatch
+type subscriber struct {
+	live chan []Event  // Committed batches in seq order
+	wake chan struct{} // Signaled when a batch was dropped (buffer full)
+}
+
+// Subscribe streams every committed event with a sequence number greater
+// than afterSeq to handler, in order, until ctx is done, the handler
+// fails or the WAL is closed
+//
+// The handler runs on the caller's goroutine and never holds WAL locks, so
+// it may block (e.g. on a network send) without stalling appends.
+//
+// Parameters:
+//
+//	ctx      - Ends the subscription when done
+//	afterSeq - Last sequence number the consumer already has (0 = all)
+//	handler  - Event handler; may return ErrStopReplay to end cleanly
+//
+// Returns:
+//
+//	error (ErrCompacted if events after afterSeq are no longer retained,
+//	ErrWALClosed when the WAL closes, ctx.Err(), or the handler's error)
+func (w *WAL) Subscribe(ctx context.Context, afterSeq uint64, handler func(event *Event) error) error {
+	sub := &subscriber{
+		live: make(chan []Event, subscriberBuffer),
+		wake: make(chan struct{}, 1),
+	}
+
+	// Register before the first read so no batch falls between the two
+	w.mu.Lock()
+	select {
+	case <-w.shutdown:
+		w.mu.Unlock()
+		return ErrWALClosed
+	default:
+	}
+	w.subs[sub] = struct{}{}
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.subs, sub)
+		w.mu.Unlock()
+	}()
+
+	cursor := afterSeq
+	for {
+		// 1. Catch up from disk
+		for {
+			events, err := w.readCommitted(cursor, catchUpChunk)
+			if err != nil {
+				return err
+			}
+			for i := range events {
+				if err := handler(&events[i]); err != nil {
+					if errors.Is(err, ErrStopReplay) {
+						return nil
+					}
+					return err
+				}
+				cursor = events[i].Seq
+			}
+			if len(events) < catchUpChunk {
+				break
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		// 2. Tail committed batches until the subscriber falls behind
+		err := w.tail(ctx, sub, &cursor, handler)
+		if errors.Is(err, ErrStopReplay) {
+			return nil
+		}
+		if err != errLagged {
+			return err
+		}
+	}
+}
+
+// tail delivers live batches that continue at cursor
+//
+// Returns errLagged when a batch was dropped or does not connect to
+// cursor; the caller then catches up from disk.
+func (w *WAL) tail(ctx context.Context, sub *subscriber, cursor *uint64, handler func(event *Event) error) error {
+	for {
+		select {
+		case batch := <-sub.live:
+			for i := range batch {
+				event := batch[i] // Batches are shared between subscribers
+				if event.Seq <= *cursor {
+					continue // Already read from disk
+				}
+				if event.Seq != *cursor+1 {
+					return errLagged
+				}
+				if err := handler(&event); err != nil {
+					return err
+				}
+				*cursor = event.Seq
+			}
+		case <-sub.wake:
+			return errLagged
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-w.shutdown:
+			return ErrWALClosed
+		}
+	}
+}
+
+// readCommitted returns up to limit committed events after afterSeq
+//
+// Archived and sealed segments are read without the lock, so catching up
+// does not stall appends; only the active segment is read under it. The
+// retention check runs again once the lock is retaken: a Prune or Compact
+// that removed or rewrote events in the meantime fails the read with
+// ErrCompacted, and segments archived meanwhile are listed again.
+func (w *WAL) readCommitted(afterSeq uint64, limit int) ([]Event, error) {
+	var events []Event
+	collect := w.openingHandler(func(event *Event) error {
+		events = append(events, *event)
+		if len(events) >= limit {
+			return ErrStopReplay
+		}
+		return nil
+	})
+	cursor := func() uint64 {
+		if len(events) > 0 {
+			return events[len(events)-1].Seq
+		}
+		return afterSeq
+	}
+
+	for {
+		w.mu.Lock()
+		from := cursor()
+		if from >= w.seq {
+			w.mu.Unlock()
+			return events, nil // Up to date, skip reading the active segment
+		}
+		if err := w.checkRetainedLocked(afterSeq); err != nil {
+			w.mu.Unlock()
+			return nil, err
+		}
+		history, err := w.sealedHistoryLocked(from)
+		w.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+
+		readErr := w.replaySealed(history, from, false, collect)
+
+		w.mu.Lock()
+		if err := w.checkRetainedLocked(afterSeq); err != nil {
+			w.mu.Unlock()
+			return nil, err
+		}
+		switch {
+		case errors.Is(readErr, ErrStopReplay):
+			w.mu.Unlock()
+			return events, nil
+		case errors.Is(readErr, fs.ErrNotExist), w.segmentStart != history.segmentStart:
+			// Pruned into the archive or rotated while reading: list again
+			w.mu.Unlock()
+			continue
+		case readErr != nil:
+			w.mu.Unlock()
+			return nil, readErr
+		}
+		err = replaySegment(w.fs, w.path, cursor(), true, w.index, collect)
+		w.mu.Unlock()
+		if err != nil && !errors.Is(err, ErrStopReplay) {
+			return nil, err
+		}
+		return events, nil
+	}
+}
+
+// checkRetainedLocked reports ErrCompacted if any event after afterSeq has
+// been pruned or compacted away; caller must hold w.mu
+func (w *WAL) checkRetainedLocked(afterSeq uint64) error {
+	oldest, err := w.oldestSeqLocked()
+	if err != nil {
+		return err
+	}
+	if afterSeq+1 < oldest {
+		return fmt.Errorf("%w: cannot resume after seq %d, oldest retained seq is %d", ErrCompacted, afterSeq, oldest)
+	}
+	through, err := w.compactedThroughLocked()
+	if err != nil {
+		return err
+	}
+	if afterSeq < through {
+		return fmt.Errorf("%w: cannot resume after seq %d, finished jobs up to seq %d were compacted", ErrCompacted, afterSeq, through)
+	}
+	return nil
+}
+
+// publishLocked hands a committed batch to every subscriber without
+// blocking; caller must hold w.mu
+func (w *WAL) publishLocked(events []Event) {
+	for sub := range w.subs {
+		select {
+		case sub.live <- events:
+		default:
+			select {
+			case sub.wake <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
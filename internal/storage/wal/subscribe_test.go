@@ -0,0 +1,204 @@
+package wal
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================================================
+// WAL Subscription Tests
+// ============================================================================
+
+// subscribeSeqs runs Subscribe in the background and sends each seq it
+// delivers; the returned channel yields Subscribe's result
+func subscribeSeqs(ctx context.Context, w *WAL, afterSeq uint64, handler func(e *Event)) (<-chan uint64, <-chan error) {
+	seqs := make(chan uint64, 1024)
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Subscribe(ctx, afterSeq, func(e *Event) error {
+			if handler != nil {
+				handler(e)
+			}
+			seqs <- e.Seq
+			return nil
+		})
+	}()
+	return seqs, done
+}
+
+// receiveSeqs waits for n delivered seqs
+func receiveSeqs(t *testing.T, seqs <-chan uint64, n int) []uint64 {
+	t.Helper()
+	var got []uint64
+	for len(got) < n {
+		select {
+		case seq := <-seqs:
+			got = append(got, seq)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out after %d of %d events: %v", len(got), n, got)
+		}
+	}
+	return got
+}
+
+// gatedFS blocks the first read-only open of path, once armed, until
+// release is closed
+type gatedFS struct {
+	vfs.FS
+	path    string
+	armed   atomic.Bool
+	opened  chan struct{}
+	release chan struct{}
+}
+
+func (g *gatedFS) OpenFile(name string, flag int, perm fs.FileMode) (vfs.File, error) {
+	if name == g.path && flag == os.O_RDONLY && g.armed.CompareAndSwap(true, false) {
+		close(g.opened)
+		<-g.release
+	}
+	return g.FS.OpenFile(name, flag, perm)
+}
+
+func TestSubscribeCatchUpAndTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+	w, err := NewWALWithOptions(path, Options{BufferSize: 10, FlushInterval: time.Millisecond})
+	require.NoError(t, err)
+	defer w.Close()
+
+	appendJobs(t, w, 1, 3)
+	require.NoError(t, w.Rotate())
+	appendJobs(t, w, 4, 5)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	seqs, done := subscribeSeqs(ctx, w, 2, nil)
+	assert.Equal(t, []uint64{3, 4, 5}, receiveSeqs(t, seqs, 3))
+
+	// Live events, across a rotation
+	appendJobs(t, w, 6, 7)
+	require.NoError(t, w.Rotate())
+	appendJobs(t, w, 8, 8)
+	assert.Equal(t, []uint64{6, 7, 8}, receiveSeqs(t, seqs, 3))
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestSubscribeSlowConsumerCatchesUp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+	w, err := NewWALWithOptions(path, Options{BufferSize: 1, FlushInterval: time.Millisecond})
+	require.NoError(t, err)
+
+	// The consumer blocks on the first event while far more batches than
+	// its buffer holds are committed
+	release := make(chan struct{})
+	seqs, done := subscribeSeqs(context.Background(), w, 0, func(e *Event) {
+		if e.Seq == 1 {
+			<-release
+		}
+	})
+	appendJobs(t, w, 1, 1)
+	total := 3 * subscriberBuffer
+	appendJobs(t, w, 2, total/2)
+	require.NoError(t, w.Rotate())
+	appendJobs(t, w, total/2+1, total)
+	close(release)
+
+	got := receiveSeqs(t, seqs, total)
+	for i, seq := range got {
+		require.Equal(t, uint64(i+1), seq)
+	}
+
+	require.NoError(t, w.Close())
+	assert.ErrorIs(t, <-done, ErrWALClosed)
+	assert.ErrorIs(t, w.Subscribe(context.Background(), 0, func(*Event) error { return nil }), ErrWALClosed)
+}
+
+func TestSubscribeStop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+	w, err := NewWALWithOptions(path, Options{BufferSize: 10, FlushInterval: time.Millisecond})
+	require.NoError(t, err)
+	defer w.Close()
+	appendJobs(t, w, 1, 5)
+
+	var got []uint64
+	err = w.Subscribe(context.Background(), 1, func(e *Event) error {
+		got = append(got, e.Seq)
+		if e.Seq == 3 {
+			return ErrStopReplay
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{2, 3}, got)
+}
+
+func TestSubscribeCompacted(t *testing.T) {
+	w, _ := writeHistoryWAL(t)
+	defer w.Close()
+	noop := func(*Event) error { return ErrStopReplay }
+
+	_, err := w.Compact(8, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.ErrorIs(t, w.Subscribe(context.Background(), 0, noop), ErrCompacted)
+	assert.ErrorIs(t, w.Subscribe(context.Background(), 7, noop), ErrCompacted)
+	assert.NoError(t, w.Subscribe(context.Background(), 8, noop))
+
+	// Pruned without an archive
+	_, err = w.Prune(10)
+	require.NoError(t, err)
+	assert.ErrorIs(t, w.Subscribe(context.Background(), 9, noop), ErrCompacted)
+	assert.NoError(t, w.Subscribe(context.Background(), 10, noop))
+}
+
+func TestSubscribeCatchUpDoesNotBlockAppends(t *testing.T) {
+	gated := &gatedFS{
+		FS:      vfs.NewMemFS(),
+		path:    segmentName(crashWALPath, 1),
+		opened:  make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	w := openMemWAL(t, gated, Options{BufferSize: 10})
+	defer w.Close()
+	appendJobs(t, w, 1, 3)
+	require.NoError(t, w.Rotate())
+	appendJobs(t, w, 4, 5)
+
+	// The subscriber stalls while reading the sealed segment
+	gated.armed.Store(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	seqs, _ := subscribeSeqs(ctx, w, 0, nil)
+	select {
+	case <-gated.opened:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscriber did not read the sealed segment")
+	}
+
+	// Appends and rotation go ahead meanwhile
+	appended := make(chan struct{})
+	go func() {
+		defer close(appended)
+		appendJobs(t, w, 6, 6)
+		assert.NoError(t, w.Rotate())
+		appendJobs(t, w, 7, 7)
+	}()
+	select {
+	case <-appended:
+	case <-time.After(5 * time.Second):
+		close(gated.release)
+		t.Fatal("appends blocked while a subscriber was catching up")
+	}
+	close(gated.release)
+
+	got := receiveSeqs(t, seqs, 7)
+	assert.Equal(t, []uint64{1, 2, 3, 4, 5, 6, 7}, got)
+}
@@ -1,6 +1,10 @@
 package wal
 
-import "github.com/ChuLiYu/raft-recovery/pkg/types"
+import (
+	"time"
+
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+)
 
 // ============================================================================
 // WAL Type Definitions
@@ -19,26 +23,102 @@ const (
 	EventDead     EventType = "DEAD"     // Job failed (exceeded retry count)
 )
 
+// Event schema versions
+//
+// V1 events only identify the job (seq, type, job_id, timestamp, checksum)
+// and were written without a version field, so a missing "v" means V1.
+// V2 events are self-contained: they carry everything needed to rebuild
+// the job on replay even if it was never part of a snapshot.
+// V3 events have the same fields as V2, but their checksum covers the
+// whole serialized record instead of type + job_id + seq (see checksum.go).
+const (
+	EventSchemaV1      = 1
+	EventSchemaV2      = 2
+	EventSchemaV3      = 3
+	CurrentEventSchema = EventSchemaV3
+)
+
 // Event represents a WAL event record
 type Event struct {
-	Seq       uint64      `json:"seq"`       // Event sequence number (monotonically increasing)
-	Type      EventType   `json:"type"`      // Event type
-	JobID     types.JobID `json:"job_id"`    // Job ID (using pkg/types type)
-	Timestamp int64       `json:"timestamp"` // Unix millisecond timestamp
-	Checksum  uint32      `json:"checksum"`  // CRC32 checksum
-
-	// Phase 2: Extended fields
-	// WorkerID  string      `json:"worker_id,omitempty"` // Worker ID processing the job
-	// Attempt   int         `json:"attempt,omitempty"`   // Job attempt count
-	// Payload   []byte      `json:"payload,omitempty"`   // Partial job data (for debugging)
+	Version   int         `json:"v,omitempty"` // Schema version (0 = legacy V1)
+	Seq       uint64      `json:"seq"`         // Event sequence number (monotonically increasing)
+	Type      EventType   `json:"type"`        // Event type
+	JobID     types.JobID `json:"job_id"`      // Job ID (using pkg/types type)
+	Timestamp int64       `json:"timestamp"`   // Unix millisecond timestamp
+	Checksum  uint32      `json:"checksum"`    // CRC32C of the record (V3) or legacy CRC32
+
+	// V2: Job state carried with the event
+	Payload   map[string]interface{} `json:"payload,omitempty"`     // Job payload (ENQUEUE only, to bound record size)
+	TimeoutMs int64                  `json:"timeout_ms,omitempty"`  // Job execution timeout
+	Attempt   int                    `json:"attempt,omitempty"`     // Job attempt count after the event
+	Deadline  *int64                 `json:"deadline_ms,omitempty"` // Job deadline (Unix ms) after the event, if set
+	CreatedAt int64                  `json:"created_at,omitempty"`  // Job creation time (Unix ms)
+
+	// Encrypted payload (see encryption.go); replaces Payload on disk
+	Sealed []byte `json:"sealed,omitempty"`
 }
 
-// TODO (Phase 2):
-// - Extend Event structure: add WorkerID, Attempt, Payload fields
-// - Design Payload structure, consider serialization/deserialization efficiency
-// - Evaluate WAL record size and performance impact
+// SchemaVersion returns the effective schema version of the event
+func (e *Event) SchemaVersion() int {
+	if e.Version == 0 {
+		return EventSchemaV1
+	}
+	return e.Version
+}
+
+// HasJob reports whether the event carries enough data to rebuild its job
+func (e *Event) HasJob() bool {
+	return e.SchemaVersion() >= EventSchemaV2 && e.Type == EventEnqueue
+}
+
+// HasState reports whether the event carries the job's attempt count and
+// deadline as they were after the event
+func (e *Event) HasState() bool {
+	return e.SchemaVersion() >= EventSchemaV2
+}
+
+// Job rebuilds the job carried by a V2 ENQUEUE event in pending state
+func (e *Event) Job() types.Job {
+	job := types.Job{
+		ID:        e.JobID,
+		Payload:   e.Payload,
+		Status:    types.StatusPending,
+		Attempt:   e.Attempt,
+		Timeout:   time.Duration(e.TimeoutMs) * time.Millisecond,
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.Timestamp,
+	}
+	if job.CreatedAt == 0 {
+		job.CreatedAt = e.Timestamp
+	}
+	return job
+}
+
+// newEvent builds a current-schema event for job
+func newEvent(seq uint64, eventType EventType, job *types.Job, timestamp int64) Event {
+	event := Event{
+		Version:   CurrentEventSchema,
+		Seq:       seq,
+		Type:      eventType,
+		JobID:     job.ID,
+		Timestamp: timestamp,
+		TimeoutMs: job.Timeout.Milliseconds(),
+		Attempt:   job.Attempt,
+		CreatedAt: job.CreatedAt,
+	}
+	if eventType == EventEnqueue {
+		event.Payload = job.Payload
+	}
+	if job.Deadline != nil {
+		deadline := *job.Deadline
+		event.Deadline = &deadline
+	}
+	return event
+}
+
+// TODO:
 // - Add more event types (e.g., CANCEL, PAUSE)
-// - Support event versioning (compatible upgrades)
+// - Evaluate carrying WorkerID once workers report it on dispatch
 
 // EventHandler is the function type for processing WAL events
 // Used during Replay to apply events to system state
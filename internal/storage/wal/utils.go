@@ -4,19 +4,291 @@ package wal
 // WAL Utility Functions
 // Purpose: Provide WAL-related helper functionality
 // ============================================================================
+//
+// These tools work on closed WALs (e.g. the WAL of a stopped or broken
+// node) and back the `beaver-raft wal` command. A path names a whole WAL:
+// the active segment plus the sealed segments next to it. A sealed
+// segment path can be passed to inspect just that file.
+//
+// Unlike Replay, the tools keep reading past damage: after a corrupted
+// record they resynchronize on the next readable record (the next line for
+// JSON, the next valid frame for binary) and report the skipped bytes as
+// an Issue. Segment files are read into memory whole, which is fine for
+// offline use with the default segment size.
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
 	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
 )
 
+// Issue kinds reported by WalkWAL and ValidateWAL
+const (
+	IssueCorrupt  = "corrupt"   // Unreadable record or checksum mismatch
+	IssueTorn     = "torn"      // File ends inside a record
+	IssueSeqGap   = "seq_gap"   // Sequence numbers skip values
+	IssueSeqOrder = "seq_order" // Sequence number repeats or goes backwards
+)
+
+// Record is one event together with where it is stored
+type Record struct {
+	Path   string `json:"path"`   // Segment file
+	Offset int64  `json:"offset"` // Byte offset of the record in the file
+	Event  Event  `json:"event"`
+}
+
+// String formats the record as one human-readable line
+func (r *Record) String() string {
+	e := &r.Event
+	ts := time.UnixMilli(e.Timestamp).UTC().Format("2006-01-02T15:04:05.000Z")
+	line := fmt.Sprintf("[Seq:%d] %s %s at %s (checksum:0x%08x, v%d)", e.Seq, e.Type, e.JobID, ts, e.Checksum, e.SchemaVersion())
+	if e.Attempt > 0 {
+		line += fmt.Sprintf(" attempt=%d", e.Attempt)
+	}
+	return line
+}
+
+// Issue describes one problem found while reading a WAL
+type Issue struct {
+	Kind   string `json:"kind"`          // One of the Issue* constants
+	Path   string `json:"path"`          // Segment file
+	Offset int64  `json:"offset"`        // Byte offset where the problem starts
+	Length int64  `json:"length"`        // Bytes skipped (0 if nothing was skipped)
+	Seq    uint64 `json:"seq,omitempty"` // Affected sequence number, if known
+	Detail string `json:"detail"`        // Human-readable description
+}
+
+// String formats the issue as one human-readable line
+func (i Issue) String() string {
+	return fmt.Sprintf("!! %s in %s at offset %d: %s", i.Kind, filepath.Base(i.Path), i.Offset, i.Detail)
+}
+
 // ============================================================================
 // File Operation Helpers
 // ============================================================================
 
-// GetLastEvent reads the last event from a WAL file
+// walFiles lists the files of the WAL at path, oldest first, ending with the
+// active segment if it exists
+func walFiles(fsys vfs.FS, path string) ([]Segment, error) {
+	segments, err := listSealedSegments(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := fsys.Stat(path); err == nil {
+		segments = append(segments, Segment{Path: path, Size: info.Size(), ModTime: info.ModTime(), Active: true})
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("no WAL files at %s: %w", path, os.ErrNotExist)
+	}
+	return segments, nil
+}
+
+// WalkWAL reads every record of the WAL at path in order
+//
+// Damaged regions are reported as issues and skipped. visit is called
+// with exactly one of rec and issue set; returning an error stops the walk.
+//
+// Parameters:
+//   - path: Active segment path, or a single segment file
+//   - visit: Callback for each record or issue
+//
+// Returns:
+//   - error: I/O failure or the error returned by visit
+func WalkWAL(path string, visit func(rec *Record, issue *Issue) error) error {
+	return walkWAL(vfs.OS, path, visit)
+}
+
+// WalkWALFrom is WalkWAL limited to records with a sequence number above
+// afterSeq
+//
+// Segments that end at or before afterSeq are skipped, and a segment with
+// a valid index (see index.go) is read from the indexed record closest to
+// afterSeq, so damage in the skipped part is not reported.
+func WalkWALFrom(path string, afterSeq uint64, visit func(rec *Record, issue *Issue) error) error {
+	files, err := walFiles(vfs.OS, path)
+	if err != nil {
+		return err
+	}
+	for i, file := range files {
+		if i+1 < len(files) && !files[i+1].Active && files[i+1].StartSeq-1 <= afterSeq {
+			continue // Fully covered
+		}
+		var index *segmentIndex
+		if file.Active || file.StartSeq <= afterSeq {
+			index = readIndex(vfs.OS, file.Path, !file.Active)
+		}
+		err := walkFileFrom(vfs.OS, file.Path, index, afterSeq, func(rec *Record, issue *Issue) error {
+			if rec != nil && rec.Event.Seq <= afterSeq {
+				return nil
+			}
+			return visit(rec, issue)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkWAL implements WalkWAL on fsys
+func walkWAL(fsys vfs.FS, path string, visit func(rec *Record, issue *Issue) error) error {
+	files, err := walFiles(fsys, path)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := walkFile(fsys, file.Path, visit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkFile reads every record of one segment file, resynchronizing after
+// corrupted records
+func walkFile(fsys vfs.FS, path string, visit func(rec *Record, issue *Issue) error) error {
+	return walkFileFrom(fsys, path, nil, 0, visit)
+}
+
+// walkFileFrom is walkFile starting at the record index locates for
+// afterSeq (from the beginning if index is nil); the skipped part of the
+// file is not read
+func walkFileFrom(fsys vfs.FS, path string, index *segmentIndex, afterSeq uint64, visit func(rec *Record, issue *Issue) error) error {
+	start, seek := index.seek(afterSeq)
+	data, err := readFileFrom(fsys, path, start)
+	if err != nil {
+		return err
+	}
+
+	var decoder recordDecoder
+	encoding := Encoding("")
+	if seek {
+		encoding = index.Encoding
+		decoder = decoderAt(data, encoding, start)
+	} else if decoder, encoding, err = newRecordDecoder(bytes.NewReader(data)); err != nil {
+		kind := IssueCorrupt
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			kind = IssueTorn
+		}
+		return visit(nil, &Issue{Kind: kind, Path: path, Length: int64(len(data)), Detail: fmt.Sprintf("unreadable file header: %v", err)})
+	}
+
+	for {
+		offset := decoder.Offset()
+		rec := &Record{Path: path, Offset: offset}
+		err := decoder.Decode(&rec.Event)
+		if err == io.EOF {
+			return nil
+		}
+		if err == nil {
+			if err := visit(rec, nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		torn, err := classifyDecodeError(bytes.NewReader(data), path, err)
+		if torn {
+			return visit(nil, &Issue{Kind: IssueTorn, Path: path, Offset: offset, Length: int64(len(data)) - offset,
+				Detail: fmt.Sprintf("incomplete final record (%d bytes)", int64(len(data))-offset)})
+		}
+		var corruption *CorruptionError
+		if !errors.As(err, &corruption) {
+			return err
+		}
+
+		next := resyncOffset(data, encoding, corruption.Offset)
+		issue := &Issue{Kind: IssueCorrupt, Path: path, Offset: corruption.Offset, Length: next - corruption.Offset,
+			Seq: corruption.Seq, Detail: fmt.Sprintf("%v (%d bytes skipped)", corruption.Cause, next-corruption.Offset)}
+		if err := visit(nil, issue); err != nil {
+			return err
+		}
+		if next >= int64(len(data)) {
+			return nil
+		}
+		decoder = decoderAt(data, encoding, next)
+	}
+}
+
+// readFileFrom reads a file from offset on; the returned slice keeps file
+// offsets, with zeros in place of the unread prefix
+func readFileFrom(fsys vfs.FS, path string, offset int64) ([]byte, error) {
+	if offset == 0 {
+		return vfs.ReadFile(fsys, path)
+	}
+	file, err := vfs.Open(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < offset {
+		return nil, fmt.Errorf("WAL segment %s is shorter than its index", path)
+	}
+	data := make([]byte, info.Size())
+	if _, err := file.ReadAt(data[offset:], offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return data, nil
+}
+
+// resyncOffset returns the offset of the next record that looks intact
+// after a corrupted record at offset, or len(data) if there is none
+func resyncOffset(data []byte, encoding Encoding, offset int64) int64 {
+	if encoding != EncodingBinary {
+		if i := bytes.IndexByte(data[offset:], '\n'); i >= 0 {
+			return offset + int64(i) + 1
+		}
+		return int64(len(data))
+	}
+
+	// Next position holding a frame whose length fits and whose CRC matches
+	for p := offset + 1; p+recordHeaderSize <= int64(len(data)); p++ {
+		length := int64(binary.LittleEndian.Uint32(data[p:]))
+		end := p + recordHeaderSize + length
+		if length > maxRecordSize || end > int64(len(data)) {
+			continue
+		}
+		crc := crc32.Update(crc32.Checksum(data[p:p+4], castagnoliTable), castagnoliTable, data[p+recordHeaderSize:end])
+		if crc == binary.LittleEndian.Uint32(data[p+4:]) {
+			return p
+		}
+	}
+	return int64(len(data))
+}
+
+// decoderAt returns a decoder reading data from offset
+func decoderAt(data []byte, encoding Encoding, offset int64) recordDecoder {
+	r := bufio.NewReader(bytes.NewReader(data[offset:]))
+	if encoding == EncodingBinary {
+		return &binaryDecoder{r: r, offset: offset}
+	}
+	return &jsonDecoder{r: r, offset: offset}
+}
+
+// GetLastEvent reads the last event from a WAL
+//
+// Segments are checked newest first, so only the newest non-empty segment
+// is read, from its last index entry if it has a valid index.
 //
 // Use cases:
-// - NewWAL needs to get last_seq to continue numbering
+// - Find where numbering continues
 // - Validate WAL integrity
 //
 // Parameters:
@@ -25,66 +297,104 @@ import (
 //
 // Returns:
 //
-//	Last event, error (returns ErrEmptyWAL if file is empty)
+//	Last event, error (returns ErrEmptyWAL if no segment holds an event)
 func GetLastEvent(path string) (*Event, error) {
-	// TODO: Implement last event reading
-	// Strategy options:
-	//
-	// Option A: Scan from start to end (simple but slow)
-	//   - Read line by line until EOF
-	//   - Return the last successfully parsed event
-	//
-	// Option B: Search backwards from end (fast but complex)
-	//   - Seek to end of file
-	//   - Search backwards for last newline
-	//   - Parse that line
-	//
-	// Option C: Maintain index file (fastest but requires extra maintenance)
-	//   - WAL.index records position of each event
-	//   - Jump directly to last event
-	//
-	// Consider: Which approach suits your scenario?
-
-	return nil, nil
-}
-
-// CountEvents counts the total number of events in WAL
+	files, err := walFiles(vfs.OS, path)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(files) - 1; i >= 0; i-- {
+		var last *Event
+		var afterSeq uint64
+		index := readIndex(vfs.OS, files[i].Path, !files[i].Active)
+		if index != nil {
+			afterSeq = index.Entries[len(index.Entries)-1].Seq - 1
+		}
+		err := walkFileFrom(vfs.OS, files[i].Path, index, afterSeq, func(rec *Record, _ *Issue) error {
+			if rec != nil {
+				last = &rec.Event
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if last != nil {
+			return last, nil
+		}
+	}
+	return nil, ErrEmptyWAL
+}
+
+// CountEvents counts the readable events in a WAL
 //
 // Use cases:
 // - Debugging and diagnostics
 // - Statistics and monitoring
+//
+// Damaged records are skipped, not counted; use ValidateWAL to find them.
 func CountEvents(path string) (int, error) {
-	// TODO: Implement event counting
-	// 1. Open file
-	// 2. Read line by line using decoder
-	// 3. Count successfully parsed events
-	// 4. Ignore corrupted events? Or return error?
-
-	return 0, nil
+	count := 0
+	err := WalkWAL(path, func(rec *Record, _ *Issue) error {
+		if rec != nil {
+			count++
+		}
+		return nil
+	})
+	return count, err
 }
 
-// ValidateWAL validates WAL file integrity
+// ValidateWAL validates WAL integrity
 //
 // Checks:
-// - All events have correct JSON format
-// - All events have correct checksums
-// - seq is sequential and unique
+//   - Every record decodes and matches its checksum
+//   - No segment ends in a torn record
+//   - seq is strictly increasing without gaps (except where compaction
+//     dropped events, see compaction.go, or AdvanceTo skipped to the seq
+//     floor, see checkpoint.go)
 //
 // Returns:
 //
-//	error (if any issues found)
+//	*ValidationError listing every issue found, or an I/O error
 func ValidateWAL(path string) error {
-	// TODO: Implement WAL validation
-	// 1. Replay all events
-	// 2. Validate each event's checksum
-	// 3. Validate seq continuity:
-	//    lastSeq := uint64(0)
-	//    for each event:
-	//      if event.Seq != lastSeq + 1:
-	//        return error
-	//      lastSeq = event.Seq
-	// 4. Collect and report all errors (not just the first)
+	manifest, err := readManifest(vfs.OS, path)
+	if err != nil {
+		return err
+	}
+	floor, err := readFloor(vfs.OS, path)
+	if err != nil {
+		return err
+	}
+
+	var issues []Issue
+	var lastSeq uint64
+	err = WalkWAL(path, func(rec *Record, issue *Issue) error {
+		if issue != nil {
+			issues = append(issues, *issue)
+			return nil
+		}
 
+		seq := rec.Event.Seq
+		switch {
+		case lastSeq != 0 && seq <= lastSeq:
+			issues = append(issues, Issue{Kind: IssueSeqOrder, Path: rec.Path, Offset: rec.Offset, Seq: seq,
+				Detail: fmt.Sprintf("seq %d follows seq %d", seq, lastSeq)})
+		case lastSeq != 0 && seq != lastSeq+1 && !manifest.covers(lastSeq+1, seq-1) && seq != floor+1:
+			issues = append(issues, Issue{Kind: IssueSeqGap, Path: rec.Path, Offset: rec.Offset, Seq: seq,
+				Detail: fmt.Sprintf("seqs %d..%d missing", lastSeq+1, seq-1)})
+		}
+		if seq > lastSeq {
+			lastSeq = seq
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(issues) > 0 {
+		return &ValidationError{Path: path, Issues: issues}
+	}
 	return nil
 }
 
@@ -92,32 +402,103 @@ func ValidateWAL(path string) error {
 // WAL Repair Tools (Advanced Features)
 // ============================================================================
 
-// RepairWAL attempts to repair a corrupted WAL
+// RepairResult summarizes a RepairWAL run
+type RepairResult struct {
+	Events  int     `json:"events"`  // Events written to the repaired WAL
+	Dropped []Issue `json:"dropped"` // Damaged regions and out-of-order events left out
+}
+
+// RepairWAL writes every readable event of a damaged WAL to a new file
 //
 // Repair strategy:
-// - Scan file, remove invalid events
-// - Renumber seq (starting from 1, sequential)
-// - Generate new WAL file
-//
-// Warning: This operation will change event sequence numbers!
-func RepairWAL(srcPath, dstPath string) error {
-	// TODO: Implement WAL repair (optional)
-	// 1. Read from srcPath
-	// 2. Filter valid events:
-	//    - JSON is parsable
-	//    - Checksum is correct
-	// 3. Renumber seq
-	// 4. Write to dstPath
-	// 5. Consider:
-	//    - How to handle events with checksum errors but valid JSON?
-	//    - Should user confirmation be required?
-	//    - Should removed events be logged?
+//   - Read all segments, skipping corrupted records and torn tails
+//   - Drop events whose seq does not increase (duplicates)
+//   - Write the rest to a single segment at dstPath, in the encoding of the
+//     newest source file
+//
+// Sequence numbers are kept, so snapshots stay aligned with the WAL;
+// dropped events leave gaps, which replay tolerates.
+//
+// If dstPath equals srcPath the WAL is repaired in place: the original
+// files are renamed with a ".bak" suffix and the repaired file becomes the
+// only segment.
+func RepairWAL(srcPath, dstPath string) (*RepairResult, error) {
+	files, err := walFiles(vfs.OS, srcPath)
+	if err != nil {
+		return nil, err
+	}
+	encoding := EncodingJSON
+	for i := len(files) - 1; i >= 0; i-- {
+		if detected, _ := detectEncoding(vfs.OS, files[i].Path); detected != "" {
+			encoding = detected
+			break
+		}
+	}
 
-	return nil
+	tmpPath := dstPath + ".repairing"
+	out, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmpPath)
+	defer out.Close()
+
+	result := &RepairResult{}
+	encoder := newRecordEncoder(out, encoding, true)
+	var lastSeq uint64
+	err = WalkWAL(srcPath, func(rec *Record, issue *Issue) error {
+		if issue != nil {
+			result.Dropped = append(result.Dropped, *issue)
+			return nil
+		}
+		if rec.Event.Seq <= lastSeq {
+			result.Dropped = append(result.Dropped, Issue{Kind: IssueSeqOrder, Path: rec.Path, Offset: rec.Offset,
+				Seq: rec.Event.Seq, Detail: fmt.Sprintf("dropped seq %d after seq %d", rec.Event.Seq, lastSeq)})
+			return nil
+		}
+		lastSeq = rec.Event.Seq
+		result.Events++
+		return encoder.Encode(&rec.Event)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := out.Sync(); err != nil {
+		return nil, err
+	}
+	if err := out.Close(); err != nil {
+		return nil, err
+	}
+
+	if dstPath == srcPath {
+		for _, file := range files {
+			if err := removeIndex(vfs.OS, file.Path); err != nil {
+				return nil, err
+			}
+			if err := os.Rename(file.Path, file.Path+".bak"); err != nil {
+				return nil, fmt.Errorf("failed to back up %s: %w", file.Path, err)
+			}
+		}
+	}
+	if err := removeIndex(vfs.OS, dstPath); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, dstPath); err != nil {
+		return nil, err
+	}
+	return result, vfs.OS.SyncDir(filepath.Dir(dstPath))
 }
 
 // TruncateWAL truncates WAL to specified sequence number
 //
+// Segments that start at or after seq are deleted and the segment holding
+// seq is rewritten without it. If the active segment is deleted, the newest
+// remaining segment becomes the active one.
+//
+// Truncating at or below the seq floor (see checkpoint.go) is refused: a
+// snapshot already covers those events, so dropping them from the WAL
+// would not roll them back.
+//
 // Use cases:
 // - Recover to a known good state
 // - Roll back erroneous operations
@@ -126,15 +507,163 @@ func RepairWAL(srcPath, dstPath string) error {
 //
 //	path - WAL file path
 //	seq  - Keep up to this sequence number (exclusive)
-func TruncateWAL(path string, seq uint64) error {
-	// TODO: Implement WAL truncation (optional)
-	// 1. Read all events
-	// 2. Filter events with seq < targetSeq
-	// 3. Write to new file
-	// 4. Atomically replace old file
-	// 5. Warning: Ensure operation atomicity!
+//
+// Returns:
+//
+//	Number of events removed, error (a corrupted segment must be repaired
+//	first; ErrBelowFloor if seq is at or below the seq floor)
+func TruncateWAL(path string, seq uint64) (int, error) {
+	return truncateWAL(vfs.OS, path, seq)
+}
 
-	return nil
+// truncateWAL implements TruncateWAL on fsys
+func truncateWAL(fsys vfs.FS, path string, seq uint64) (int, error) {
+	floor, err := readFloor(fsys, path)
+	if err != nil {
+		return 0, err
+	}
+	if floor > 0 && seq <= floor {
+		return 0, fmt.Errorf("%w: seq %d, floor %d in %s", ErrBelowFloor, seq, floor, floorPath(path))
+	}
+
+	files, err := walFiles(fsys, path)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	var deleteFiles []Segment
+	var kept []Segment
+	for _, file := range files {
+		scan, err := scanSegment(fsys, file.Path)
+		if err != nil {
+			return removed, fmt.Errorf("cannot truncate %s: %w", file.Path, err)
+		}
+		switch {
+		case scan.Count > 0 && scan.First >= seq:
+			removed += scan.Count
+			deleteFiles = append(deleteFiles, file)
+		case scan.Count > 0 && scan.Last >= seq:
+			// Rewrite in place, keeping the file's encoding
+			if err := removeIndex(fsys, file.Path); err != nil {
+				return removed, err
+			}
+			tmpPath := file.Path + ".truncating"
+			keptEvents, err := rewriteFile(fsys, file.Path, tmpPath, scan.Encoding, func(e *Event) bool { return e.Seq < seq })
+			if err != nil {
+				fsys.Remove(tmpPath)
+				return removed, err
+			}
+			if err := fsys.Rename(tmpPath, file.Path); err != nil {
+				fsys.Remove(tmpPath)
+				return removed, err
+			}
+			removed += scan.Count - keptEvents
+			kept = append(kept, file)
+		default:
+			kept = append(kept, file)
+		}
+	}
+
+	// Delete newest first so a crash never leaves a gap in the middle
+	for i := len(deleteFiles) - 1; i >= 0; i-- {
+		if err := fsys.Remove(deleteFiles[i].Path); err != nil {
+			return removed, err
+		}
+		if err := removeIndex(fsys, deleteFiles[i].Path); err != nil {
+			return removed, err
+		}
+	}
+	if len(kept) > 0 && !kept[len(kept)-1].Active {
+		if _, err := fsys.Stat(path); os.IsNotExist(err) {
+			if err := removeIndex(fsys, kept[len(kept)-1].Path); err != nil {
+				return removed, err
+			}
+			if err := fsys.Rename(kept[len(kept)-1].Path, path); err != nil {
+				return removed, err
+			}
+		}
+	}
+	return removed, fsys.SyncDir(filepath.Dir(path))
+}
+
+// exportEvents copies the readable events of the WAL at path accepted by
+// keep into a single JSON segment at dst
+//
+// Returns:
+//   - int: Number of events written
+//   - error: Read or write failure
+func exportEvents(fsys vfs.FS, path, dst string, keep func(e *Event) bool) (int, error) {
+	out, err := fsys.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	encoder := newRecordEncoder(out, EncodingJSON, true)
+	count := 0
+	err = walkWAL(fsys, path, func(rec *Record, _ *Issue) error {
+		if rec == nil || !keep(&rec.Event) {
+			return nil
+		}
+		count++
+		return encoder.Encode(&rec.Event)
+	})
+	if err != nil {
+		return count, err
+	}
+	if err := out.Sync(); err != nil {
+		return count, err
+	}
+	return count, out.Close()
+}
+
+// rewriteFile copies the events of src accepted by keep into dst
+//
+// Returns:
+//   - int: Number of events written
+//   - error: Read, decode or write failure (a torn tail is reported, not dropped)
+func rewriteFile(fsys vfs.FS, src, dst string, encoding Encoding, keep func(e *Event) bool) (int, error) {
+	in, err := vfs.Open(fsys, src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	decoder, _, err := newRecordDecoder(in)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", src, err)
+	}
+
+	out, err := fsys.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	encoder := newRecordEncoder(out, encoding, true)
+	count := 0
+	for {
+		var event Event
+		if err := decoder.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return count, fmt.Errorf("failed to decode event after %d events of %s: %w", count, src, err)
+		}
+		if !keep(&event) {
+			continue
+		}
+		if err := encoder.Encode(&event); err != nil {
+			return count, fmt.Errorf("failed to write %s: %w", dst, err)
+		}
+		count++
+	}
+
+	if err := out.Sync(); err != nil {
+		return count, err
+	}
+	return count, out.Close()
 }
 
 // ============================================================================
@@ -143,34 +672,105 @@ func TruncateWAL(path string, seq uint64) error {
 
 // DumpWAL outputs WAL contents (human-readable format)
 //
+// Output (damaged regions are marked inline):
+//
+//	[Seq:1] ENQUEUE job-001 at 2024-01-01T00:00:00.000Z (checksum:0x12345678, v3)
+//	!! corrupt in beaver-raft.wal at offset 118: ... (57 bytes skipped)
+//
 // Use cases:
 // - Debugging
 // - Manual event inspection
 func DumpWAL(path string, w io.Writer) error {
-	// TODO: Implement WAL dump
-	// 1. Read all events
-	// 2. Format output:
-	//    [Seq:1] ENQUEUE job-001 at 2024-01-01T00:00:00 (checksum:0x12345678)
-	//    [Seq:2] DISPATCH job-001 at 2024-01-01T00:00:01 (checksum:0x87654321)
-	// 3. Mark corrupted events
-
-	return nil
+	return WalkWAL(path, func(rec *Record, issue *Issue) error {
+		var err error
+		if rec != nil {
+			_, err = fmt.Fprintln(w, rec.String())
+		} else {
+			_, err = fmt.Fprintln(w, issue.String())
+		}
+		return err
+	})
 }
 
-// CompareWAL compares differences between two WAL files
+// CompareWAL compares differences between two WALs
+//
+// Events are matched by sequence number. Checksums are ignored because
+// they depend on the record encoding, so a WAL and its converted copy
+// compare equal.
 //
 // Use cases:
 // - Testing
-// - Verify Rotate correctness
+// - Verify Rotate, Convert and Repair correctness
+//
+// Returns:
+//
+//	One line per difference (empty if the WALs hold the same events), error
 func CompareWAL(path1, path2 string) ([]string, error) {
-	// TODO: Implement WAL comparison (optional)
-	// 1. Read all events from both files
-	// 2. Compare:
-	//    - Event count
-	//    - Content of each event
-	// 3. Return difference list
+	events1, err := readEventsBySeq(path1)
+	if err != nil {
+		return nil, err
+	}
+	events2, err := readEventsBySeq(path2)
+	if err != nil {
+		return nil, err
+	}
+
+	seqs := make([]uint64, 0, len(events1))
+	for seq := range events1 {
+		seqs = append(seqs, seq)
+	}
+	for seq := range events2 {
+		if _, ok := events1[seq]; !ok {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	var diffs []string
+	for _, seq := range seqs {
+		a, inA := events1[seq]
+		b, inB := events2[seq]
+		switch {
+		case !inB:
+			diffs = append(diffs, fmt.Sprintf("seq %d: only in %s (%s %s)", seq, path1, a.Type, a.JobID))
+		case !inA:
+			diffs = append(diffs, fmt.Sprintf("seq %d: only in %s (%s %s)", seq, path2, b.Type, b.JobID))
+		default:
+			if fields := eventDiff(a, b); len(fields) > 0 {
+				diffs = append(diffs, fmt.Sprintf("seq %d: %v differ", seq, fields))
+			}
+		}
+	}
+	return diffs, nil
+}
+
+// readEventsBySeq reads the readable events of a WAL keyed by seq
+func readEventsBySeq(path string) (map[uint64]*Event, error) {
+	events := make(map[uint64]*Event)
+	err := WalkWAL(path, func(rec *Record, _ *Issue) error {
+		if rec != nil {
+			events[rec.Event.Seq] = &rec.Event
+		}
+		return nil
+	})
+	return events, err
+}
 
-	return nil, nil
+// eventDiff returns the JSON names of the fields that differ between two
+// events, ignoring the checksum
+func eventDiff(a, b *Event) []string {
+	var fields []string
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	for i := 0; i < va.NumField(); i++ {
+		field := va.Type().Field(i)
+		if field.Name == "Checksum" {
+			continue
+		}
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			fields = append(fields, field.Name)
+		}
+	}
+	return fields
 }
 
 // ============================================================================
@@ -179,22 +779,59 @@ func CompareWAL(path1, path2 string) ([]string, error) {
 
 // WALStats WAL statistics information
 type WALStats struct {
-	TotalEvents    int               // Total number of events
-	EventTypes     map[EventType]int // Event count by type
-	FirstSeq       uint64            // Sequence number of first event
-	LastSeq        uint64            // Sequence number of last event
-	TimeRange      [2]int64          // Time range [earliest, latest]
-	CorruptedCount int               // Number of corrupted events
+	Segments       int               `json:"segments"`        // Number of segment files
+	TotalBytes     int64             `json:"total_bytes"`     // Size of all segment files
+	TotalEvents    int               `json:"total_events"`    // Total number of events
+	EventTypes     map[EventType]int `json:"event_types"`     // Event count by type
+	FirstSeq       uint64            `json:"first_seq"`       // Sequence number of first event
+	LastSeq        uint64            `json:"last_seq"`        // Sequence number of last event
+	TimeRange      [2]int64          `json:"time_range"`      // Time range [earliest, latest]
+	CorruptedCount int               `json:"corrupted_count"` // Number of corrupted regions
+	TornTail       bool              `json:"torn_tail"`       // A segment ends in a torn record
 }
 
 // GetWALStats retrieves WAL statistics
 func GetWALStats(path string) (*WALStats, error) {
-	// TODO: Implement statistics collection
-	// 1. Scan entire WAL
-	// 2. Collect various statistics
-	// 3. Return WALStats structure
+	files, err := walFiles(vfs.OS, path)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil, nil
+	stats := &WALStats{Segments: len(files), EventTypes: make(map[EventType]int)}
+	for _, file := range files {
+		stats.TotalBytes += file.Size
+	}
+
+	err = WalkWAL(path, func(rec *Record, issue *Issue) error {
+		if issue != nil {
+			if issue.Kind == IssueTorn {
+				stats.TornTail = true
+			} else {
+				stats.CorruptedCount++
+			}
+			return nil
+		}
+
+		e := &rec.Event
+		if stats.TotalEvents == 0 {
+			stats.FirstSeq = e.Seq
+			stats.TimeRange = [2]int64{e.Timestamp, e.Timestamp}
+		}
+		stats.TotalEvents++
+		stats.EventTypes[e.Type]++
+		stats.LastSeq = e.Seq
+		if e.Timestamp < stats.TimeRange[0] {
+			stats.TimeRange[0] = e.Timestamp
+		}
+		if e.Timestamp > stats.TimeRange[1] {
+			stats.TimeRange[1] = e.Timestamp
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
 }
 
 // TODO: Other utility tools to consider
@@ -203,14 +840,10 @@ func GetWALStats(path string) (*WALStats, error) {
 //    - Merge multiple WAL files into one
 //    - For historical data consolidation
 //
-// 2. WAL Split:
-//    - Split large WAL file into multiple smaller files
-//    - Split by time or seq range
-//
-// 3. WAL Compaction:
+// 2. WAL Compaction:
 //    - Remove ENQUEUE/DISPATCH/ACK events for completed jobs
 //    - Keep only necessary events (e.g., Dead jobs)
 //
-// 4. WAL Export:
+// 3. WAL Export:
 //    - Convert to other formats (CSV, Parquet)
 //    - For data analysis
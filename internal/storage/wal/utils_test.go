@@ -0,0 +1,233 @@
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================================================
+// WAL Utility Tests
+// ============================================================================
+
+// writeSegmentedWAL writes seqs 1..3 to a sealed segment and 4..6 to the
+// active one
+func writeSegmentedWAL(t *testing.T, encoding Encoding) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.wal")
+	w, err := NewWALWithOptions(path, Options{BufferSize: 10, FlushInterval: time.Millisecond, Encoding: encoding})
+	require.NoError(t, err)
+	appendJobs(t, w, 1, 3)
+	require.NoError(t, w.Rotate())
+	appendJobs(t, w, 4, 5)
+	require.NoError(t, w.Append(EventAck, &types.Job{ID: "job_5"}))
+	require.NoError(t, w.Close())
+	return path
+}
+
+// corruptRecord overwrites the start of the n-th record of a segment file
+func corruptRecord(t *testing.T, path string, n int) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	off := recordOffsets(t, path)[n]
+	copy(data[off:], "XXXXXX")
+	require.NoError(t, os.WriteFile(path, data, 0644))
+}
+
+func TestGetLastEventAndCount(t *testing.T) {
+	path := writeSegmentedWAL(t, EncodingJSON)
+
+	last, err := GetLastEvent(path)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(6), last.Seq)
+	assert.Equal(t, EventAck, last.Type)
+
+	count, err := CountEvents(path)
+	require.NoError(t, err)
+	assert.Equal(t, 6, count)
+
+	// Falls back to the sealed segment when the active one is empty
+	require.NoError(t, os.Truncate(path, 0))
+	last, err = GetLastEvent(path)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), last.Seq)
+
+	_, err = GetLastEvent(filepath.Join(t.TempDir(), "missing.wal"))
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestValidateWAL(t *testing.T) {
+	for _, encoding := range []Encoding{EncodingJSON, EncodingBinary} {
+		t.Run(string(encoding), func(t *testing.T) {
+			path := writeSegmentedWAL(t, encoding)
+			require.NoError(t, ValidateWAL(path))
+
+			corruptRecord(t, segmentName(path, 1), 1)
+			err := ValidateWAL(path)
+			var invalid *ValidationError
+			require.True(t, errors.As(err, &invalid), "got %v", err)
+
+			// The corrupted record is reported and leaves a seq gap
+			kinds := make([]string, 0, len(invalid.Issues))
+			for _, issue := range invalid.Issues {
+				kinds = append(kinds, issue.Kind)
+			}
+			assert.Equal(t, []string{IssueCorrupt, IssueSeqGap}, kinds)
+			assert.Equal(t, segmentName(path, 1), invalid.Issues[0].Path)
+			assert.Equal(t, uint64(3), invalid.Issues[1].Seq)
+
+			// Reading resumes after the damage
+			count, err := CountEvents(path)
+			require.NoError(t, err)
+			assert.Equal(t, 5, count)
+		})
+	}
+}
+
+func TestRepairWAL(t *testing.T) {
+	path := writeSegmentedWAL(t, EncodingBinary)
+	corruptRecord(t, path, 0)
+	require.NoError(t, os.Truncate(path, fileSize(t, path)-2))
+
+	dst := filepath.Join(t.TempDir(), "repaired.wal")
+	result, err := RepairWAL(path, dst)
+	require.NoError(t, err)
+	assert.Equal(t, 4, result.Events) // Seq 4 corrupted, seq 6 torn
+	require.Len(t, result.Dropped, 2)
+	assert.Equal(t, IssueCorrupt, result.Dropped[0].Kind)
+	assert.Equal(t, IssueTorn, result.Dropped[1].Kind)
+
+	encoding, err := detectEncoding(vfs.OS, dst)
+	require.NoError(t, err)
+	assert.Equal(t, EncodingBinary, encoding)
+
+	// Sequence numbers are kept
+	w, err := NewWALWithOptions(dst, Options{Encoding: EncodingBinary})
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{1, 2, 3, 5}, collectSeqs(t, w, 0))
+	require.NoError(t, w.Close())
+
+	// In place: originals are kept as backups
+	result, err = RepairWAL(path, path)
+	require.NoError(t, err)
+	assert.Equal(t, 4, result.Events)
+	assert.FileExists(t, path+".bak")
+	assert.FileExists(t, segmentName(path, 1)+".bak")
+	assert.NoFileExists(t, segmentName(path, 1))
+	last, err := GetLastEvent(path)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), last.Seq)
+}
+
+func TestTruncateWAL(t *testing.T) {
+	path := writeSegmentedWAL(t, EncodingJSON)
+
+	// Cut inside the active segment
+	removed, err := TruncateWAL(path, 5)
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	last, err := GetLastEvent(path)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), last.Seq)
+
+	// Cut inside the sealed segment: the active one is deleted and the
+	// remaining segment becomes active
+	removed, err = TruncateWAL(path, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	assert.NoFileExists(t, segmentName(path, 1))
+
+	w, err := NewWAL(path, false, 10, time.Millisecond)
+	require.NoError(t, err)
+	defer w.Close()
+	assert.Equal(t, uint64(2), w.GetLastSeq())
+	appendJobs(t, w, 3, 3)
+	assert.Equal(t, []uint64{1, 2, 3}, collectSeqs(t, w, 0))
+}
+
+func TestTruncateWALBelowFloor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+	w, err := NewWAL(path, false, 10, time.Millisecond)
+	require.NoError(t, err)
+	appendJobs(t, w, 1, 3)
+	require.NoError(t, w.AdvanceTo(10))
+	appendJobs(t, w, 4, 5)
+	require.NoError(t, w.Close())
+
+	// A snapshot covers seqs up to 10: refuse and keep everything
+	for _, seq := range []uint64{2, 10} {
+		removed, err := TruncateWAL(path, seq)
+		assert.ErrorIs(t, err, ErrBelowFloor)
+		assert.Zero(t, removed)
+	}
+	count, err := CountEvents(path)
+	require.NoError(t, err)
+	assert.Equal(t, 5, count)
+
+	// Above the floor it truncates as usual
+	removed, err := TruncateWAL(path, 12)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	w, err = NewWAL(path, false, 10, time.Millisecond)
+	require.NoError(t, err)
+	defer w.Close()
+	assert.Equal(t, uint64(11), w.GetLastSeq())
+	appendJobs(t, w, 6, 6)
+	assert.Equal(t, []uint64{1, 2, 3, 11, 12}, collectSeqs(t, w, 0))
+}
+
+func TestDumpAndCompareWAL(t *testing.T) {
+	path := writeSegmentedWAL(t, EncodingJSON)
+
+	var out bytes.Buffer
+	require.NoError(t, DumpWAL(path, &out))
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	require.Len(t, lines, 6)
+	assert.Contains(t, string(lines[0]), "[Seq:1] ENQUEUE job_1 at ")
+	assert.Contains(t, string(lines[5]), "[Seq:6] ACK job_5")
+
+	// A converted copy holds the same events
+	copyPath := filepath.Join(t.TempDir(), "copy.wal")
+	_, err := ConvertFile(segmentName(path, 1), copyPath, EncodingBinary)
+	require.NoError(t, err)
+	diffs, err := CompareWAL(segmentName(path, 1), copyPath)
+	require.NoError(t, err)
+	assert.Empty(t, diffs)
+
+	// ...while the full WAL has three more than its sealed segment
+	diffs, err = CompareWAL(segmentName(path, 1), path)
+	require.NoError(t, err)
+	require.Len(t, diffs, 3)
+	assert.Contains(t, diffs[0], "seq 4: only in "+path)
+
+	corruptRecord(t, path, 0)
+	out.Reset()
+	require.NoError(t, DumpWAL(path, &out))
+	assert.Contains(t, out.String(), "!! corrupt in test.wal at offset 0")
+}
+
+func TestGetWALStats(t *testing.T) {
+	path := writeSegmentedWAL(t, EncodingJSON)
+	require.NoError(t, os.Truncate(path, fileSize(t, path)-2))
+
+	stats, err := GetWALStats(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Segments)
+	assert.Equal(t, 5, stats.TotalEvents)
+	assert.Equal(t, 5, stats.EventTypes[EventEnqueue])
+	assert.Equal(t, uint64(1), stats.FirstSeq)
+	assert.Equal(t, uint64(5), stats.LastSeq)
+	assert.True(t, stats.TornTail)
+	assert.Zero(t, stats.CorruptedCount)
+	assert.LessOrEqual(t, stats.TimeRange[0], stats.TimeRange[1])
+}
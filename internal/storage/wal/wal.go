@@ -47,14 +47,20 @@
 //   └─────────────┘
 //
 // Data Format:
-//   Each WAL record contains:
+//   Each WAL record contains (schema V2, see types.go):
 //   {
+//     "v": 2,                    // Event schema version (absent in V1 files)
 //     "seq": 12345,              // Sequence number, monotonically increasing
-//     "type": "JobEnqueued",     // Event type
+//     "type": "ENQUEUE",         // Event type
 //     "timestamp": 1698765432,   // Unix millisecond timestamp
 //     "job_id": "job-123",       // Job ID
-//     "payload": {...}           // Event-related data
+//     "payload": {...},          // Job payload (ENQUEUE only)
+//     "timeout_ms": 5000,        // Job timeout
+//     "attempt": 0,              // Job attempt count
+//     "deadline_ms": 1698765437  // Job deadline, if in flight
 //   }
+//   V1 files (no "v" field) stay readable; their ENQUEUE events cannot
+//   rebuild a job and rely on the snapshot instead.
 //
 // Event Types:
 //   - JobEnqueued: Job enqueued
@@ -70,28 +76,42 @@
 //   - Reduce fsync call count (fsync is expensive)
 //   - Trade-off: Latency vs Throughput
 //
-// Log Rotation:
-//   After periodic snapshot creation, old WAL can be cleared:
-//   1. Create system snapshot
-//   2. Compress old WAL (optional)
-//   3. Create new WAL file
-//   4. Delete or archive old files
+// Segments (see segment.go):
+//   The WAL is a sequence of segment files sharing one monotonically
+//   increasing sequence number:
+//   1. Appends go to the active segment at the configured path
+//   2. At MaxSegmentSize (or on Rotate) the active segment is sealed,
+//      i.e. renamed after its starting seq, and a new one is opened
+//   3. ReplayFrom(lastSeq) skips segments a snapshot fully covers
+//   4. Prune deletes covered segments once they outlive Retention, or
+//      compresses them into Options.Archive first (see archive.go)
+//   5. Compact drops finished job chains from covered segments
+//      (see compaction.go)
+//   6. Subscribe streams committed events across segments
+//      (see subscribe.go)
 //
 // Data Integrity:
-//   - Checksum: Each record includes checksum
+//   - Checksum: Each record carries a CRC32C of the whole record (see checksum.go)
 //   - Atomic Write: Use append-only mode
-//   - Fsync: Ensure data actually written to disk
-//   - Skip corrupted records during replay
+//   - Fsync: Ensure data actually written to disk (per batch by default;
+//     Options.SyncMode trades durability for speed, see durability.go)
+//   - Torn tail: An incomplete final record (crash mid-write) is truncated
+//     with a warning when the WAL is opened
+//   - Corruption: A bad record followed by more data fails replay with a
+//     *CorruptionError carrying the file and byte offset
+//   - Encryption: Options.Keyring seals payloads with AES-GCM under
+//     rotatable key IDs (see encryption.go)
 //
 // Performance Considerations:
 //   - Batch writing reduces I/O count
 //   - JSON format convenient for debugging but has performance overhead
-//   - Consider using binary format (Protocol Buffers)
+//   - Binary format (Options.Encoding, see codec.go) is smaller, faster and
+//     frames each record with a length and CRC32C
 //   - sync.Mutex ensures concurrency safety
 //
 // Error Handling:
 //   - Write failure: Return error, caller decides whether to retry
-//   - Replay failure: Skip corrupted records, log warnings
+//   - Replay failure: Torn tails are dropped, corruption stops recovery
 //   - Disk full: Requires external monitoring and alerts
 //
 // Collaboration with Snapshot:
@@ -114,6 +134,7 @@ package wal
 import (
 	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -121,45 +142,103 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ChuLiYu/raft-recovery/internal/encryption"
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
 	"github.com/ChuLiYu/raft-recovery/pkg/types"
 )
 
 // FileInterface defines the methods required for file operations
-// This allows mocking file operations in tests
+// This allows mocking file operations in tests (Options.FS replaces the
+// whole filesystem, see internal/storage/vfs)
 type FileInterface interface {
 	Write(p []byte) (n int, err error)
 	Sync() error
 	Close() error
 }
 
-// batchRequest represents a single append request with response channel
+// batchRequest represents one append request with response channel
+// Its events are always flushed and synced together (see AppendBatch).
 type batchRequest struct {
-	event Event
+	events []Event
+	errCh  chan error
+	queued time.Time // When the request was submitted
+}
+
+// controlRequest runs fn inside the batch writer, between two batches
+type controlRequest struct {
+	fn    func() error
 	errCh chan error
 }
 
 // WAL represents a Write-Ahead Log instance
 type WAL struct {
 	mu           sync.Mutex    // Protects concurrent writes
-	file         FileInterface // WAL file
-	encoder      *json.Encoder // JSON encoder
-	path         string        // WAL file path
-	seq          uint64        // Current event sequence number
+	fs           vfs.FS        // Filesystem holding the segments
+	file         FileInterface // Active segment file
+	encoder      recordEncoder // Record encoder for the active segment
+	encoding     Encoding      // Format of new segments
+	path         string        // Active segment path (sealed segments are path.<start seq>)
+	seq          uint64        // Last assigned event sequence number
 	syncOnAppend bool          // Whether to force sync on every append (deprecated, use batch commit)
 
+	// Durability fields (see durability.go)
+	syncMode     SyncMode      // When batches are synced
+	syncInterval time.Duration // Background sync period (SyncPeriodic)
+	preallocate  int64         // Bytes reserved for each new segment (0 = off)
+	dirty        bool          // Active segment has unsynced writes
+	failed       error         // Set when a failed batch could not be rolled back; fails every later append
+
+	// Encryption fields (see encryption.go)
+	keyring *encryption.Keyring // Seals new payloads, opens sealed ones (nil = off)
+	sealer  *encryption.Sealer  // Data key for this process's writes
+
+	// Segment fields
+	segmentStart   uint64         // First seq of the active segment
+	segmentSize    int64          // Bytes in the active segment
+	index          *segmentIndex  // Sparse index of the active segment (see index.go)
+	maxSegmentSize int64          // Seal the active segment at this size (0 = only on Rotate)
+	retention      time.Duration  // Minimum age before Prune may delete a covered segment
+	archive        ArchiveOptions // Where pruned segments are kept (see archive.go)
+
 	// Batch commit fields
-	batchChan     chan batchRequest // Channel for batch requests
-	bufferSize    int               // Max batch size before flush
-	flushInterval time.Duration     // Max time between flushes
-	closed        chan struct{}     // Close signal
-	wg            sync.WaitGroup    // Wait for batch writer to finish
-	isClosed      bool              // Flag to prevent double close/rotate
+	batchChan     chan batchRequest   // Channel for batch requests
+	controlChan   chan controlRequest // Segment switches and other work for the batch writer
+	bufferSize    int                 // Max batch size before flush
+	flushInterval time.Duration       // Max time between flushes
+	commit        *groupCommit        // Adaptive group commit estimates (nil = fixed batching, see group_commit.go)
+	metrics       Metrics             // Group commit observer (nil = not exported)
+	closed        chan struct{}       // Close signal
+	sendMu        sync.RWMutex        // Held (read) while sending to the writer, (write) by Close before signaling
+	wg            sync.WaitGroup      // Wait for batch writer to finish
+	isClosed      bool                // Flag to prevent double close
+
+	// Change data capture (see subscribe.go)
+	subs     map[*subscriber]struct{} // Active subscriptions
+	shutdown chan struct{}            // Closed by Close, ends subscriptions
 
 	// Legacy fields (for backward compatibility during migration)
 	buffer        []Event   // Batch write event buffer
 	lastFlushTime time.Time // Last flush time
 }
 
+// Options configures a WAL opened with NewWALWithOptions
+type Options struct {
+	BufferSize     int                 // Max events per batch (default 100)
+	FlushInterval  time.Duration       // Max time between flushes (default 10ms)
+	MaxSegmentSize int64               // Seal the active segment once it reaches this many bytes (0 = only on Rotate)
+	Retention      time.Duration       // Keep snapshot-covered segments at least this long (0 = prune immediately)
+	Encoding       Encoding            // Record format for new segments (default JSON)
+	Archive        ArchiveOptions      // Compress pruned segments into an archive instead of only deleting them
+	SyncMode       SyncMode            // When batches reach the disk (default SyncBatch, see durability.go)
+	SyncInterval   time.Duration       // Background sync period for SyncPeriodic (default 100ms)
+	Preallocate    int64               // Reserve this many bytes for each new segment (0 = off)
+	LatencyTarget  time.Duration       // p99 Append latency for adaptive group commit (0 = fixed BufferSize/FlushInterval batching)
+	Keyring        *encryption.Keyring // Encrypt payloads at rest (nil = off, see encryption.go)
+	Metrics        Metrics             // Observes group sizes and latencies (nil = not exported)
+	FS             vfs.FS              // Filesystem for segments and archive (default vfs.OS)
+	SyncOnAppend   bool                // Deprecated and ignored, use SyncMode
+}
+
 // SnapshotData represents the metadata for a snapshot
 // This is used to integrate WAL with snapshot recovery
 type SnapshotData struct {
@@ -186,64 +265,133 @@ type SnapshotData struct {
 //   - *WAL: WAL instance with background batch writer running
 //   - error: if initialization fails
 func NewWAL(path string, syncOnAppend bool, bufferSize int, flushInterval time.Duration) (*WAL, error) {
+	return NewWALWithOptions(path, Options{
+		BufferSize:    bufferSize,
+		FlushInterval: flushInterval,
+		SyncOnAppend:  syncOnAppend,
+	})
+}
+
+// NewWALWithOptions opens the segmented WAL at path
+//
+// The sequence number continues from the last event found in the active
+// segment, or in the newest sealed segment if the active one is empty.
+//
+// Parameters:
+//   - path: Active segment path; sealed segments live next to it
+//   - opts: Batch and segment settings (zero values use defaults)
+//
+// Returns:
+//   - *WAL: WAL instance with background batch writer running
+//   - error: if initialization fails
+func NewWALWithOptions(path string, opts Options) (*WAL, error) {
+	fsys := vfs.Default(opts.FS)
+
 	// Ensure the directory exists before opening the file
 	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	if err := fsys.MkdirAll(dir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create WAL directory: %w", err)
 	}
 
-	// Open WAL file with O_CREATE | O_APPEND | O_RDWR mode
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
+	encoding, err := ParseEncoding(string(opts.Encoding))
 	if err != nil {
-		// Return error directly if file open fails
-		return nil, fmt.Errorf("failed to open WAL file: %w", err)
+		return nil, err
+	}
+	syncMode, err := ParseSyncMode(string(opts.SyncMode))
+	if err != nil {
+		return nil, err
+	}
+	syncInterval := opts.SyncInterval
+	if syncInterval <= 0 {
+		syncInterval = defaultSyncInterval
 	}
 
-	// Wrap file with JSON Encoder for convenient event writing
-	encoder := json.NewEncoder(file)
-
-	// Initialize event sequence number, default is 0
-	var seq uint64 = 0
+	if err := recoverCompaction(fsys, path); err != nil {
+		return nil, err
+	}
+	if opts.Archive.enabled() {
+		if err := archiveLegacyFiles(fsys, opts.Archive, path); err != nil {
+			return nil, fmt.Errorf("failed to archive rotated WAL files: %w", err)
+		}
+	}
 
-	// If file is not empty, try to read last event to get seq
-	if lastEvent, err := GetLastEvent(path); err == nil && lastEvent != nil {
-		seq = lastEvent.Seq
-	} else if err != ErrEmptyWAL && err != nil {
-		// If file is corrupted or other error occurs
-		fmt.Printf("Warning: failed to get last event, starting from seq=0: %v\n", err)
-		// If read fails or file is corrupted, seq can remain 0, decide based on requirements
+	seq, segmentStart, index, err := recoverSeq(fsys, path)
+	if err != nil {
+		return nil, err
 	}
 
 	// Set default values if not provided
+	bufferSize := opts.BufferSize
 	if bufferSize <= 0 {
 		bufferSize = 100 // Default: 100 events per batch
 	}
+	flushInterval := opts.FlushInterval
 	if flushInterval <= 0 {
 		flushInterval = 10 * time.Millisecond // Default: 10ms
 	}
 
 	// Create WAL instance, inject state
 	wal := &WAL{
-		file:         file,
-		encoder:      encoder,
+		fs:           fsys,
 		path:         path,
 		seq:          seq,
-		syncOnAppend: syncOnAppend,
+		syncOnAppend: opts.SyncOnAppend,
+		encoding:     encoding,
+
+		syncMode:     syncMode,
+		syncInterval: syncInterval,
+		preallocate:  opts.Preallocate,
+
+		keyring: opts.Keyring,
+
+		segmentStart:   segmentStart,
+		maxSegmentSize: opts.MaxSegmentSize,
+		retention:      opts.Retention,
+		archive:        opts.Archive,
 
 		// Batch commit setup
 		batchChan:     make(chan batchRequest, bufferSize*2), // Buffer is 2x batch size to avoid blocking
 		bufferSize:    bufferSize,
+		controlChan:   make(chan controlRequest),
 		flushInterval: flushInterval,
+		metrics:       opts.Metrics,
 		closed:        make(chan struct{}),
 
+		subs:     make(map[*subscriber]struct{}),
+		shutdown: make(chan struct{}),
+
 		// Legacy fields
 		buffer:        make([]Event, 0, bufferSize),
 		lastFlushTime: time.Now(),
 	}
+	wal.setIndexLocked(index)
+	if opts.LatencyTarget > 0 {
+		wal.commit = newGroupCommit(opts.LatencyTarget)
+	}
+
+	// Open the active segment with O_CREATE | O_APPEND | O_RDWR mode
+	if err := wal.openActiveLocked(); err != nil {
+		return nil, err
+	}
+
+	// A segment holds a single format: if the configured encoding changed,
+	// seal the existing active segment and continue in a new one
+	if current, err := detectEncoding(fsys, path); err != nil {
+		wal.file.Close()
+		return nil, fmt.Errorf("failed to read WAL file: %w", err)
+	} else if current != "" && current != encoding {
+		if err := wal.sealActiveLocked(); err != nil {
+			wal.file.Close()
+			return nil, err
+		}
+	}
 
 	// Start background batch writer goroutine
 	wal.wg.Add(1)
 	go wal.batchWriter()
+	if syncMode == SyncPeriodic {
+		go wal.syncLoop()
+	}
 
 	// Return WAL instance
 	return wal, nil
@@ -269,40 +417,38 @@ func NewWAL(path string, syncOnAppend bool, bufferSize int, flushInterval time.D
 //
 //	error (if write fails or WAL is closed)
 func (w *WAL) Append(eventType EventType, job *types.Job) error {
-	// Increment seq and create event (still needs lock for seq)
-	w.mu.Lock()
-	w.seq++
-	seq := w.seq
-	w.mu.Unlock()
-
-	timestamp := time.Now().UnixMilli()
-	checksum := CalculateChecksum(eventType, *job, seq)
-
-	event := Event{
-		Seq:       seq,
-		Type:      eventType,
-		JobID:     job.ID,
-		Timestamp: timestamp,
-		Checksum:  checksum,
-	}
+	return w.AppendAsync(eventType, job).Wait()
+}
 
-	// Create response channel
+// submit hands events to the batch writer as one request
+//
+// Returns:
+//   - chan error: Receives the result of the fsync group holding the events
+func (w *WAL) submit(events []Event) chan error {
 	errCh := make(chan error, 1)
 
-	// Send to batch writer (non-blocking with timeout)
-	select {
-	case w.batchChan <- batchRequest{event: event, errCh: errCh}:
-		// Wait for batch to be flushed
-		return <-errCh
-	case <-w.closed:
-		return fmt.Errorf("WAL is closed")
+	// Hold sendMu so Close cannot stop the writer between our check and send
+	w.sendMu.RLock()
+	defer w.sendMu.RUnlock()
+
+	w.mu.Lock()
+	closed := w.isClosed
+	w.mu.Unlock()
+	if closed {
+		errCh <- fmt.Errorf("WAL is closed")
+		return errCh
 	}
+
+	// Send to batch writer; it drains the channel before exiting, so
+	// every accepted request is answered
+	w.batchChan <- batchRequest{events: events, errCh: errCh, queued: time.Now()}
+	return errCh
 }
 
 // Replay replays all WAL events
 //
 // Behavior:
-// - Read WAL file from beginning
+// - Read every segment from the oldest to the active one
 // - Verify checksum of each event
 // - Call handler to apply event
 // - Stop immediately on error
@@ -315,21 +461,170 @@ func (w *WAL) Append(eventType EventType, job *types.Job) error {
 //
 //	error (if replay fails)
 func (w *WAL) Replay(handler func(event *Event) error) error {
+	return w.ReplayFrom(0, handler)
+}
+
+// ReplayFrom replays events with a sequence number greater than afterSeq
+//
+// Sealed segments that end at or before afterSeq are not opened at all,
+// so recovery cost is bounded by the WAL written since the snapshot.
+// Events older than the oldest local segment are read from the archive,
+// if one is configured.
+//
+// Parameters:
+//
+//	afterSeq - Last sequence number already covered (e.g. snapshot LastSeq)
+//	handler  - Event handler function; may return ErrStopReplay to stop early
+//
+// Returns:
+//
+//	error (if replay fails)
+func (w *WAL) ReplayFrom(afterSeq uint64, handler func(event *Event) error) error {
 	// Acquire lock to avoid conflicts with other operations
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	return w.replayFromLocked(afterSeq, handler)
+}
+
+// replayFromLocked implements ReplayFrom; caller must hold w.mu
+func (w *WAL) replayFromLocked(afterSeq uint64, handler func(event *Event) error) error {
+	handler = w.openingHandler(handler)
+
+	history, err := w.sealedHistoryLocked(afterSeq)
+	if err != nil {
+		return err
+	}
+	err = w.replaySealed(history, afterSeq, true, handler)
+	if err == nil {
+		err = replaySegment(w.fs, w.path, afterSeq, true, w.index, handler)
+	}
+	if errors.Is(err, ErrStopReplay) {
+		return nil
+	}
+	return err
+}
+
+// sealedHistory lists the WAL files before the active segment: archived
+// and sealed segments, which are never appended to
+type sealedHistory struct {
+	archived     []ArchiveEntry
+	sealed       []Segment
+	segmentStart uint64 // Start seq of the active segment when listed
+}
+
+// sealedHistoryLocked lists the archived and sealed segments replay reads
+// for events after afterSeq; caller must hold w.mu
+func (w *WAL) sealedHistoryLocked(afterSeq uint64) (*sealedHistory, error) {
+	sealed, err := listSealedSegments(w.fs, w.path)
+	if err != nil {
+		return nil, err
+	}
+
+	// History older than the local segments comes from the archive
+	firstLocal := w.segmentStart
+	if len(sealed) > 0 {
+		firstLocal = sealed[0].StartSeq
+	}
+	archived, err := w.archivedBefore(afterSeq, firstLocal)
+	if err != nil {
+		return nil, err
+	}
+	return &sealedHistory{archived: archived, sealed: sealed, segmentStart: w.segmentStart}, nil
+}
+
+// replaySealed replays the events after afterSeq in history
+//
+// It needs no lock, but without one a concurrent Prune or Compact may
+// remove or rewrite the files (see readCommitted), and missing indexes are
+// only rebuilt when locked is set.
+//
+// Returns:
+//   - error: First read or handler error, including ErrStopReplay
+func (w *WAL) replaySealed(history *sealedHistory, afterSeq uint64, locked bool, handler func(event *Event) error) error {
+	for _, entry := range history.archived {
+		path := filepath.Join(w.archive.Dir, entry.File)
+		src, err := readArchived(w.fs, path)
+		if err != nil {
+			return err
+		}
+		if err := replayRecords(src, path, afterSeq, false, handler); err != nil {
+			return err
+		}
+	}
+
+	for i, seg := range history.sealed {
+		nextStart := history.segmentStart
+		if i+1 < len(history.sealed) {
+			nextStart = history.sealed[i+1].StartSeq
+		}
+		if nextStart > 0 && nextStart-1 <= afterSeq {
+			continue // Fully covered
+		}
+		// Only a segment with a covered prefix needs its index
+		var index *segmentIndex
+		if seg.StartSeq <= afterSeq {
+			if locked {
+				index = sealedIndex(w.fs, seg.Path)
+			} else {
+				index = readIndex(w.fs, seg.Path, true)
+			}
+		}
+		if err := replaySegment(w.fs, seg.Path, afterSeq, false, index, handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+// replaySegment replays the events of one segment file after afterSeq
+//
+// With an index, decoding starts at the indexed record closest before
+// afterSeq+1 instead of the beginning of the file. A torn final record in
+// the active segment (only possible if it was torn after the WAL was
+// opened) ends the replay with a warning. Torn records in sealed segments
+// and mid-file corruption fail with *CorruptionError.
+func replaySegment(fsys vfs.FS, path string, afterSeq uint64, active bool, index *segmentIndex, handler func(event *Event) error) error {
 	// Reopen file (read-only mode)
-	file, err := os.Open(w.path)
+	file, err := vfs.Open(fsys, path)
 	if err != nil {
 		return fmt.Errorf("failed to open WAL for replay: %w", err)
 	}
 	defer file.Close()
 
-	// Create JSON decoder
-	decoder := json.NewDecoder(file)
+	if offset, ok := index.seek(afterSeq); ok {
+		return replayDecoded(decoderFrom(file, index.Encoding, offset), file, path, afterSeq, active, handler)
+	}
+	return replayRecords(file, path, afterSeq, active, handler)
+}
+
+// segmentSource is a readable segment: an open file or an archived
+// segment decompressed into memory
+type segmentSource interface {
+	io.Reader
+	io.ReaderAt
+}
+
+// replayRecords replays the events read from src (named path in errors)
+func replayRecords(src segmentSource, path string, afterSeq uint64, active bool, handler func(event *Event) error) error {
+	// Create decoder for the segment's format (JSON or binary)
+	decoder, _, err := newRecordDecoder(src)
+	if err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = &CorruptionError{Path: path, Cause: err}
+			if active {
+				fmt.Printf("Warning: ignoring torn record: %v\n", err)
+				return nil
+			}
+			return err
+		}
+		return fmt.Errorf("failed to read WAL segment %s: %w", path, err)
+	}
+	return replayDecoded(decoder, src, path, afterSeq, active, handler)
+}
 
-	// Loop to read each event
+// replayDecoded replays the events decoder reads from src
+func replayDecoded(decoder recordDecoder, src io.ReaderAt, path string, afterSeq uint64, active bool, handler func(event *Event) error) error {
+	// Loop to read each event; decoders verify checksums
 	for {
 		// Decode event
 		var event Event
@@ -338,12 +633,20 @@ func (w *WAL) Replay(handler func(event *Event) error) error {
 			break
 		}
 		if err != nil {
-			return fmt.Errorf("failed to decode event: %w", err)
+			torn, err := classifyDecodeError(src, path, err)
+			if !torn {
+				return fmt.Errorf("failed to decode event: %w", err)
+			}
+			tornErr := &CorruptionError{Path: path, Offset: decoder.Offset(), Cause: io.ErrUnexpectedEOF}
+			if !active {
+				return tornErr
+			}
+			fmt.Printf("Warning: ignoring torn record: %v\n", tornErr)
+			break
 		}
 
-		// Verify checksum (using VerifyChecksum)
-		if !VerifyChecksum(event) {
-			return ErrChecksumMismatch
+		if event.Seq <= afterSeq {
+			continue
 		}
 
 		// Call handler(event)
@@ -355,129 +658,212 @@ func (w *WAL) Replay(handler func(event *Event) error) error {
 	return nil
 }
 
-// Rotate rotates the log file
-// Note: Rotation pauses the batch writer temporarily to ensure atomicity
+// Rotate seals the active segment and starts a new one
+// The switch runs inside the batch writer: requests queued before it are
+// flushed to the old segment, requests queued during it wait in the
+// channel and go to the new one, so appends never fail because of a
+// rotation. Sequence numbers continue across segments; an empty active
+// segment is not sealed.
 //
 // Returns:
 //
-//	error (if rotation fails)
+//	error (if rotation fails; the old segment stays active)
 func (w *WAL) Rotate() error {
+	return w.runInWriter(func() error {
+		err := w.sealActiveLocked()
+		w.buffer = w.buffer[:0]
+		w.lastFlushTime = time.Now()
+		return err
+	})
+}
+
+// runInWriter runs fn in the batch writer goroutine with w.mu held, after
+// the batch being collected has been flushed, and waits for its result
+func (w *WAL) runInWriter(fn func() error) error {
+	// Same protocol as Append: Close cannot stop the writer while we send
+	w.sendMu.RLock()
 	w.mu.Lock()
 	if w.isClosed {
 		w.mu.Unlock()
-		return fmt.Errorf("WAL is closed or rotating")
+		w.sendMu.RUnlock()
+		return ErrWALClosed
 	}
-	w.isClosed = true
 	w.mu.Unlock()
 
-	// Stop batch writer temporarily
-	close(w.closed)
-	w.wg.Wait()
-
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	if err := w.file.Close(); err != nil {
-		// Attempt to restore state if possible, or leave it broken
-		// Ideally we should restart writer, but simple for now
-		return err
-	}
-
-	backupPath := w.path + "." + time.Now().Format("20060102_150405")
-	if err := os.Rename(w.path, backupPath); err != nil {
-		return err
-	}
-
-	newFile, err := os.OpenFile(w.path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
-	if err != nil {
-		return err
-	}
-
-	w.file = newFile
-	w.encoder = json.NewEncoder(newFile)
-	w.seq = 0
-	w.buffer = w.buffer[:0]
-	w.lastFlushTime = time.Now()
-
-	// Restart batch writer
-	w.closed = make(chan struct{})
-	w.wg.Add(1)
-	go w.batchWriter()
-	
-	w.isClosed = false // Restore available state
-
-	return nil
+	errCh := make(chan error, 1)
+	w.controlChan <- controlRequest{fn: fn, errCh: errCh}
+	w.sendMu.RUnlock()
+	return <-errCh
 }
 
 // batchWriter runs in background to flush batches
 // This is the core of async batch commit optimization
 func (w *WAL) batchWriter() {
 	defer w.wg.Done()
+	if w.commit != nil {
+		w.adaptiveBatchWriter()
+		return
+	}
 
 	ticker := time.NewTicker(w.flushInterval)
 	defer ticker.Stop()
 
 	batch := make([]batchRequest, 0, w.bufferSize)
+	pending := 0 // Events in batch
 
 	for {
 		select {
 		case req := <-w.batchChan:
 			// Accumulate requests
 			batch = append(batch, req)
+			pending += len(req.events)
 
 			// Flush when batch is full
-			if len(batch) >= w.bufferSize {
+			if pending >= w.bufferSize {
 				w.flushBatch(batch)
-				batch = batch[:0]
+				batch, pending = batch[:0], 0
 			}
 
-		case <-ticker.C:
-			// Periodic flush to avoid high latency
+		case req := <-w.controlChan:
+			// Everything collected so far belongs before the control work
 			if len(batch) > 0 {
 				w.flushBatch(batch)
-				batch = batch[:0]
+				batch, pending = batch[:0], 0
 			}
+			w.runControl(req)
 
-		case <-w.closed:
-			// Flush remaining batch before shutdown
+		case <-ticker.C:
+			// Periodic flush to avoid high latency
 			if len(batch) > 0 {
 				w.flushBatch(batch)
+				batch, pending = batch[:0], 0
 			}
+
+		case <-w.closed:
+			w.drainAndFlush(batch)
 			return
 		}
 	}
 }
 
+// runControl runs a control request between two batches
+func (w *WAL) runControl(req controlRequest) {
+	w.mu.Lock()
+	err := req.fn()
+	w.mu.Unlock()
+	req.errCh <- err
+}
+
+// drainAndFlush flushes batch plus every request accepted before shutdown
+func (w *WAL) drainAndFlush(batch []batchRequest) {
+	for {
+		select {
+		case req := <-w.batchChan:
+			batch = append(batch, req)
+			continue
+		default:
+		}
+		break
+	}
+	if len(batch) > 0 {
+		w.flushBatch(batch)
+	}
+}
+
 // flushBatch writes a batch of events and syncs to disk
 // This is where the magic happens: N events → 1 fsync
 func (w *WAL) flushBatch(batch []batchRequest) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	var flushErr error
+	flushErr := w.failed
+	startSeq, startSize, startIndex := w.seq, w.segmentSize, *w.index
+	start := time.Now()
 
 	// Write all events to file (in-memory buffer)
-	for i := range batch {
-		if err := w.encoder.Encode(batch[i].event); err != nil {
-			flushErr = fmt.Errorf("failed to encode event: %w", err)
-			break
+	count := 0
+	for i := 0; flushErr == nil && i < len(batch); i++ {
+		for j := range batch[i].events {
+			if flushErr = w.writeEventLocked(&batch[i].events[j]); flushErr != nil {
+				break
+			}
 		}
+		count += len(batch[i].events)
 	}
 
-	// Single fsync for entire batch (KEY OPTIMIZATION!)
+	// Single fsync for entire batch (KEY OPTIMIZATION!), or none at all
+	// if the sync mode defers it
 	if flushErr == nil {
-		if err := w.file.Sync(); err != nil {
-			flushErr = fmt.Errorf("failed to sync WAL: %w", err)
+		if err := w.syncBatchLocked(); err != nil {
+			flushErr = fmt.Errorf("%w: %w", ErrSyncFailed, err)
+		}
+	}
+	if flushErr != nil && w.failed == nil {
+		w.rollbackLocked(startSeq, startSize, startIndex)
+	}
+	if flushErr == nil {
+		syncTime := time.Since(start)
+		if w.metrics != nil {
+			w.metrics.ObserveWALGroup(count, syncTime)
+		}
+		if w.commit != nil {
+			w.commit.flushed(syncTime)
+		}
+	}
+
+	// The batch is committed: hand it to subscribers
+	if flushErr == nil && len(w.subs) > 0 {
+		events := make([]Event, 0, count)
+		for i := range batch {
+			events = append(events, batch[i].events...)
+		}
+		w.publishLocked(events)
+	}
+
+	// Seal the segment once it reaches the size limit; the batch is already
+	// durable, so a failure here is reported but does not fail the appends
+	if flushErr == nil && w.maxSegmentSize > 0 && w.segmentSize >= w.maxSegmentSize {
+		if err := w.sealActiveLocked(); err != nil {
+			fmt.Printf("Warning: WAL segment roll-over failed: %v\n", err)
 		}
 	}
 
 	// Respond to all requests in batch
+	done := time.Now()
 	for i := range batch {
 		batch[i].errCh <- flushErr
 		close(batch[i].errCh)
+		latency := done.Sub(batch[i].queued)
+		if w.metrics != nil {
+			w.metrics.ObserveWALAppend(latency)
+		}
+		if w.commit != nil {
+			w.commit.observe(latency)
+		}
 	}
 }
 
+// writeEventLocked assigns the next seq to event and encodes it into the
+// active segment; caller must hold w.mu
+func (w *WAL) writeEventLocked(event *Event) error {
+	w.seq++
+	event.Seq = w.seq
+	stored, err := w.sealLocked(event)
+	if err != nil {
+		return err
+	}
+	offset := w.segmentSize
+	if offset == 0 && w.encoding == EncodingBinary {
+		offset = fileHeaderSize // Written together with the first record
+	}
+	if err := w.encoder.Encode(stored); err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	event.Checksum = stored.Checksum // Set by the encoder
+	w.index.add(event.Seq, offset, w.segmentSize)
+	return nil
+}
+
 // Close closes the WAL gracefully
 // Ensures all pending batches are flushed before closing
 func (w *WAL) Close() error {
@@ -489,8 +875,10 @@ func (w *WAL) Close() error {
 	w.isClosed = true
 	w.mu.Unlock()
 
-	// Signal shutdown to batch writer
+	// Signal shutdown to batch writer once in-progress sends are done
+	w.sendMu.Lock()
 	close(w.closed)
+	w.sendMu.Unlock()
 
 	// Wait for batch writer to finish
 	w.wg.Wait()
@@ -498,10 +886,21 @@ func (w *WAL) Close() error {
 	// Now safe to close file
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	close(w.shutdown)
 
+	syncErr := w.syncDirtyLocked()
+	if syncErr == nil && len(w.index.Entries) > 0 {
+		// Lets the next open skip decoding what this process appended
+		if err := writeIndex(w.fs, w.path, w.index); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
 	if err := w.file.Close(); err != nil {
 		return err
 	}
+	if syncErr != nil {
+		return syncErr
+	}
 
 	// Decision: WAL instance should not be reused after Close.
 	//    Reasons:
@@ -545,8 +944,8 @@ func (w *WAL) flush() error {
 // DEPRECATED: No longer used with async batch commit
 // Batch writes buffered events and syncs to disk
 func (w *WAL) flushLocked() error {
-	for _, event := range w.buffer {
-		if err := w.encoder.Encode(event); err != nil {
+	for i := range w.buffer {
+		if err := w.encoder.Encode(&w.buffer[i]); err != nil {
 			return err
 		}
 	}
@@ -564,7 +963,7 @@ func (w *WAL) flushLocked() error {
 //    - Can record design-related questions here to avoid mixing into function implementation.
 
 // ============================================================================
-// Advanced Optimization: gzip Compression and Multi-file Management (Not referenced yet)
+// Advanced Optimization: gzip Compression and Multi-file Management
 // ============================================================================
 
 // gzip compress WAL file
@@ -572,14 +971,14 @@ func (w *WAL) flushLocked() error {
 // - Only compress during file rotation or snapshot, avoid compressing on every write to prevent performance bottleneck
 // - Add .gz to filename for easy identification
 // - Use io.Pipe + goroutine for async compression to reduce main flow blocking
-// - Add .gz to filename for easy identification
-func compressFile(srcPath, dstPath string) error {
-	srcFile, err := os.Open(srcPath)
+// Used by the archive (see archive.go); dstPath is fsynced before returning.
+func compressFile(fsys vfs.FS, srcPath, dstPath string) error {
+	srcFile, err := vfs.Open(fsys, srcPath)
 	if err != nil {
 		return err
 	}
 	defer srcFile.Close()
-	dstFile, err := os.Create(dstPath)
+	dstFile, err := vfs.Create(fsys, dstPath)
 	if err != nil {
 		return err
 	}
@@ -587,11 +986,18 @@ func compressFile(srcPath, dstPath string) error {
 
 	// Create gzip writer
 	gzipWriter := gzip.NewWriter(dstFile)
-	defer gzipWriter.Close()
 
 	// Copy content directly to compressed file
-	_, err = io.Copy(gzipWriter, srcFile)
-	return err
+	if _, err := io.Copy(gzipWriter, srcFile); err != nil {
+		return err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return err
+	}
+	if err := dstFile.Sync(); err != nil {
+		return err
+	}
+	return dstFile.Close()
 }
 
 // Multi-file management: Automatic WAL file splitting
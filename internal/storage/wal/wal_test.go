@@ -9,10 +9,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/ChuLiYu/raft-recovery/internal/storage/vfs"
 	"github.com/ChuLiYu/raft-recovery/pkg/types"
 	"github.com/stretchr/testify/assert"
 )
@@ -25,6 +27,7 @@ import (
 func TestNewWAL(t *testing.T) {
 	tempFile := "test_wal.log"
 	defer os.Remove(tempFile)
+	defer os.Remove(indexPath(tempFile))
 
 	wal, err := NewWAL(tempFile, true, 100, 10*time.Millisecond)
 	assert.NoError(t, err)
@@ -36,6 +39,7 @@ func TestNewWAL(t *testing.T) {
 func TestAppend(t *testing.T) {
 	tempFile := "test_wal_append.log"
 	defer os.Remove(tempFile)
+	defer os.Remove(indexPath(tempFile))
 
 	wal, err := NewWAL(tempFile, true, 100, 10*time.Millisecond)
 	assert.NoError(t, err)
@@ -84,6 +88,7 @@ func TestAppend(t *testing.T) {
 func TestReplay(t *testing.T) {
 	tempFile := "test_wal_replay.log"
 	defer os.Remove(tempFile)
+	defer os.Remove(indexPath(tempFile))
 
 	wal, err := NewWAL(tempFile, true, 100, 10*time.Millisecond)
 	assert.NoError(t, err)
@@ -125,10 +130,95 @@ func TestReplay(t *testing.T) {
 	}
 }
 
+// TestReplaySelfContainedEvents tests that V2 events carry the full job
+func TestReplaySelfContainedEvents(t *testing.T) {
+	tempFile := "test_wal_v2.log"
+	defer os.Remove(tempFile)
+	defer os.Remove(indexPath(tempFile))
+
+	wal, err := NewWAL(tempFile, true, 100, 10*time.Millisecond)
+	assert.NoError(t, err)
+
+	deadline := time.Now().Add(time.Minute).UnixMilli()
+	job := &types.Job{
+		ID:        "job_v2",
+		Payload:   map[string]interface{}{"url": "https://example.com"},
+		Attempt:   2,
+		Timeout:   5 * time.Second,
+		CreatedAt: 1700000000000,
+		Deadline:  &deadline,
+	}
+	assert.NoError(t, wal.Append(EventEnqueue, job))
+	assert.NoError(t, wal.Append(EventDispatch, job))
+	assert.NoError(t, wal.Close())
+
+	replayed := []Event{}
+	wal, err = NewWAL(tempFile, true, 100, 10*time.Millisecond)
+	assert.NoError(t, err)
+	assert.NoError(t, wal.Replay(func(e *Event) error {
+		replayed = append(replayed, *e)
+		return nil
+	}))
+	assert.NoError(t, wal.Close())
+
+	assert.Len(t, replayed, 2)
+	enqueue := replayed[0]
+	assert.Equal(t, CurrentEventSchema, enqueue.SchemaVersion())
+	assert.True(t, enqueue.HasJob())
+
+	rebuilt := enqueue.Job()
+	assert.Equal(t, job.ID, rebuilt.ID)
+	assert.Equal(t, "https://example.com", rebuilt.Payload["url"])
+	assert.Equal(t, 2, rebuilt.Attempt)
+	assert.Equal(t, 5*time.Second, rebuilt.Timeout)
+	assert.Equal(t, int64(1700000000000), rebuilt.CreatedAt)
+	assert.Equal(t, types.StatusPending, rebuilt.Status)
+
+	// Non-ENQUEUE events omit the payload to keep records small
+	assert.False(t, replayed[1].HasJob())
+	assert.Nil(t, replayed[1].Payload)
+	assert.Equal(t, deadline, *replayed[1].Deadline)
+}
+
+// TestReplayLegacyEvents tests that V1 records written without a version still replay
+func TestReplayLegacyEvents(t *testing.T) {
+	tempFile := "test_wal_v1.log"
+	defer os.Remove(tempFile)
+	defer os.Remove(indexPath(tempFile))
+
+	file, err := os.Create(tempFile)
+	assert.NoError(t, err)
+	for i, eventType := range []EventType{EventEnqueue, EventDispatch} {
+		seq := uint64(i + 1)
+		line := fmt.Sprintf(`{"seq":%d,"type":"%s","job_id":"job_v1","timestamp":1700000000000,"checksum":%d}`+"\n",
+			seq, eventType, CalculateChecksum(eventType, types.Job{ID: "job_v1"}, seq))
+		_, err = file.WriteString(line)
+		assert.NoError(t, err)
+	}
+	file.Close()
+
+	replayed := []Event{}
+	wal, err := NewWAL(tempFile, true, 100, 10*time.Millisecond)
+	assert.NoError(t, err)
+	assert.NoError(t, wal.Replay(func(e *Event) error {
+		replayed = append(replayed, *e)
+		return nil
+	}))
+	assert.NoError(t, wal.Close())
+
+	assert.Len(t, replayed, 2)
+	for _, e := range replayed {
+		assert.Equal(t, EventSchemaV1, e.SchemaVersion())
+		assert.False(t, e.HasJob())
+		assert.Equal(t, types.JobID("job_v1"), e.JobID)
+	}
+}
+
 // TestRotate tests log rotation
 func TestRotate(t *testing.T) {
 	tempFile := "test_wal.log"
 	defer os.Remove(tempFile)
+	defer os.Remove(indexPath(tempFile))
 
 	wal, err := NewWAL(tempFile, true, 100, 10*time.Millisecond)
 	assert.NoError(t, err)
@@ -155,7 +245,7 @@ func TestCompressWALFile(t *testing.T) {
 	_, err = file.WriteString("dummy data")
 	assert.NoError(t, err)
 
-	err = compressFile(srcFile, dstFile)
+	err = compressFile(vfs.OS, srcFile, dstFile)
 	assert.NoError(t, err)
 
 	_, err = os.Stat(dstFile)
@@ -200,6 +290,7 @@ func TestSplitWALFile(t *testing.T) {
 func TestChecksumValidation(t *testing.T) {
 	tempFile := "test_wal.log"
 	defer os.Remove(tempFile)
+	defer os.Remove(indexPath(tempFile))
 
 	wal, err := NewWAL(tempFile, true, 100, 10*time.Millisecond)
 	assert.NoError(t, err)
@@ -254,6 +345,7 @@ func TestChecksumValidation(t *testing.T) {
 func TestCorruptedWAL(t *testing.T) {
 	tempFile := "test_wal.log"
 	defer os.Remove(tempFile)
+	defer os.Remove(indexPath(tempFile))
 
 	// Create WAL file with invalid JSON
 	file, err := os.Create(tempFile)
@@ -275,38 +367,32 @@ func TestCorruptedWAL(t *testing.T) {
 
 // TestSyncFailure tests Sync failure handling
 func TestSyncFailure(t *testing.T) {
-	tempFile := "test_wal_sync_failure.log"
-	defer os.Remove(tempFile)
-
-	// Mock WAL with a file that fails on Sync
-	mockFile := &MockFile{
-		WriteFunc: func(p []byte) (n int, err error) {
-			return len(p), nil
-		},
-		SyncFunc: func() error {
-			return ErrSyncFailed
-		},
+	fsys := vfs.NewMemFS()
+	w := openMemWAL(t, fsys, Options{BufferSize: 1})
+	defer w.Close()
+	assert.NoError(t, appendJob(w, "job_1"))
+	size := func() int64 {
+		info, err := fsys.Stat(crashWALPath)
+		assert.NoError(t, err)
+		return info.Size()
 	}
+	synced := size()
 
-	wal := &WAL{
-		file:          mockFile,
-		seq:           0,
-		buffer:        make([]Event, 0),
-		bufferSize:    1, // Set to 1 to trigger immediate flush
-		lastFlushTime: time.Now().Add(-2 * time.Second),
-		flushInterval: 1 * time.Second,
-	}
-	wal.encoder = json.NewEncoder(mockFile)
+	// The batch is written, then its fsync fails
+	fsys.Inject(vfs.Fault{Op: vfs.OpSync, Path: crashWALPath, Times: 1})
+	err := appendJob(w, "job_2")
+	assert.ErrorIs(t, err, ErrSyncFailed)
 
-	// Attempt to append an event - should trigger flush and fail on Sync
-	event := Event{
-		Type:      "ENQUEUE",
-		JobID:     "job_1",
-		Timestamp: time.Now().UnixMilli(),
-	}
-	err := wal.Append(event.Type, &types.Job{ID: event.JobID})
-	assert.Error(t, err)
-	assert.Equal(t, ErrSyncFailed, err)
+	// Rolled back: the seq and the unsynced bytes are gone
+	assert.Equal(t, uint64(1), w.GetLastSeq())
+	assert.Equal(t, synced, size())
+
+	// The WAL stays usable and the next event takes the freed seq
+	assert.NoError(t, appendJob(w, "job_3"))
+	assert.Equal(t, uint64(2), w.GetLastSeq())
+	crashed := openMemWAL(t, fsys.Crash(), Options{})
+	defer crashed.Close()
+	assert.Equal(t, map[string]bool{"job_1": true, "job_3": true}, replayedJobs(t, crashed))
 }
 
 // ============================================================================
@@ -317,6 +403,7 @@ func TestSyncFailure(t *testing.T) {
 func TestConcurrentAppend(t *testing.T) {
 	tempFile := "test_wal_concurrent_append.log"
 	defer os.Remove(tempFile)
+	defer os.Remove(indexPath(tempFile))
 
 	wal, err := NewWAL(tempFile, true, 100, 10*time.Millisecond)
 	assert.NoError(t, err)
@@ -370,6 +457,7 @@ func TestConcurrentAppend(t *testing.T) {
 func TestConcurrentReplay(t *testing.T) {
 	tempFile := "test_wal_concurrent_replay.log"
 	defer os.Remove(tempFile)
+	defer os.Remove(indexPath(tempFile))
 
 	wal, err := NewWAL(tempFile, true, 100, 10*time.Millisecond)
 	assert.NoError(t, err)
@@ -454,8 +542,7 @@ func TestConcurrentReplay(t *testing.T) {
 
 // TestWALLifecycle tests full lifecycle
 func TestWALLifecycle(t *testing.T) {
-	tempFile := "test_wal_lifecycle.log"
-	defer os.Remove(tempFile)
+	tempFile := filepath.Join(t.TempDir(), "test_wal_lifecycle.log")
 
 	wal, err := NewWAL(tempFile, true, 100, 10*time.Millisecond)
 	assert.NoError(t, err)
@@ -502,19 +589,18 @@ func TestWALLifecycle(t *testing.T) {
 	err = wal.Replay(handler)
 	assert.NoError(t, err)
 
-	// Validate replayed events (should only contain the last 50 events)
-	assert.Equal(t, 50, len(replayedEvents))
+	// Validate replayed events (replay spans the sealed and the active segment)
+	assert.Equal(t, 150, len(replayedEvents))
 	for i, event := range replayedEvents {
-		expectedSeq := uint64(1 + i) // Seq resets to 1 after rotation
+		expectedSeq := uint64(1 + i) // Seq continues across rotation
 		assert.Equal(t, expectedSeq, event.Seq)
-		assert.Equal(t, types.JobID(fmt.Sprintf("job_%d", 101+i)), event.JobID)
+		assert.Equal(t, types.JobID(fmt.Sprintf("job_%d", 1+i)), event.JobID)
 	}
 }
 
 // TestSnapshotIntegration tests integration with Snapshot
 func TestSnapshotIntegration(t *testing.T) {
-	tempFile := "test_wal_snapshot_integration.log"
-	defer os.Remove(tempFile)
+	tempFile := filepath.Join(t.TempDir(), "test_wal_snapshot_integration.log")
 
 	wal, err := NewWAL(tempFile, true, 100, 10*time.Millisecond)
 	assert.NoError(t, err)
@@ -563,14 +649,13 @@ func TestSnapshotIntegration(t *testing.T) {
 
 	wal, err = NewWAL(tempFile, true, 100, 10*time.Millisecond)
 	assert.NoError(t, err)
-	err = wal.Replay(handler)
+	err = wal.ReplayFrom(snapshot.LastSeq, handler)
 	assert.NoError(t, err)
 
-	// Validate final state - after rotation, only the 50 new events remain in active WAL
-	// The first 100 events are in the rotated backup file
+	// Validate final state - only events after the snapshot are replayed
 	assert.Equal(t, 50, len(replayedEvents))
 	for i, event := range replayedEvents {
-		expectedSeq := uint64(1 + i) // Seq resets after rotation
+		expectedSeq := uint64(101 + i)
 		assert.Equal(t, expectedSeq, event.Seq)
 		assert.Equal(t, types.JobID(fmt.Sprintf("job_%d", 101+i)), event.JobID)
 	}
@@ -584,6 +669,7 @@ func TestSnapshotIntegration(t *testing.T) {
 func BenchmarkAppend(b *testing.B) {
 	tempFile := "benchmark_wal_append.log"
 	defer os.Remove(tempFile)
+	defer os.Remove(indexPath(tempFile))
 
 	wal, err := NewWAL(tempFile, true, 100, 10*time.Millisecond)
 	if err != nil {
@@ -609,6 +695,7 @@ func BenchmarkAppend(b *testing.B) {
 func BenchmarkReplay(b *testing.B) {
 	tempFile := "benchmark_wal_replay.log"
 	defer os.Remove(tempFile)
+	defer os.Remove(indexPath(tempFile))
 
 	wal, err := NewWAL(tempFile, true, 100, 10*time.Millisecond)
 	if err != nil {
@@ -659,6 +746,7 @@ func BenchmarkReplay(b *testing.B) {
 func BenchmarkBatchWriter(b *testing.B) {
 	tempFile := "benchmark_wal_batch_writer.log"
 	defer os.Remove(tempFile)
+	defer os.Remove(indexPath(tempFile))
 
 	wal, err := NewWAL(tempFile, true, 100, 10*time.Millisecond)
 	if err != nil {
@@ -688,6 +776,36 @@ func BenchmarkBatchWriter(b *testing.B) {
 	}
 }
 
+// BenchmarkAppendBatch tests AppendBatch performance, one call per batch
+func BenchmarkAppendBatch(b *testing.B) {
+	tempFile := "benchmark_wal_append_batch.log"
+	defer os.Remove(tempFile)
+	defer os.Remove(indexPath(tempFile))
+
+	wal, err := NewWAL(tempFile, true, 100, 10*time.Millisecond)
+	if err != nil {
+		b.Fatalf("Failed to create WAL: %v", err)
+	}
+	defer wal.Close()
+
+	batchSizes := []int{10, 100, 1000}
+
+	for _, batchSize := range batchSizes {
+		b.Run(fmt.Sprintf("batch_size_%d", batchSize), func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				entries := make([]BatchEntry, batchSize)
+				for j := range entries {
+					entries[j] = BatchEntry{Type: EventEnqueue, Job: &types.Job{ID: types.JobID(fmt.Sprintf("job_%d_%d", i, j))}}
+				}
+				if err := wal.AppendBatch(entries); err != nil {
+					b.Fatalf("Failed to append batch: %v", err)
+				}
+			}
+		})
+	}
+}
+
 // ============================================================================
 // Helper functions
 // ============================================================================
@@ -725,27 +843,3 @@ func mockHandler(events *[]Event) EventHandler {
 		return nil
 	}
 }
-
-// MockFile simulates a file for testing purposes
-type MockFile struct {
-	WriteFunc func(p []byte) (n int, err error)
-	SyncFunc  func() error
-}
-
-func (m *MockFile) Write(p []byte) (n int, err error) {
-	if m.WriteFunc != nil {
-		return m.WriteFunc(p)
-	}
-	return len(p), nil
-}
-
-func (m *MockFile) Sync() error {
-	if m.SyncFunc != nil {
-		return m.SyncFunc()
-	}
-	return nil
-}
-
-func (m *MockFile) Close() error {
-	return nil
-}
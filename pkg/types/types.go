@@ -78,9 +78,39 @@ type InFlightInfo struct {
 	StartedAt int64 `json:"started_at"`  // Execution start time (Unix ms)
 }
 
+// SnapshotKind tells which jobs a snapshot holds
+type SnapshotKind string
+
+// Snapshot kind constants
+const (
+	SnapshotFull    SnapshotKind = "full"    // Every job
+	SnapshotPartial SnapshotKind = "partial" // Pending and in-flight jobs only (Raft mode)
+)
+
+// Snapshot schema versions (see internal/snapshot/schema.go for migrations)
+const (
+	SnapshotSchemaV1      = 1 // Full snapshots only
+	SnapshotSchemaV2      = 2 // Adds kind; partial snapshots
+	CurrentSnapshotSchema = SnapshotSchemaV2
+)
+
 // SnapshotData contains system state for persistence and recovery
 type SnapshotData struct {
-	Jobs      map[JobID]*Job `json:"jobs"`       // Complete job data
-	SchemaVer int            `json:"schema_ver"` // Schema version for compatibility
-	LastSeq   uint64         `json:"last_seq"`   // Last processed sequence number
+	Jobs      map[JobID]*Job `json:"jobs"`                 // Complete job data
+	SchemaVer int            `json:"schema_ver"`           // Schema version for compatibility
+	Kind      SnapshotKind   `json:"kind,omitempty"`       // Full or partial ("" = full)
+	LastSeq   uint64         `json:"last_seq"`             // Last processed sequence number
+	CreatedAt int64          `json:"created_at,omitempty"` // Snapshot creation time (Unix ms)
+}
+
+// IsPartial reports whether the snapshot leaves out completed and dead jobs
+func (s *SnapshotData) IsPartial() bool {
+	return s.Kind == SnapshotPartial
+}
+
+// JobIterator yields jobs one at a time, e.g. while a snapshot streams
+// from or to disk
+type JobIterator interface {
+	// Next returns the next job, or io.EOF after the last one
+	Next() (*Job, error)
 }
@@ -0,0 +1,163 @@
+// ============================================================================
+// Beaver-Raft Recovery Benchmark
+// ============================================================================
+//
+// Package: test/integration
+// File: recovery_bench_test.go
+// Functionality: compare sequential and parallel WAL replay on recovery
+//
+// BenchmarkRecovery:
+//   builds one WAL with no snapshot, then measures Controller.Start on a
+//   fresh copy of it per iteration
+//   - sequential: RecoveryWorkers = 1 (decode and apply on one goroutine)
+//   - parallel: RecoveryWorkers = NumCPU decoding goroutines and apply
+//     partitions, each partition on its own JobManager shard (see
+//     internal/controller/replay.go)
+//
+// WAL contents:
+//   - RECOVERY_BENCH_EVENTS events (default 3,000,000), binary encoding
+//   - 3 events per job: ENQUEUE, DISPATCH, then ACK (3 in 4) or RETRY,
+//     interleaved in blocks of 10,000 jobs
+//
+// Usage:
+//   go test ./test/integration -run '^$' -bench BenchmarkRecovery -benchtime 3x
+//
+// Notes:
+//   - on a single CPU both runs replay sequentially
+//   - the WAL is built in a temp directory and needs ~100 bytes per event
+//     on disk, twice (original and copy)
+//
+// ============================================================================
+
+package integration
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChuLiYu/raft-recovery/internal/controller"
+	"github.com/ChuLiYu/raft-recovery/internal/storage/wal"
+	"github.com/ChuLiYu/raft-recovery/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+// recoveryBenchEvents returns the WAL size for BenchmarkRecovery
+func recoveryBenchEvents(b *testing.B) int {
+	events := 3_000_000
+	if v := os.Getenv("RECOVERY_BENCH_EVENTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		require.NoError(b, err, "RECOVERY_BENCH_EVENTS")
+		events = n
+	}
+	return events
+}
+
+// buildRecoveryWAL writes about events job events to a WAL at path
+func buildRecoveryWAL(b *testing.B, path string, events int) int {
+	w, err := wal.NewWALWithOptions(path, wal.Options{
+		BufferSize:     10000,
+		FlushInterval:  time.Millisecond,
+		MaxSegmentSize: 64 << 20,
+		Encoding:       wal.EncodingBinary,
+		SyncMode:       wal.SyncNone,
+	})
+	require.NoError(b, err)
+	defer w.Close()
+
+	const block = 10000
+	written := 0
+	for first := 0; written < events; first += block {
+		jobs := make([]*types.Job, block)
+		for i := range jobs {
+			jobs[i] = &types.Job{
+				ID:      types.JobID(fmt.Sprintf("job-%d", first+i)),
+				Payload: map[string]interface{}{"index": first + i},
+			}
+		}
+		for _, eventType := range []wal.EventType{wal.EventEnqueue, wal.EventDispatch, ""} {
+			entries := make([]wal.BatchEntry, block)
+			for i, job := range jobs {
+				entries[i] = wal.BatchEntry{Type: eventType, Job: job}
+				if eventType == "" {
+					entries[i].Type = wal.EventAck
+					if i%4 == 0 {
+						entries[i].Type = wal.EventRetry
+					}
+				}
+			}
+			require.NoError(b, w.AppendBatch(entries))
+			written += block
+		}
+	}
+	return written
+}
+
+// copyWAL copies every segment and index of the WAL at src next to dst
+func copyWAL(b *testing.B, src, dst string) {
+	entries, err := os.ReadDir(filepath.Dir(src))
+	require.NoError(b, err)
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), filepath.Base(src)) {
+			continue
+		}
+		in, err := os.Open(filepath.Join(filepath.Dir(src), entry.Name()))
+		require.NoError(b, err)
+		out, err := os.Create(filepath.Join(filepath.Dir(dst), filepath.Base(dst)+strings.TrimPrefix(entry.Name(), filepath.Base(src))))
+		require.NoError(b, err)
+		_, err = io.Copy(out, in)
+		require.NoError(b, err)
+		require.NoError(b, in.Close())
+		require.NoError(b, out.Close())
+	}
+}
+
+func BenchmarkRecovery(b *testing.B) {
+	source := filepath.Join(b.TempDir(), "bench.wal")
+	events := buildRecoveryWAL(b, source, recoveryBenchEvents(b))
+	jobs := events / 3
+
+	for _, tc := range []struct {
+		name    string
+		workers int
+	}{
+		{"sequential", 1},
+		{"parallel", runtime.NumCPU()},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			b.StopTimer()
+			for i := 0; i < b.N; i++ {
+				dir := b.TempDir()
+				walPath := filepath.Join(dir, "recover.wal")
+				copyWAL(b, source, walPath)
+
+				ctrl, err := controller.NewController(controller.Config{
+					WorkerCount:         1,
+					TaskTimeout:         time.Minute,
+					SnapshotInterval:    time.Hour,
+					WALPath:             walPath,
+					SnapshotPath:        filepath.Join(dir, "recover.snapshot"),
+					WALEncoding:         "binary",
+					WALSyncMode:         "none",
+					RecoveryWorkers:     tc.workers,
+					DisableDispatchLoop: true,
+				})
+				require.NoError(b, err)
+
+				b.StartTimer()
+				require.NoError(b, ctrl.Start())
+				b.StopTimer()
+
+				require.Equal(b, jobs, ctrl.GetTotalJobs())
+				ctrl.Stop()
+			}
+			b.ReportMetric(float64(events*b.N)/b.Elapsed().Seconds(), "events/s")
+		})
+	}
+}